@@ -0,0 +1,113 @@
+// Package animation decodes animated GIF files into full frames, which the layers can be executed
+// on one at a time, and keeps the timing needed to write them as an animation again.
+package animation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"io"
+
+	models "tool7/image-processing/models"
+)
+
+// Frames of an animation as they are shown, each covering the whole animation
+type Animation struct {
+	Frames []models.Image
+	// Time each frame is shown, in hundredths of a second
+	Delays []int
+	// What happens to each frame before the next is drawn, see gif.GIF.Disposal
+	Disposals []byte
+	// See gif.GIF.LoopCount
+	LoopCount int
+}
+
+// Whether the data starts like a GIF file
+func IsGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// Decodes all frames of a GIF file. Frames of GIF files often only hold the part of the image that
+// changed, so each is drawn over what its predecessors left according to their disposal method.
+func Decode(reader io.Reader) (*Animation, error) {
+	decoded, err := gif.DecodeAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded.Image) == 0 {
+		return nil, fmt.Errorf("GIF file has no frames")
+	}
+
+	bounds := image.Rect(0, 0, decoded.Config.Width, decoded.Config.Height)
+	if bounds.Empty() {
+		bounds = decoded.Image[0].Bounds()
+	}
+
+	animation := &Animation{
+		Frames:    make([]models.Image, len(decoded.Image)),
+		Delays:    decoded.Delay,
+		Disposals: decoded.Disposal,
+		LoopCount: decoded.LoopCount,
+	}
+
+	canvas := image.NewRGBA(bounds)
+	for i, frame := range decoded.Image {
+		var previous *image.RGBA
+		if decoded.Disposal[i] == gif.DisposalPrevious {
+			previous = clone(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		animation.Frames[i] = clone(canvas)
+
+		switch decoded.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return animation, nil
+}
+
+func (this *Animation) IsAnimated() bool {
+	return len(this.Frames) > 1
+}
+
+// Returns the animation with every frame replaced by its output of process, keeping the timing.
+// Fails when the outputs differ in size, since all frames of an animation share it.
+func (this *Animation) Process(ctx context.Context, process func(context.Context, models.Image) (models.Image, error)) (*Animation, error) {
+	result := &Animation{
+		Frames:    make([]models.Image, len(this.Frames)),
+		Delays:    this.Delays,
+		Disposals: this.Disposals,
+		LoopCount: this.LoopCount,
+	}
+
+	for i, frame := range this.Frames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		processed, err := process(ctx, frame)
+		if err != nil {
+			return nil, fmt.Errorf("Frame %d: %w", i+1, err)
+		}
+		if i > 0 && processed.Bounds().Size() != result.Frames[0].Bounds().Size() {
+			return nil, fmt.Errorf("Frame %d was processed to a different size than the first frame", i+1)
+		}
+		result.Frames[i] = processed
+	}
+
+	return result, nil
+}
+
+func clone(img *image.RGBA) *image.RGBA {
+	result := image.NewRGBA(img.Bounds())
+	copy(result.Pix, img.Pix)
+	return result
+}
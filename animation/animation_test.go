@@ -0,0 +1,170 @@
+package animation
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"reflect"
+	"testing"
+
+	models "tool7/image-processing/models"
+)
+
+var (
+	transparent = color.RGBA{}
+	red         = color.RGBA{255, 0, 0, 255}
+	green       = color.RGBA{0, 255, 0, 255}
+	blue        = color.RGBA{0, 0, 255, 255}
+	palette     = color.Palette{transparent, red, green, blue}
+)
+
+func newFrame(bounds image.Rectangle, colors ...color.RGBA) *image.Paletted {
+	frame := image.NewPaletted(bounds, palette)
+	for i := range frame.Pix {
+		frame.Pix[i] = uint8(palette.Index(colors[i%len(colors)]))
+	}
+	return frame
+}
+
+// 4x4 animation of frames drawn over a red one, each disposed of differently
+func newTestGIF(t *testing.T) []byte {
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			newFrame(image.Rect(0, 0, 4, 4), red),
+			// Cleared to transparent afterwards
+			newFrame(image.Rect(0, 0, 2, 2), green),
+			// Removed again afterwards
+			newFrame(image.Rect(2, 2, 4, 4), blue),
+			// Keeps what is below its transparent pixel
+			newFrame(image.Rect(2, 0, 4, 1), transparent, green),
+		},
+		Delay:     []int{10, 20, 30, 40},
+		Disposal:  []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		LoopCount: 3,
+		Config:    image.Config{ColorModel: palette, Width: 4, Height: 4},
+	}
+
+	var buff bytes.Buffer
+	if err := gif.EncodeAll(&buff, animation); err != nil {
+		t.Fatal(err)
+	}
+	return buff.Bytes()
+}
+
+// Rows of the frame as letters: r, g and b for the colors, . for transparent pixels
+func frameRows(t *testing.T, frame models.Image) []string {
+	letters := map[color.RGBA]byte{transparent: '.', red: 'r', green: 'g', blue: 'b'}
+
+	bounds := frame.Bounds()
+	rows := make([]string, bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		row := make([]byte, bounds.Dx())
+		for x := range row {
+			c := color.RGBAModel.Convert(frame.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			letter, ok := letters[c]
+			if !ok {
+				t.Fatalf("Unexpected color %v at %d,%d", c, x, y)
+			}
+			row[x] = letter
+		}
+		rows[y] = string(row)
+	}
+	return rows
+}
+
+func TestDecodeDisposals(t *testing.T) {
+	animation, err := Decode(bytes.NewReader(newTestGIF(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]string{
+		{"rrrr", "rrrr", "rrrr", "rrrr"},
+		{"ggrr", "ggrr", "rrrr", "rrrr"},
+		// The green corner was cleared
+		{"..rr", "..rr", "rrbb", "rrbb"},
+		// The blue corner was removed again, and the red pixel below the transparent one is kept
+		{"..rg", "..rr", "rrrr", "rrrr"},
+	}
+	if len(animation.Frames) != len(expected) {
+		t.Fatalf("Animation has %d frames", len(animation.Frames))
+	}
+	for i, frame := range animation.Frames {
+		if rows := frameRows(t, frame); !reflect.DeepEqual(rows, expected[i]) {
+			t.Errorf("Frame %d is %v, expected %v", i+1, rows, expected[i])
+		}
+	}
+
+	if !reflect.DeepEqual(animation.Delays, []int{10, 20, 30, 40}) || animation.LoopCount != 3 {
+		t.Errorf("Delays are %v and loop count is %d", animation.Delays, animation.LoopCount)
+	}
+	if !reflect.DeepEqual(animation.Disposals, []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone}) {
+		t.Errorf("Disposals are %v", animation.Disposals)
+	}
+	if !animation.IsAnimated() {
+		t.Error("Animation is not animated")
+	}
+}
+
+// Frames share no pixels, so that changing one leaves the others alone
+func TestDecodeFramesAreCopies(t *testing.T) {
+	animation, err := Decode(bytes.NewReader(newTestGIF(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	animation.Frames[0].(*image.RGBA).SetRGBA(3, 3, blue)
+	if rows := frameRows(t, animation.Frames[1]); rows[3] != "rrrr" {
+		t.Errorf("Changing the first frame changed the second to %v", rows)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, err := Decode(bytes.NewReader([]byte("GIF89a"))); err == nil {
+		t.Error("Truncated GIF was decoded")
+	}
+	if IsGIF([]byte("\x89PNG")) || !IsGIF(newTestGIF(t)) {
+		t.Error("GIF files were not told apart")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	animation, err := Decode(bytes.NewReader(newTestGIF(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	processed, err := animation.Process(context.Background(), func(ctx context.Context, frame models.Image) (models.Image, error) {
+		// Crops every frame to its top row
+		return frame.(*image.RGBA).SubImage(image.Rect(0, 0, 4, 1)).(*image.RGBA), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := frameRows(t, processed.Frames[3]); !reflect.DeepEqual(rows, []string{"..rg"}) {
+		t.Errorf("Last frame is %v", rows)
+	}
+	if !reflect.DeepEqual(processed.Delays, animation.Delays) || processed.LoopCount != animation.LoopCount {
+		t.Error("Processing changed the timing")
+	}
+
+	// All frames need the same size
+	count := 0
+	_, err = animation.Process(context.Background(), func(ctx context.Context, frame models.Image) (models.Image, error) {
+		count++
+		return image.NewRGBA(image.Rect(0, 0, count, 1)), nil
+	})
+	if err == nil {
+		t.Error("Frames of different sizes were accepted")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := animation.Process(ctx, func(ctx context.Context, frame models.Image) (models.Image, error) {
+		return frame, nil
+	}); err != context.Canceled {
+		t.Errorf("Cancelled processing returned %v", err)
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"fmt"
 	"image"
-	"image/color"
 	"image/png"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"tool7/image-processing/animation"
+	"tool7/image-processing/history"
+	"tool7/image-processing/metadata"
 	"tool7/image-processing/models"
 	"tool7/image-processing/operations"
+	"tool7/image-processing/project"
 	"tool7/image-processing/utils"
 
 	"github.com/pkg/errors"
@@ -19,9 +25,37 @@ import (
 )
 
 type App struct {
-	ctx                  context.Context
-	originalImage        *image.RGBA
+	ctx context.Context
+	// Image file the session was started from, empty for projects, whose image is embedded
+	sourceFilePath string
+	// Name of the opened file or project without its extension, suggested when saving
+	sourceName string
+	// Pixels of the opened image, which layers never modify
+	sourceImage models.Image
+	// Metadata of the opened image, written into exports as chosen when exporting
+	sourceMetadata metadata.Metadata
+	// Page of the opened file shown, and how many it has, see utils.ImagePageCount
+	sourcePage      int
+	sourcePageCount int
+	// Frames of the opened file when it is an animated GIF, of which sourceImage is the one shown
+	sourceAnimation      *animation.Animation
 	imageLayerCollection *models.ImageLayerCollection
+	history              *history.History
+	cacheBudget          int64
+	previewSize          image.Point
+	// Color space the layers work in, kept for every image opened and saved with projects
+	workingSpace models.ColorSpace
+	// Longest time a single render may take, no limit when zero
+	processingTimeout time.Duration
+
+	// Held while the layers are executed or changed, see lockPipeline
+	pipelineMutex sync.Mutex
+	// Guards cancelRender, which cancels the preview render in progress
+	renderMutex  sync.Mutex
+	cancelRender context.CancelFunc
+	// Guards cancelBatch, which stops the batch in progress
+	batchMutex  sync.Mutex
+	cancelBatch context.CancelFunc
 }
 
 type Base64Image struct {
@@ -30,373 +64,656 @@ type Base64Image struct {
 	Base64 string `json:"base64"`
 }
 
-type ImageOperationType int
-
-const (
-	Brightness ImageOperationType = iota + 1
-	Contrast
-	Saturation
-	Tint
-	Greyscale
-	Negative
-	Sepia
-	BoxBlur
-	MotionBlur
-	Sharpen
-	Emboss
-	EdgesHorizontal
-	EdgesVertical
-	Outline
-)
+type ImageOperation struct {
+	Name      string                `json:"name"`
+	Params    operations.Parameters `json:"params,omitempty"`
+	IsEnabled bool                  `json:"isEnabled"`
+	// Fully opaque and normal when left out
+	Opacity   *float64           `json:"opacity,omitempty"`
+	BlendMode models.BlendMode   `json:"blendMode,omitempty"`
+	Mask      *project.MaskState `json:"mask,omitempty"`
+	// Members of a group, in pipeline order
+	Layers []ImageOperation `json:"layers,omitempty"`
+	// Nodes of a graph
+	Graph *project.GraphState `json:"graph,omitempty"`
+}
 
-type TintRGB struct {
-	R uint8 `json:"r"`
-	G uint8 `json:"g"`
-	B uint8 `json:"b"`
+func newImageOperation(state project.OperationState) ImageOperation {
+	operation := ImageOperation{
+		Name:      state.Name,
+		Params:    state.Params,
+		IsEnabled: state.IsEnabled,
+		Opacity:   state.Opacity,
+		BlendMode: state.BlendMode,
+		Mask:      state.Mask,
+		Graph:     state.Graph,
+	}
+	for _, member := range state.Layers {
+		operation.Layers = append(operation.Layers, newImageOperation(member))
+	}
+	return operation
 }
 
-type ImageOperation struct {
-	Type       ImageOperationType `json:"type"`
-	Level      float64            `json:"level,omitempty"`
-	Tint       TintRGB            `json:"tint,omitempty"`
-	KernelSize models.KernelSize  `json:"kernelSize,omitempty"`
-	IsEnabled  bool               `json:"isEnabled"`
+func (this ImageOperation) state() project.OperationState {
+	state := project.OperationState{
+		Name:      this.Name,
+		Params:    this.Params,
+		IsEnabled: this.IsEnabled,
+		Opacity:   this.Opacity,
+		BlendMode: this.BlendMode,
+		Mask:      this.Mask,
+		Graph:     this.Graph,
+	}
+	for _, member := range this.Layers {
+		state.Layers = append(state.Layers, member.state())
+	}
+	return state
 }
 
+var defaultPreviewSize = image.Pt(1920, 1080)
+
+// Event emitted with models.Progress while layers are executed
+const progressEvent = "processing:progress"
+
 func NewApp() *App {
-	return &App{}
+	return &App{
+		history:     history.New(history.DefaultDepth),
+		cacheBudget: models.DefaultCacheBudget,
+		previewSize: defaultPreviewSize,
+	}
 }
 
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 }
 
-func (a *App) initProject(img *image.RGBA) {
-	a.originalImage = img
+// File an editing session was started from, see startSession
+type imageSource struct {
+	filePath  string
+	name      string
+	image     models.Image
+	metadata  metadata.Metadata
+	page      int
+	pageCount int
+	animation *animation.Animation
+}
 
-	imageLayerCollection := utils.NewImageLayerCollection(a.originalImage)
+// Starts a new editing session on the given source and collection. Expects the pipeline to be
+// locked, so that renders and changes never see the source of one session and layers of another.
+func (a *App) startSession(source imageSource, imageLayerCollection *models.ImageLayerCollection) {
+	a.sourceFilePath = source.filePath
+	a.sourceName = source.name
+	a.sourceImage = source.image
+	a.sourceMetadata = source.metadata
+	a.sourcePage = source.page
+	a.sourcePageCount = source.pageCount
+	a.sourceAnimation = source.animation
+
+	imageLayerCollection.Cache.SetBudget(a.cacheBudget)
+	imageLayerCollection.PreviewSize = a.previewSize
+	imageLayerCollection.WorkingSpace = a.workingSpace
 	a.imageLayerCollection = imageLayerCollection
+	a.history.Clear()
+}
+
+// One filter for all decodable images, followed by one per format
+var imageFileFilters = newImageFileFilters()
+
+func newImageFileFilters() []runtime.FileFilter {
+	allPatterns := make([]string, 0, len(utils.SupportedImageExtensions))
+	formatFilters := make([]runtime.FileFilter, 0, len(utils.ImageFormats))
+
+	for _, format := range utils.ImageFormats {
+		patterns := make([]string, len(format.Extensions))
+		for i, extension := range format.Extensions {
+			patterns[i] = "*" + extension
+		}
+		allPatterns = append(allPatterns, patterns...)
+
+		pattern := strings.Join(patterns, ";")
+		formatFilters = append(formatFilters, runtime.FileFilter{
+			DisplayName: format.Name + " (" + pattern + ")",
+			Pattern:     pattern,
+		})
+	}
+
+	pattern := strings.Join(allPatterns, ";")
+	allFilter := runtime.FileFilter{DisplayName: "Images (" + pattern + ")", Pattern: pattern}
+	return append([]runtime.FileFilter{allFilter}, formatFilters...)
 }
 
-func (a *App) OpenImageFileSelector() bool {
+// Returns false if the user closed the dialog without choosing a file
+func (a *App) OpenImageFileSelector() (isSelected bool, err error) {
+	defer toAppError(&err)
+
 	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Select Image File (PNG or JPG)",
-		Filters: []runtime.FileFilter{
-			{
-				DisplayName: "Images (*.png;*.jpg)",
-				Pattern:     "*.png;*.jpg",
-			},
-		},
+		Title:   "Select Image File",
+		Filters: imageFileFilters,
 	})
 	if err != nil {
-		panic("Error on image file selection")
+		return false, errors.Wrap(err, "Error on image file selection")
 	}
 	if filePath == "" {
-		return false
+		return false, nil
 	}
 
-	img, err := utils.GetImageFromFilePath(filePath)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return false, errors.Wrap(err, "Error reading image file")
+	}
+	// The first frame of a GIF file is decoded on its own as well, which checks the size of the
+	// image before all frames are
+	img, imageMetadata, err := metadata.DecodeImagePage(data, 0)
 	if err != nil {
-		panic(err)
+		return false, err
+	}
+	frames, err := loadAnimation(data)
+	if err != nil {
+		return false, err
+	}
+	if frames != nil {
+		img = frames.Frames[0]
 	}
 
-	a.initProject(img)
-	return true
+	unlock := a.lockPipelineForChange()
+	defer unlock()
+
+	a.startSession(imageSource{
+		filePath:  filePath,
+		name:      fileNameWithoutExtension(filePath),
+		image:     img,
+		metadata:  imageMetadata,
+		pageCount: utils.ImagePageCount(data),
+		animation: frames,
+	}, utils.NewImageLayerCollection(img))
+	return true, nil
 }
 
-func (a *App) GetOriginalImage() Base64Image {
-	var buff bytes.Buffer
-	png.Encode(&buff, a.originalImage)
-
-	rawBase64String := base64.StdEncoding.EncodeToString(buff.Bytes())
-	base64String := "data:image/png;base64,"
-	base64String += rawBase64String
+type ImagePages struct {
+	// Number of pages of the opened file, more than one only for multi-page TIFF files
+	Count int `json:"count"`
+	// Index of the page shown, starting at 0
+	Current int `json:"current"`
+}
 
-	return Base64Image{
-		Width:  a.originalImage.Bounds().Max.X - a.originalImage.Bounds().Min.X,
-		Height: a.originalImage.Bounds().Max.Y - a.originalImage.Bounds().Min.Y,
-		Base64: base64String,
-	}
+func (a *App) GetImagePages() ImagePages {
+	return ImagePages{Count: a.sourcePageCount, Current: a.sourcePage}
 }
 
-func (a *App) SetOriginalImage(imageBase64 string) {
-	reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader(imageBase64))
-	decodedImage, _, err := image.Decode(reader)
+// Replaces the image with another page of the opened file, keeping the layers. Cannot be undone,
+// like opening another file. Fails without changing anything when a layer cannot be recreated.
+func (a *App) SelectImagePage(page int) (err error) {
+	defer toAppError(&err)
 
+	unlock, err := a.beginChange()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer unlock()
 
-	rgbaImage := image.NewRGBA(decodedImage.Bounds())
-	for y := decodedImage.Bounds().Min.Y; y < decodedImage.Bounds().Max.Y; y++ {
-		for x := decodedImage.Bounds().Min.X; x < decodedImage.Bounds().Max.X; x++ {
-			r, g, b, a := utils.GetPixelColor(decodedImage, x, y)
-			rgbaImage.SetRGBA(x, y, color.RGBA{r, g, b, a})
-		}
+	if page < 0 || page >= a.sourcePageCount {
+		return models.NewError(models.InvalidIndex, fmt.Sprintf("Image has no page %d", page+1))
+	}
+	if a.sourceFilePath == "" {
+		return models.NewError(models.InvalidOperation, "Image was not opened from a file")
 	}
 
-	a.initProject(rgbaImage)
-}
-
-func (a *App) GetUserSelectedProjectFileContent() string {
-	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
-		Title: "Select Project File (.goimp extension)",
-		Filters: []runtime.FileFilter{
-			{
-				DisplayName: "Files (*.goimp)",
-				Pattern:     "*.goimp",
-			},
-		},
-	})
+	img, imageMetadata, err := metadata.LoadImagePage(a.sourceFilePath, page)
 	if err != nil {
-		panic("Error on project file selection")
-	}
-	if filePath == "" {
-		return ""
+		return err
 	}
 
-	byteData, err := os.ReadFile(filePath)
+	states, err := project.Capture(a.imageLayerCollection)
 	if err != nil {
-		panic("Error reading project file")
+		return err
+	}
+	imageLayerCollection, skipped := project.BuildCollection(img, states)
+	if len(skipped) > 0 {
+		return models.NewError(models.InvalidOperation, fmt.Sprintf("Operation %d (%s) cannot be kept: %s", skipped[0].Index+1, skipped[0].Name, skipped[0].Reason))
 	}
 
-	return string(byteData)
+	a.startSession(imageSource{
+		filePath:  a.sourceFilePath,
+		name:      a.sourceName,
+		image:     img,
+		metadata:  imageMetadata,
+		page:      page,
+		pageCount: a.sourcePageCount,
+	}, imageLayerCollection)
+	return nil
 }
 
-func (a *App) ProcessImage(indexToExecuteFrom int) Base64Image {
-	var buff bytes.Buffer
+func (a *App) GetOriginalImage() (result Base64Image, err error) {
+	defer toAppError(&err)
+
+	if a.sourceImage == nil {
+		return Base64Image{}, errNoImageLoaded()
+	}
+	return newBase64Image(a.sourceImage), nil
+}
+
+// Renders the preview sized copy of the image, see SetPreviewSize. Starting a render cancels the
+// one in progress, which then fails with the models.Canceled code.
+func (a *App) ProcessImage(indexToExecuteFrom int) (result Base64Image, err error) {
+	defer toAppError(&err)
+
+	ctx, cancel := context.WithCancel(a.context())
+	defer cancel()
+
+	a.replaceRender(cancel)
+	unlock := a.lockPipeline()
+	defer unlock()
+
+	ctx, cancelTimeout := a.withProcessingTimeout(ctx)
+	defer cancelTimeout()
+
+	if err := a.requireImage(); err != nil {
+		return Base64Image{}, err
+	}
+
+	var processedImage models.Image
 
 	if a.imageLayerCollection.Size > 0 {
-		processedImage, err := a.imageLayerCollection.ExecuteLayersFrom(indexToExecuteFrom)
+		processedImage, err = a.imageLayerCollection.ExecuteLayersFrom(models.WithProgress(ctx, a.emitProgress), indexToExecuteFrom)
 		if err != nil {
-			panic(err)
+			return Base64Image{}, err
 		}
-		png.Encode(&buff, processedImage)
 	} else {
-		png.Encode(&buff, a.originalImage)
+		processedImage, _ = a.imageLayerCollection.PreviewImage()
+	}
+
+	return newBase64Image(processedImage), nil
+}
+
+// Cancels the preview render in progress and makes cancel the one to call for the next render
+func (a *App) replaceRender(cancel context.CancelFunc) {
+	a.renderMutex.Lock()
+	defer a.renderMutex.Unlock()
+
+	if a.cancelRender != nil {
+		a.cancelRender()
+	}
+	a.cancelRender = cancel
+}
+
+// Waits until no other render or change uses the layers. Wails calls bound methods concurrently,
+// so everything that executes or changes the layers goes through here.
+func (a *App) lockPipeline() func() {
+	a.pipelineMutex.Lock()
+	return a.pipelineMutex.Unlock
+}
+
+// Changes made while a preview renders make it obsolete, so it is cancelled rather than waited for
+func (a *App) lockPipelineForChange() func() {
+	a.replaceRender(nil)
+	return a.lockPipeline()
+}
+
+// Cancels the preview render in progress and locks the pipeline for changing the layers.
+// Fails when no image is loaded.
+func (a *App) beginChange() (func(), error) {
+	unlock := a.lockPipelineForChange()
+	if err := a.requireImage(); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func (a *App) emitProgress(progress models.Progress) {
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, progressEvent, progress)
+}
+
+// Limits a render to the processing timeout when one is set. Expects the pipeline to be locked,
+// which guards the timeout like the other settings.
+func (a *App) withProcessingTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.processingTimeout > 0 {
+		return context.WithTimeout(ctx, a.processingTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// The context of the running application, or a background context when there is none yet
+func (a *App) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
 	}
+	return a.ctx
+}
+
+// Sets the largest size of the image returned by ProcessImage. Layers are previewed on a copy of
+// the image downscaled to fit, which keeps editing responsive for large images.
+func (a *App) SetPreviewSize(width, height int) (err error) {
+	defer toAppError(&err)
+
+	if width < 0 || height < 0 {
+		return errors.New("Preview size cannot be negative")
+	}
+
+	unlock := a.lockPipelineForChange()
+	defer unlock()
+
+	a.previewSize = image.Pt(width, height)
+	if a.imageLayerCollection != nil {
+		a.imageLayerCollection.PreviewSize = a.previewSize
+	}
+	return nil
+}
+
+// Sets the color space the layers work in, see models.ImageLayerCollection. In linear space the
+// preview and exports are computed in linear light and converted to sRGB only for display and
+// encoding.
+func (a *App) SetWorkingSpace(space models.ColorSpace) (err error) {
+	defer toAppError(&err)
+
+	if !space.IsWorkingSpace() {
+		return models.NewError(models.InvalidOperation, fmt.Sprintf("Unknown working space %q", space))
+	}
+
+	unlock := a.lockPipelineForChange()
+	defer unlock()
+
+	a.workingSpace = space
+	if a.imageLayerCollection != nil {
+		a.imageLayerCollection.WorkingSpace = space
+	}
+	return nil
+}
+
+func (a *App) GetWorkingSpace() models.ColorSpace {
+	if a.workingSpace == "" {
+		return models.PerceptualSpace
+	}
+	return a.workingSpace
+}
+
+// Encodes the image for display, which only needs 8 bits per channel
+func newBase64Image(img models.Image) Base64Image {
+	var buff bytes.Buffer
+	png.Encode(&buff, utils.ConvertTo8Bit(img))
 
 	rawBase64String := base64.StdEncoding.EncodeToString(buff.Bytes())
 	base64String := "data:image/png;base64,"
 	base64String += rawBase64String
 
 	return Base64Image{
-		Width:  a.originalImage.Bounds().Max.X - a.originalImage.Bounds().Min.X,
-		Height: a.originalImage.Bounds().Max.Y - a.originalImage.Bounds().Min.Y,
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
 		Base64: base64String,
 	}
 }
 
+// Sets how much memory cached layer outputs may take
+func (a *App) SetCacheBudget(megabytes int) (err error) {
+	defer toAppError(&err)
+
+	if megabytes < 0 {
+		return errors.New("Cache budget cannot be negative")
+	}
+
+	unlock := a.lockPipelineForChange()
+	defer unlock()
+
+	a.cacheBudget = int64(megabytes) << 20
+	if a.imageLayerCollection != nil {
+		a.imageLayerCollection.Cache.SetBudget(a.cacheBudget)
+	}
+	return nil
+}
+
+// Sets the longest time a render may take before it fails with the models.TimedOut code.
+// Zero removes the limit, which is the default.
+func (a *App) SetProcessingTimeout(seconds float64) (err error) {
+	defer toAppError(&err)
+
+	if seconds < 0 {
+		return errors.New("Processing timeout cannot be negative")
+	}
+
+	// Renders in progress keep the timeout they started with, so they are waited for
+	unlock := a.lockPipeline()
+	defer unlock()
+
+	a.processingTimeout = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
 func (a *App) ResetAppState() {
-	a.originalImage = nil
+	unlock := a.lockPipelineForChange()
+	defer unlock()
+
+	a.sourceFilePath = ""
+	a.sourceName = ""
+	a.sourceImage = nil
+	a.sourceMetadata = metadata.Metadata{}
+	a.sourcePage = 0
+	a.sourcePageCount = 0
+	a.sourceAnimation = nil
 	a.imageLayerCollection = nil
+	a.history.Clear()
 }
 
-func (a *App) AppendImageOperation(operation ImageOperation) error {
+func (a *App) AppendImageOperation(operation ImageOperation) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	imageLayer, err := CreateImageLayerWithOperation(operation)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	imageLayer.IsEnabled = operation.IsEnabled
-	a.imageLayerCollection.Append(imageLayer)
 
-	return nil
+	return a.history.Execute(history.NewCommand(
+		"Add "+layerLabel(imageLayer),
+		func() error {
+			a.imageLayerCollection.Append(imageLayer)
+			return nil
+		},
+		func() error {
+			return a.imageLayerCollection.RemoveAt(a.imageLayerCollection.Size - 1)
+		},
+	))
 }
 
-func (a *App) RemoveImageOperationAtIndex(index int) error {
-	return a.imageLayerCollection.RemoveAt(index)
-}
+func (a *App) RemoveImageOperationAtIndex(index int) (err error) {
+	defer toAppError(&err)
 
-func (a *App) UpdateImageOperationAtIndex(index int, operation ImageOperation) error {
-	imageLayer, err := a.imageLayerCollection.At(index)
+	unlock, err := a.beginChange()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer unlock()
 
-	switch operation.Type {
-	case Brightness:
-		brightnessOperation, ok := imageLayer.Operation.(*operations.BrightnessOperation)
-		if !ok {
-			panic("Failed to cast to BrightnessOperation")
-		}
-		brightnessOperation.Level = operation.Level
-		break
-	case Contrast:
-		contrastOperation, ok := imageLayer.Operation.(*operations.ContrastOperation)
-		if !ok {
-			panic("Failed to cast to ContrastOperation")
-		}
-		contrastOperation.Factor = operation.Level
-		break
-	case Saturation:
-		saturationOperation, ok := imageLayer.Operation.(*operations.SaturationOperation)
-		if !ok {
-			panic("Failed to cast to SaturationOperation")
-		}
-		saturationOperation.Level = operation.Level
-		break
-	case Tint:
-		tintOperation, ok := imageLayer.Operation.(*operations.TintOperation)
-		if !ok {
-			panic("Failed to cast to TintOperation")
-		}
-		tintOperation.Intensity = operation.Level
-		tintOperation.Tint = color.RGBA{
-			R: operation.Tint.R,
-			G: operation.Tint.G,
-			B: operation.Tint.B,
-			A: 255,
-		}
-		break
-	case BoxBlur, MotionBlur, Sharpen, Emboss:
-		kernelOperation, ok := imageLayer.Operation.(*operations.KernelOperation)
-		if !ok {
-			panic("Failed to cast to KernelOperation")
-		}
-		kernelOperation.KernelSize = operation.KernelSize
-		break
+	imageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return a.history.Execute(history.NewCommand(
+		"Remove "+layerLabel(imageLayer),
+		func() error {
+			return a.imageLayerCollection.RemoveAt(index)
+		},
+		func() error {
+			return a.imageLayerCollection.InsertAt(imageLayer, index)
+		},
+	))
 }
 
-func (a *App) ReplaceImageOperationAtIndex(index int, operation ImageOperation) error {
-	imageLayer, err := CreateImageLayerWithOperation(operation)
+func (a *App) UpdateImageOperationAtIndex(index int, operation ImageOperation) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer unlock()
 
-	a.imageLayerCollection.RemoveAt(index)
-	a.imageLayerCollection.InsertAt(imageLayer, index)
+	imageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
+	}
 
+	// Failed updates leave the layer and the history unchanged
+	if err := a.history.Execute(newLayerUpdateCommand(imageLayer, operation.Params)); err != nil {
+		return models.WrapError(models.InvalidOperation, err, "Invalid parameters")
+	}
 	return nil
 }
 
-func (a *App) MoveImageOperation(oldIndex, newIndex int) error {
-	if oldIndex == newIndex {
-		return nil
-	}
+// Sets how the output of the layer at index is blended over its input
+func (a *App) SetImageOperationBlending(index int, blendMode models.BlendMode, opacity float64) (err error) {
+	defer toAppError(&err)
 
-	imageLayer, err := a.imageLayerCollection.At(oldIndex)
+	unlock, err := a.beginChange()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer unlock()
 
-	a.imageLayerCollection.RemoveAt(oldIndex)
-	a.imageLayerCollection.InsertAt(imageLayer, newIndex)
+	imageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
+	}
 
-	return nil
+	return a.history.Execute(newLayerBlendingCommand(imageLayer, blendMode, opacity))
 }
 
-func (a *App) ToggleImageOperation(index int) error {
-	imageLayer, err := a.imageLayerCollection.At(index)
+func (a *App) ReplaceImageOperationAtIndex(index int, operation ImageOperation) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer unlock()
 
-	if imageLayer.IsEnabled {
-		imageLayer.Disable()
-	} else {
-		imageLayer.Enable()
+	imageLayer, err := CreateImageLayerWithOperation(operation)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	previousImageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
+	}
+
+	imageLayer.IsEnabled = operation.IsEnabled
+
+	return a.history.Execute(history.NewCommand(
+		"Replace "+layerLabel(previousImageLayer)+" with "+layerLabel(imageLayer),
+		func() error {
+			return a.replaceLayer(index, imageLayer)
+		},
+		func() error {
+			return a.replaceLayer(index, previousImageLayer)
+		},
+	))
 }
 
-func CreateImageLayerWithOperation(operation ImageOperation) (*models.ImageLayer, error) {
-	switch operation.Type {
-	case Brightness:
-		brightnessOperation := operations.NewBrightnessOperation(operation.Level)
-		return utils.NewImageLayer(brightnessOperation), nil
-	case Contrast:
-		contrastOperation := operations.NewContrastOperation(operation.Level)
-		return utils.NewImageLayer(contrastOperation), nil
-	case Saturation:
-		saturationOperation := operations.NewSaturationOperation(operation.Level)
-		return utils.NewImageLayer(saturationOperation), nil
-	case Tint:
-		applyTintOperation := operations.NewTintOperation(color.RGBA{
-			R: operation.Tint.R,
-			G: operation.Tint.G,
-			B: operation.Tint.B,
-			A: 255,
-		}, operation.Level)
-
-		return utils.NewImageLayer(applyTintOperation), nil
-	case Greyscale:
-		greyscaleOperation := operations.NewGreyscaleOperation()
-		return utils.NewImageLayer(greyscaleOperation), nil
-	case Negative:
-		negativeOperation := operations.NewNegativeOperation()
-		return utils.NewImageLayer(negativeOperation), nil
-	case Sepia:
-		sepiaOperation := operations.NewSepiaOperation()
-		return utils.NewImageLayer(sepiaOperation), nil
-	case BoxBlur:
-		boxBlurOperation := operations.NewKernelOperation(models.BoxBlur, operation.KernelSize)
-		return utils.NewImageLayer(boxBlurOperation), nil
-	case MotionBlur:
-		motionBlurOperation := operations.NewKernelOperation(models.MotionBlur, operation.KernelSize)
-		return utils.NewImageLayer(motionBlurOperation), nil
-	case Sharpen:
-		sharpenOperation := operations.NewKernelOperation(models.Sharpen, operation.KernelSize)
-		return utils.NewImageLayer(sharpenOperation), nil
-	case Emboss:
-		embossOperation := operations.NewKernelOperation(models.Emboss, operation.KernelSize)
-		return utils.NewImageLayer(embossOperation), nil
-	case EdgesHorizontal:
-		horizontalEdgeDetectionOperation := operations.NewKernelOperation(models.EdgeDetectionHorizontal, operation.KernelSize)
-		return utils.NewImageLayer(horizontalEdgeDetectionOperation), nil
-	case EdgesVertical:
-		verticalEdgeDetectionOperation := operations.NewKernelOperation(models.EdgeDetectionVertical, operation.KernelSize)
-		return utils.NewImageLayer(verticalEdgeDetectionOperation), nil
-	case Outline:
-		outlineOperation := operations.NewKernelOperation(models.Outline, operation.KernelSize)
-		return utils.NewImageLayer(outlineOperation), nil
-	}
-
-	return nil, errors.New("Failed to create ImageLayer with provided ImageOperation")
-}
-
-func (a *App) RotateImageBy90Deg() error {
-	rotationOperation := operations.NewRotationOperation(operations.By90Deg)
-	rotatedImage, err := rotationOperation.Execute(a.originalImage)
+func (a *App) MoveImageOperation(oldIndex, newIndex int) (err error) {
+	defer toAppError(&err)
 
+	unlock, err := a.beginChange()
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
-	a.originalImage = rotatedImage
-	a.imageLayerCollection.InputImage = rotatedImage
+	imageLayer, err := a.imageLayerCollection.At(oldIndex)
+	if err != nil {
+		return err
+	}
+	if newIndex < 0 || newIndex >= a.imageLayerCollection.Size {
+		return models.NewError(models.InvalidIndex, "Invalid index")
+	}
+	if oldIndex == newIndex {
+		return nil
+	}
 
-	return nil
+	return a.history.Execute(history.NewCommand(
+		"Move "+layerLabel(imageLayer),
+		func() error {
+			return a.moveLayer(oldIndex, newIndex)
+		},
+		func() error {
+			return a.moveLayer(newIndex, oldIndex)
+		},
+	))
 }
 
-func (a *App) MirrorImageVertically() error {
-	verticalMirrorOperation := operations.NewVerticalMirrorOperation()
-	mirroredImage, err := verticalMirrorOperation.Execute(a.originalImage)
+func (a *App) ToggleImageOperation(index int) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
+	imageLayer, err := a.imageLayerCollection.At(index)
 	if err != nil {
 		return err
 	}
 
-	a.originalImage = mirroredImage
-	a.imageLayerCollection.InputImage = mirroredImage
+	toggle := func() error {
+		if imageLayer.IsEnabled {
+			imageLayer.Disable()
+		} else {
+			imageLayer.Enable()
+		}
+		return nil
+	}
+
+	label := "Enable "
+	if imageLayer.IsEnabled {
+		label = "Disable "
+	}
 
-	return nil
+	return a.history.Execute(history.NewCommand(label+layerLabel(imageLayer), toggle, toggle))
 }
 
-func (a *App) MirrorImageHorizontally() error {
-	horizontalMirrorOperation := operations.NewHorizontalMirrorOperation()
-	mirroredImage, err := horizontalMirrorOperation.Execute(a.originalImage)
+func (a *App) replaceLayer(index int, imageLayer *models.ImageLayer) error {
+	if err := a.imageLayerCollection.RemoveAt(index); err != nil {
+		return err
+	}
+	return a.imageLayerCollection.InsertAt(imageLayer, index)
+}
 
+func (a *App) moveLayer(oldIndex, newIndex int) error {
+	imageLayer, err := a.imageLayerCollection.At(oldIndex)
 	if err != nil {
 		return err
 	}
 
-	a.originalImage = mirroredImage
-	a.imageLayerCollection.InputImage = mirroredImage
+	if err := a.imageLayerCollection.RemoveAt(oldIndex); err != nil {
+		return err
+	}
+	return a.imageLayerCollection.InsertAt(imageLayer, newIndex)
+}
 
-	return nil
+func CreateImageLayerWithOperation(operation ImageOperation) (*models.ImageLayer, error) {
+	imageLayer, err := project.NewImageLayer(operation.state())
+	if err != nil {
+		return nil, models.WrapError(models.InvalidOperation, err, "Failed to create ImageLayer with provided ImageOperation")
+	}
+
+	return imageLayer, nil
+}
+
+func (a *App) ListOperations() []operations.Definition {
+	return operations.List()
+}
+
+func (a *App) ListBlendModes() []models.BlendMode {
+	return models.BlendModes
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"tool7/image-processing/animation"
+	"tool7/image-processing/models"
+)
+
+// Returns the frames of the opened file when it is an animated GIF, otherwise nothing
+func loadAnimation(data []byte) (*animation.Animation, error) {
+	if !animation.IsGIF(data) {
+		return nil, nil
+	}
+
+	frames, err := animation.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, models.WrapError(models.DecodeFailed, err, "Failed to decode GIF animation")
+	}
+	if !frames.IsAnimated() {
+		return nil, nil
+	}
+	return frames, nil
+}
+
+// Number of frames of the opened image, more than one only for animated GIF files
+func (a *App) GetFrameCount() int {
+	if a.sourceAnimation != nil {
+		return len(a.sourceAnimation.Frames)
+	}
+	if a.sourceImage != nil {
+		return 1
+	}
+	return 0
+}
+
+// Shows the given frame of the opened animation and renders its preview, see ProcessImage. The
+// layers stay as they are, so later renders and changes apply to this frame until another one is
+// chosen.
+func (a *App) ProcessFrame(frame int) (result Base64Image, err error) {
+	defer toAppError(&err)
+
+	if err := a.selectFrame(frame); err != nil {
+		return Base64Image{}, err
+	}
+	return a.ProcessImage(0)
+}
+
+func (a *App) selectFrame(frame int) error {
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if frame < 0 || frame >= a.GetFrameCount() {
+		return models.NewError(models.InvalidIndex, fmt.Sprintf("Image has no frame %d", frame+1))
+	}
+	if a.sourceAnimation == nil {
+		return nil
+	}
+
+	a.sourceImage = a.sourceAnimation.Frames[frame]
+	a.imageLayerCollection.InputImage = a.sourceImage
+	return nil
+}
+
+// Executes the layers on every frame of the opened animation at full resolution. Frames are not
+// cached, so rendering them does not push the previews out of the cache. Expects the pipeline to
+// be locked.
+func (a *App) renderAnimation(ctx context.Context) (*animation.Animation, error) {
+	collection := a.imageLayerCollection
+	inputImage, cache := collection.InputImage, collection.Cache
+	defer func() {
+		collection.InputImage, collection.Cache = inputImage, cache
+	}()
+	collection.Cache = nil
+
+	return a.sourceAnimation.Process(ctx, func(ctx context.Context, frame models.Image) (models.Image, error) {
+		collection.InputImage = frame
+		return collection.ExecuteFullResolution(ctx)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+
+	"tool7/image-processing/batch"
+	"tool7/image-processing/models"
+	"tool7/image-processing/project"
+
+	"github.com/pkg/errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+const (
+	// Event emitted with batch.Progress whenever a file of a batch is done
+	batchProgressEvent = "batch:progress"
+	// Event emitted with batch.Progress for every file of a batch that failed
+	batchErrorEvent = "batch:error"
+)
+
+// Returns the image files chosen by the user, none if the dialog was closed
+func (a *App) SelectBatchFiles() (filePaths []string, err error) {
+	defer toAppError(&err)
+
+	filePaths, err = runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Images to Process",
+		Filters: imageFileFilters,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error on image file selection")
+	}
+	if filePaths == nil {
+		filePaths = []string{}
+	}
+	return filePaths, nil
+}
+
+// Returns the image files directly inside the folder chosen by the user, none if the dialog was
+// closed
+func (a *App) SelectBatchFolder() (filePaths []string, err error) {
+	defer toAppError(&err)
+
+	directory, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "Select Folder of Images to Process",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error on folder selection")
+	}
+	if directory == "" {
+		return []string{}, nil
+	}
+
+	filePaths, err = batch.CollectInputs(directory)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading folder")
+	}
+	if filePaths == nil {
+		filePaths = []string{}
+	}
+	return filePaths, nil
+}
+
+// Returns the directory chosen by the user, or an empty path if the dialog was closed
+func (a *App) SelectOutputDirectory() (directory string, err error) {
+	defer toAppError(&err)
+
+	directory, err = runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:                "Select Output Folder",
+		CanCreateDirectories: true,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Error on folder selection")
+	}
+	return directory, nil
+}
+
+// Applies the current layers to every input file, see batch.Run. The layers are captured when
+// the batch starts, so editing them meanwhile does not affect it. Only one batch runs at a time
+// and CancelBatch stops it.
+func (a *App) ProcessBatch(options batch.Options) (summary batch.Summary, err error) {
+	defer toAppError(&err)
+
+	unlock := a.lockPipeline()
+	if err := a.requireImage(); err != nil {
+		unlock()
+		return batch.Summary{}, err
+	}
+	steps, err := project.Capture(a.imageLayerCollection)
+	options.Timeout = a.processingTimeout
+	options.WorkingSpace = a.workingSpace
+	unlock()
+	if err != nil {
+		return batch.Summary{}, err
+	}
+
+	ctx, cancel := context.WithCancel(a.context())
+	defer cancel()
+
+	if !a.startBatch(cancel) {
+		return batch.Summary{}, models.NewError(models.InvalidOperation, "A batch is already running")
+	}
+	defer a.startBatch(nil)
+
+	return batch.Run(ctx, steps, options, func(progress batch.Progress) {
+		if a.ctx == nil {
+			return
+		}
+		runtime.EventsEmit(a.ctx, batchProgressEvent, progress)
+		if progress.Error != "" {
+			runtime.EventsEmit(a.ctx, batchErrorEvent, progress)
+		}
+	})
+}
+
+// Stops the running batch. Files done so far are kept.
+func (a *App) CancelBatch() {
+	a.batchMutex.Lock()
+	defer a.batchMutex.Unlock()
+
+	if a.cancelBatch != nil {
+		a.cancelBatch()
+	}
+}
+
+// Makes cancel the function stopping the running batch, or clears it when nil. Returns false if
+// another batch is running.
+func (a *App) startBatch(cancel context.CancelFunc) bool {
+	a.batchMutex.Lock()
+	defer a.batchMutex.Unlock()
+
+	if cancel != nil && a.cancelBatch != nil {
+		return false
+	}
+	a.cancelBatch = cancel
+	return true
+}
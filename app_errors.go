@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"tool7/image-processing/models"
+)
+
+// Error as returned to the frontend. Wails only passes the message of an error on, so the
+// message is the JSON encoding of the error.
+type AppError struct {
+	Code    models.ErrorCode `json:"code"`
+	Message string           `json:"message"`
+	// Index of the failed layer, only set for models.OperationFailed
+	Layer *int `json:"layer,omitempty"`
+}
+
+func (this *AppError) Error() string {
+	encoded, err := json.Marshal(this)
+	if err != nil {
+		return this.Message
+	}
+	return string(encoded)
+}
+
+// Converts the error pointed to by err into an AppError, meant to be deferred by bound methods
+func toAppError(err *error) {
+	if *err == nil {
+		return
+	}
+
+	var appError *AppError
+	if errors.As(*err, &appError) {
+		return
+	}
+
+	appError = &AppError{
+		Code:    models.ErrorCodeOf(*err),
+		Message: (*err).Error(),
+	}
+
+	var codedError *models.Error
+	if errors.As(*err, &codedError) && codedError.Layer >= 0 {
+		layer := codedError.Layer
+		appError.Layer = &layer
+	}
+
+	*err = appError
+}
+
+func errNoImageLoaded() error {
+	return models.NewError(models.NoImageLoaded, "No image loaded")
+}
+
+func (a *App) requireImage() error {
+	if a.imageLayerCollection == nil {
+		return errNoImageLoaded()
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"tool7/image-processing/models"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestToAppError(t *testing.T) {
+	failure := errors.New("disk full")
+
+	tests := []struct {
+		err     error
+		code    models.ErrorCode
+		message string
+		layer   int
+	}{
+		{failure, models.UnknownError, "disk full", -1},
+		{pkgerrors.Wrap(failure, "Error writing image file"), models.UnknownError, "Error writing image file: disk full", -1},
+		{errNoImageLoaded(), models.NoImageLoaded, "No image loaded", -1},
+		{models.WrapError(models.DecodeFailed, failure, "Failed to load project"), models.DecodeFailed, "Failed to load project: disk full", -1},
+		{fmt.Errorf("Page 2: %w", models.NewError(models.InvalidIndex, "Image has no page 2")), models.InvalidIndex, "Page 2: Image has no page 2", -1},
+		{pkgerrors.Wrap(models.NewLayerError(3, failure), "Export"), models.OperationFailed, "Export: Layer 4 failed: disk full", 3},
+		{models.NewLayerError(0, failure), models.OperationFailed, "Layer 1 failed: disk full", 0},
+		{context.Canceled, models.Canceled, "context canceled", -1},
+		{fmt.Errorf("Render: %w", context.DeadlineExceeded), models.TimedOut, "Render: context deadline exceeded", -1},
+	}
+
+	for _, test := range tests {
+		err := test.err
+		toAppError(&err)
+
+		var appError *AppError
+		if !errors.As(err, &appError) {
+			t.Errorf("%v became %T", test.err, err)
+			continue
+		}
+		if appError.Code != test.code || appError.Message != test.message {
+			t.Errorf("%v became %+v", test.err, appError)
+		}
+		if test.layer < 0 && appError.Layer != nil {
+			t.Errorf("%v has layer %d", test.err, *appError.Layer)
+		}
+		if test.layer >= 0 && (appError.Layer == nil || *appError.Layer != test.layer) {
+			t.Errorf("%v has layer %v, expected %d", test.err, appError.Layer, test.layer)
+		}
+	}
+}
+
+func TestToAppErrorKeepsNilAndAppErrors(t *testing.T) {
+	var err error
+	toAppError(&err)
+	if err != nil {
+		t.Errorf("No error became %v", err)
+	}
+
+	layer := 1
+	appError := &AppError{Code: models.OperationFailed, Message: "Layer 2 failed", Layer: &layer}
+	err = fmt.Errorf("Again: %w", appError)
+	wrapped := err
+	toAppError(&err)
+	if err != wrapped {
+		t.Errorf("Error already converted became %v", err)
+	}
+}
+
+// The frontend only gets the message, so it holds the whole error
+func TestAppErrorMessageIsJSON(t *testing.T) {
+	layer := 2
+	tests := []struct {
+		err      *AppError
+		expected string
+	}{
+		{&AppError{Code: models.NoImageLoaded, Message: "No image loaded"}, `{"code":"noImageLoaded","message":"No image loaded"}`},
+		{&AppError{Code: models.OperationFailed, Message: "Layer 3 failed", Layer: &layer}, `{"code":"operationFailed","message":"Layer 3 failed","layer":2}`},
+	}
+
+	for _, test := range tests {
+		if message := test.err.Error(); message != test.expected {
+			t.Errorf("Message is %s, expected %s", message, test.expected)
+		}
+		var decoded AppError
+		if err := json.Unmarshal([]byte(test.err.Error()), &decoded); err != nil || decoded.Code != test.err.Code {
+			t.Errorf("%s decodes to %+v: %v", test.err.Error(), decoded, err)
+		}
+	}
+}
+
+// Fails every time it is executed
+type failingOperation struct{}
+
+func (this failingOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	return nil, errors.New("out of memory")
+}
+
+func TestBoundMethodsReportFailedLayer(t *testing.T) {
+	app := newTestApp(newTestImage(8, 8))
+	for _, operation := range []ImageOperation{{Name: "greyscale", IsEnabled: true}, {Name: "negative", IsEnabled: true}} {
+		if err := app.AppendImageOperation(operation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app.imageLayerCollection.Append(&models.ImageLayer{Operation: failingOperation{}, IsEnabled: true, Opacity: 1, BlendMode: models.NormalBlend})
+
+	_, err := app.ProcessImage(0)
+	var appError *AppError
+	if !errors.As(err, &appError) || appError.Code != models.OperationFailed || appError.Layer == nil || *appError.Layer != 2 {
+		t.Errorf("Render failed with %v", err)
+	}
+
+	if err := app.RemoveImageOperationAtIndex(7); appErrorCode(err) != models.InvalidIndex {
+		t.Errorf("Removing a missing layer failed with %v", err)
+	}
+
+	app.ResetAppState()
+	if _, err := app.ProcessImage(0); appErrorCode(err) != models.NoImageLoaded {
+		t.Errorf("Render without image failed with %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"path/filepath"
+
+	"tool7/image-processing/export"
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+
+	"github.com/pkg/errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// See export.Options
+type ExportOptions struct {
+	// png, jpeg, gif, bmp or tiff
+	Format string `json:"format"`
+	// PNG and TIFF only: default, none, fast or best
+	Compression string `json:"compression,omitempty"`
+	// JPEG only, from 1 to 100
+	Quality int `json:"quality,omitempty"`
+	// JPEG only: 4:4:4, 4:2:2 or 4:2:0
+	ChromaSubsampling string `json:"chromaSubsampling,omitempty"`
+	// PNG and TIFF only: 8 or 16 bits per channel, the depth of the opened image when zero
+	BitDepth int `json:"bitDepth,omitempty"`
+	// Metadata of the opened image to keep, only PNG and JPEG files have it
+	Metadata metadata.Selection `json:"metadata"`
+}
+
+func (this ExportOptions) options(sourceMetadata metadata.Metadata) export.Options {
+	return export.Options{
+		Format:            export.Format(this.Format),
+		Compression:       export.Compression(this.Compression),
+		Quality:           this.Quality,
+		ChromaSubsampling: export.ChromaSubsampling(this.ChromaSubsampling),
+		BitDepth:          this.BitDepth,
+		Metadata:          sourceMetadata.Select(this.Metadata),
+	}
+}
+
+var exportFileFilters = map[export.Format]runtime.FileFilter{
+	export.PNG:  {DisplayName: "PNG (*.png)", Pattern: "*.png"},
+	export.JPEG: {DisplayName: "JPEG (*.jpg;*.jpeg)", Pattern: "*.jpg;*.jpeg"},
+	export.GIF:  {DisplayName: "GIF (*.gif)", Pattern: "*.gif"},
+	export.BMP:  {DisplayName: "BMP (*.bmp)", Pattern: "*.bmp"},
+	export.TIFF: {DisplayName: "TIFF (*.tif;*.tiff)", Pattern: "*.tif;*.tiff"},
+}
+
+// Renders the image at its original resolution and writes it to the file chosen by the user,
+// named after the source file by default. Animations exported as GIF keep all their frames.
+// Returns false if the user closed the dialog without choosing a file.
+func (a *App) ExportImage(exportOptions ExportOptions) (isExported bool, err error) {
+	defer toAppError(&err)
+
+	if a.sourceImage == nil {
+		return false, errNoImageLoaded()
+	}
+
+	options := exportOptions.options(a.sourceMetadata)
+	if err := options.Validate(); err != nil {
+		return false, models.WrapError(models.UnsupportedFormat, err, "Invalid export options")
+	}
+
+	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Image",
+		DefaultFilename: a.defaultFileName("image-processing-result") + options.Format.Extension(),
+		Filters:         []runtime.FileFilter{exportFileFilters[options.Format]},
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "Error on image file selection")
+	}
+	if filePath == "" {
+		return false, nil
+	}
+	if filepath.Ext(filePath) == "" {
+		filePath += options.Format.Extension()
+	}
+
+	unlock := a.lockPipeline()
+	defer unlock()
+
+	if err := a.requireImage(); err != nil {
+		return false, err
+	}
+
+	ctx, cancel := a.withProcessingTimeout(a.context())
+	defer cancel()
+
+	if a.sourceAnimation != nil && options.Format == export.GIF {
+		frames, err := a.renderAnimation(models.WithProgress(ctx, a.emitProgress))
+		if err != nil {
+			return false, err
+		}
+		if err := export.WriteAnimationFile(filePath, frames); err != nil {
+			return false, errors.Wrap(err, "Error writing image file")
+		}
+		return true, nil
+	}
+
+	processedImage, err := a.imageLayerCollection.ExecuteFullResolution(models.WithProgress(ctx, a.emitProgress))
+	if err != nil {
+		return false, err
+	}
+
+	if err := export.WriteFile(filePath, processedImage, options); err != nil {
+		return false, errors.Wrap(err, "Error writing image file")
+	}
+
+	return true, nil
+}
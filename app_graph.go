@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+
+	"tool7/image-processing/history"
+	"tool7/image-processing/models"
+	"tool7/image-processing/utils"
+)
+
+// Replaces the layers from startIndex to endIndex, both included, with a graph in which every
+// layer is the input of the next one
+func (a *App) ConvertToGraph(startIndex, endIndex int) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if startIndex > endIndex || startIndex < 0 || endIndex >= a.imageLayerCollection.Size {
+		return models.NewError(models.InvalidIndex, "Invalid index")
+	}
+
+	var imageLayers []*models.ImageLayer
+	for index := startIndex; index <= endIndex; index++ {
+		imageLayer, err := a.imageLayerCollection.At(index)
+		if err != nil {
+			return err
+		}
+		imageLayers = append(imageLayers, imageLayer)
+	}
+
+	graphLayer := utils.NewImageLayer(models.NewLayerGraphFromChain(imageLayers))
+
+	return a.history.Execute(history.NewCommand(
+		"Convert to graph",
+		func() error {
+			for range imageLayers {
+				if err := a.imageLayerCollection.RemoveAt(startIndex); err != nil {
+					return err
+				}
+			}
+			return a.imageLayerCollection.InsertAt(graphLayer, startIndex)
+		},
+		func() error {
+			if err := a.imageLayerCollection.RemoveAt(startIndex); err != nil {
+				return err
+			}
+			for i, imageLayer := range imageLayers {
+				if err := a.imageLayerCollection.InsertAt(imageLayer, startIndex+i); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	))
+}
+
+// Adds a layer node without inputs to the graph at index and returns its ID
+func (a *App) AddGraphNode(index int, operation ImageOperation) (nodeID int, err error) {
+	defer toAppError(&err)
+
+	imageLayer, err := CreateImageLayerWithOperation(operation)
+	if err != nil {
+		return 0, err
+	}
+	imageLayer.IsEnabled = operation.IsEnabled
+
+	err = a.changeGraph(index, "Add "+layerLabel(imageLayer)+" node", func(graph *models.LayerGraph) error {
+		nodeID = int(graph.AddLayerNode(imageLayer))
+		return nil
+	})
+	return nodeID, err
+}
+
+// Adds a merge node blending its second input over its first one and returns its ID
+func (a *App) AddGraphBlendNode(index int, blendMode models.BlendMode, opacity float64) (nodeID int, err error) {
+	defer toAppError(&err)
+
+	merge, err := models.NewBlendMerge(blendMode, opacity)
+	if err != nil {
+		return 0, err
+	}
+
+	err = a.changeGraph(index, "Add blend node", func(graph *models.LayerGraph) error {
+		nodeID = int(graph.AddMergeNode(merge))
+		return nil
+	})
+	return nodeID, err
+}
+
+// Changes the parameters of a layer node
+func (a *App) UpdateGraphNode(index, nodeID int, operation ImageOperation) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	graph, err := a.graphAt(index)
+	if err != nil {
+		return err
+	}
+	node, err := graph.Node(models.NodeID(nodeID))
+	if err != nil {
+		return err
+	}
+	if node.Layer == nil {
+		return models.NewError(models.InvalidOperation, fmt.Sprintf("Node %d is not a layer", nodeID))
+	}
+
+	if err := a.history.Execute(newLayerUpdateCommand(node.Layer, operation.Params)); err != nil {
+		return models.WrapError(models.InvalidOperation, err, "Invalid parameters")
+	}
+	return nil
+}
+
+// Changes the blending of a blend node
+func (a *App) UpdateGraphBlendNode(index, nodeID int, blendMode models.BlendMode, opacity float64) (err error) {
+	defer toAppError(&err)
+
+	merge, err := models.NewBlendMerge(blendMode, opacity)
+	if err != nil {
+		return err
+	}
+
+	return a.changeGraph(index, "Change blend node", func(graph *models.LayerGraph) error {
+		node, err := graph.Node(models.NodeID(nodeID))
+		if err != nil {
+			return err
+		}
+		if _, ok := node.Merge.(*models.BlendMerge); !ok {
+			return models.NewError(models.InvalidOperation, fmt.Sprintf("Node %d is not a blend node", nodeID))
+		}
+
+		node.Merge = merge
+		return nil
+	})
+}
+
+func (a *App) RemoveGraphNode(index, nodeID int) (err error) {
+	defer toAppError(&err)
+
+	return a.changeGraph(index, "Remove node", func(graph *models.LayerGraph) error {
+		return graph.RemoveNode(models.NodeID(nodeID))
+	})
+}
+
+// Makes the output of the node from the input at the given slot of the node to
+func (a *App) ConnectGraphNodes(index, from, to, slot int) (err error) {
+	defer toAppError(&err)
+
+	return a.changeGraph(index, "Connect nodes", func(graph *models.LayerGraph) error {
+		return graph.Connect(models.NodeID(from), models.NodeID(to), slot)
+	})
+}
+
+func (a *App) DisconnectGraphNode(index, to, slot int) (err error) {
+	defer toAppError(&err)
+
+	return a.changeGraph(index, "Disconnect nodes", func(graph *models.LayerGraph) error {
+		return graph.Disconnect(models.NodeID(to), slot)
+	})
+}
+
+// Makes the node the one whose output is the output of the graph
+func (a *App) SetGraphOutput(index, nodeID int) (err error) {
+	defer toAppError(&err)
+
+	return a.changeGraph(index, "Change graph output", func(graph *models.LayerGraph) error {
+		return graph.SetOutput(models.NodeID(nodeID))
+	})
+}
+
+func (a *App) changeGraph(index int, label string, change func(graph *models.LayerGraph) error) error {
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	graph, err := a.graphAt(index)
+	if err != nil {
+		return err
+	}
+
+	return a.history.Execute(&graphChangeCommand{label: label, graph: graph, change: change})
+}
+
+func (a *App) graphAt(index int) (*models.LayerGraph, error) {
+	imageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, ok := imageLayer.Operation.(*models.LayerGraph)
+	if !ok {
+		return nil, models.NewError(models.InvalidOperation, "Layer is not a graph")
+	}
+	return graph, nil
+}
+
+// Change of the structure of a graph, undone by restoring the structure from before it.
+// Redoing restores the structure from after it, so that node IDs stay the same.
+type graphChangeCommand struct {
+	label  string
+	graph  *models.LayerGraph
+	change func(graph *models.LayerGraph) error
+	before models.GraphSnapshot
+	after  *models.GraphSnapshot
+}
+
+func (this *graphChangeCommand) Label() string {
+	return this.label
+}
+
+func (this *graphChangeCommand) Do() error {
+	if this.after != nil {
+		this.graph.Restore(*this.after)
+		return nil
+	}
+
+	this.before = this.graph.Snapshot()
+	if err := this.change(this.graph); err != nil {
+		this.graph.Restore(this.before)
+		return err
+	}
+
+	after := this.graph.Snapshot()
+	this.after = &after
+	return nil
+}
+
+func (this *graphChangeCommand) Undo() error {
+	this.graph.Restore(this.before)
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"tool7/image-processing/history"
+	"tool7/image-processing/models"
+	"tool7/image-processing/project"
+	"tool7/image-processing/utils"
+)
+
+// Moves the layers from startIndex to endIndex, both included, into a new group at startIndex
+func (a *App) GroupImageOperations(startIndex, endIndex int) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if startIndex > endIndex || startIndex < 0 || endIndex >= a.imageLayerCollection.Size {
+		return models.NewError(models.InvalidIndex, "Invalid index")
+	}
+
+	group := models.NewLayerGroup()
+	groupLayer := utils.NewImageLayer(group)
+	count := endIndex - startIndex + 1
+
+	return a.history.Execute(history.NewCommand(
+		"Group layers",
+		func() error {
+			for i := 0; i < count; i++ {
+				imageLayer, err := a.imageLayerCollection.At(startIndex)
+				if err != nil {
+					return err
+				}
+				if err := a.imageLayerCollection.RemoveAt(startIndex); err != nil {
+					return err
+				}
+				group.Layers.Append(imageLayer)
+			}
+			return a.imageLayerCollection.InsertAt(groupLayer, startIndex)
+		},
+		func() error {
+			return a.ungroupLayer(startIndex, group)
+		},
+	))
+}
+
+// Replaces the group at index with its members
+func (a *App) UngroupImageOperation(index int) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	groupLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
+	}
+
+	group, ok := groupLayer.Operation.(*models.LayerGroup)
+	if !ok {
+		return models.NewError(models.InvalidOperation, "Layer is not a group")
+	}
+
+	count := group.Layers.Size
+
+	return a.history.Execute(history.NewCommand(
+		"Ungroup layers",
+		func() error {
+			return a.ungroupLayer(index, group)
+		},
+		func() error {
+			for i := 0; i < count; i++ {
+				imageLayer, err := a.imageLayerCollection.At(index)
+				if err != nil {
+					return err
+				}
+				if err := a.imageLayerCollection.RemoveAt(index); err != nil {
+					return err
+				}
+				group.Layers.Append(imageLayer)
+			}
+			return a.imageLayerCollection.InsertAt(groupLayer, index)
+		},
+	))
+}
+
+// Inserts a copy of the layer at index right after it. Groups are copied with all their members.
+func (a *App) DuplicateImageOperation(index int) (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	imageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
+	}
+
+	state, err := project.CaptureLayer(imageLayer)
+	if err != nil {
+		return err
+	}
+
+	duplicate, err := project.NewImageLayer(state)
+	if err != nil {
+		return err
+	}
+
+	return a.history.Execute(history.NewCommand(
+		"Duplicate "+layerLabel(imageLayer),
+		func() error {
+			return a.imageLayerCollection.InsertAt(duplicate, index+1)
+		},
+		func() error {
+			return a.imageLayerCollection.RemoveAt(index + 1)
+		},
+	))
+}
+
+// Removes the group at index and inserts its members in its place, leaving the group empty
+func (a *App) ungroupLayer(index int, group *models.LayerGroup) error {
+	if err := a.imageLayerCollection.RemoveAt(index); err != nil {
+		return err
+	}
+
+	for group.Layers.Size > 0 {
+		imageLayer, err := group.Layers.At(group.Layers.Size - 1)
+		if err != nil {
+			return err
+		}
+		if err := group.Layers.RemoveAt(group.Layers.Size - 1); err != nil {
+			return err
+		}
+		if err := a.imageLayerCollection.InsertAt(imageLayer, index); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"tool7/image-processing/history"
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+
+	"github.com/pkg/errors"
+)
+
+type HistoryState struct {
+	Entries []history.Entry `json:"entries"`
+	CanUndo bool            `json:"canUndo"`
+	CanRedo bool            `json:"canRedo"`
+	Depth   int             `json:"depth"`
+}
+
+func (a *App) Undo() (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return a.history.Undo()
+}
+
+func (a *App) Redo() (err error) {
+	defer toAppError(&err)
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return a.history.Redo()
+}
+
+func (a *App) GetHistory() HistoryState {
+	return HistoryState{
+		Entries: a.history.Entries(),
+		CanUndo: a.history.CanUndo(),
+		CanRedo: a.history.CanRedo(),
+		Depth:   a.history.Depth(),
+	}
+}
+
+// Sets how many changes can be undone. Zero removes the limit.
+func (a *App) SetHistoryDepth(depth int) (err error) {
+	defer toAppError(&err)
+
+	if depth < 0 {
+		return errors.New("History depth cannot be negative")
+	}
+
+	a.history.SetDepth(depth)
+	return nil
+}
+
+// Parameter change of a single layer. Consecutive changes of the same layer, like the steps of a
+// slider drag, are merged into one command that restores the parameters from before the drag.
+type layerUpdateCommand struct {
+	imageLayer *models.ImageLayer
+	before     operations.Parameters
+	after      operations.Parameters
+}
+
+func newLayerUpdateCommand(imageLayer *models.ImageLayer, params operations.Parameters) *layerUpdateCommand {
+	var before operations.Parameters
+	if configurable, ok := imageLayer.Operation.(operations.ConfigurableOperation); ok {
+		before = configurable.Parameters()
+	}
+
+	return &layerUpdateCommand{imageLayer, before, params}
+}
+
+func (this *layerUpdateCommand) Label() string {
+	return "Change " + layerLabel(this.imageLayer)
+}
+
+func (this *layerUpdateCommand) Do() error {
+	return operations.Update(this.imageLayer.Operation, this.after)
+}
+
+func (this *layerUpdateCommand) Undo() error {
+	return operations.Update(this.imageLayer.Operation, this.before)
+}
+
+func (this *layerUpdateCommand) Coalesce(next history.Command) bool {
+	nextUpdate, ok := next.(*layerUpdateCommand)
+	if !ok || nextUpdate.imageLayer != this.imageLayer {
+		return false
+	}
+
+	this.after = nextUpdate.after
+	return true
+}
+
+// Blending change of a single layer, merged with consecutive changes of the same layer like
+// parameter changes are
+type layerBlendingCommand struct {
+	imageLayer    *models.ImageLayer
+	beforeMode    models.BlendMode
+	beforeOpacity float64
+	afterMode     models.BlendMode
+	afterOpacity  float64
+}
+
+func newLayerBlendingCommand(imageLayer *models.ImageLayer, blendMode models.BlendMode, opacity float64) *layerBlendingCommand {
+	return &layerBlendingCommand{imageLayer, imageLayer.BlendMode, imageLayer.Opacity, blendMode, opacity}
+}
+
+func (this *layerBlendingCommand) Label() string {
+	return "Change blending of " + layerLabel(this.imageLayer)
+}
+
+func (this *layerBlendingCommand) Do() error {
+	return this.imageLayer.SetBlending(this.afterMode, this.afterOpacity)
+}
+
+func (this *layerBlendingCommand) Undo() error {
+	return this.imageLayer.SetBlending(this.beforeMode, this.beforeOpacity)
+}
+
+func (this *layerBlendingCommand) Coalesce(next history.Command) bool {
+	nextChange, ok := next.(*layerBlendingCommand)
+	if !ok || nextChange.imageLayer != this.imageLayer {
+		return false
+	}
+
+	this.afterMode = nextChange.afterMode
+	this.afterOpacity = nextChange.afterOpacity
+	return true
+}
+
+// Replaces the mask of a single layer. Masks are immutable, so consecutive changes of the same
+// layer, like dragging a gradient, are merged by keeping the first previous mask.
+type layerMaskCommand struct {
+	imageLayer *models.ImageLayer
+	before     *models.LayerMask
+	after      *models.LayerMask
+}
+
+func newLayerMaskCommand(imageLayer *models.ImageLayer, mask *models.LayerMask) *layerMaskCommand {
+	return &layerMaskCommand{imageLayer, imageLayer.Mask, mask}
+}
+
+func (this *layerMaskCommand) Label() string {
+	if this.after == nil {
+		return "Remove mask of " + layerLabel(this.imageLayer)
+	}
+	return "Change mask of " + layerLabel(this.imageLayer)
+}
+
+func (this *layerMaskCommand) Do() error {
+	this.imageLayer.Mask = this.after
+	return nil
+}
+
+func (this *layerMaskCommand) Undo() error {
+	this.imageLayer.Mask = this.before
+	return nil
+}
+
+func (this *layerMaskCommand) Coalesce(next history.Command) bool {
+	nextChange, ok := next.(*layerMaskCommand)
+	if !ok || nextChange.imageLayer != this.imageLayer || this.after == nil || nextChange.after == nil {
+		return false
+	}
+
+	this.after = nextChange.after
+	return true
+}
+
+func layerLabel(imageLayer *models.ImageLayer) string {
+	if _, ok := imageLayer.Operation.(*models.LayerGroup); ok {
+		return "group"
+	}
+	if _, ok := imageLayer.Operation.(*models.LayerGraph); ok {
+		return "graph"
+	}
+
+	configurable, ok := imageLayer.Operation.(operations.ConfigurableOperation)
+	if !ok {
+		return "layer"
+	}
+
+	definition, ok := operations.Lookup(configurable.Name())
+	if !ok {
+		return configurable.Name()
+	}
+	return definition.Label
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+	"tool7/image-processing/project"
+	"tool7/image-processing/utils"
+
+	"github.com/pkg/errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// Sets the mask restricting where the layer at index applies. A nil mask removes it.
+func (a *App) SetImageOperationMask(index int, mask *project.MaskState) (err error) {
+	defer toAppError(&err)
+
+	var layerMask *models.LayerMask
+	if mask != nil {
+		layerMask, err = project.NewLayerMask(*mask)
+		if err != nil {
+			return models.WrapError(models.InvalidOperation, err, "Invalid mask")
+		}
+	}
+
+	return a.setLayerMask(index, layerMask)
+}
+
+// Lets the user choose an image whose luminance becomes the mask of the layer at index.
+// Returns false if the user closed the dialog without choosing a file.
+func (a *App) OpenMaskFileSelector(index int) (isSelected bool, err error) {
+	defer toAppError(&err)
+
+	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Mask Image",
+		Filters: imageFileFilters,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "Error on mask file selection")
+	}
+	if filePath == "" {
+		return false, nil
+	}
+
+	img, _, err := metadata.LoadImage(filePath)
+	if err != nil {
+		return false, err
+	}
+
+	layerMask, err := models.NewLayerMask(models.MaskShape{Kind: models.BitmapMask}, utils.ConvertToGray(img))
+	if err != nil {
+		return false, err
+	}
+
+	return true, a.setLayerMask(index, layerMask)
+}
+
+func (a *App) setLayerMask(index int, layerMask *models.LayerMask) error {
+	unlock, err := a.beginChange()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	imageLayer, err := a.imageLayerCollection.At(index)
+	if err != nil {
+		return err
+	}
+
+	return a.history.Execute(newLayerMaskCommand(imageLayer, layerMask))
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"tool7/image-processing/history"
+	"tool7/image-processing/models"
+	"tool7/image-processing/preset"
+	"tool7/image-processing/project"
+
+	"github.com/pkg/errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type Preset struct {
+	Name       string           `json:"name"`
+	Operations []ImageOperation `json:"operations"`
+}
+
+var presetFileFilters = []runtime.FileFilter{
+	{
+		DisplayName: "Presets (*.gopreset)",
+		Pattern:     "*" + preset.FileExtension,
+	},
+}
+
+func presetStore() (*preset.Store, error) {
+	store, err := preset.DefaultStore()
+	if err != nil {
+		return nil, errors.Wrap(err, "Preset directory unavailable")
+	}
+	return store, nil
+}
+
+// Saves the current layers as a preset, replacing the preset with the same name
+func (a *App) SavePreset(name string) (err error) {
+	defer toAppError(&err)
+
+	unlock := a.lockPipeline()
+	defer unlock()
+
+	if err := a.requireImage(); err != nil {
+		return err
+	}
+
+	operationStates, err := project.Capture(a.imageLayerCollection)
+	if err != nil {
+		return err
+	}
+
+	newPreset, err := preset.New(name, operationStates)
+	if err != nil {
+		return models.WrapError(models.InvalidOperation, err, "Invalid preset")
+	}
+
+	store, err := presetStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Save(*newPreset); err != nil {
+		return errors.Wrap(err, "Error writing preset")
+	}
+	return nil
+}
+
+func (a *App) ListPresets() (presets []Preset, err error) {
+	defer toAppError(&err)
+
+	store, err := presetStore()
+	if err != nil {
+		return nil, err
+	}
+
+	storedPresets, err := store.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error reading presets")
+	}
+
+	presets = make([]Preset, 0, len(storedPresets))
+	for _, storedPreset := range storedPresets {
+		operations := make([]ImageOperation, 0, len(storedPreset.Operations))
+		for _, state := range storedPreset.Operations {
+			operations = append(operations, newImageOperation(state))
+		}
+		presets = append(presets, Preset{Name: storedPreset.Name, Operations: operations})
+	}
+	return presets, nil
+}
+
+// Adds the operations of the preset after the current layers, or replaces the layers with them.
+// Operations that cannot be created are left out and returned.
+func (a *App) ApplyPreset(name string, replace bool) (skipped []project.SkippedOperation, err error) {
+	defer toAppError(&err)
+
+	store, err := presetStore()
+	if err != nil {
+		return nil, err
+	}
+	storedPreset, err := store.Load(name)
+	if err != nil {
+		return nil, models.WrapError(models.DecodeFailed, err, "Failed to load preset")
+	}
+
+	unlock, err := a.beginChange()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	imageLayers, skipped := project.NewImageLayers(storedPreset.Operations)
+
+	var replacedLayers []*models.ImageLayer
+	if replace {
+		for current := a.imageLayerCollection.Head; current != nil; current = current.Next {
+			replacedLayers = append(replacedLayers, current)
+		}
+	}
+
+	err = a.history.Execute(history.NewCommand(
+		"Apply preset "+storedPreset.Name,
+		func() error {
+			for range replacedLayers {
+				if err := a.imageLayerCollection.RemoveAt(0); err != nil {
+					return err
+				}
+			}
+			for _, imageLayer := range imageLayers {
+				a.imageLayerCollection.Append(imageLayer)
+			}
+			return nil
+		},
+		func() error {
+			for range imageLayers {
+				if err := a.imageLayerCollection.RemoveAt(a.imageLayerCollection.Size - 1); err != nil {
+					return err
+				}
+			}
+			for index, imageLayer := range replacedLayers {
+				if err := a.imageLayerCollection.InsertAt(imageLayer, index); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if skipped == nil {
+		skipped = []project.SkippedOperation{}
+	}
+	return skipped, nil
+}
+
+func (a *App) DeletePreset(name string) (err error) {
+	defer toAppError(&err)
+
+	store, err := presetStore()
+	if err != nil {
+		return err
+	}
+	return store.Delete(name)
+}
+
+func (a *App) RenamePreset(oldName, newName string) (err error) {
+	defer toAppError(&err)
+
+	store, err := presetStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Rename(oldName, newName); err != nil {
+		return models.WrapError(models.InvalidOperation, err, "Failed to rename preset")
+	}
+	return nil
+}
+
+// Adds the preset file chosen by the user to the presets and returns its name, or an empty name
+// if the user closed the dialog without choosing a file. A preset with the same name is kept and
+// the imported one gets a number appended to its name, see preset.Store.Add.
+func (a *App) ImportPreset() (name string, err error) {
+	defer toAppError(&err)
+
+	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Preset File (.gopreset extension)",
+		Filters: presetFileFilters,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Error on preset file selection")
+	}
+	if filePath == "" {
+		return "", nil
+	}
+
+	importedPreset, err := preset.ReadFile(filePath)
+	if err != nil {
+		return "", models.WrapError(models.DecodeFailed, err, "Failed to import preset")
+	}
+
+	store, err := presetStore()
+	if err != nil {
+		return "", err
+	}
+	name, err = store.Add(*importedPreset)
+	if err != nil {
+		return "", errors.Wrap(err, "Error writing preset")
+	}
+	return name, nil
+}
+
+// Writes the preset to a file chosen by the user. Returns false if the user closed the dialog
+// without choosing a file.
+func (a *App) ExportPreset(name string) (isExported bool, err error) {
+	defer toAppError(&err)
+
+	store, err := presetStore()
+	if err != nil {
+		return false, err
+	}
+	storedPreset, err := store.Load(name)
+	if err != nil {
+		return false, models.WrapError(models.DecodeFailed, err, "Failed to load preset")
+	}
+
+	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Export Preset",
+		DefaultFilename: strings.NewReplacer("/", "-", "\\", "-").Replace(storedPreset.Name) + preset.FileExtension,
+		Filters:         presetFileFilters,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "Error on preset file selection")
+	}
+	if filePath == "" {
+		return false, nil
+	}
+	if filepath.Ext(filePath) == "" {
+		filePath += preset.FileExtension
+	}
+
+	if err := preset.WriteFile(filePath, *storedPreset); err != nil {
+		return false, errors.Wrap(err, "Error writing preset file")
+	}
+	return true, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"tool7/image-processing/models"
+	"tool7/image-processing/project"
+
+	"github.com/pkg/errors"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+type ProjectLoadResult struct {
+	IsLoaded     bool                       `json:"isLoaded"`
+	Operations   []ImageOperation           `json:"operations"`
+	Skipped      []project.SkippedOperation `json:"skipped"`
+	WorkingSpace models.ColorSpace          `json:"workingSpace"`
+}
+
+var projectFileFilters = []runtime.FileFilter{
+	{
+		DisplayName: "Files (*.goimp)",
+		Pattern:     "*" + project.FileExtension,
+	},
+}
+
+// Returns false if the user closed the dialog without choosing a file
+func (a *App) SaveProject() (isSaved bool, err error) {
+	defer toAppError(&err)
+
+	state, err := a.captureProject()
+	if err != nil {
+		return false, err
+	}
+
+	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		Title:           "Save Project",
+		DefaultFilename: a.defaultFileName("image-processing-project") + project.FileExtension,
+		Filters:         projectFileFilters,
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "Error on project file selection")
+	}
+	if filePath == "" {
+		return false, nil
+	}
+	if filepath.Ext(filePath) == "" {
+		filePath += project.FileExtension
+	}
+
+	if err := project.Save(filePath, state); err != nil {
+		return false, errors.Wrap(err, "Error writing project file")
+	}
+
+	return true, nil
+}
+
+// Captures the session with the pipeline locked, so that it is not saved half way through a change
+func (a *App) captureProject() (project.State, error) {
+	unlock := a.lockPipeline()
+	defer unlock()
+
+	if err := a.requireImage(); err != nil {
+		return project.State{}, err
+	}
+
+	operationStates, err := project.Capture(a.imageLayerCollection)
+	if err != nil {
+		return project.State{}, err
+	}
+
+	return project.State{
+		Image:        a.sourceImage,
+		Operations:   operationStates,
+		Metadata:     a.sourceMetadata,
+		WorkingSpace: a.workingSpace,
+	}, nil
+}
+
+// Replaces the current session with the project chosen by the user. Operations that could not
+// be restored are reported in the result instead of failing the whole load.
+func (a *App) LoadProject() (result ProjectLoadResult, err error) {
+	defer toAppError(&err)
+
+	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title:   "Select Project File (.goimp extension)",
+		Filters: projectFileFilters,
+	})
+	if err != nil {
+		return ProjectLoadResult{}, errors.Wrap(err, "Error on project file selection")
+	}
+	if filePath == "" {
+		return ProjectLoadResult{}, nil
+	}
+
+	return a.loadProjectFile(filePath)
+}
+
+// Starts a session on the image embedded in the project file. The session keeps no source file,
+// as the project is not an image that pages could be decoded from.
+func (a *App) loadProjectFile(filePath string) (ProjectLoadResult, error) {
+	state, err := project.Load(filePath)
+	if err != nil {
+		return ProjectLoadResult{}, models.WrapError(models.DecodeFailed, err, "Failed to load project")
+	}
+
+	imageLayerCollection, skipped := project.BuildCollection(state.Image, state.Operations)
+
+	unlock := a.lockPipelineForChange()
+	a.workingSpace = state.WorkingSpace
+	a.startSession(imageSource{
+		name:      fileNameWithoutExtension(filePath),
+		image:     state.Image,
+		metadata:  state.Metadata,
+		pageCount: 1,
+	}, imageLayerCollection)
+	unlock()
+
+	imageOperations, err := a.GetImageOperations()
+	if err != nil {
+		return ProjectLoadResult{}, err
+	}
+
+	return ProjectLoadResult{
+		IsLoaded:     true,
+		Operations:   imageOperations,
+		Skipped:      skipped,
+		WorkingSpace: a.GetWorkingSpace(),
+	}, nil
+}
+
+// Describes the current layers, in pipeline order
+func (a *App) GetImageOperations() (imageOperations []ImageOperation, err error) {
+	defer toAppError(&err)
+
+	unlock := a.lockPipeline()
+	defer unlock()
+
+	if a.imageLayerCollection == nil {
+		return []ImageOperation{}, nil
+	}
+
+	operationStates, err := project.Capture(a.imageLayerCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	imageOperations = make([]ImageOperation, 0, len(operationStates))
+	for _, state := range operationStates {
+		imageOperations = append(imageOperations, newImageOperation(state))
+	}
+
+	return imageOperations, nil
+}
+
+func (a *App) defaultFileName(fallback string) string {
+	if a.sourceName == "" {
+		return fallback
+	}
+	return a.sourceName
+}
+
+func fileNameWithoutExtension(filePath string) string {
+	base := filepath.Base(filePath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"path/filepath"
+	"testing"
+
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+	"tool7/image-processing/project"
+)
+
+func newTestImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+func saveTestProject(t *testing.T, state project.State) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "holiday"+project.FileExtension)
+	if err := project.Save(filePath, state); err != nil {
+		t.Fatal(err)
+	}
+	return filePath
+}
+
+func appErrorCode(err error) models.ErrorCode {
+	var appError *AppError
+	if !errors.As(err, &appError) {
+		return ""
+	}
+	return appError.Code
+}
+
+// The project file holds no pages to decode, so it must not become the source file
+func TestLoadProjectKeepsNoSourceFile(t *testing.T) {
+	filePath := saveTestProject(t, project.State{
+		Image: newTestImage(4, 3),
+		Operations: []project.OperationState{
+			{Name: "brightness", Params: operations.Parameters{"level": 1.3}, IsEnabled: true},
+		},
+	})
+
+	app := NewApp()
+	result, err := app.loadProjectFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.IsLoaded || len(result.Operations) != 1 || len(result.Skipped) != 0 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	if app.sourceFilePath != "" {
+		t.Errorf("Source file is %q", app.sourceFilePath)
+	}
+	if name := app.defaultFileName("fallback"); name != "holiday" {
+		t.Errorf("Default file name is %q", name)
+	}
+	if pages := app.GetImagePages(); pages.Count != 1 || pages.Current != 0 {
+		t.Errorf("Pages are %+v", pages)
+	}
+
+	sourceImage := app.sourceImage
+	if err := app.SelectImagePage(0); appErrorCode(err) != models.InvalidOperation {
+		t.Errorf("Selecting a page of a project failed with %v", err)
+	}
+	if app.sourceImage != sourceImage || app.imageLayerCollection.Size != 1 {
+		t.Error("Selecting a page of a project changed the session")
+	}
+
+	app.ResetAppState()
+	if name := app.defaultFileName("fallback"); name != "fallback" {
+		t.Errorf("Default file name after a reset is %q", name)
+	}
+}
+
+// The working space of a project is restored with it and saved again
+func TestLoadProjectRestoresWorkingSpace(t *testing.T) {
+	app := NewApp()
+	for _, space := range []models.ColorSpace{models.LinearSpace, models.PerceptualSpace} {
+		filePath := saveTestProject(t, project.State{
+			Image:        newTestImage(4, 3),
+			Operations:   []project.OperationState{{Name: "boxblur", Params: operations.Parameters{"radius": 1.0}, IsEnabled: true}},
+			WorkingSpace: space,
+		})
+
+		result, err := app.loadProjectFile(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.WorkingSpace != space || app.GetWorkingSpace() != space {
+			t.Errorf("Working space of a %s project is %q, the app has %q", space, result.WorkingSpace, app.GetWorkingSpace())
+		}
+		if isLinear := app.imageLayerCollection.WorkingSpace == models.LinearSpace; isLinear != (space == models.LinearSpace) {
+			t.Errorf("Layers of a %s project work in %q", space, app.imageLayerCollection.WorkingSpace)
+		}
+
+		state, err := app.captureProject()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resaved, err := project.Load(saveTestProject(t, state))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (resaved.WorkingSpace == models.LinearSpace) != (space == models.LinearSpace) {
+			t.Errorf("%s project was saved again with %q", space, resaved.WorkingSpace)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"sync"
+	"testing"
+
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+	"tool7/image-processing/utils"
+)
+
+// App with a session on img, as if it had been opened
+func newTestApp(img models.Image) *App {
+	app := NewApp()
+	app.startSession(imageSource{image: img, pageCount: 1}, utils.NewImageLayerCollection(img))
+	return app
+}
+
+// Run with -race: the timeout is read by renders while the frontend may change it
+func TestSetProcessingTimeoutWhileRendering(t *testing.T) {
+	app := newTestApp(newTestImage(64, 64))
+	if err := app.AppendImageOperation(ImageOperation{Name: "boxblur", IsEnabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	var wait sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wait.Add(2)
+		go func() {
+			defer wait.Done()
+			// Renders are cancelled by the ones started after them, which is no failure here
+			app.ProcessImage(0)
+		}()
+		go func(seconds float64) {
+			defer wait.Done()
+			if err := app.SetProcessingTimeout(seconds); err != nil {
+				t.Error(err)
+			}
+		}(float64(i * 10))
+	}
+	wait.Wait()
+
+	if err := app.SetProcessingTimeout(-1); appErrorCode(err) != models.UnknownError {
+		t.Errorf("Negative timeout failed with %v", err)
+	}
+}
+
+// Blurring black and white stripes averages their light in linear space, which looks as bright
+// as the stripes from afar, while averaging sRGB values comes out too dark
+func TestWorkingSpaceOfBlur(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for i := 0; i < len(img.Pix); i += 4 {
+		if (i/4)%2 == 0 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2] = 255, 255, 255
+		}
+		img.Pix[i+3] = 255
+	}
+
+	app := newTestApp(img)
+	if err := app.AppendImageOperation(ImageOperation{Name: "boxblur", Params: operations.Parameters{"radius": 8.0}, IsEnabled: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Half the light of white is 188 in sRGB
+	tests := []struct {
+		space    models.ColorSpace
+		expected int
+	}{
+		{models.PerceptualSpace, 128},
+		{models.LinearSpace, 188},
+	}
+
+	for _, test := range tests {
+		if err := app.SetWorkingSpace(test.space); err != nil {
+			t.Fatal(err)
+		}
+		result, err := app.imageLayerCollection.ExecuteFullResolution(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isLinear := models.IsLinear(result); isLinear != (test.space == models.LinearSpace) {
+			t.Errorf("%s result is %T", test.space, result)
+		}
+
+		for x := 12; x < 20; x++ {
+			pixel := color.RGBAModel.Convert(result.At(x, 16)).(color.RGBA)
+			if d := int(pixel.R) - test.expected; d < -8 || d > 8 || pixel.G != pixel.R || pixel.A != 255 {
+				t.Errorf("%s blur is %v at %d, expected about %d", test.space, pixel, x, test.expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Package batch applies a chain of operations to many image files, writing one output per input.
+package batch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tool7/image-processing/export"
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+	"tool7/image-processing/project"
+	"tool7/image-processing/utils"
+)
+
+const (
+	DefaultNameTemplate = "{name}_edited.{ext}"
+	DefaultConcurrency  = 2
+	DefaultQuality      = 90
+)
+
+type Options struct {
+	Inputs          []string `json:"inputs"`
+	OutputDirectory string   `json:"outputDirectory"`
+	// File name of the outputs, where {name} is the input file name without its extension, {ext}
+	// the input extension without the dot, png for inputs that cannot be written, and {index} the
+	// position of the input starting at 1.
+	// The output format follows the resulting extension.
+	NameTemplate string `json:"nameTemplate"`
+	// Largest number of files processed at the same time
+	Concurrency int `json:"concurrency"`
+	// Quality of JPEG outputs, from 1 to 100
+	Quality int `json:"quality"`
+	// Longest time spent rendering each file, no limit when zero
+	Timeout time.Duration `json:"-"`
+	// Color space the layers work in, perceptual when empty
+	WorkingSpace models.ColorSpace `json:"-"`
+}
+
+// Reported whenever a file is done, whether it succeeded or not
+type Progress struct {
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	// Error message of a failed file, empty when the output was written
+	Error string `json:"error,omitempty"`
+}
+
+type Summary struct {
+	Total     int `json:"total"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	// Whether the batch was cancelled before all files were processed
+	Canceled bool `json:"canceled"`
+}
+
+type job struct {
+	input  string
+	output string
+}
+
+// Renders every input with the given operations and writes the outputs into the output directory.
+// Files fail independently of each other, and each one is reported to report once it is done,
+// from the goroutine that processed it. Cancelling ctx stops the renders in progress and skips
+// the files not started yet.
+func Run(ctx context.Context, steps []project.OperationState, options Options, report func(Progress)) (Summary, error) {
+	if _, skipped := project.NewImageLayers(steps); len(skipped) > 0 {
+		return Summary{}, fmt.Errorf("Operation %d (%s): %s", skipped[0].Index+1, skipped[0].Name, skipped[0].Reason)
+	}
+
+	quality := options.Quality
+	if quality == 0 {
+		quality = DefaultQuality
+	}
+	if quality < 1 || quality > 100 {
+		return Summary{}, fmt.Errorf("JPEG quality has to be between 1 and 100")
+	}
+
+	jobs, err := plan(options)
+	if err != nil {
+		return Summary{}, err
+	}
+	if err := os.MkdirAll(options.OutputDirectory, 0755); err != nil {
+		return Summary{}, err
+	}
+
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	summary := Summary{Total: len(jobs)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	pending := make(chan job)
+
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range pending {
+				err := ProcessFile(ctx, job.input, job.output, steps, options.WorkingSpace, quality, options.Timeout)
+				if err != nil && ctx.Err() != nil {
+					// Files interrupted by cancelling are neither done nor failed
+					continue
+				}
+
+				mutex.Lock()
+				progress := Progress{Total: summary.Total, Input: job.input, Output: job.output}
+				if err != nil {
+					summary.Failed++
+					progress.Output = ""
+					progress.Error = err.Error()
+				} else {
+					summary.Succeeded++
+				}
+				progress.Done = summary.Succeeded + summary.Failed
+				report(progress)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case pending <- job:
+		case <-ctx.Done():
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	summary.Canceled = ctx.Err() != nil
+	return summary, nil
+}
+
+// Returns the files in the directory that can be processed, ordered by name. Subdirectories are
+// not searched.
+func CollectInputs(directory string) ([]string, error) {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []string
+	for _, entry := range entries {
+		if entry.IsDir() || !utils.IsSupportedImageFile(entry.Name()) {
+			continue
+		}
+		inputs = append(inputs, filepath.Join(directory, entry.Name()))
+	}
+
+	sort.Strings(inputs)
+	return inputs, nil
+}
+
+// Resolves the output of every input, failing before anything is written when two inputs would
+// be written to the same file or an output would overwrite an input
+func plan(options Options) ([]job, error) {
+	if len(options.Inputs) == 0 {
+		return nil, fmt.Errorf("No files to process")
+	}
+	if options.OutputDirectory == "" {
+		return nil, fmt.Errorf("No output directory")
+	}
+
+	template := options.NameTemplate
+	if template == "" {
+		template = DefaultNameTemplate
+	}
+
+	inputs := map[string]bool{}
+	for _, input := range options.Inputs {
+		inputs[absolutePath(input)] = true
+	}
+
+	jobs := make([]job, 0, len(options.Inputs))
+	outputs := map[string]string{}
+
+	for index, input := range options.Inputs {
+		name, err := OutputName(template, input, index)
+		if err != nil {
+			return nil, err
+		}
+
+		output := filepath.Join(options.OutputDirectory, name)
+		key := absolutePath(output)
+		if inputs[key] {
+			return nil, fmt.Errorf("Output %q would overwrite an input", output)
+		}
+		if previous, ok := outputs[key]; ok {
+			return nil, fmt.Errorf("Inputs %q and %q would both be written to %q", previous, input, output)
+		}
+		outputs[key] = input
+
+		jobs = append(jobs, job{input: input, output: output})
+	}
+
+	return jobs, nil
+}
+
+// Expands the name template for the input at the given position, see Options.NameTemplate
+func OutputName(template, input string, index int) (string, error) {
+	extension := filepath.Ext(input)
+	name := strings.TrimSuffix(filepath.Base(input), extension)
+
+	// Inputs in formats that cannot be written, such as WebP, become PNG files
+	outputExtension := strings.TrimPrefix(extension, ".")
+	if export.FormatFromExtension(extension) == "" {
+		outputExtension = "png"
+	}
+
+	expanded := strings.NewReplacer(
+		"{name}", name,
+		"{ext}", outputExtension,
+		"{index}", fmt.Sprint(index+1),
+	).Replace(template)
+
+	if strings.ContainsAny(expanded, "{}") {
+		return "", fmt.Errorf("Unknown placeholder in name template %q", template)
+	}
+	if strings.ContainsAny(expanded, `/\`) || expanded == "" {
+		return "", fmt.Errorf("Name template %q does not make a file name", template)
+	}
+	if export.FormatFromExtension(filepath.Ext(expanded)) == "" {
+		return "", fmt.Errorf("Unsupported output format of %q, use png, jpg, gif, bmp or tif", expanded)
+	}
+	return expanded, nil
+}
+
+func absolutePath(path string) string {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return absolute
+}
+
+// Renders a single file with the layers working in workingSpace and writes the result, whose
+// format follows the output extension
+func ProcessFile(ctx context.Context, input, output string, steps []project.OperationState, workingSpace models.ColorSpace, quality int, timeout time.Duration) error {
+	img, _, err := metadata.LoadImage(input)
+	if err != nil {
+		return err
+	}
+
+	// Every file is rendered once, so its layers are not cached
+	collection, _ := project.BuildCollection(img, steps)
+	collection.Cache = nil
+	collection.WorkingSpace = workingSpace
+
+	result := img
+	if collection.Size > 0 {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		result, err = collection.ExecuteFullResolution(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	options := export.Options{Format: export.FormatFromExtension(filepath.Ext(output)), Quality: quality}
+	return export.WriteFile(output, result, options)
+}
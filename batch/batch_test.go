@@ -0,0 +1,201 @@
+package batch
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tool7/image-processing/project"
+)
+
+func TestOutputName(t *testing.T) {
+	tests := []struct {
+		template, input string
+		index           int
+		expected        string
+	}{
+		{DefaultNameTemplate, "photos/beach.jpg", 0, "beach_edited.jpg"},
+		{"{index}-{name}.{ext}", "beach.JPEG", 11, "12-beach.JPEG"},
+		{"{name}.tif", "scans/page.png", 0, "page.tif"},
+		// Formats that cannot be written become PNG files
+		{DefaultNameTemplate, "photo.webp", 0, "photo_edited.png"},
+		{"{name}.{ext}", "archive.tar.gz", 0, "archive.tar.png"},
+	}
+
+	for _, test := range tests {
+		name, err := OutputName(test.template, test.input, test.index)
+		if err != nil {
+			t.Errorf("%q for %q failed: %v", test.template, test.input, err)
+		} else if name != test.expected {
+			t.Errorf("%q for %q is %q, expected %q", test.template, test.input, name, test.expected)
+		}
+	}
+}
+
+func TestOutputNameErrors(t *testing.T) {
+	for _, template := range []string{
+		"{name}_{date}.{ext}",
+		"{name.{ext}",
+		"edited/{name}.{ext}",
+		`edited\{name}.{ext}`,
+		"{name}.webp",
+		"{name}",
+		"",
+	} {
+		if name, err := OutputName(template, "beach.jpg", 0); err == nil {
+			t.Errorf("%q was accepted and gave %q", template, name)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	jobs, err := plan(Options{
+		Inputs:          []string{"in/a.jpg", "in/b.webp"},
+		OutputDirectory: "out",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []job{
+		{input: "in/a.jpg", output: filepath.Join("out", "a_edited.jpg")},
+		{input: "in/b.webp", output: filepath.Join("out", "b_edited.png")},
+	}
+	if !reflect.DeepEqual(jobs, expected) {
+		t.Errorf("Jobs are %+v, expected %+v", jobs, expected)
+	}
+}
+
+func TestPlanErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		message string
+	}{
+		{"no inputs", Options{OutputDirectory: "out"}, "No files to process"},
+		{"no output directory", Options{Inputs: []string{"a.jpg"}}, "No output directory"},
+		{
+			"same name in two directories",
+			Options{Inputs: []string{"one/a.jpg", "two/a.jpg"}, OutputDirectory: "out"},
+			"would both be written to",
+		},
+		{
+			"same name in two formats that become PNG",
+			Options{Inputs: []string{"a.png", "a.webp"}, OutputDirectory: "out", NameTemplate: "{name}.{ext}"},
+			"would both be written to",
+		},
+		{
+			"output over input",
+			Options{Inputs: []string{"in/a.jpg"}, OutputDirectory: "in", NameTemplate: "{name}.{ext}"},
+			"would overwrite an input",
+		},
+		{
+			"output over another input",
+			Options{Inputs: []string{"a.jpg", "a_edited.jpg"}, OutputDirectory: "."},
+			"would overwrite an input",
+		},
+		{"invalid template", Options{Inputs: []string{"a.jpg"}, OutputDirectory: "out", NameTemplate: "{nme}"}, "Unknown placeholder"},
+	}
+
+	for _, test := range tests {
+		_, err := plan(test.options)
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Plan with %s gave %v, expected %q", test.name, err, test.message)
+		}
+	}
+
+	// The index keeps the names apart
+	if _, err := plan(Options{Inputs: []string{"one/a.jpg", "two/a.jpg"}, OutputDirectory: "out", NameTemplate: "{index}_{name}.{ext}"}); err != nil {
+		t.Errorf("Indexed names collided: %v", err)
+	}
+}
+
+func writeTestImage(t *testing.T, filePath string) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Files fail on their own, without stopping the others
+func TestRun(t *testing.T) {
+	directory := t.TempDir()
+	good := filepath.Join(directory, "good.png")
+	broken := filepath.Join(directory, "broken.png")
+	writeTestImage(t, good)
+	os.WriteFile(broken, []byte("not an image"), 0644)
+	outputDirectory := filepath.Join(directory, "out")
+
+	var reports []Progress
+	steps := []project.OperationState{{Name: "negative", IsEnabled: true}}
+	summary, err := Run(context.Background(), steps, Options{Inputs: []string{good, broken}, OutputDirectory: outputDirectory, Concurrency: 1}, func(progress Progress) {
+		reports = append(reports, progress)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := (Summary{Total: 2, Succeeded: 1, Failed: 1}); summary != expected {
+		t.Errorf("Summary is %+v, expected %+v", summary, expected)
+	}
+	if len(reports) != 2 || reports[1].Done != 2 {
+		t.Fatalf("Reports are %+v", reports)
+	}
+	for _, report := range reports {
+		if (report.Error == "") != (report.Input == good) {
+			t.Errorf("Report is %+v", report)
+		}
+	}
+
+	f, err := os.Open(filepath.Join(outputDirectory, "good_edited.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	output, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := color.RGBAModel.Convert(output.At(0, 0)).(color.RGBA); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("Output pixel is %v", c)
+	}
+}
+
+func TestRunRejectsUnknownOperations(t *testing.T) {
+	steps := []project.OperationState{{Name: "negative", IsEnabled: true}, {Name: "unknown", IsEnabled: true}}
+	if _, err := Run(context.Background(), steps, Options{Inputs: []string{"a.png"}, OutputDirectory: t.TempDir()}, func(Progress) {}); err == nil {
+		t.Error("Batch with an unknown operation ran")
+	}
+}
+
+func TestCollectInputs(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"b.png", "a.JPG", "notes.txt"} {
+		os.WriteFile(filepath.Join(directory, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(directory, "c.png"), 0755)
+
+	inputs, err := CollectInputs(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(directory, "a.JPG"), filepath.Join(directory, "b.png")}
+	if !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("Inputs are %v, expected %v", inputs, expected)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"tool7/image-processing/operations"
+	"tool7/image-processing/project"
+)
+
+// Parses an inline operation chain such as "brightness=1.2,boxblur=2,tint=color:#ff8800;intensity:0.3".
+// A bare value is assigned to the first parameter of the operation, while "param:value" pairs
+// separated by ";" set parameters by name.
+func parseChain(chain string) ([]project.OperationState, error) {
+	var steps []project.OperationState
+
+	for _, item := range strings.Split(chain, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		definition, ok := operations.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown operation %q", name)
+		}
+
+		params := operations.Parameters{}
+		if hasValue {
+			if err := parseChainParams(definition, value, params); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		if _, err := definition.Validate(params); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		steps = append(steps, project.OperationState{Name: name, Params: params, IsEnabled: true})
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("Operation chain is empty")
+	}
+
+	return steps, nil
+}
+
+func parseChainParams(definition operations.Definition, value string, params operations.Parameters) error {
+	if !strings.Contains(value, ":") {
+		if len(definition.Parameters) == 0 {
+			return fmt.Errorf("operation takes no parameters")
+		}
+
+		spec := definition.Parameters[0]
+		parsed, err := parseChainValue(spec, value)
+		if err != nil {
+			return err
+		}
+		params[spec.Name] = parsed
+		return nil
+	}
+
+	for _, pair := range strings.Split(value, ";") {
+		paramName, paramValue, ok := strings.Cut(pair, ":")
+		if !ok {
+			return fmt.Errorf("expected param:value, got %q", pair)
+		}
+
+		spec, ok := findParameter(definition, strings.TrimSpace(paramName))
+		if !ok {
+			return fmt.Errorf("unknown parameter %q", paramName)
+		}
+
+		parsed, err := parseChainValue(spec, paramValue)
+		if err != nil {
+			return err
+		}
+		params[spec.Name] = parsed
+	}
+
+	return nil
+}
+
+func findParameter(definition operations.Definition, name string) (operations.ParameterSpec, bool) {
+	for _, spec := range definition.Parameters {
+		if strings.EqualFold(spec.Name, name) {
+			return spec, true
+		}
+	}
+	return operations.ParameterSpec{}, false
+}
+
+func parseChainValue(spec operations.ParameterSpec, value string) (interface{}, error) {
+	value = strings.TrimSpace(value)
+
+	if spec.Kind == operations.ColorParameter {
+		raw, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+		if err != nil || len(raw) != 3 {
+			return nil, fmt.Errorf("parameter %q expects a color like #ff8800", spec.Name)
+		}
+		return operations.Color{R: raw[0], G: raw[1], B: raw[2]}, nil
+	}
+	if spec.Kind == operations.BooleanParameter {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q expects true or false, got %q", spec.Name, value)
+		}
+		return parsed, nil
+	}
+
+	// ParseFloat also accepts "NaN" and "Inf", which no parameter can take
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return nil, fmt.Errorf("parameter %q expects a number, got %q", spec.Name, value)
+	}
+	return number, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"tool7/image-processing/operations"
+	"tool7/image-processing/project"
+)
+
+func TestParseChain(t *testing.T) {
+	tests := []struct {
+		chain    string
+		expected []project.OperationState
+	}{
+		{"greyscale", []project.OperationState{
+			{Name: "greyscale", Params: operations.Parameters{}, IsEnabled: true},
+		}},
+		{" Brightness=1.3 , boxblur=2,", []project.OperationState{
+			{Name: "brightness", Params: operations.Parameters{"level": 1.3}, IsEnabled: true},
+			{Name: "boxblur", Params: operations.Parameters{"radius": 2.0}, IsEnabled: true},
+		}},
+		{"tint=color:#ff8800;Intensity:0.3", []project.OperationState{
+			{Name: "tint", Params: operations.Parameters{"color": operations.Color{R: 255, G: 136}, "intensity": 0.3}, IsEnabled: true},
+		}},
+		{"boxblur=radius:1.5;processAlpha:true", []project.OperationState{
+			{Name: "boxblur", Params: operations.Parameters{"radius": 1.5, "processAlpha": true}, IsEnabled: true},
+		}},
+	}
+
+	for _, test := range tests {
+		steps, err := parseChain(test.chain)
+		if err != nil {
+			t.Errorf("%q failed: %v", test.chain, err)
+		} else if !reflect.DeepEqual(steps, test.expected) {
+			t.Errorf("%q is %+v, expected %+v", test.chain, steps, test.expected)
+		}
+	}
+}
+
+func TestParseChainErrors(t *testing.T) {
+	chains := []string{
+		"",
+		" , ",
+		"vignette=2",
+		"greyscale=1",
+		"brightness=bright",
+		"brightness=5",
+		"brightness=NaN",
+		"boxblur=NaN",
+		"boxblur=Inf",
+		"contrast=-Inf",
+		"tint=color",
+		"tint=colour:#ff8800",
+		"tint=color:orange",
+		"tint=color:#ff88",
+		"boxblur=radius:1;processAlpha:maybe",
+	}
+
+	for _, chain := range chains {
+		if steps, err := parseChain(chain); err == nil {
+			t.Errorf("%q was accepted as %+v", chain, steps)
+		}
+	}
+}
+
+func TestParseChainValue(t *testing.T) {
+	number := operations.ParameterSpec{Name: "level", Kind: operations.NumberParameter}
+	color := operations.ParameterSpec{Name: "color", Kind: operations.ColorParameter}
+	boolean := operations.ParameterSpec{Name: "processAlpha", Kind: operations.BooleanParameter}
+
+	tests := []struct {
+		spec     operations.ParameterSpec
+		value    string
+		expected interface{}
+	}{
+		{number, "1.25", 1.25},
+		{number, " -3 ", -3.0},
+		{number, "1e2", 100.0},
+		{number, "NaN", nil},
+		{number, "nan", nil},
+		{number, "Inf", nil},
+		{number, "-Infinity", nil},
+		{number, "1,5", nil},
+		{color, "#FF8800", operations.Color{R: 255, G: 136}},
+		{color, "0080ff", operations.Color{G: 128, B: 255}},
+		{color, "#f80", nil},
+		{boolean, "true", true},
+		{boolean, "0", false},
+		{boolean, "yes", nil},
+	}
+
+	for _, test := range tests {
+		value, err := parseChainValue(test.spec, test.value)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%s %q was accepted as %v", test.spec.Name, test.value, value)
+			}
+		} else if err != nil {
+			t.Errorf("%s %q failed: %v", test.spec.Name, test.value, err)
+		} else if value != test.expected {
+			t.Errorf("%s %q is %v, expected %v", test.spec.Name, test.value, value, test.expected)
+		}
+	}
+}
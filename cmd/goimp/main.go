@@ -0,0 +1,389 @@
+// Command goimp renders .goimp projects or inline operation chains without the desktop app.
+//
+// Usage:
+//
+//	goimp -chain "brightness=1.2,boxblur=2" -out result.png photo.jpg
+//	goimp -project edit.goimp -out edited/ photos/
+//	goimp -project edit.goimp -out result.png
+//	goimp -preset "Punchy" -out edited/ photos/
+//	goimp -preset "Punchy" -watch incoming/ -out edited/ -processed done/
+//
+// When no input is given, the image embedded in the project is rendered.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"tool7/image-processing/export"
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+	"tool7/image-processing/preset"
+	"tool7/image-processing/project"
+	"tool7/image-processing/utils"
+	"tool7/image-processing/watch"
+)
+
+const (
+	exitOK = iota
+	exitFailures
+	exitUsage
+)
+
+type options struct {
+	output       string
+	format       export.Format
+	quality      int
+	timeout      time.Duration
+	workingSpace models.ColorSpace
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	flags := flag.NewFlagSet("goimp", flag.ContinueOnError)
+	chain := flags.String("chain", "", "inline operation chain, e.g. \"brightness=1.2,boxblur=2\"")
+	projectPath := flags.String("project", "", "path to a .goimp project file")
+	presetName := flags.String("preset", "", "name of a saved preset, or path to a .gopreset file")
+	output := flags.String("out", "", "output file, or directory when processing several inputs")
+	format := flags.String("format", "", "output format: png, jpeg, gif, bmp or tiff (default: from output or input extension)")
+	quality := flags.Int("quality", 90, "JPEG quality (1-100)")
+	timeout := flags.Duration("timeout", 0, "longest time to spend rendering each image, e.g. 30s (default: no limit)")
+	linear := flags.Bool("linear", false, "run the layers in linear light (default: as saved in the -project file)")
+	list := flags.Bool("list", false, "list available operations and exit")
+	watchDirectory := flags.String("watch", "", "directory whose arriving images are processed until interrupted")
+	processedDirectory := flags.String("processed", "", "where -watch moves processed originals (default: \"processed\" in the watched directory)")
+
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if *list {
+		printOperations()
+		return exitOK
+	}
+
+	sources := 0
+	for _, source := range []string{*chain, *projectPath, *presetName} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		fmt.Fprintln(os.Stderr, "goimp: exactly one of -chain, -project or -preset is required")
+		flags.Usage()
+		return exitUsage
+	}
+	if *output == "" {
+		fmt.Fprintln(os.Stderr, "goimp: -out is required")
+		return exitUsage
+	}
+	var outputFormat export.Format
+	if *format != "" {
+		outputFormat = export.FormatFromExtension("." + *format)
+		if outputFormat == "" {
+			fmt.Fprintf(os.Stderr, "goimp: unsupported format %q\n", *format)
+			return exitUsage
+		}
+	}
+
+	var steps []project.OperationState
+	var projectImage models.Image
+	var workingSpace models.ColorSpace
+	var err error
+
+	switch {
+	case *chain != "":
+		steps, err = parseChain(*chain)
+	case *presetName != "":
+		steps, err = loadPreset(*presetName)
+	default:
+		steps, projectImage, workingSpace, err = loadProject(*projectPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+		return exitUsage
+	}
+
+	if *linear {
+		workingSpace = models.LinearSpace
+	}
+
+	opts := options{output: *output, format: outputFormat, quality: *quality, timeout: *timeout, workingSpace: workingSpace}
+
+	if *watchDirectory != "" {
+		if flags.NArg() > 0 {
+			fmt.Fprintln(os.Stderr, "goimp: -watch takes no input images")
+			return exitUsage
+		}
+		return watchDirectoryUntilInterrupted(*watchDirectory, *processedDirectory, steps, opts)
+	}
+
+	if flags.NArg() == 0 {
+		if projectImage == nil {
+			fmt.Fprintln(os.Stderr, "goimp: no input images given")
+			return exitUsage
+		}
+		if err := renderImage(projectImage, steps, opts.output, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+			return exitFailures
+		}
+		return exitOK
+	}
+
+	inputs, err := collectInputs(flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+		return exitUsage
+	}
+
+	outputIsDirectory := len(inputs) > 1 || isDirectory(opts.output) || strings.HasSuffix(opts.output, string(os.PathSeparator))
+
+	outputPaths, err := planOutputs(inputs, opts, outputIsDirectory)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+		return exitUsage
+	}
+
+	if outputIsDirectory {
+		if err := os.MkdirAll(opts.output, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+			return exitFailures
+		}
+	}
+
+	failures := 0
+	for i, input := range inputs {
+		outputPath := outputPaths[i]
+
+		if err := processFile(input, outputPath, steps, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "goimp: %s: %v\n", input, err)
+			failures++
+			continue
+		}
+		fmt.Printf("%s -> %s\n", input, outputPath)
+	}
+
+	if failures > 0 {
+		fmt.Fprintf(os.Stderr, "goimp: %d of %d images failed\n", failures, len(inputs))
+		return exitFailures
+	}
+	return exitOK
+}
+
+func printOperations() {
+	for _, definition := range operations.List() {
+		names := make([]string, 0, len(definition.Parameters))
+		for _, spec := range definition.Parameters {
+			names = append(names, spec.Name)
+		}
+		fmt.Printf("%-16s %s\n", definition.Name, strings.Join(names, ", "))
+	}
+}
+
+// Processes the images arriving in the directory until the command is interrupted
+func watchDirectoryUntilInterrupted(directory, processedDirectory string, steps []project.OperationState, opts options) int {
+	if processedDirectory == "" {
+		processedDirectory = filepath.Join(directory, "processed")
+	}
+
+	// Outputs keep the name of their input, like when processing a directory
+	nameTemplate := "{name}.{ext}"
+	if opts.format != "" {
+		nameTemplate = "{name}" + opts.format.Extension()
+	}
+
+	watcher, err := watch.New(steps, watch.Options{
+		InputDirectory:     directory,
+		OutputDirectory:    opts.output,
+		ProcessedDirectory: processedDirectory,
+		NameTemplate:       nameTemplate,
+		Quality:            opts.quality,
+		Timeout:            opts.timeout,
+		WorkingSpace:       opts.workingSpace,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Watching %s, press Ctrl+C to stop\n", directory)
+	err = watcher.Run(ctx, func(event watch.Event) {
+		if event.Error != "" {
+			fmt.Fprintf(os.Stderr, "goimp: %s: %s\n", event.Input, event.Error)
+			return
+		}
+		fmt.Printf("%s -> %s\n", event.Input, event.Output)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goimp: %v\n", err)
+		return exitFailures
+	}
+	return exitOK
+}
+
+// Output path of every input. Inputs from different directories can share a name, and would
+// overwrite each other's output, so that is an error.
+func planOutputs(inputs []string, opts options, outputIsDirectory bool) ([]string, error) {
+	outputPaths := make([]string, len(inputs))
+	inputsByOutput := map[string]string{}
+
+	for i, input := range inputs {
+		outputPath := opts.output
+		if outputIsDirectory {
+			outputPath = filepath.Join(opts.output, outputFileName(input, opts.format))
+		}
+		if other, ok := inputsByOutput[outputPath]; ok {
+			return nil, fmt.Errorf("%s and %s would both be written to %s", other, input, outputPath)
+		}
+		inputsByOutput[outputPath] = input
+		outputPaths[i] = outputPath
+	}
+	return outputPaths, nil
+}
+
+// Expands directories into the supported image files they directly contain
+func collectInputs(args []string) ([]string, error) {
+	var inputs []string
+
+	for _, arg := range args {
+		if !isDirectory(arg) {
+			inputs = append(inputs, arg)
+			continue
+		}
+
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !utils.IsSupportedImageFile(entry.Name()) {
+				continue
+			}
+			inputs = append(inputs, filepath.Join(arg, entry.Name()))
+		}
+	}
+
+	if len(inputs) == 0 {
+		return nil, errors.New("no supported images found in input")
+	}
+	return inputs, nil
+}
+
+func processFile(inputPath, outputPath string, steps []project.OperationState, opts options) error {
+	img, _, err := metadata.LoadImage(inputPath)
+	if err != nil {
+		return err
+	}
+
+	return renderImage(img, steps, outputPath, opts)
+}
+
+func renderImage(img models.Image, steps []project.OperationState, outputPath string, opts options) error {
+	collection, skipped := project.BuildCollection(img, steps)
+	if len(skipped) > 0 {
+		return fmt.Errorf("Operation %d (%s): %s", skipped[0].Index+1, skipped[0].Name, skipped[0].Reason)
+	}
+	collection.WorkingSpace = opts.workingSpace
+
+	var err error
+	result := img
+	if collection.Size > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		if opts.timeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), opts.timeout)
+		}
+		defer cancel()
+
+		result, err = collection.ExecuteFullResolution(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	format := opts.format
+	if format == "" {
+		format = export.FormatFromExtension(filepath.Ext(outputPath))
+	}
+	if format == "" {
+		format = export.PNG
+	}
+
+	return export.WriteFile(outputPath, result, export.Options{Format: format, Quality: opts.quality})
+}
+
+// Loads the operations of a project together with its image and working space
+func loadProject(filePath string) ([]project.OperationState, models.Image, models.ColorSpace, error) {
+	state, err := project.Load(filePath)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	for index, operation := range state.Operations {
+		if _, err := project.NewImageLayer(operation); err != nil {
+			return nil, nil, "", fmt.Errorf("Operation %d (%s): %w", index+1, operation.Name, err)
+		}
+	}
+
+	return state.Operations, state.Image, state.WorkingSpace, nil
+}
+
+// Loads the operations of a preset file, or of the saved preset with the given name
+func loadPreset(nameOrPath string) ([]project.OperationState, error) {
+	var loadedPreset *preset.Preset
+	var err error
+
+	if filepath.Ext(nameOrPath) == preset.FileExtension {
+		loadedPreset, err = preset.ReadFile(nameOrPath)
+	} else {
+		var store *preset.Store
+		store, err = preset.DefaultStore()
+		if err == nil {
+			loadedPreset, err = store.Load(nameOrPath)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for index, operation := range loadedPreset.Operations {
+		if _, err := project.NewImageLayer(operation); err != nil {
+			return nil, fmt.Errorf("Operation %d (%s): %w", index+1, operation.Name, err)
+		}
+	}
+
+	return loadedPreset.Operations, nil
+}
+
+func outputFileName(inputPath string, format export.Format) string {
+	extension := filepath.Ext(inputPath)
+	name := strings.TrimSuffix(filepath.Base(inputPath), extension)
+
+	// Inputs in formats that cannot be written, such as WebP, become PNG files
+	if format == "" && export.FormatFromExtension(extension) == "" {
+		format = export.PNG
+	}
+	if format != "" {
+		extension = format.Extension()
+	}
+	return name + extension
+}
+
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tool7/image-processing/export"
+)
+
+func writeTestImage(t *testing.T, path string) {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 5)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutputFileName(t *testing.T) {
+	tests := []struct {
+		input    string
+		format   export.Format
+		expected string
+	}{
+		{"photos/beach.jpg", "", "beach.jpg"},
+		{"beach.JPEG", "", "beach.JPEG"},
+		{"beach.jpg", export.PNG, "beach.png"},
+		{"scan.png", export.TIFF, "scan.tif"},
+		{"scan.png", export.JPEG, "scan.jpg"},
+		// Formats that cannot be written become PNG files unless another format is chosen
+		{"photo.webp", "", "photo.png"},
+		{"photo.webp", export.BMP, "photo.bmp"},
+		{"archive.tar.gz", "", "archive.tar.png"},
+	}
+
+	for _, test := range tests {
+		if name := outputFileName(test.input, test.format); name != test.expected {
+			t.Errorf("%q as %q is %q, expected %q", test.input, test.format, name, test.expected)
+		}
+	}
+}
+
+func TestPlanOutputs(t *testing.T) {
+	tests := []struct {
+		inputs            []string
+		opts              options
+		outputIsDirectory bool
+		expected          []string
+	}{
+		{[]string{"a.png"}, options{output: "result.jpg"}, false, []string{"result.jpg"}},
+		{[]string{"in/a.png", "in/b.webp"}, options{output: "out"}, true,
+			[]string{filepath.Join("out", "a.png"), filepath.Join("out", "b.png")}},
+		{[]string{"in/a.png", "in/b.jpg"}, options{output: "out", format: export.TIFF}, true,
+			[]string{filepath.Join("out", "a.tif"), filepath.Join("out", "b.tif")}},
+		// Same names in different formats stay apart until a format is forced
+		{[]string{"in/a.png", "in/a.jpg"}, options{output: "out"}, true,
+			[]string{filepath.Join("out", "a.png"), filepath.Join("out", "a.jpg")}},
+		{[]string{"in/a.png", "in/a.jpg"}, options{output: "out", format: export.PNG}, true, nil},
+		{[]string{"one/a.png", "two/a.png"}, options{output: "out"}, true, nil},
+		{[]string{"a.webp", "a.png"}, options{output: "out"}, true, nil},
+	}
+
+	for _, test := range tests {
+		outputs, err := planOutputs(test.inputs, test.opts, test.outputIsDirectory)
+		if test.expected == nil {
+			if err == nil {
+				t.Errorf("%v was planned as %v", test.inputs, outputs)
+			}
+		} else if err != nil {
+			t.Errorf("%v failed: %v", test.inputs, err)
+		} else if !reflect.DeepEqual(outputs, test.expected) {
+			t.Errorf("%v is planned as %v, expected %v", test.inputs, outputs, test.expected)
+		}
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	directory := t.TempDir()
+	input := filepath.Join(directory, "photo.png")
+	writeTestImage(t, input)
+
+	otherDirectory := filepath.Join(directory, "other")
+	if err := os.Mkdir(otherDirectory, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestImage(t, filepath.Join(otherDirectory, "photo.png"))
+
+	output := filepath.Join(directory, "out")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"list", []string{"-list"}, exitOK},
+		{"unknown flag", []string{"-sharpness", "2"}, exitUsage},
+		{"no source", []string{"-out", output, input}, exitUsage},
+		{"two sources", []string{"-chain", "greyscale", "-preset", "Punchy", "-out", output, input}, exitUsage},
+		{"no output", []string{"-chain", "greyscale", input}, exitUsage},
+		{"unsupported format", []string{"-chain", "greyscale", "-format", "webp", "-out", output, input}, exitUsage},
+		{"invalid chain", []string{"-chain", "brightness=NaN", "-out", output, input}, exitUsage},
+		{"value out of range", []string{"-chain", "boxblur=0", "-out", output, input}, exitUsage},
+		{"no inputs", []string{"-chain", "greyscale", "-out", output}, exitUsage},
+		{"same output name", []string{"-chain", "greyscale", "-out", output, input, filepath.Join(otherDirectory, "photo.png")}, exitUsage},
+		{"missing input", []string{"-chain", "greyscale", "-out", filepath.Join(output, "missing.png"), filepath.Join(directory, "missing.png")}, exitFailures},
+		{"watch with inputs", []string{"-chain", "greyscale", "-watch", directory, "-out", output, input}, exitUsage},
+		{"single file", []string{"-chain", "brightness=1.3,boxblur=1", "-out", filepath.Join(directory, "result.jpg"), input}, exitOK},
+		{"directory", []string{"-chain", "greyscale", "-format", "tiff", "-out", output + string(os.PathSeparator), otherDirectory}, exitOK},
+	}
+
+	for _, test := range tests {
+		if code := run(test.args); code != test.expected {
+			t.Errorf("%s exited with %d, expected %d", test.name, code, test.expected)
+		}
+	}
+
+	for _, path := range []string{filepath.Join(directory, "result.jpg"), filepath.Join(output, "photo.tif")} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Output was not written: %v", err)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Package export encodes rendered images into the file formats they can be exported to.
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"tool7/image-processing/animation"
+	"tool7/image-processing/export/jpeg"
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+	"tool7/image-processing/utils"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+type Format string
+
+const (
+	PNG  Format = "png"
+	JPEG Format = "jpeg"
+	GIF  Format = "gif"
+	BMP  Format = "bmp"
+	TIFF Format = "tiff"
+)
+
+// Whether metadata.Write can add metadata to files of the format
+func (this Format) HasMetadata() bool {
+	return this == PNG || this == JPEG
+}
+
+// Extension of files in the format, including the dot
+func (this Format) Extension() string {
+	switch this {
+	case JPEG:
+		return ".jpg"
+	case GIF:
+		return ".gif"
+	case BMP:
+		return ".bmp"
+	case TIFF:
+		return ".tif"
+	}
+	return ".png"
+}
+
+// Returns the format of files with the extension, or an empty format if it cannot be exported
+func FormatFromExtension(extension string) Format {
+	switch strings.ToLower(extension) {
+	case ".png":
+		return PNG
+	case ".jpg", ".jpeg":
+		return JPEG
+	case ".gif":
+		return GIF
+	case ".bmp":
+		return BMP
+	case ".tif", ".tiff":
+		return TIFF
+	}
+	return ""
+}
+
+// How hard PNG encoding tries to make the file small. TIFF files are compressed with Deflate
+// unless CompressionNone is chosen.
+type Compression string
+
+const (
+	CompressionDefault Compression = "default"
+	CompressionNone    Compression = "none"
+	CompressionFast    Compression = "fast"
+	CompressionBest    Compression = "best"
+)
+
+// How much less often JPEG samples colors than brightness
+type ChromaSubsampling string
+
+const (
+	Subsampling444 ChromaSubsampling = "4:4:4"
+	Subsampling422 ChromaSubsampling = "4:2:2"
+	Subsampling420 ChromaSubsampling = "4:2:0"
+)
+
+const DefaultQuality = 90
+
+type Options struct {
+	Format Format
+	// PNG and TIFF only, CompressionDefault when empty
+	Compression Compression
+	// JPEG only, from 1 to 100, DefaultQuality when zero
+	Quality int
+	// JPEG only, Subsampling420 when empty
+	ChromaSubsampling ChromaSubsampling
+	// PNG and TIFF only, 8 or 16 bits per channel. Zero keeps the depth of the image, with 16
+	// bits for linear images, other formats always have 8 bits.
+	BitDepth int
+	// Written into the formats that have metadata, see Format.HasMetadata
+	Metadata metadata.Metadata
+}
+
+// Fails when the options cannot be used to encode an image
+func (this Options) Validate() error {
+	switch this.Format {
+	case PNG, JPEG, GIF, BMP, TIFF:
+	default:
+		return fmt.Errorf("Unsupported export format %q", this.Format)
+	}
+	if _, err := pngCompression(this.Compression); err != nil {
+		return err
+	}
+	if this.Quality < 0 || this.Quality > 100 {
+		return fmt.Errorf("JPEG quality has to be between 1 and 100")
+	}
+	switch this.BitDepth {
+	case 0, 8:
+	case 16:
+		if this.Format != PNG && this.Format != TIFF {
+			return fmt.Errorf("Only PNG and TIFF support 16 bits per channel")
+		}
+	default:
+		return fmt.Errorf("Bit depth has to be 8 or 16, got %d", this.BitDepth)
+	}
+	_, err := jpegSubsampling(this.ChromaSubsampling)
+	return err
+}
+
+// Bits per channel img is written with
+func (this Options) bitDepth(img image.Image) int {
+	if this.Format != PNG && this.Format != TIFF {
+		return 8
+	}
+	if this.BitDepth != 0 {
+		return this.BitDepth
+	}
+	switch img.(type) {
+	case *image.RGBA64, *models.LinearImage:
+		return 16
+	}
+	return 8
+}
+
+// Writes img to w in the format and with the settings of the options. GIF uses a palette of 256
+// colors picked for the image, see MedianCutQuantizer.
+func Encode(w io.Writer, img image.Image, options Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	if options.Format.HasMetadata() && !options.Metadata.IsEmpty() {
+		var buffer bytes.Buffer
+		if err := encode(&buffer, img, options); err != nil {
+			return err
+		}
+		_, err := w.Write(metadata.Write(buffer.Bytes(), options.Metadata))
+		return err
+	}
+
+	return encode(w, img, options)
+}
+
+func encode(w io.Writer, img image.Image, options Options) error {
+	// Linear images are only converted to sRGB here, at the depth they are written with
+	if linear, ok := img.(*models.LinearImage); ok {
+		if options.bitDepth(img) == 16 {
+			img = linear.ToRGBA64()
+		} else {
+			img = linear.ToRGBA()
+		}
+	}
+
+	// The encoders write *image.RGBA64 with 16 bits per channel where the format has them
+	rgba64, is16Bit := img.(*image.RGBA64)
+	switch depth := options.bitDepth(img); {
+	case is16Bit && depth == 8:
+		img = utils.ConvertTo8Bit(rgba64)
+	case !is16Bit && depth == 16:
+		converted := image.NewRGBA64(img.Bounds())
+		draw.Draw(converted, converted.Rect, img, img.Bounds().Min, draw.Src)
+		img = converted
+	}
+
+	switch options.Format {
+	case JPEG:
+		quality := options.Quality
+		if quality == 0 {
+			quality = DefaultQuality
+		}
+		subsampling, _ := jpegSubsampling(options.ChromaSubsampling)
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality, Subsampling: subsampling})
+
+	case GIF:
+		return gif.Encode(w, palettedImage(img), nil)
+
+	case BMP:
+		return bmp.Encode(w, img)
+
+	case TIFF:
+		tiffOptions := &tiff.Options{Compression: tiff.Deflate, Predictor: true}
+		if options.Compression == CompressionNone {
+			tiffOptions = &tiff.Options{Compression: tiff.Uncompressed}
+		}
+		return tiff.Encode(w, img, tiffOptions)
+	}
+
+	compression, _ := pngCompression(options.Compression)
+	encoder := png.Encoder{CompressionLevel: compression}
+	return encoder.Encode(w, img)
+}
+
+// Encodes img into the file at filePath, see Encode
+func WriteFile(filePath string, img image.Image, options Options) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := Encode(f, img, options); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Writes the frames of the animation to w as a GIF file with the same timing. Every frame gets
+// its own palette, see MedianCutQuantizer.
+func EncodeAnimation(w io.Writer, frames *animation.Animation) error {
+	if len(frames.Frames) == 0 {
+		return fmt.Errorf("Animation has no frames")
+	}
+
+	bounds := frames.Frames[0].Bounds()
+	result := &gif.GIF{
+		Image:     make([]*image.Paletted, len(frames.Frames)),
+		Delay:     frames.Delays,
+		Disposal:  frames.Disposals,
+		LoopCount: frames.LoopCount,
+		Config:    image.Config{Width: bounds.Dx(), Height: bounds.Dy()},
+	}
+	for i, frame := range frames.Frames {
+		paletted := palettedImage(frame)
+		// GIF frames are placed relative to the top left corner of the animation
+		paletted.Rect = paletted.Rect.Sub(frame.Bounds().Min)
+		result.Image[i] = paletted
+	}
+
+	return gif.EncodeAll(w, result)
+}
+
+// Encodes the animation into the file at filePath, see EncodeAnimation
+func WriteAnimationFile(filePath string, frames *animation.Animation) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := EncodeAnimation(f, frames); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func pngCompression(compression Compression) (png.CompressionLevel, error) {
+	switch compression {
+	case "", CompressionDefault:
+		return png.DefaultCompression, nil
+	case CompressionNone:
+		return png.NoCompression, nil
+	case CompressionFast:
+		return png.BestSpeed, nil
+	case CompressionBest:
+		return png.BestCompression, nil
+	}
+	return 0, fmt.Errorf("Unknown PNG compression %q", compression)
+}
+
+func jpegSubsampling(subsampling ChromaSubsampling) (jpeg.Subsampling, error) {
+	switch subsampling {
+	case "", Subsampling420:
+		return jpeg.Subsampling420, nil
+	case Subsampling422:
+		return jpeg.Subsampling422, nil
+	case Subsampling444:
+		return jpeg.Subsampling444, nil
+	}
+	return 0, fmt.Errorf("Unknown chroma subsampling %q", subsampling)
+}
@@ -0,0 +1,329 @@
+package export
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	stdjpeg "image/jpeg"
+	"image/png"
+	"path/filepath"
+	"testing"
+
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+	"tool7/image-processing/utils"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// Opaque image with smooth gradients
+func newTestImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 8), uint8(y * 10), uint8(120 + x*2), 255})
+		}
+	}
+	return img
+}
+
+func encodeTestImage(t *testing.T, img image.Image, options Options) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	if err := Encode(&buffer, img, options); err != nil {
+		t.Fatalf("Encoding %+v: %v", options, err)
+	}
+	return buffer.Bytes()
+}
+
+func TestFormatExtensions(t *testing.T) {
+	tests := []struct {
+		extension string
+		format    Format
+	}{
+		{".png", PNG},
+		{".JPG", JPEG},
+		{".jpeg", JPEG},
+		{".gif", GIF},
+		{".bmp", BMP},
+		{".tif", TIFF},
+		{".TIFF", TIFF},
+		{".webp", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if format := FormatFromExtension(test.extension); format != test.format {
+			t.Errorf("%q is %q, expected %q", test.extension, format, test.format)
+		}
+		// Every format is found again from its own extension
+		if test.format != "" && FormatFromExtension(test.format.Extension()) != test.format {
+			t.Errorf("%q has extension %q", test.format, test.format.Extension())
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		options Options
+		valid   bool
+	}{
+		{Options{Format: PNG}, true},
+		{Options{Format: JPEG, Quality: 1}, true},
+		{Options{Format: JPEG, Quality: 100, ChromaSubsampling: Subsampling444}, true},
+		{Options{Format: TIFF, BitDepth: 16, Compression: CompressionNone}, true},
+		{Options{Format: PNG, BitDepth: 8, Compression: CompressionBest}, true},
+		{Options{Format: "webp"}, false},
+		{Options{}, false},
+		{Options{Format: JPEG, Quality: -1}, false},
+		{Options{Format: JPEG, Quality: 101}, false},
+		{Options{Format: JPEG, BitDepth: 16}, false},
+		{Options{Format: GIF, BitDepth: 16}, false},
+		{Options{Format: PNG, BitDepth: 12}, false},
+		{Options{Format: PNG, Compression: "maximum"}, false},
+		{Options{Format: JPEG, ChromaSubsampling: "4:1:1"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.options.Validate()
+		if test.valid && err != nil {
+			t.Errorf("%+v: %v", test.options, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%+v was accepted", test.options)
+		}
+		// Invalid options never get as far as writing a file
+		if !test.valid {
+			if err := WriteFile(filepath.Join(t.TempDir(), "image"), newTestImage(), test.options); err == nil {
+				t.Errorf("%+v was written", test.options)
+			}
+		}
+	}
+}
+
+func TestEncodeFormats(t *testing.T) {
+	img := newTestImage()
+	decoders := map[Format]func([]byte) (image.Image, error){
+		PNG:  func(data []byte) (image.Image, error) { return png.Decode(bytes.NewReader(data)) },
+		JPEG: func(data []byte) (image.Image, error) { return stdjpeg.Decode(bytes.NewReader(data)) },
+		GIF:  func(data []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(data)) },
+		BMP:  func(data []byte) (image.Image, error) { return bmp.Decode(bytes.NewReader(data)) },
+		TIFF: func(data []byte) (image.Image, error) { return tiff.Decode(bytes.NewReader(data)) },
+	}
+	// Largest difference of a channel after decoding, GIF has a palette and JPEG is lossy
+	tolerances := map[Format]int{PNG: 0, BMP: 0, TIFF: 0, GIF: 16, JPEG: 16}
+
+	for format, decode := range decoders {
+		decoded, err := decode(encodeTestImage(t, img, Options{Format: format}))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if decoded.Bounds() != img.Rect {
+			t.Errorf("%s decoded to bounds %v", format, decoded.Bounds())
+			continue
+		}
+		if difference := maxDifference(img, decoded); difference > tolerances[format] {
+			t.Errorf("%s differs by %d", format, difference)
+		}
+	}
+}
+
+func TestJPEGQuality(t *testing.T) {
+	img := newTestImage()
+
+	// Zero stands for the default quality
+	if !bytes.Equal(encodeTestImage(t, img, Options{Format: JPEG}), encodeTestImage(t, img, Options{Format: JPEG, Quality: DefaultQuality})) {
+		t.Error("Quality 0 differs from the default quality")
+	}
+
+	previousSize := 0
+	for _, quality := range []int{1, 50, 100} {
+		encoded := encodeTestImage(t, img, Options{Format: JPEG, Quality: quality})
+		if len(encoded) <= previousSize {
+			t.Errorf("Quality %d takes %d bytes, no more than a lower quality", quality, len(encoded))
+		}
+		previousSize = len(encoded)
+
+		decoded, err := stdjpeg.Decode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quality == 100 && maxDifference(img, decoded) > 8 {
+			t.Errorf("Quality 100 differs by %d", maxDifference(img, decoded))
+		}
+	}
+}
+
+func TestEncodeWritesMetadata(t *testing.T) {
+	img := newTestImage()
+	written := metadata.Metadata{
+		EXIF: []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00"),
+		XMP:  []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`),
+		ICC:  bytes.Repeat([]byte("profile "), 40),
+	}
+
+	for _, format := range []Format{PNG, JPEG} {
+		encoded := encodeTestImage(t, img, Options{Format: format, Metadata: written})
+		if read := metadata.Read(encoded); !bytes.Equal(read.EXIF, written.EXIF) || !bytes.Equal(read.XMP, written.XMP) || !bytes.Equal(read.ICC, written.ICC) {
+			t.Errorf("%s has metadata %+v", format, read)
+		}
+		if _, _, err := image.Decode(bytes.NewReader(encoded)); err != nil {
+			t.Errorf("%s with metadata cannot be decoded: %v", format, err)
+		}
+
+		// Without metadata, the file is what the encoder wrote
+		plain := encodeTestImage(t, img, Options{Format: format})
+		if !metadata.Read(plain).IsEmpty() {
+			t.Errorf("%s without metadata has %+v", format, metadata.Read(plain))
+		}
+	}
+
+	// Formats without metadata are written as they are
+	for _, format := range []Format{GIF, BMP, TIFF} {
+		if !bytes.Equal(encodeTestImage(t, img, Options{Format: format, Metadata: written}), encodeTestImage(t, img, Options{Format: format})) {
+			t.Errorf("%s changed with metadata", format)
+		}
+	}
+}
+
+// 16-bit images lose their lower byte in formats and depths of 8 bits per channel
+func TestEncodeConvertsToEightBits(t *testing.T) {
+	img := image.NewRGBA64(image.Rect(0, 0, 4, 4))
+	for i := 0; i < len(img.Pix); i += 2 {
+		img.Pix[i], img.Pix[i+1] = 0x9a, 0x3c
+		if i%8 == 6 {
+			img.Pix[i], img.Pix[i+1] = 0xff, 0xff
+		}
+	}
+	expected := color.RGBA{0x9a, 0x9a, 0x9a, 0xff}
+
+	for _, options := range []Options{{Format: PNG, BitDepth: 8}, {Format: TIFF, BitDepth: 8}, {Format: BMP}, {Format: GIF}} {
+		decoded, _, err := image.Decode(bytes.NewReader(encodeTestImage(t, img, options)))
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+		if got := color.RGBAModel.Convert(decoded.At(1, 1)); got != expected {
+			t.Errorf("%+v decoded to %v, expected %v", options, got, expected)
+		}
+		if _, is16Bit := decoded.(*image.RGBA64); is16Bit {
+			t.Errorf("%+v has 16 bits per channel", options)
+		}
+	}
+
+	// Linear images are converted to sRGB at 8 bits
+	linear := models.ToLinearImage(img)
+	decoded, err := png.Decode(bytes.NewReader(encodeTestImage(t, linear, Options{Format: PNG, BitDepth: 8})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.RGBAModel.Convert(decoded.At(2, 2)); got != expected {
+		t.Errorf("Linear image decoded to %v, expected %v", got, expected)
+	}
+}
+
+// Largest difference between the 8-bit channels of a and b, over the bounds of a
+func maxDifference(a, b image.Image) int {
+	bounds := a.Bounds()
+	max := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca := color.RGBAModel.Convert(a.At(x, y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(b.At(x, y)).(color.RGBA)
+			for _, d := range []int{int(ca.R) - int(cb.R), int(ca.G) - int(cb.G), int(ca.B) - int(cb.B), int(ca.A) - int(cb.A)} {
+				if d < 0 {
+					d = -d
+				}
+				if d > max {
+					max = d
+				}
+			}
+		}
+	}
+	return max
+}
+
+// Opaque and translucent 16-bit pixels, whose lower bytes 8-bit formats would lose
+func newTestImage16() *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			alpha := uint16(0xffff)
+			if y >= 4 {
+				alpha = 0x8123
+			}
+			scale := func(value int) uint16 { return uint16(value * int(alpha) / 0xffff) }
+			img.SetRGBA64(x, y, color.RGBA64{scale(0x1234 + x*0x101), scale(0x8765 + y*7), scale(0xfedc - x*y), alpha})
+		}
+	}
+	return img
+}
+
+func TestEncode16BitRoundTrip(t *testing.T) {
+	original := newTestImage16()
+
+	for _, options := range []Options{{Format: PNG}, {Format: PNG, BitDepth: 16}, {Format: TIFF}, {Format: TIFF, BitDepth: 16, Compression: CompressionNone}} {
+		decoded, err := utils.GetImageFromReader(bytes.NewReader(encodeTestImage(t, original, options)))
+		if err != nil {
+			t.Fatalf("%+v: %v", options, err)
+		}
+		rgba64, ok := decoded.(*image.RGBA64)
+		if !ok {
+			t.Fatalf("%+v decoded to %T", options, decoded)
+		}
+
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 16; x++ {
+				expected, pixel := original.RGBA64At(x, y), rgba64.RGBA64At(x, y)
+				// Opaque pixels come back exactly, translucent ones are written with straight
+				// colors by PNG and premultiplied again on decoding
+				tolerance := 0
+				if expected.A != 0xffff && options.Format == PNG {
+					tolerance = 1
+				}
+				if difference16(expected, pixel) > tolerance {
+					t.Errorf("%+v decoded %v at %d,%d, expected %v", options, pixel, x, y, expected)
+				}
+			}
+		}
+	}
+}
+
+// Linear images are written with 16 bits per channel unless 8 are asked for
+func TestEncodeLinearImageAt16Bits(t *testing.T) {
+	linear := models.ToLinearImage(newTestImage16())
+
+	for _, format := range []Format{PNG, TIFF} {
+		decoded, err := utils.GetImageFromReader(bytes.NewReader(encodeTestImage(t, linear, Options{Format: format})))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if _, ok := decoded.(*image.RGBA64); !ok {
+			t.Fatalf("%s decoded to %T", format, decoded)
+		}
+		expected := linear.ToRGBA64()
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 16; x++ {
+				if difference16(expected.RGBA64At(x, y), decoded.(*image.RGBA64).RGBA64At(x, y)) > 1 {
+					t.Errorf("%s decoded %v at %d,%d, expected %v", format, decoded.At(x, y), x, y, expected.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+// Largest difference between the channels of a and b
+func difference16(a, b color.RGBA64) int {
+	max := 0
+	for _, d := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+		if d < 0 {
+			d = -d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
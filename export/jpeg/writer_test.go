@@ -0,0 +1,197 @@
+package jpeg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"testing"
+)
+
+var subsamplings = []struct {
+	name        string
+	subsampling Subsampling
+	// Luminance sampling factors of the SOF0 header
+	h, v  int
+	ratio image.YCbCrSubsampleRatio
+}{
+	{"4:4:4", Subsampling444, 1, 1, image.YCbCrSubsampleRatio444},
+	{"4:2:2", Subsampling422, 2, 1, image.YCbCrSubsampleRatio422},
+	{"4:2:0", Subsampling420, 2, 2, image.YCbCrSubsampleRatio420},
+}
+
+// Smooth gradients, whose size is no multiple of the block size
+func newGradientImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 37, 29))
+	for y := 0; y < 29; y++ {
+		for x := 0; x < 37; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x * 255 / 36), uint8(y * 255 / 28), uint8((x + y) * 2), 255})
+		}
+	}
+	return img
+}
+
+// Columns alternating between red and blue, which only full resolution chrominance keeps
+func newStripedImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if x%2 == 0 {
+				img.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.SetRGBA(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+	return img
+}
+
+// Mean and largest absolute difference of the color channels
+func difference(a, b image.Image) (float64, int) {
+	var sum, max int
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca := color.RGBAModel.Convert(a.At(x, y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(b.At(x, y)).(color.RGBA)
+			for _, d := range []int{int(ca.R) - int(cb.R), int(ca.G) - int(cb.G), int(ca.B) - int(cb.B)} {
+				if d < 0 {
+					d = -d
+				}
+				sum += d
+				if d > max {
+					max = d
+				}
+			}
+		}
+	}
+	return float64(sum) / float64(3*bounds.Dx()*bounds.Dy()), max
+}
+
+// Returns the component count and the sampling factors of each component of the SOF0 header
+func readSOF0(t *testing.T, data []byte) (int, [][2]int) {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			t.Fatalf("No marker at offset %d", i)
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == sof0Marker {
+			segment := data[i+4 : i+2+length]
+			count := int(segment[5])
+			factors := make([][2]int, count)
+			for c := 0; c < count; c++ {
+				hv := segment[6+3*c+1]
+				factors[c] = [2]int{int(hv >> 4), int(hv & 0x0f)}
+			}
+			return count, factors
+		}
+		i += 2 + length
+	}
+	t.Fatal("No SOF0 marker")
+	return 0, nil
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	original := newGradientImage()
+
+	for _, test := range subsamplings {
+		var buff bytes.Buffer
+		if err := Encode(&buff, original, &Options{Quality: 95, Subsampling: test.subsampling}); err != nil {
+			t.Fatal(err)
+		}
+
+		count, factors := readSOF0(t, buff.Bytes())
+		expected := [][2]int{{test.h, test.v}, {1, 1}, {1, 1}}
+		if count != 3 || len(factors) != 3 || factors[0] != expected[0] || factors[1] != expected[1] || factors[2] != expected[2] {
+			t.Errorf("%s SOF0 has %d components sampled %v, expected %v", test.name, count, factors, expected)
+		}
+
+		decoded, err := stdjpeg.Decode(bytes.NewReader(buff.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if decoded.Bounds() != original.Bounds() {
+			t.Fatalf("%s decoded to bounds %v", test.name, decoded.Bounds())
+		}
+		if ycbcr, ok := decoded.(*image.YCbCr); !ok {
+			t.Errorf("%s decoded to %T", test.name, decoded)
+		} else if ycbcr.SubsampleRatio != test.ratio {
+			t.Errorf("%s decoded with ratio %v, expected %v", test.name, ycbcr.SubsampleRatio, test.ratio)
+		}
+
+		mean, max := difference(original, decoded)
+		if mean > 2.5 || max > 16 {
+			t.Errorf("%s differs by %.2f on average and %d at most", test.name, mean, max)
+		}
+	}
+}
+
+// 4:2:0 is what the standard library always writes
+func TestEncode420MatchesStandardLibrary(t *testing.T) {
+	for _, original := range []image.Image{newGradientImage(), newStripedImage()} {
+		for _, quality := range []int{30, 75, 95} {
+			var own, std bytes.Buffer
+			if err := Encode(&own, original, &Options{Quality: quality, Subsampling: Subsampling420}); err != nil {
+				t.Fatal(err)
+			}
+			if err := stdjpeg.Encode(&std, original, &stdjpeg.Options{Quality: quality}); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(own.Bytes(), std.Bytes()) {
+				t.Errorf("Quality %d output of %v differs from the standard library", quality, original.Bounds())
+			}
+		}
+	}
+}
+
+// Each step of subsampling loses more of the fine chrominance details
+func TestEncodeSubsamplingKeepsChrominance(t *testing.T) {
+	original := newStripedImage()
+
+	var previous float64
+	for _, test := range subsamplings {
+		var buff bytes.Buffer
+		if err := Encode(&buff, original, &Options{Quality: 95, Subsampling: test.subsampling}); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := stdjpeg.Decode(&buff)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mean, _ := difference(original, decoded)
+		if test.subsampling == Subsampling444 && mean > 8 {
+			t.Errorf("4:4:4 differs by %.2f on average", mean)
+		}
+		if mean < previous {
+			t.Errorf("%s differs by %.2f on average, less than %.2f with finer chrominance", test.name, mean, previous)
+		}
+		previous = mean
+	}
+}
+
+// Gray images have a single component, whatever the subsampling
+func TestEncodeGray(t *testing.T) {
+	original := image.NewGray(image.Rect(0, 0, 19, 11))
+	for i := range original.Pix {
+		original.Pix[i] = uint8(i)
+	}
+
+	var buff bytes.Buffer
+	if err := Encode(&buff, original, &Options{Quality: 95, Subsampling: Subsampling420}); err != nil {
+		t.Fatal(err)
+	}
+	if count, factors := readSOF0(t, buff.Bytes()); count != 1 || factors[0] != [2]int{1, 1} {
+		t.Errorf("SOF0 has %d components sampled %v", count, factors)
+	}
+
+	decoded, err := stdjpeg.Decode(&buff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mean, max := difference(original, decoded); mean > 2 || max > 16 {
+		t.Errorf("Gray image differs by %.2f on average and %d at most", mean, max)
+	}
+}
@@ -0,0 +1,191 @@
+package export
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// Pixels less opaque than this are transparent in GIF files, which only know fully transparent
+// and fully opaque pixels
+const gifAlphaThreshold = 0x80
+
+// Picks the palette for an image by median cut: the colors of the image are split into boxes
+// along their widest channel, at the median pixel, until there are as many boxes as palette
+// entries, and every entry is the average color of a box. Unlike a fixed palette it follows the
+// colors of the image, so tinted or sepia toned images do not band.
+type MedianCutQuantizer struct{}
+
+// Implements draw.Quantizer. Appends to p at most cap(p) - len(p) colors, one of them transparent
+// when m has transparent pixels.
+func (this MedianCutQuantizer) Quantize(p color.Palette, m image.Image) color.Palette {
+	histogram, hasTransparency := colorHistogram(m)
+
+	size := cap(p) - len(p)
+	if hasTransparency {
+		p = append(p, color.RGBA{})
+		size--
+	}
+	if size <= 0 || len(histogram) == 0 {
+		return p
+	}
+
+	boxes := []colorBox{newColorBox(histogram)}
+	for len(boxes) < size {
+		widest := -1
+		for i, box := range boxes {
+			if len(box.colors) > 1 && (widest < 0 || box.priority() > boxes[widest].priority()) {
+				widest = i
+			}
+		}
+		if widest < 0 {
+			break
+		}
+
+		first, second := boxes[widest].split()
+		boxes[widest] = first
+		boxes = append(boxes, second)
+	}
+
+	for _, box := range boxes {
+		p = append(p, box.average())
+	}
+	return p
+}
+
+type colorCount struct {
+	color [3]uint8
+	count int
+}
+
+// Counts the opaque colors of the image, see gifAlphaThreshold
+func colorHistogram(img image.Image) ([]colorCount, bool) {
+	counts := map[[3]uint8]int{}
+	hasTransparency := false
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if pixel.A < gifAlphaThreshold {
+				hasTransparency = true
+				continue
+			}
+			counts[[3]uint8{pixel.R, pixel.G, pixel.B}]++
+		}
+	}
+
+	histogram := make([]colorCount, 0, len(counts))
+	for rgb, count := range counts {
+		histogram = append(histogram, colorCount{rgb, count})
+	}
+	// Map order is random, sorting keeps the palette the same for the same image
+	sort.Slice(histogram, func(i, j int) bool {
+		a, b := histogram[i].color, histogram[j].color
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		if a[1] != b[1] {
+			return a[1] < b[1]
+		}
+		return a[2] < b[2]
+	})
+	return histogram, hasTransparency
+}
+
+type colorBox struct {
+	colors []colorCount
+	// Channel with the widest range of values and that range
+	channel, spread int
+	pixels          int
+}
+
+func newColorBox(colors []colorCount) colorBox {
+	box := colorBox{colors: colors}
+
+	for channel := 0; channel < 3; channel++ {
+		low, high := 255, 0
+		for _, c := range colors {
+			value := int(c.color[channel])
+			if value < low {
+				low = value
+			}
+			if value > high {
+				high = value
+			}
+		}
+		if high-low > box.spread || channel == 0 {
+			box.channel, box.spread = channel, high-low
+		}
+	}
+	for _, c := range colors {
+		box.pixels += c.count
+	}
+
+	return box
+}
+
+// Boxes that cover many pixels and a wide range of colors are split first
+func (this colorBox) priority() int {
+	return this.spread * this.pixels
+}
+
+// Splits the box along its widest channel so both halves cover about as many pixels
+func (this colorBox) split() (colorBox, colorBox) {
+	channel := this.channel
+	sort.SliceStable(this.colors, func(i, j int) bool {
+		return this.colors[i].color[channel] < this.colors[j].color[channel]
+	})
+
+	median, counted := 1, 0
+	for i, c := range this.colors[:len(this.colors)-1] {
+		counted += c.count
+		median = i + 1
+		if counted*2 >= this.pixels {
+			break
+		}
+	}
+
+	return newColorBox(this.colors[:median]), newColorBox(this.colors[median:])
+}
+
+func (this colorBox) average() color.Color {
+	var r, g, b int
+	for _, c := range this.colors {
+		r += int(c.color[0]) * c.count
+		g += int(c.color[1]) * c.count
+		b += int(c.color[2]) * c.count
+	}
+	return color.RGBA{uint8(r / this.pixels), uint8(g / this.pixels), uint8(b / this.pixels), 0xff}
+}
+
+// Converts the image to at most 256 colors picked by MedianCutQuantizer, diffusing the difference
+// to the original colors with Floyd-Steinberg dithering
+func palettedImage(img image.Image) *image.Paletted {
+	bounds := img.Bounds()
+
+	// Dithering spreads the error of half transparent pixels to their neighbors, so they are made
+	// fully transparent or fully opaque first
+	opaque := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pixel := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if pixel.A < gifAlphaThreshold {
+				pixel = color.NRGBA{}
+			} else {
+				pixel.A = 0xff
+			}
+			opaque.SetNRGBA(x, y, pixel)
+		}
+	}
+
+	palette := MedianCutQuantizer{}.Quantize(make(color.Palette, 0, 256), opaque)
+	if len(palette) == 0 {
+		palette = color.Palette{color.RGBA{}}
+	}
+
+	paletted := image.NewPaletted(bounds, palette)
+	draw.FloydSteinberg.Draw(paletted, bounds, opaque, bounds.Min)
+	return paletted
+}
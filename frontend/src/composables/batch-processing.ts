@@ -0,0 +1,104 @@
+import { readonly, ref } from "vue";
+
+import { batch } from "../../wailsjs/go/models";
+import {
+  CancelBatch,
+  ProcessBatch,
+  SelectBatchFiles,
+  SelectBatchFolder,
+  SelectOutputDirectory,
+} from "../../wailsjs/go/main/App";
+import { EventsOn } from "../../wailsjs/runtime/runtime";
+import { BatchProgress, DEFAULT_BATCH_NAME_TEMPLATE } from "../types/batch";
+
+const isDialogOpen = ref<boolean>(false);
+const isRunning = ref<boolean>(false);
+const inputs = ref<Array<string>>([]);
+const outputDirectory = ref<string>("");
+const nameTemplate = ref<string>(DEFAULT_BATCH_NAME_TEMPLATE);
+const concurrency = ref<number>(2);
+const quality = ref<number>(90);
+const progress = ref<BatchProgress | undefined>();
+// Files of the latest batch that failed, in the order they were done
+const failures = ref<Array<BatchProgress>>([]);
+const summary = ref<batch.Summary | undefined>();
+
+EventsOn("batch:progress", (value: BatchProgress) => {
+  progress.value = value;
+});
+
+EventsOn("batch:error", (value: BatchProgress) => {
+  failures.value.push(value);
+});
+
+const setIsDialogOpen = (value: boolean) => {
+  isDialogOpen.value = value;
+};
+
+// Choosing files or a folder replaces the inputs chosen before, closing the dialog keeps them
+const selectFiles = async () => {
+  const filePaths = await SelectBatchFiles();
+  if (filePaths.length) {
+    inputs.value = filePaths;
+  }
+};
+
+const selectFolder = async () => {
+  const filePaths = await SelectBatchFolder();
+  if (filePaths.length) {
+    inputs.value = filePaths;
+  }
+};
+
+const selectOutputDirectory = async () => {
+  const directory = await SelectOutputDirectory();
+  if (directory) {
+    outputDirectory.value = directory;
+  }
+};
+
+const runBatch = async () => {
+  isRunning.value = true;
+  progress.value = undefined;
+  failures.value = [];
+  summary.value = undefined;
+
+  try {
+    summary.value = await ProcessBatch(
+      new batch.Options({
+        inputs: inputs.value,
+        outputDirectory: outputDirectory.value,
+        nameTemplate: nameTemplate.value,
+        concurrency: concurrency.value,
+        quality: quality.value,
+      })
+    );
+  } finally {
+    isRunning.value = false;
+  }
+};
+
+const cancelBatch = async () => {
+  await CancelBatch();
+};
+
+export function useBatchProcessing() {
+  return {
+    isDialogOpen: readonly(isDialogOpen),
+    isRunning: readonly(isRunning),
+    inputs: readonly(inputs),
+    outputDirectory: readonly(outputDirectory),
+    nameTemplate,
+    concurrency,
+    quality,
+    progress: readonly(progress),
+    failures: readonly(failures),
+    summary: readonly(summary),
+    setIsDialogOpen,
+    selectFiles,
+    selectFolder,
+    selectOutputDirectory,
+    runBatch,
+    cancelBatch,
+  };
+}
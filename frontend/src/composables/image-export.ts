@@ -0,0 +1,61 @@
+import { readonly, ref } from "vue";
+
+import { main, metadata } from "../../wailsjs/go/models";
+import { ExportImage } from "../../wailsjs/go/main/App";
+import { DEEP_FORMATS, ExportFormat, METADATA_MODE_SELECTIONS, MetadataMode, MetadataSelection } from "../types/export";
+
+const isDialogOpen = ref<boolean>(false);
+const isExporting = ref<boolean>(false);
+const format = ref<ExportFormat>("png");
+const compression = ref<string>("default");
+const quality = ref<number>(90);
+const chromaSubsampling = ref<string>("4:2:0");
+const bitDepth = ref<number>(0);
+// Published images should not reveal more than intended, so metadata is removed unless chosen
+const metadataMode = ref<MetadataMode>("strip");
+const customMetadata = ref<MetadataSelection>({ exif: true, xmp: true, icc: true, location: false });
+
+const setIsDialogOpen = (value: boolean) => {
+  isDialogOpen.value = value;
+};
+
+// The image is rendered again at full resolution by the backend, which also asks for the file
+const exportImage = async () => {
+  isExporting.value = true;
+
+  try {
+    const isExported = await ExportImage(
+      new main.ExportOptions({
+        format: format.value,
+        compression: compression.value,
+        quality: quality.value,
+        chromaSubsampling: chromaSubsampling.value,
+        bitDepth: DEEP_FORMATS.includes(format.value) ? bitDepth.value : 0,
+        metadata: new metadata.Selection(
+          metadataMode.value === "custom" ? customMetadata.value : METADATA_MODE_SELECTIONS[metadataMode.value]
+        ),
+      })
+    );
+    if (isExported) {
+      isDialogOpen.value = false;
+    }
+  } finally {
+    isExporting.value = false;
+  }
+};
+
+export function useImageExport() {
+  return {
+    isDialogOpen: readonly(isDialogOpen),
+    isExporting: readonly(isExporting),
+    format,
+    compression,
+    quality,
+    chromaSubsampling,
+    bitDepth,
+    metadataMode,
+    customMetadata,
+    setIsDialogOpen,
+    exportImage,
+  };
+}
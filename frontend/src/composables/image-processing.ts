@@ -1,12 +1,21 @@
 import { ref, readonly } from "vue";
 import { nanoid } from "nanoid";
 
-import { main } from "../../wailsjs/go/models";
+import { main, operations, project } from "../../wailsjs/go/models";
 import {
+  GetImageOperations,
+  GetImagePages,
+  GetFrameCount,
+  ProcessFrame,
+  SelectImagePage,
+  ListOperations,
+  ListBlendModes,
+  Undo,
+  Redo,
+  SetPreviewSize,
+  SetWorkingSpace,
   OpenImageFileSelector,
   ProcessImage,
-  GetOriginalImage,
-  SetOriginalImage,
   ResetAppState,
   AppendImageOperation,
   RemoveImageOperationAtIndex,
@@ -14,15 +23,48 @@ import {
   ReplaceImageOperationAtIndex,
   MoveImageOperation,
   ToggleImageOperation,
-  RotateImageBy90Deg,
-  MirrorImageVertically,
-  MirrorImageHorizontally,
+  GroupImageOperations,
+  UngroupImageOperation,
+  DuplicateImageOperation,
+  SetImageOperationBlending,
+  SetImageOperationMask,
+  OpenMaskFileSelector,
+  ConvertToGraph,
+  AddGraphNode,
+  AddGraphBlendNode,
+  UpdateGraphNode,
+  UpdateGraphBlendNode,
+  RemoveGraphNode,
+  ConnectGraphNodes,
+  DisconnectGraphNode,
+  SetGraphOutput,
 } from "../../wailsjs/go/main/App";
-import { ImageOperationDraggableItem } from "../types/image";
+import { EventsOn } from "../../wailsjs/runtime/runtime";
+import { ImageOperationDraggableItem, ProcessingProgress } from "../types/image";
+import { AppError, isCanceledError, parseAppError } from "../types/error";
 
 const isLoading = ref<boolean>(false);
 const processedImage = ref<main.Base64Image | undefined>();
+// Pages of the opened file, more than one only for multi-page TIFF files
+const imagePages = ref<main.ImagePages>(new main.ImagePages({ count: 0, current: 0 }));
+// Frames of the opened image, more than one only for animated GIF files
+const frameCount = ref<number>(0);
+const currentFrame = ref<number>(0);
 const operationDraggableItems = ref<Array<ImageOperationDraggableItem>>([]);
+const operationDefinitions = ref<Array<operations.Definition>>([]);
+const blendModes = ref<Array<string>>([]);
+const progress = ref<ProcessingProgress | undefined>();
+// Error of the latest failed render, cleared by the next successful one
+const processingError = ref<AppError | undefined>();
+// Color space the layers work in, "perceptual" or "linear"
+const workingSpace = ref<string>("perceptual");
+
+// Incremented for every render, only the latest one updates the state
+let latestRender = 0;
+
+EventsOn("processing:progress", (value: ProcessingProgress) => {
+  progress.value = value;
+});
 
 const setIsLoading = (value: boolean) => {
   isLoading.value = value;
@@ -38,6 +80,8 @@ const openImageFileSelector = async () => {
       return;
     }
 
+    await loadImagePages();
+    await loadFrames();
     const result = await ProcessImage(0);
     processedImage.value = result;
   } catch (err) {
@@ -47,13 +91,40 @@ const openImageFileSelector = async () => {
   }
 };
 
-const getOriginalImage = async () => {
-  return await GetOriginalImage();
+const loadImagePages = async () => {
+  imagePages.value = await GetImagePages();
+};
+
+const loadFrames = async () => {
+  frameCount.value = await GetFrameCount();
+  currentFrame.value = 0;
+};
+
+// Shows another page of the opened file, keeping the layers
+const selectImagePage = async (page: number) => {
+  await SelectImagePage(page);
+  await loadImagePages();
+  await processImage();
+};
+
+const loadOperationDefinitions = async () => {
+  if (operationDefinitions.value.length) {
+    return;
+  }
+  operationDefinitions.value = await ListOperations();
+  blendModes.value = await ListBlendModes();
+};
+
+const getOperationDefinition = (name: string) => {
+  return operationDefinitions.value.find((definition) => definition.name === name);
 };
 
-const setOriginalImage = async (image: main.Base64Image) => {
-  const rawBase64 = image.base64.split(",")[1];
-  await SetOriginalImage(rawBase64);
+const setImageOperations = (operations: Array<main.ImageOperation>) => {
+  operationDraggableItems.value = operations.map((operation) => ({
+    id: nanoid(),
+    operation,
+    isEnabled: operation.isEnabled,
+  }));
 };
 
 const addImageOperation = async (operation: main.ImageOperation) => {
@@ -66,18 +137,17 @@ const removeImageOperation = async (index: number) => {
   operationDraggableItems.value.splice(index, 1);
 };
 
-const updateImageOperation = async (index: number, level?: number, tint?: main.TintRGB, kernelSize?: number) => {
+const updateImageOperation = async (index: number, params: { [key: string]: any }) => {
   const operation = operationDraggableItems.value[index].operation;
-  operation.level = level;
-  operation.tint = tint;
-  operation.kernelSize = kernelSize;
+  operation.params = params;
 
   await UpdateImageOperationAtIndex(index, operation);
 };
 
 const replaceImageOperation = async (index: number, operation: main.ImageOperation) => {
   await ReplaceImageOperationAtIndex(index, operation);
-  operationDraggableItems.value[index].operation.type = operation.type;
+  operationDraggableItems.value[index].operation.name = operation.name;
+  operationDraggableItems.value[index].operation.params = operation.params;
 };
 
 const moveImageOperation = async (oldIndex: number, newIndex: number) => {
@@ -94,60 +164,256 @@ const toggleImageOperation = async (index: number) => {
   operation.isEnabled = !operation.isEnabled;
 };
 
+const setImageOperationBlending = async (index: number, blendMode: string, opacity: number) => {
+  await SetImageOperationBlending(index, blendMode, opacity);
+
+  const { operation } = operationDraggableItems.value[index];
+  operation.blendMode = blendMode;
+  operation.opacity = opacity;
+};
+
+// Passing no mask removes it
+const setImageOperationMask = async (index: number, mask?: project.MaskState) => {
+  await SetImageOperationMask(index, mask as project.MaskState);
+  operationDraggableItems.value[index].operation.mask = mask;
+};
+
+// Returns false if no file was chosen
+const openMaskFileSelector = async (index: number) => {
+  const isSelected = await OpenMaskFileSelector(index);
+  if (isSelected) {
+    setImageOperations(await GetImageOperations());
+  }
+  return isSelected;
+};
+
+// Grouping changes the structure of the list, which is therefore reloaded from the backend
+const groupImageOperations = async (startIndex: number, endIndex: number) => {
+  await GroupImageOperations(startIndex, endIndex);
+  setImageOperations(await GetImageOperations());
+};
+
+const ungroupImageOperation = async (index: number) => {
+  await UngroupImageOperation(index);
+  setImageOperations(await GetImageOperations());
+};
+
+const duplicateImageOperation = async (index: number) => {
+  await DuplicateImageOperation(index);
+  setImageOperations(await GetImageOperations());
+};
+
+const convertToGraph = async (startIndex: number, endIndex: number) => {
+  await ConvertToGraph(startIndex, endIndex);
+  setImageOperations(await GetImageOperations());
+};
+
+const getGraphNode = (index: number, nodeID: number) => {
+  return operationDraggableItems.value[index].operation.graph?.nodes.find((node) => node.id === nodeID);
+};
+
+// Changes of the graph structure reload the list, like grouping does
+const addGraphNode = async (index: number, operation: main.ImageOperation) => {
+  await AddGraphNode(index, operation);
+  setImageOperations(await GetImageOperations());
+};
+
+const addGraphBlendNode = async (index: number, blendMode: string, opacity: number) => {
+  await AddGraphBlendNode(index, blendMode, opacity);
+  setImageOperations(await GetImageOperations());
+};
+
+const updateGraphNode = async (index: number, nodeID: number, params: { [key: string]: any }) => {
+  const layer = getGraphNode(index, nodeID)?.layer;
+  if (!layer) {
+    return;
+  }
+  layer.params = params;
+
+  await UpdateGraphNode(index, nodeID, new main.ImageOperation({ ...layer }));
+};
+
+const updateGraphBlendNode = async (index: number, nodeID: number, blendMode: string, opacity: number) => {
+  await UpdateGraphBlendNode(index, nodeID, blendMode, opacity);
+
+  const node = getGraphNode(index, nodeID);
+  if (node) {
+    node.blend = new project.BlendState({ blendMode, opacity });
+  }
+};
+
+const removeGraphNode = async (index: number, nodeID: number) => {
+  await RemoveGraphNode(index, nodeID);
+  setImageOperations(await GetImageOperations());
+};
+
+const connectGraphNodes = async (index: number, from: number, to: number, slot: number) => {
+  await ConnectGraphNodes(index, from, to, slot);
+  setImageOperations(await GetImageOperations());
+};
+
+const disconnectGraphNode = async (index: number, to: number, slot: number) => {
+  await DisconnectGraphNode(index, to, slot);
+  setImageOperations(await GetImageOperations());
+};
+
+const setGraphOutput = async (index: number, nodeID: number) => {
+  await SetGraphOutput(index, nodeID);
+  setImageOperations(await GetImageOperations());
+};
+
+// Rotation and mirroring are regular layers, added after the existing ones
+const addTransformOperation = async (name: string, params: { [key: string]: any } = {}) => {
+  await addImageOperation(new main.ImageOperation({ name, params, isEnabled: true }));
+};
+
 const rotateImageBy90Deg = async () => {
-  await RotateImageBy90Deg();
+  await addTransformOperation("rotate", { degrees: 90 });
 };
 
 const mirrorImageVertically = async () => {
-  await MirrorImageVertically();
+  await addTransformOperation("mirrorvertical");
 };
 
 const mirrorImageHorizontally = async () => {
-  await MirrorImageHorizontally();
+  await addTransformOperation("mirrorhorizontal");
 };
 
+// Starting a render cancels the one in progress, whose rejection is ignored
 const processImage = async (indexToExecuteFrom: number = 0) => {
   if (indexToExecuteFrom < 0) {
     indexToExecuteFrom = 0;
   }
 
+  await renderPreview(() => ProcessImage(indexToExecuteFrom));
+};
+
+// Shows another frame of an animation, the layers apply to it until another one is shown
+const processFrame = async (frame: number) => {
+  currentFrame.value = frame;
+  await renderPreview(() => ProcessFrame(frame));
+};
+
+const renderPreview = async (renderImage: () => Promise<main.Base64Image>) => {
+  const render = ++latestRender;
   setIsLoading(true);
+  progress.value = undefined;
 
   try {
-    const result = await ProcessImage(indexToExecuteFrom);
-    processedImage.value = result;
+    const result = await renderImage();
+    if (render === latestRender) {
+      processedImage.value = result;
+      processingError.value = undefined;
+    }
   } catch (err) {
-    throw err;
+    if (render === latestRender && !isCanceledError(err)) {
+      processingError.value = parseAppError(err);
+      throw err;
+    }
   } finally {
-    setIsLoading(false);
+    if (render === latestRender) {
+      setIsLoading(false);
+      progress.value = undefined;
+    }
   }
 };
 
+// Previews never need to be larger than the screen they are shown on
+const setPreviewSizeFromScreen = async () => {
+  const pixelRatio = window.devicePixelRatio || 1;
+  await SetPreviewSize(Math.round(window.screen.width * pixelRatio), Math.round(window.screen.height * pixelRatio));
+};
+
+// Linear light makes blurs and brightness physically correct, the layers are rendered again
+const setWorkingSpace = async (space: string) => {
+  await SetWorkingSpace(space);
+  workingSpace.value = space;
+  if (processedImage.value) {
+    await processImage();
+  }
+};
+
+// Shows the working space of a loaded project, which the backend already uses
+const setLoadedWorkingSpace = (space: string) => {
+  workingSpace.value = space;
+};
+
+const refreshImageOperations = async () => {
+  setImageOperations(await GetImageOperations());
+  await processImage();
+};
+
+const undo = async () => {
+  await Undo();
+  await refreshImageOperations();
+};
+
+const redo = async () => {
+  await Redo();
+  await refreshImageOperations();
+};
+
 const resetAppState = async () => {
   await ResetAppState();
 
   processedImage.value = undefined;
+  processingError.value = undefined;
   operationDraggableItems.value = [];
+  await loadImagePages();
+  await loadFrames();
 };
 
 export function useImageProcessing() {
   return {
     isLoading: readonly(isLoading),
     processedImage: readonly(processedImage),
+    imagePages: readonly(imagePages),
+    frameCount: readonly(frameCount),
+    currentFrame: readonly(currentFrame),
+    progress: readonly(progress),
+    processingError,
+    workingSpace: readonly(workingSpace),
     operationDraggableItems,
-    getOriginalImage,
-    setOriginalImage,
+    operationDefinitions,
+    blendModes: readonly(blendModes),
+    loadOperationDefinitions,
+    getOperationDefinition,
+    setImageOperations,
     openImageFileSelector,
+    loadImagePages,
+    selectImagePage,
+    loadFrames,
     addImageOperation,
     removeImageOperation,
     updateImageOperation,
     replaceImageOperation,
     moveImageOperation,
     toggleImageOperation,
+    setImageOperationBlending,
+    setImageOperationMask,
+    openMaskFileSelector,
+    groupImageOperations,
+    ungroupImageOperation,
+    duplicateImageOperation,
+    convertToGraph,
+    addGraphNode,
+    addGraphBlendNode,
+    updateGraphNode,
+    updateGraphBlendNode,
+    removeGraphNode,
+    connectGraphNodes,
+    disconnectGraphNode,
+    setGraphOutput,
     rotateImageBy90Deg,
     mirrorImageVertically,
     mirrorImageHorizontally,
     processImage,
+    processFrame,
+    setPreviewSizeFromScreen,
+    setWorkingSpace,
+    setLoadedWorkingSpace,
+    undo,
+    redo,
     resetAppState,
   };
 }
@@ -0,0 +1,74 @@
+import { readonly, ref } from "vue";
+
+import { main } from "../../wailsjs/go/models";
+import {
+  ApplyPreset,
+  DeletePreset,
+  ExportPreset,
+  GetImageOperations,
+  ImportPreset,
+  ListPresets,
+  RenamePreset,
+  SavePreset,
+} from "../../wailsjs/go/main/App";
+import { useImageProcessing } from "./image-processing";
+
+const presets = ref<Array<main.Preset>>([]);
+
+const { setImageOperations, processImage } = useImageProcessing();
+
+const loadPresets = async () => {
+  presets.value = await ListPresets();
+};
+
+// Saving under an existing name replaces that preset
+const savePreset = async (name: string) => {
+  await SavePreset(name);
+  await loadPresets();
+};
+
+// Adds the operations of the preset after the current ones, or replaces them
+const applyPreset = async (name: string, replace: boolean) => {
+  const skipped = await ApplyPreset(name, replace);
+  for (const { index, name: operationName, reason } of skipped ?? []) {
+    console.warn(`Skipped operation ${index + 1} (${operationName}): ${reason}`);
+  }
+
+  setImageOperations(await GetImageOperations());
+  await processImage();
+};
+
+const deletePreset = async (name: string) => {
+  await DeletePreset(name);
+  await loadPresets();
+};
+
+// Fails instead of replacing another preset with the new name
+const renamePreset = async (oldName: string, newName: string) => {
+  await RenamePreset(oldName, newName);
+  await loadPresets();
+};
+
+const importPreset = async () => {
+  const name = await ImportPreset();
+  if (name) {
+    await loadPresets();
+  }
+};
+
+const exportPreset = async (name: string) => {
+  await ExportPreset(name);
+};
+
+export function usePresetLibrary() {
+  return {
+    presets: readonly(presets),
+    loadPresets,
+    savePreset,
+    applyPreset,
+    deletePreset,
+    renamePreset,
+    importPreset,
+    exportPreset,
+  };
+}
@@ -1,58 +1,30 @@
 import { readonly, ref } from "vue";
 
-import { GetUserSelectedProjectFileContent } from "../../wailsjs/go/main/App";
-import { ProjectState } from "../types/project";
+import { LoadProject, SaveProject } from "../../wailsjs/go/main/App";
 import { useImageProcessing } from "./image-processing";
 
 const isLoading = ref<boolean>(false);
 const isSaving = ref<boolean>(false);
 
-const {
-  processedImage,
-  operationDraggableItems,
-  addImageOperation,
-  resetAppState,
-  getOriginalImage,
-  setOriginalImage,
-  processImage,
-} = useImageProcessing();
-
-const convertUrlToFile = async (url: string, filename: string) => {
-  const res = await fetch(url);
-  const buf = await res.arrayBuffer();
-  return new File([buf], filename);
-};
-
-const downloadFile = (file: File) => {
-  const link = document.createElement("a");
-
-  link.style.display = "none";
-  link.href = URL.createObjectURL(file);
-  link.download = file.name;
-
-  document.body.appendChild(link);
-  link.click();
-  document.body.removeChild(link);
-  URL.revokeObjectURL(link.href);
-};
+const { setImageOperations, setLoadedWorkingSpace, loadImagePages, loadFrames, processImage } = useImageProcessing();
 
 const loadProject = async () => {
-  const selectedProjectFileContent = await GetUserSelectedProjectFileContent();
-  if (!selectedProjectFileContent) {
-    return;
-  }
-
-  const projectState: ProjectState = JSON.parse(selectedProjectFileContent);
   isLoading.value = true;
 
   try {
-    await resetAppState();
-    await setOriginalImage(projectState.originalImage);
+    const result = await LoadProject();
+    if (!result.isLoaded) {
+      return;
+    }
 
-    for (const operation of projectState.operations) {
-      await addImageOperation(operation);
+    for (const { index, name, reason } of result.skipped ?? []) {
+      console.warn(`Skipped operation ${index + 1} (${name}): ${reason}`);
     }
 
+    setImageOperations(result.operations);
+    setLoadedWorkingSpace(result.workingSpace);
+    await loadImagePages();
+    await loadFrames();
     await processImage();
   } catch (err) {
     console.log(err);
@@ -65,13 +37,7 @@ const saveProject = async () => {
   isSaving.value = true;
 
   try {
-    const originalImage = await getOriginalImage();
-    const operations = operationDraggableItems.value.map(({ operation }) => operation);
-    const projectState: ProjectState = { originalImage, operations };
-    const projectStateString = JSON.stringify(projectState);
-
-    const file = new File([projectStateString], "image-processing-project.goimp");
-    downloadFile(file);
+    await SaveProject();
   } catch (err) {
     console.log(err);
   } finally {
@@ -79,22 +45,11 @@ const saveProject = async () => {
   }
 };
 
-const exportPng = async () => {
-  const imageBase64 = processedImage.value?.base64;
-  if (!imageBase64) {
-    return;
-  }
-
-  const file = await convertUrlToFile(imageBase64, "image-processing-result.png");
-  downloadFile(file);
-};
-
 export function useProjectManager() {
   return {
     isLoading: readonly(isLoading),
     isSaving: readonly(isSaving),
     loadProject,
     saveProject,
-    exportPng,
   };
 }
@@ -0,0 +1,12 @@
+// Payload of the "batch:progress" and "batch:error" events emitted whenever a file of a batch is done
+export interface BatchProgress {
+  done: number;
+  total: number;
+  input: string;
+  output: string;
+  // Error message of a failed file
+  error?: string;
+}
+
+// {name} and {ext} are the name and extension of the input file, {index} its position
+export const DEFAULT_BATCH_NAME_TEMPLATE = "{name}_edited.{ext}";
@@ -0,0 +1,19 @@
+// Error returned by the Go side, whose message is the JSON encoding of an AppError
+export interface AppError {
+  code: string;
+  message: string;
+  layer?: number;
+}
+
+export const parseAppError = (err: unknown): AppError => {
+  const message = err instanceof Error ? err.message : String(err);
+  try {
+    const parsed = JSON.parse(message);
+    if (parsed && typeof parsed.code === "string") {
+      return parsed as AppError;
+    }
+  } catch {}
+  return { code: "unknown", message };
+};
+
+export const isCanceledError = (err: unknown) => parseAppError(err).code === "canceled";
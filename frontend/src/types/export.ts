@@ -0,0 +1,65 @@
+export type ExportFormat = "png" | "jpeg" | "gif" | "bmp" | "tiff";
+
+export const EXPORT_FORMATS: Array<{ title: string; value: ExportFormat }> = [
+  { title: "PNG", value: "png" },
+  { title: "JPEG", value: "jpeg" },
+  { title: "GIF", value: "gif" },
+  { title: "BMP", value: "bmp" },
+  { title: "TIFF", value: "tiff" },
+];
+
+// Formats the metadata of the opened image can be written into
+export const METADATA_FORMATS: Array<ExportFormat> = ["png", "jpeg"];
+
+// PNG compression levels, TIFF files are only compressed or not
+export const PNG_COMPRESSIONS = [
+  { title: "Default", value: "default" },
+  { title: "None", value: "none" },
+  { title: "Fast", value: "fast" },
+  { title: "Best", value: "best" },
+];
+
+export const TIFF_COMPRESSIONS = [
+  { title: "Deflate", value: "default" },
+  { title: "None", value: "none" },
+];
+
+// Formats that can have 16 bits per channel
+export const DEEP_FORMATS: Array<ExportFormat> = ["png", "tiff"];
+
+// 0 keeps the bit depth of the opened image, or writes 16 bits when processing in linear light
+export const BIT_DEPTHS = [
+  { title: "Same as image", value: 0 },
+  { title: "8 bits per channel", value: 8 },
+  { title: "16 bits per channel", value: 16 },
+];
+
+// 4:2:0 halves the color resolution in both directions, 4:4:4 keeps it
+export const CHROMA_SUBSAMPLINGS = [
+  { title: "4:4:4 (best)", value: "4:4:4" },
+  { title: "4:2:2", value: "4:2:2" },
+  { title: "4:2:0 (smallest)", value: "4:2:0" },
+];
+
+export type MetadataMode = "keep" | "removeLocation" | "strip" | "custom";
+
+export const METADATA_MODES: Array<{ title: string; value: MetadataMode }> = [
+  { title: "Keep all", value: "keep" },
+  { title: "Remove location", value: "removeLocation" },
+  { title: "Remove all", value: "strip" },
+  { title: "Choose", value: "custom" },
+];
+
+export interface MetadataSelection {
+  exif: boolean;
+  xmp: boolean;
+  icc: boolean;
+  location: boolean;
+}
+
+// Selections of the modes other than "custom"
+export const METADATA_MODE_SELECTIONS: Record<Exclude<MetadataMode, "custom">, MetadataSelection> = {
+  keep: { exif: true, xmp: true, icc: true, location: true },
+  removeLocation: { exif: true, xmp: true, icc: true, location: false },
+  strip: { exif: false, xmp: false, icc: false, location: false },
+};
@@ -1,45 +1,79 @@
-import { main } from "../../wailsjs/go/models";
-
-export enum ImageOperationType {
-  Brightness = 1,
-  Contrast,
-  Saturation,
-  Tint,
-  Greyscale,
-  Negative,
-  Sepia,
-  BoxBlur,
-  MotionBlur,
-  Sharpen,
-  Emboss,
-  EdgesHorizontal,
-  EdgesVertical,
-  Outline,
-}
+import { main, operations, project } from "../../wailsjs/go/models";
+
+export const getDefaultParams = (definition: operations.Definition) => {
+  const params: { [key: string]: any } = {};
+  for (const parameter of definition.parameters ?? []) {
+    params[parameter.name] = parameter.default;
+  }
+  return params;
+};
+
+// Name of group layers, whose members are in the layers of the operation
+export const GROUP_OPERATION_NAME = "group";
+
+// Name of graph layers, whose nodes are in the graph of the operation
+export const GRAPH_OPERATION_NAME = "graph";
+
+// Node every graph starts from, holding the input of the layer
+export const GRAPH_INPUT_NODE = 0;
+
+// Input of a graph node that is not connected
+export const NO_NODE = -1;
+
+export const DEFAULT_BLEND_MODE = "normal";
 
-export const imageOperationSelectItems: Array<{ type: ImageOperationType; label: string }> = [
-  { type: ImageOperationType.Brightness, label: "Brightness" },
-  { type: ImageOperationType.Contrast, label: "Contrast" },
-  { type: ImageOperationType.Saturation, label: "Saturation" },
-  { type: ImageOperationType.Tint, label: "Tint" },
-  { type: ImageOperationType.Greyscale, label: "Greyscale" },
-  { type: ImageOperationType.Negative, label: "Negative" },
-  { type: ImageOperationType.Sepia, label: "Sepia" },
-  { type: ImageOperationType.BoxBlur, label: "Blur" },
-  { type: ImageOperationType.MotionBlur, label: "Motion blur" },
-  { type: ImageOperationType.Sharpen, label: "Sharpen" },
-  { type: ImageOperationType.Emboss, label: "Emboss" },
-  { type: ImageOperationType.EdgesHorizontal, label: "Horizontal edges" },
-  { type: ImageOperationType.EdgesVertical, label: "Vertical edges" },
-  { type: ImageOperationType.Outline, label: "Outline" },
+const blendModeLabels: { [mode: string]: string } = {
+  normal: "Normal",
+  multiply: "Multiply",
+  screen: "Screen",
+  overlay: "Overlay",
+  softLight: "Soft light",
+  hardLight: "Hard light",
+  darken: "Darken",
+  lighten: "Lighten",
+  difference: "Difference",
+  color: "Color",
+  luminosity: "Luminosity",
+};
+
+export const getBlendModeLabel = (mode: string) => blendModeLabels[mode] ?? mode;
+
+export type MaskKind = "linearGradient" | "radialGradient" | "ellipse" | "rectangle" | "bitmap";
+
+export const maskKinds: Array<{ title: string; value: MaskKind }> = [
+  { title: "Linear gradient", value: "linearGradient" },
+  { title: "Radial gradient", value: "radialGradient" },
+  { title: "Ellipse", value: "ellipse" },
+  { title: "Rectangle", value: "rectangle" },
+  { title: "Image", value: "bitmap" },
 ];
 
+// Mask of the given kind covering the middle of the image, positions are relative to the image
+export const getDefaultMask = (kind: MaskKind) => {
+  return new project.MaskState({
+    kind,
+    start: { x: 0.5, y: 0 },
+    end: { x: 0.5, y: 1 },
+    center: { x: 0.5, y: 0.5 },
+    radius: { x: 0.35, y: 0.35 },
+    feather: kind === "radialGradient" ? 0 : 0.25,
+    inverted: false,
+  });
+};
+
 export interface ImageOperationDraggableItem {
   id: string;
   operation: main.ImageOperation;
   isEnabled: boolean;
 }
 
+// Payload of the "processing:progress" event emitted while layers are executed
+export interface ProcessingProgress {
+  layer: number;
+  layerCount: number;
+  percent: number;
+}
+
 const colorComponentToHex = (c: number) => {
   var hex = c.toString(16);
   return hex.length == 1 ? "0" + hex : hex;
@@ -1,33 +1,118 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
+import {batch} from '../models';
 import {main} from '../models';
+import {operations} from '../models';
+import {project} from '../models';
+
+export function AddGraphBlendNode(arg1:number,arg2:string,arg3:number):Promise<number>;
+
+export function AddGraphNode(arg1:number,arg2:main.ImageOperation):Promise<number>;
 
 export function AppendImageOperation(arg1:main.ImageOperation):Promise<Error>;
 
+export function ApplyPreset(arg1:string,arg2:boolean):Promise<Array<project.SkippedOperation>>;
+
+export function CancelBatch():Promise<void>;
+
+export function ConnectGraphNodes(arg1:number,arg2:number,arg3:number,arg4:number):Promise<Error>;
+
+export function ConvertToGraph(arg1:number,arg2:number):Promise<Error>;
+
+export function DeletePreset(arg1:string):Promise<Error>;
+
+export function DisconnectGraphNode(arg1:number,arg2:number,arg3:number):Promise<Error>;
+
+export function DuplicateImageOperation(arg1:number):Promise<Error>;
+
+export function ExportImage(arg1:main.ExportOptions):Promise<boolean>;
+
+export function ExportPreset(arg1:string):Promise<boolean>;
+
+export function GetFrameCount():Promise<number>;
+
+export function GetHistory():Promise<main.HistoryState>;
+
+export function GetImageOperations():Promise<Array<main.ImageOperation>>;
+
+export function GetImagePages():Promise<main.ImagePages>;
+
 export function GetOriginalImage():Promise<main.Base64Image>;
 
-export function GetUserSelectedProjectFileContent():Promise<string>;
+export function GetWorkingSpace():Promise<string>;
+
+export function GroupImageOperations(arg1:number,arg2:number):Promise<Error>;
 
-export function MirrorImageHorizontally():Promise<Error>;
+export function ImportPreset():Promise<string>;
 
-export function MirrorImageVertically():Promise<Error>;
+export function ListBlendModes():Promise<Array<string>>;
+
+export function ListOperations():Promise<Array<operations.Definition>>;
+
+export function ListPresets():Promise<Array<main.Preset>>;
+
+export function LoadProject():Promise<main.ProjectLoadResult>;
 
 export function MoveImageOperation(arg1:number,arg2:number):Promise<Error>;
 
 export function OpenImageFileSelector():Promise<boolean>;
 
+export function OpenMaskFileSelector(arg1:number):Promise<boolean>;
+
+export function ProcessBatch(arg1:batch.Options):Promise<batch.Summary>;
+
+export function ProcessFrame(arg1:number):Promise<main.Base64Image>;
+
 export function ProcessImage(arg1:number):Promise<main.Base64Image>;
 
+export function Redo():Promise<Error>;
+
+export function RemoveGraphNode(arg1:number,arg2:number):Promise<Error>;
+
 export function RemoveImageOperationAtIndex(arg1:number):Promise<Error>;
 
+export function RenamePreset(arg1:string,arg2:string):Promise<Error>;
+
 export function ReplaceImageOperationAtIndex(arg1:number,arg2:main.ImageOperation):Promise<Error>;
 
 export function ResetAppState():Promise<void>;
 
-export function RotateImageBy90Deg():Promise<Error>;
+export function SavePreset(arg1:string):Promise<Error>;
+
+export function SaveProject():Promise<boolean>;
+
+export function SelectBatchFiles():Promise<Array<string>>;
+
+export function SelectBatchFolder():Promise<Array<string>>;
+
+export function SelectImagePage(arg1:number):Promise<Error>;
+
+export function SelectOutputDirectory():Promise<string>;
+
+export function SetCacheBudget(arg1:number):Promise<Error>;
 
-export function SetOriginalImage(arg1:string):Promise<void>;
+export function SetGraphOutput(arg1:number,arg2:number):Promise<Error>;
+
+export function SetHistoryDepth(arg1:number):Promise<Error>;
+
+export function SetImageOperationBlending(arg1:number,arg2:string,arg3:number):Promise<Error>;
+
+export function SetImageOperationMask(arg1:number,arg2:project.MaskState):Promise<Error>;
+
+export function SetPreviewSize(arg1:number,arg2:number):Promise<Error>;
+
+export function SetProcessingTimeout(arg1:number):Promise<Error>;
+
+export function SetWorkingSpace(arg1:string):Promise<Error>;
 
 export function ToggleImageOperation(arg1:number):Promise<Error>;
 
+export function Undo():Promise<Error>;
+
+export function UngroupImageOperation(arg1:number):Promise<Error>;
+
+export function UpdateGraphBlendNode(arg1:number,arg2:number,arg3:string,arg4:number):Promise<Error>;
+
+export function UpdateGraphNode(arg1:number,arg2:number,arg3:main.ImageOperation):Promise<Error>;
+
 export function UpdateImageOperationAtIndex(arg1:number,arg2:main.ImageOperation):Promise<Error>;
@@ -2,24 +2,100 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
+export function AddGraphBlendNode(arg1, arg2, arg3) {
+  return window['go']['main']['App']['AddGraphBlendNode'](arg1, arg2, arg3);
+}
+
+export function AddGraphNode(arg1, arg2) {
+  return window['go']['main']['App']['AddGraphNode'](arg1, arg2);
+}
+
 export function AppendImageOperation(arg1) {
   return window['go']['main']['App']['AppendImageOperation'](arg1);
 }
 
+export function ApplyPreset(arg1, arg2) {
+  return window['go']['main']['App']['ApplyPreset'](arg1, arg2);
+}
+
+export function CancelBatch() {
+  return window['go']['main']['App']['CancelBatch']();
+}
+
+export function ConnectGraphNodes(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['ConnectGraphNodes'](arg1, arg2, arg3, arg4);
+}
+
+export function ConvertToGraph(arg1, arg2) {
+  return window['go']['main']['App']['ConvertToGraph'](arg1, arg2);
+}
+
+export function DeletePreset(arg1) {
+  return window['go']['main']['App']['DeletePreset'](arg1);
+}
+
+export function DisconnectGraphNode(arg1, arg2, arg3) {
+  return window['go']['main']['App']['DisconnectGraphNode'](arg1, arg2, arg3);
+}
+
+export function DuplicateImageOperation(arg1) {
+  return window['go']['main']['App']['DuplicateImageOperation'](arg1);
+}
+
+export function ExportImage(arg1) {
+  return window['go']['main']['App']['ExportImage'](arg1);
+}
+
+export function ExportPreset(arg1) {
+  return window['go']['main']['App']['ExportPreset'](arg1);
+}
+
+export function GetFrameCount() {
+  return window['go']['main']['App']['GetFrameCount']();
+}
+
+export function GetHistory() {
+  return window['go']['main']['App']['GetHistory']();
+}
+
+export function GetImageOperations() {
+  return window['go']['main']['App']['GetImageOperations']();
+}
+
+export function GetImagePages() {
+  return window['go']['main']['App']['GetImagePages']();
+}
+
 export function GetOriginalImage() {
   return window['go']['main']['App']['GetOriginalImage']();
 }
 
-export function GetUserSelectedProjectFileContent() {
-  return window['go']['main']['App']['GetUserSelectedProjectFileContent']();
+export function GetWorkingSpace() {
+  return window['go']['main']['App']['GetWorkingSpace']();
+}
+
+export function GroupImageOperations(arg1, arg2) {
+  return window['go']['main']['App']['GroupImageOperations'](arg1, arg2);
+}
+
+export function ImportPreset() {
+  return window['go']['main']['App']['ImportPreset']();
+}
+
+export function ListBlendModes() {
+  return window['go']['main']['App']['ListBlendModes']();
 }
 
-export function MirrorImageHorizontally() {
-  return window['go']['main']['App']['MirrorImageHorizontally']();
+export function ListOperations() {
+  return window['go']['main']['App']['ListOperations']();
 }
 
-export function MirrorImageVertically() {
-  return window['go']['main']['App']['MirrorImageVertically']();
+export function ListPresets() {
+  return window['go']['main']['App']['ListPresets']();
+}
+
+export function LoadProject() {
+  return window['go']['main']['App']['LoadProject']();
 }
 
 export function MoveImageOperation(arg1, arg2) {
@@ -30,14 +106,38 @@ export function OpenImageFileSelector() {
   return window['go']['main']['App']['OpenImageFileSelector']();
 }
 
+export function OpenMaskFileSelector(arg1) {
+  return window['go']['main']['App']['OpenMaskFileSelector'](arg1);
+}
+
+export function ProcessBatch(arg1) {
+  return window['go']['main']['App']['ProcessBatch'](arg1);
+}
+
+export function ProcessFrame(arg1) {
+  return window['go']['main']['App']['ProcessFrame'](arg1);
+}
+
 export function ProcessImage(arg1) {
   return window['go']['main']['App']['ProcessImage'](arg1);
 }
 
+export function Redo() {
+  return window['go']['main']['App']['Redo']();
+}
+
+export function RemoveGraphNode(arg1, arg2) {
+  return window['go']['main']['App']['RemoveGraphNode'](arg1, arg2);
+}
+
 export function RemoveImageOperationAtIndex(arg1) {
   return window['go']['main']['App']['RemoveImageOperationAtIndex'](arg1);
 }
 
+export function RenamePreset(arg1, arg2) {
+  return window['go']['main']['App']['RenamePreset'](arg1, arg2);
+}
+
 export function ReplaceImageOperationAtIndex(arg1, arg2) {
   return window['go']['main']['App']['ReplaceImageOperationAtIndex'](arg1, arg2);
 }
@@ -46,18 +146,82 @@ export function ResetAppState() {
   return window['go']['main']['App']['ResetAppState']();
 }
 
-export function RotateImageBy90Deg() {
-  return window['go']['main']['App']['RotateImageBy90Deg']();
+export function SavePreset(arg1) {
+  return window['go']['main']['App']['SavePreset'](arg1);
+}
+
+export function SaveProject() {
+  return window['go']['main']['App']['SaveProject']();
+}
+
+export function SelectBatchFiles() {
+  return window['go']['main']['App']['SelectBatchFiles']();
+}
+
+export function SelectBatchFolder() {
+  return window['go']['main']['App']['SelectBatchFolder']();
+}
+
+export function SelectImagePage(arg1) {
+  return window['go']['main']['App']['SelectImagePage'](arg1);
+}
+
+export function SelectOutputDirectory() {
+  return window['go']['main']['App']['SelectOutputDirectory']();
+}
+
+export function SetCacheBudget(arg1) {
+  return window['go']['main']['App']['SetCacheBudget'](arg1);
 }
 
-export function SetOriginalImage(arg1) {
-  return window['go']['main']['App']['SetOriginalImage'](arg1);
+export function SetGraphOutput(arg1, arg2) {
+  return window['go']['main']['App']['SetGraphOutput'](arg1, arg2);
+}
+
+export function SetHistoryDepth(arg1) {
+  return window['go']['main']['App']['SetHistoryDepth'](arg1);
+}
+
+export function SetImageOperationBlending(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SetImageOperationBlending'](arg1, arg2, arg3);
+}
+
+export function SetImageOperationMask(arg1, arg2) {
+  return window['go']['main']['App']['SetImageOperationMask'](arg1, arg2);
+}
+
+export function SetPreviewSize(arg1, arg2) {
+  return window['go']['main']['App']['SetPreviewSize'](arg1, arg2);
+}
+
+export function SetProcessingTimeout(arg1) {
+  return window['go']['main']['App']['SetProcessingTimeout'](arg1);
+}
+
+export function SetWorkingSpace(arg1) {
+  return window['go']['main']['App']['SetWorkingSpace'](arg1);
 }
 
 export function ToggleImageOperation(arg1) {
   return window['go']['main']['App']['ToggleImageOperation'](arg1);
 }
 
+export function Undo() {
+  return window['go']['main']['App']['Undo']();
+}
+
+export function UngroupImageOperation(arg1) {
+  return window['go']['main']['App']['UngroupImageOperation'](arg1);
+}
+
+export function UpdateGraphBlendNode(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['UpdateGraphBlendNode'](arg1, arg2, arg3, arg4);
+}
+
+export function UpdateGraphNode(arg1, arg2, arg3) {
+  return window['go']['main']['App']['UpdateGraphNode'](arg1, arg2, arg3);
+}
+
 export function UpdateImageOperationAtIndex(arg1, arg2) {
   return window['go']['main']['App']['UpdateImageOperationAtIndex'](arg1, arg2);
 }
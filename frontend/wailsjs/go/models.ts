@@ -1,3 +1,107 @@
+export namespace batch {
+	
+	export class Options {
+	    inputs: string[];
+	    outputDirectory: string;
+	    nameTemplate: string;
+	    concurrency: number;
+	    quality: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new Options(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.inputs = source["inputs"];
+	        this.outputDirectory = source["outputDirectory"];
+	        this.nameTemplate = source["nameTemplate"];
+	        this.concurrency = source["concurrency"];
+	        this.quality = source["quality"];
+	    }
+	}
+	export class Summary {
+	    total: number;
+	    succeeded: number;
+	    failed: number;
+	    canceled: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Summary(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.total = source["total"];
+	        this.succeeded = source["succeeded"];
+	        this.failed = source["failed"];
+	        this.canceled = source["canceled"];
+	    }
+	}
+
+}
+
+export namespace history {
+	
+	export class Entry {
+	    label: string;
+	    isApplied: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Entry(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.label = source["label"];
+	        this.isApplied = source["isApplied"];
+	    }
+	}
+
+}
+
+export namespace metadata {
+	
+	export class Selection {
+	    exif: boolean;
+	    xmp: boolean;
+	    icc: boolean;
+	    location: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new Selection(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.exif = source["exif"];
+	        this.xmp = source["xmp"];
+	        this.icc = source["icc"];
+	        this.location = source["location"];
+	    }
+	}
+
+}
+
+export namespace models {
+	
+	export class MaskPoint {
+	    x: number;
+	    y: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new MaskPoint(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.x = source["x"];
+	        this.y = source["y"];
+	    }
+	}
+
+}
+
 export namespace main {
 	
 	export class Base64Image {
@@ -16,28 +120,106 @@ export namespace main {
 	        this.base64 = source["base64"];
 	    }
 	}
-	export class TintRGB {
-	    r: number;
-	    g: number;
-	    b: number;
+	export class ExportOptions {
+	    format: string;
+	    compression?: string;
+	    quality?: number;
+	    chromaSubsampling?: string;
+	    bitDepth?: number;
+	    metadata: metadata.Selection;
 	
 	    static createFrom(source: any = {}) {
-	        return new TintRGB(source);
+	        return new ExportOptions(source);
 	    }
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.r = source["r"];
-	        this.g = source["g"];
-	        this.b = source["b"];
+	        this.format = source["format"];
+	        this.compression = source["compression"];
+	        this.quality = source["quality"];
+	        this.chromaSubsampling = source["chromaSubsampling"];
+	        this.bitDepth = source["bitDepth"];
+	        this.metadata = this.convertValues(source["metadata"], metadata.Selection);
+	    }
+
+	convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class HistoryState {
+	    entries: history.Entry[];
+	    canUndo: boolean;
+	    canRedo: boolean;
+	    depth: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new HistoryState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.entries = this.convertValues(source["entries"], history.Entry);
+	        this.canUndo = source["canUndo"];
+	        this.canRedo = source["canRedo"];
+	        this.depth = source["depth"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ImagePages {
+	    count: number;
+	    current: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ImagePages(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.count = source["count"];
+	        this.current = source["current"];
 	    }
 	}
 	export class ImageOperation {
-	    type: number;
-	    level?: number;
-	    tint?: TintRGB;
-	    kernelSize?: number;
+	    name: string;
+	    params?: {[key: string]: any};
 	    isEnabled: boolean;
+	    opacity?: number;
+	    blendMode?: string;
+	    mask?: project.MaskState;
+	    layers?: ImageOperation[];
+	    graph?: project.GraphState;
 	
 	    static createFrom(source: any = {}) {
 	        return new ImageOperation(source);
@@ -45,13 +227,49 @@ export namespace main {
 	
 	    constructor(source: any = {}) {
 	        if ('string' === typeof source) source = JSON.parse(source);
-	        this.type = source["type"];
-	        this.level = source["level"];
-	        this.tint = this.convertValues(source["tint"], TintRGB);
-	        this.kernelSize = source["kernelSize"];
+	        this.name = source["name"];
+	        this.params = source["params"];
 	        this.isEnabled = source["isEnabled"];
+	        this.opacity = source["opacity"];
+	        this.blendMode = source["blendMode"];
+	        this.mask = this.convertValues(source["mask"], project.MaskState);
+	        this.layers = this.convertValues(source["layers"], ImageOperation);
+	        this.graph = this.convertValues(source["graph"], project.GraphState);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class Preset {
+	    name: string;
+	    operations: ImageOperation[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Preset(source);
 	    }
 	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.operations = this.convertValues(source["operations"], ImageOperation);
+	    }
+
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
 		    if (!a) {
 		        return a;
@@ -71,5 +289,299 @@ export namespace main {
 		}
 	}
 
+	export class ProjectLoadResult {
+	    isLoaded: boolean;
+	    operations: ImageOperation[];
+	    skipped: project.SkippedOperation[];
+	    workingSpace: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ProjectLoadResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.isLoaded = source["isLoaded"];
+	        this.operations = this.convertValues(source["operations"], ImageOperation);
+	        this.skipped = this.convertValues(source["skipped"], project.SkippedOperation);
+	        this.workingSpace = source["workingSpace"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+}
+
+export namespace operations {
+	
+	export class ParameterSpec {
+	    name: string;
+	    label: string;
+	    kind: string;
+	    min: number;
+	    max: number;
+	    step: number;
+	    default: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new ParameterSpec(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.label = source["label"];
+	        this.kind = source["kind"];
+	        this.min = source["min"];
+	        this.max = source["max"];
+	        this.step = source["step"];
+	        this.default = source["default"];
+	    }
+	}
+	export class Definition {
+	    name: string;
+	    label: string;
+	    parameters: ParameterSpec[];
+	
+	    static createFrom(source: any = {}) {
+	        return new Definition(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.label = source["label"];
+	        this.parameters = this.convertValues(source["parameters"], ParameterSpec);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+}
+
+export namespace project {
+	
+	export class BlendState {
+	    blendMode: string;
+	    opacity: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new BlendState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.blendMode = source["blendMode"];
+	        this.opacity = source["opacity"];
+	    }
+	}
+	export class GraphNodeState {
+	    id: number;
+	    inputs: number[];
+	    layer?: OperationState;
+	    blend?: BlendState;
+	
+	    static createFrom(source: any = {}) {
+	        return new GraphNodeState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.inputs = source["inputs"];
+	        this.layer = this.convertValues(source["layer"], OperationState);
+	        this.blend = this.convertValues(source["blend"], BlendState);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class GraphState {
+	    nodes: GraphNodeState[];
+	    output: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new GraphState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.nodes = this.convertValues(source["nodes"], GraphNodeState);
+	        this.output = source["output"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class MaskState {
+	    kind: string;
+	    start?: models.MaskPoint;
+	    end?: models.MaskPoint;
+	    center?: models.MaskPoint;
+	    radius?: models.MaskPoint;
+	    feather?: number;
+	    inverted?: boolean;
+	    bitmap?: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new MaskState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.start = this.convertValues(source["start"], models.MaskPoint);
+	        this.end = this.convertValues(source["end"], models.MaskPoint);
+	        this.center = this.convertValues(source["center"], models.MaskPoint);
+	        this.radius = this.convertValues(source["radius"], models.MaskPoint);
+	        this.feather = source["feather"];
+	        this.inverted = source["inverted"];
+	        this.bitmap = source["bitmap"];
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class OperationState {
+	    name: string;
+	    params?: {[key: string]: any};
+	    isEnabled: boolean;
+	    opacity?: number;
+	    blendMode?: string;
+	    mask?: MaskState;
+	    layers?: OperationState[];
+	    graph?: GraphState;
+	
+	    static createFrom(source: any = {}) {
+	        return new OperationState(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.name = source["name"];
+	        this.params = source["params"];
+	        this.isEnabled = source["isEnabled"];
+	        this.opacity = source["opacity"];
+	        this.blendMode = source["blendMode"];
+	        this.mask = this.convertValues(source["mask"], MaskState);
+	        this.layers = this.convertValues(source["layers"], OperationState);
+	        this.graph = this.convertValues(source["graph"], GraphState);
+	    }
+
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+
+	export class SkippedOperation {
+	    index: number;
+	    name: string;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new SkippedOperation(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.index = source["index"];
+	        this.name = source["name"];
+	        this.reason = source["reason"];
+	    }
+	}
+
 }
 
@@ -0,0 +1,24 @@
+package history
+
+type funcCommand struct {
+	label string
+	do    func() error
+	undo  func() error
+}
+
+// Creates a command from a pair of functions that apply and revert a change
+func NewCommand(label string, do, undo func() error) Command {
+	return &funcCommand{label, do, undo}
+}
+
+func (this *funcCommand) Label() string {
+	return this.label
+}
+
+func (this *funcCommand) Do() error {
+	return this.do()
+}
+
+func (this *funcCommand) Undo() error {
+	return this.undo()
+}
@@ -0,0 +1,174 @@
+package history
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const DefaultDepth = 50
+
+// Consecutive commands closer together than this may be merged into one entry
+const DefaultCoalesceWindow = time.Second
+
+// Reversible change to the editing session
+type Command interface {
+	Label() string
+	Do() error
+	Undo() error
+}
+
+// Command that can absorb the command executed right after it, so that for example
+// every step of a slider drag ends up as a single history entry
+type Coalescer interface {
+	Coalesce(next Command) bool
+}
+
+type Entry struct {
+	Label     string `json:"label"`
+	IsApplied bool   `json:"isApplied"`
+}
+
+type History struct {
+	mutex          sync.Mutex
+	undoStack      []Command
+	redoStack      []Command
+	depth          int
+	CoalesceWindow time.Duration
+	lastExecutedAt time.Time
+}
+
+func New(depth int) *History {
+	return &History{
+		depth:          depth,
+		CoalesceWindow: DefaultCoalesceWindow,
+	}
+}
+
+// Runs the command and records it. Any undone commands are discarded.
+func (this *History) Execute(command Command) error {
+	if err := command.Do(); err != nil {
+		return err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.redoStack = nil
+
+	now := time.Now()
+	canCoalesce := len(this.undoStack) > 0 && now.Sub(this.lastExecutedAt) < this.CoalesceWindow
+	this.lastExecutedAt = now
+
+	if canCoalesce {
+		if previous, ok := this.undoStack[len(this.undoStack)-1].(Coalescer); ok && previous.Coalesce(command) {
+			return nil
+		}
+	}
+
+	this.undoStack = append(this.undoStack, command)
+	this.trim()
+	return nil
+}
+
+func (this *History) Undo() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.undoStack) == 0 {
+		return errors.New("Nothing to undo")
+	}
+
+	command := this.undoStack[len(this.undoStack)-1]
+	if err := command.Undo(); err != nil {
+		return err
+	}
+
+	this.undoStack = this.undoStack[:len(this.undoStack)-1]
+	this.redoStack = append(this.redoStack, command)
+	this.lastExecutedAt = time.Time{}
+	return nil
+}
+
+func (this *History) Redo() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if len(this.redoStack) == 0 {
+		return errors.New("Nothing to redo")
+	}
+
+	command := this.redoStack[len(this.redoStack)-1]
+	if err := command.Do(); err != nil {
+		return err
+	}
+
+	this.redoStack = this.redoStack[:len(this.redoStack)-1]
+	this.undoStack = append(this.undoStack, command)
+	this.lastExecutedAt = time.Time{}
+	return nil
+}
+
+func (this *History) CanUndo() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return len(this.undoStack) > 0
+}
+
+func (this *History) CanRedo() bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return len(this.redoStack) > 0
+}
+
+// Lists applied commands from oldest to newest, followed by the undone ones that can be redone
+func (this *History) Entries() []Entry {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	entries := make([]Entry, 0, len(this.undoStack)+len(this.redoStack))
+	for _, command := range this.undoStack {
+		entries = append(entries, Entry{Label: command.Label(), IsApplied: true})
+	}
+	for i := len(this.redoStack) - 1; i >= 0; i-- {
+		entries = append(entries, Entry{Label: this.redoStack[i].Label(), IsApplied: false})
+	}
+	return entries
+}
+
+func (this *History) Depth() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.depth
+}
+
+// Sets the maximum number of undoable commands, dropping the oldest ones if needed.
+// A depth of zero or less disables the limit.
+func (this *History) SetDepth(depth int) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.depth = depth
+	this.trim()
+}
+
+func (this *History) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.undoStack = nil
+	this.redoStack = nil
+	this.lastExecutedAt = time.Time{}
+}
+
+func (this *History) trim() {
+	if this.depth <= 0 || len(this.undoStack) <= this.depth {
+		return
+	}
+
+	excess := len(this.undoStack) - this.depth
+	this.undoStack = append([]Command(nil), this.undoStack[excess:]...)
+}
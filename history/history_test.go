@@ -0,0 +1,208 @@
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Sets a value, like a slider of the frontend, and absorbs the settings of the same value that
+// follow it
+type setValue struct {
+	target   *int
+	from, to int
+}
+
+func newSetValue(target *int, to int) *setValue {
+	return &setValue{target: target, from: *target, to: to}
+}
+
+func (this *setValue) Label() string {
+	return "Set value"
+}
+
+func (this *setValue) Do() error {
+	*this.target = this.to
+	return nil
+}
+
+func (this *setValue) Undo() error {
+	*this.target = this.from
+	return nil
+}
+
+func (this *setValue) Coalesce(next Command) bool {
+	other, ok := next.(*setValue)
+	if !ok || other.target != this.target {
+		return false
+	}
+	this.to = other.to
+	return true
+}
+
+func appendCommand(values *[]string, value string) Command {
+	return NewCommand("Append "+value, func() error {
+		*values = append(*values, value)
+		return nil
+	}, func() error {
+		*values = (*values)[:len(*values)-1]
+		return nil
+	})
+}
+
+func labels(entries []Entry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Label
+		if !entry.IsApplied {
+			result[i] += " (undone)"
+		}
+	}
+	return result
+}
+
+func TestUndoRedo(t *testing.T) {
+	var values []string
+	history := New(DefaultDepth)
+
+	for _, value := range []string{"a", "b", "c"} {
+		if err := history.Execute(appendCommand(&values, value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := history.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []string{"a"}) {
+		t.Errorf("Values after undoing twice are %v", values)
+	}
+	expected := []string{"Append a", "Append b (undone)", "Append c (undone)"}
+	if entries := labels(history.Entries()); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Entries are %v, expected %v", entries, expected)
+	}
+
+	if err := history.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []string{"a", "b"}) {
+		t.Errorf("Values after redoing are %v", values)
+	}
+	if !history.CanUndo() || !history.CanRedo() {
+		t.Error("Both undo and redo should be possible")
+	}
+}
+
+func TestUndoRedoWhenEmpty(t *testing.T) {
+	history := New(DefaultDepth)
+
+	if history.CanUndo() || history.Undo() == nil {
+		t.Error("Undo of an empty history succeeded")
+	}
+	if history.CanRedo() || history.Redo() == nil {
+		t.Error("Redo of an empty history succeeded")
+	}
+}
+
+func TestExecuteDropsRedoStack(t *testing.T) {
+	var values []string
+	history := New(DefaultDepth)
+
+	history.Execute(appendCommand(&values, "a"))
+	history.Execute(appendCommand(&values, "b"))
+	history.Undo()
+	history.Execute(appendCommand(&values, "c"))
+
+	if history.CanRedo() {
+		t.Error("Undone command can still be redone after a new one")
+	}
+	if !reflect.DeepEqual(values, []string{"a", "c"}) {
+		t.Errorf("Values are %v", values)
+	}
+	expected := []string{"Append a", "Append c"}
+	if entries := labels(history.Entries()); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Entries are %v, expected %v", entries, expected)
+	}
+}
+
+func TestCoalesceWithinWindow(t *testing.T) {
+	value := 0
+	history := New(DefaultDepth)
+	history.CoalesceWindow = time.Hour
+
+	for _, to := range []int{1, 2, 3} {
+		if err := history.Execute(newSetValue(&value, to)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if entries := history.Entries(); len(entries) != 1 {
+		t.Fatalf("Coalesced commands left %d entries", len(entries))
+	}
+	if value != 3 {
+		t.Errorf("Value is %d", value)
+	}
+
+	// A single undo reverts the whole drag
+	history.Undo()
+	if value != 0 {
+		t.Errorf("Value after undo is %d", value)
+	}
+	history.Redo()
+	if value != 3 {
+		t.Errorf("Value after redo is %d", value)
+	}
+}
+
+func TestCoalesceOutsideWindow(t *testing.T) {
+	value := 0
+	history := New(DefaultDepth)
+	history.CoalesceWindow = 10 * time.Millisecond
+
+	history.Execute(newSetValue(&value, 1))
+	time.Sleep(2 * history.CoalesceWindow)
+	history.Execute(newSetValue(&value, 2))
+
+	if entries := history.Entries(); len(entries) != 2 {
+		t.Fatalf("Commands apart from each other left %d entries", len(entries))
+	}
+	history.Undo()
+	if value != 1 {
+		t.Errorf("Value after undo is %d", value)
+	}
+}
+
+// Commands are not merged into one that was undone and redone, nor into other kinds of commands
+func TestCoalesceOnlyFollowingExecutes(t *testing.T) {
+	value := 0
+	var values []string
+	history := New(DefaultDepth)
+	history.CoalesceWindow = time.Hour
+
+	history.Execute(newSetValue(&value, 1))
+	history.Undo()
+	history.Redo()
+	history.Execute(newSetValue(&value, 2))
+	history.Execute(appendCommand(&values, "a"))
+
+	if entries := history.Entries(); len(entries) != 3 {
+		t.Errorf("History has %d entries, expected 3", len(entries))
+	}
+}
+
+func TestDepthDropsOldestCommands(t *testing.T) {
+	var values []string
+	history := New(2)
+
+	for _, value := range []string{"a", "b", "c"} {
+		history.Execute(appendCommand(&values, value))
+	}
+
+	expected := []string{"Append b", "Append c"}
+	if entries := labels(history.Entries()); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Entries are %v, expected %v", entries, expected)
+	}
+}
@@ -0,0 +1,214 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	orientationTag     = 0x0112
+	gpsTag             = 0x8825
+	thumbnailOffsetTag = 0x0201
+	thumbnailLengthTag = 0x0202
+
+	// Size of an IFD entry: tag, type, count and value or offset
+	entrySize = 12
+)
+
+// Sizes of the TIFF value types, by type number
+var typeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// TIFF structure holding the EXIF data
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	// Position of the entry in the data
+	position int
+	tag      uint16
+	typ      uint16
+	count    uint32
+}
+
+func parseTIFF(data []byte) (*tiff, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		return &tiff{data, binary.LittleEndian}, true
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		return &tiff{data, binary.BigEndian}, true
+	}
+	return nil, false
+}
+
+func (this *tiff) firstIFD() int {
+	return int(this.order.Uint32(this.data[4:8]))
+}
+
+// Returns the entries of the IFD at offset, false if it does not fit into the data
+func (this *tiff) entries(offset int) ([]ifdEntry, bool) {
+	if offset < 8 || offset+2 > len(this.data) {
+		return nil, false
+	}
+	count := int(this.order.Uint16(this.data[offset:]))
+	if offset+2+count*entrySize+4 > len(this.data) {
+		return nil, false
+	}
+
+	entries := make([]ifdEntry, count)
+	for i := range entries {
+		position := offset + 2 + i*entrySize
+		entries[i] = ifdEntry{
+			position: position,
+			tag:      this.order.Uint16(this.data[position:]),
+			typ:      this.order.Uint16(this.data[position+2:]),
+			count:    this.order.Uint32(this.data[position+4:]),
+		}
+	}
+	return entries, true
+}
+
+// Position of the offset of the IFD following the one at offset, which has the given entries
+func (this *tiff) nextIFDPosition(offset int, entries []ifdEntry) int {
+	return offset + 2 + len(entries)*entrySize
+}
+
+func (this *tiff) value(entry ifdEntry) uint32 {
+	if entry.typ == 3 {
+		return uint32(this.order.Uint16(this.data[entry.position+8:]))
+	}
+	return this.order.Uint32(this.data[entry.position+8:])
+}
+
+// Overwrites the data stored outside the entry with zeros
+func (this *tiff) clearValue(entry ifdEntry) {
+	size := typeSizes[entry.typ] * entry.count
+	if size <= 4 || entry.count > uint32(len(this.data)) {
+		return
+	}
+	this.clear(int(this.value(entry)), int(size))
+}
+
+func (this *tiff) clear(offset, size int) {
+	if offset < 8 || size <= 0 || offset+size > len(this.data) {
+		return
+	}
+	for i := offset; i < offset+size; i++ {
+		this.data[i] = 0
+	}
+}
+
+// Overwrites the IFD at offset and all data it points to with zeros
+func (this *tiff) clearIFD(offset int) {
+	entries, ok := this.entries(offset)
+	if !ok {
+		return
+	}
+	for _, entry := range entries {
+		this.clearValue(entry)
+	}
+	this.clear(offset, 2+len(entries)*entrySize+4)
+}
+
+// Returns the EXIF orientation, from 1 to 8, where 1 is upright. Returns 1 when there is none.
+func Orientation(exif []byte) int {
+	t, ok := parseTIFF(exif)
+	if !ok {
+		return 1
+	}
+	entries, _ := t.entries(t.firstIFD())
+	for _, entry := range entries {
+		if entry.tag == orientationTag && entry.typ == 3 {
+			if orientation := int(t.value(entry)); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+		}
+	}
+	return 1
+}
+
+// Returns a copy of the EXIF data with the given orientation, if it has one
+func withOrientation(exif []byte, orientation int) []byte {
+	t, ok := parseTIFF(append([]byte(nil), exif...))
+	if !ok {
+		return exif
+	}
+	entries, _ := t.entries(t.firstIFD())
+	for _, entry := range entries {
+		if entry.tag == orientationTag && entry.typ == 3 {
+			t.order.PutUint16(t.data[entry.position+8:], uint16(orientation))
+		}
+	}
+	return t.data
+}
+
+// Returns a copy of the EXIF data whose GPS IFD is removed and overwritten with zeros. Returns
+// false if the data cannot be parsed.
+func withoutGPS(exif []byte) ([]byte, bool) {
+	t, ok := parseTIFF(append([]byte(nil), exif...))
+	if !ok {
+		return nil, false
+	}
+	offset := t.firstIFD()
+	entries, ok := t.entries(offset)
+	if !ok {
+		return nil, false
+	}
+
+	for _, entry := range entries {
+		if entry.tag != gpsTag {
+			continue
+		}
+		t.clearIFD(int(t.value(entry)))
+
+		// Moves the following entries and the offset of the next IFD over the GPS entry
+		end := t.nextIFDPosition(offset, entries) + 4
+		copy(t.data[entry.position:], t.data[entry.position+entrySize:end])
+		t.clear(end-entrySize, entrySize)
+		t.order.PutUint16(t.data[offset:], uint16(len(entries)-1))
+		break
+	}
+
+	return t.data, true
+}
+
+// Returns a copy of the EXIF data without the IFD holding the thumbnail, which is overwritten
+// with zeros. Returns false if the data cannot be parsed.
+func withoutThumbnail(exif []byte) ([]byte, bool) {
+	t, ok := parseTIFF(append([]byte(nil), exif...))
+	if !ok {
+		return nil, false
+	}
+	offset := t.firstIFD()
+	entries, ok := t.entries(offset)
+	if !ok {
+		return nil, false
+	}
+
+	nextPosition := t.nextIFDPosition(offset, entries)
+	thumbnailIFD := int(t.order.Uint32(t.data[nextPosition:]))
+	if thumbnailIFD == 0 {
+		return t.data, true
+	}
+
+	if thumbnailEntries, ok := t.entries(thumbnailIFD); ok {
+		var thumbnailOffset, thumbnailLength int
+		for _, entry := range thumbnailEntries {
+			switch entry.tag {
+			case thumbnailOffsetTag:
+				thumbnailOffset = int(t.value(entry))
+			case thumbnailLengthTag:
+				thumbnailLength = int(t.value(entry))
+			}
+		}
+		t.clear(thumbnailOffset, thumbnailLength)
+		t.clearIFD(thumbnailIFD)
+	}
+	t.order.PutUint32(t.data[nextPosition:], 0)
+
+	return t.data, true
+}
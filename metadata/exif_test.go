@@ -0,0 +1,341 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tool7/image-processing/models"
+)
+
+const (
+	artistTag        = 0x013b
+	imageUniqueIDTag = 0xa420
+
+	// Layout of the EXIF data of newTestEXIF
+	gpsIFDOffset       = 62
+	gpsEnd             = 116
+	thumbnailIFDOffset = 116
+)
+
+var testThumbnail = []byte("\xff\xd8THUMBNAIL\xff\xd9")
+
+// EXIF data with an orientation, a GPS IFD with the latitude stored outside of it, an entry
+// after the GPS entry and a thumbnail in the second IFD
+func newTestEXIF(order binary.ByteOrder, orientation int) []byte {
+	data := make([]byte, thumbnailIFDOffset+2+2*entrySize+4+len(testThumbnail))
+	if order == binary.LittleEndian {
+		copy(data, "II*\x00")
+	} else {
+		copy(data, "MM\x00*")
+	}
+	order.PutUint32(data[4:], 8)
+
+	putIFD := func(offset int, next uint32, entries ...[]byte) {
+		order.PutUint16(data[offset:], uint16(len(entries)))
+		for i, entry := range entries {
+			copy(data[offset+2+i*entrySize:], entry)
+		}
+		order.PutUint32(data[offset+2+len(entries)*entrySize:], next)
+	}
+	entry := func(tag, typ uint16, count uint32, value []byte) []byte {
+		result := make([]byte, entrySize)
+		order.PutUint16(result, tag)
+		order.PutUint16(result[2:], typ)
+		order.PutUint32(result[4:], count)
+		copy(result[8:], value)
+		return result
+	}
+	short := func(value uint16) []byte {
+		result := make([]byte, 2)
+		order.PutUint16(result, value)
+		return result
+	}
+	long := func(value uint32) []byte {
+		result := make([]byte, 4)
+		order.PutUint32(result, value)
+		return result
+	}
+
+	putIFD(8, thumbnailIFDOffset,
+		entry(orientationTag, 3, 1, short(uint16(orientation))),
+		entry(artistTag, 2, 3, []byte("Me\x00")),
+		entry(gpsTag, 4, 1, long(gpsIFDOffset)),
+		entry(imageUniqueIDTag, 2, 3, []byte("id\x00")),
+	)
+	// Latitude reference and latitude, as three rationals
+	latitudeOffset := gpsIFDOffset + 2 + 2*entrySize + 4
+	putIFD(gpsIFDOffset, 0,
+		entry(1, 2, 2, []byte("N\x00")),
+		entry(2, 5, 3, long(uint32(latitudeOffset))),
+	)
+	for i, value := range []uint32{52, 1, 31, 1, 1234, 100} {
+		order.PutUint32(data[latitudeOffset+4*i:], value)
+	}
+
+	thumbnailOffset := thumbnailIFDOffset + 2 + 2*entrySize + 4
+	putIFD(thumbnailIFDOffset, 0,
+		entry(thumbnailOffsetTag, 4, 1, long(uint32(thumbnailOffset))),
+		entry(thumbnailLengthTag, 4, 1, long(uint32(len(testThumbnail)))),
+	)
+	copy(data[thumbnailOffset:], testThumbnail)
+
+	return data
+}
+
+var byteOrders = map[string]binary.ByteOrder{"little endian": binary.LittleEndian, "big endian": binary.BigEndian}
+
+func isZero(data []byte) bool {
+	return bytes.Count(data, []byte{0}) == len(data)
+}
+
+func ifdTags(t *testing.T, exif []byte, offset int) []uint16 {
+	parsed, _ := parseTIFF(exif)
+	entries, ok := parsed.entries(offset)
+	if !ok {
+		t.Fatalf("IFD at %d cannot be read", offset)
+	}
+	tags := make([]uint16, len(entries))
+	for i, entry := range entries {
+		tags[i] = entry.tag
+	}
+	return tags
+}
+
+func TestOrientation(t *testing.T) {
+	for name, order := range byteOrders {
+		for orientation := 1; orientation <= 8; orientation++ {
+			exif := newTestEXIF(order, orientation)
+			if actual := Orientation(exif); actual != orientation {
+				t.Errorf("%s orientation %d was read as %d", name, orientation, actual)
+			}
+
+			upright := withOrientation(exif, 1)
+			if actual := Orientation(upright); actual != 1 {
+				t.Errorf("%s orientation %d was reset to %d", name, orientation, actual)
+			}
+			if actual := Orientation(exif); actual != orientation {
+				t.Errorf("Resetting %s orientation %d changed the original to %d", name, orientation, actual)
+			}
+		}
+
+		// Values outside of the EXIF range count as upright
+		for _, orientation := range []int{0, 9} {
+			if actual := Orientation(newTestEXIF(order, orientation)); actual != 1 {
+				t.Errorf("%s orientation %d was read as %d", name, orientation, actual)
+			}
+		}
+	}
+
+	for _, exif := range [][]byte{nil, []byte("Exif"), []byte("II*\x00\xff\xff\x00\x00")} {
+		if actual := Orientation(exif); actual != 1 {
+			t.Errorf("Orientation of %q is %d", exif, actual)
+		}
+	}
+}
+
+func TestWithoutGPS(t *testing.T) {
+	for name, order := range byteOrders {
+		original := newTestEXIF(order, 6)
+		exif, ok := withoutGPS(original)
+		if !ok {
+			t.Fatalf("%s EXIF data cannot be parsed", name)
+		}
+
+		// The entries after the GPS entry move up
+		expected := []uint16{orientationTag, artistTag, imageUniqueIDTag}
+		if tags := ifdTags(t, exif, 8); !reflect.DeepEqual(tags, expected) {
+			t.Errorf("%s first IFD has tags %x, expected %x", name, tags, expected)
+		}
+		parsed, _ := parseTIFF(exif)
+		entries, _ := parsed.entries(8)
+		if value := exif[entries[2].position+8 : entries[2].position+11]; string(value) != "id\x00" {
+			t.Errorf("%s moved entry has value %q", name, value)
+		}
+		if next := parsed.order.Uint32(exif[parsed.nextIFDPosition(8, entries):]); next != thumbnailIFDOffset {
+			t.Errorf("%s next IFD is at %d", name, next)
+		}
+
+		if !isZero(exif[gpsIFDOffset:gpsEnd]) {
+			t.Errorf("%s GPS IFD and latitude were not cleared", name)
+		}
+		if Orientation(exif) != 6 || !bytes.Contains(exif, testThumbnail) {
+			t.Errorf("%s data besides the location was removed", name)
+		}
+		if !bytes.Equal(original, newTestEXIF(order, 6)) {
+			t.Errorf("%s original was changed", name)
+		}
+	}
+}
+
+func TestWithoutThumbnail(t *testing.T) {
+	for name, order := range byteOrders {
+		exif, ok := withoutThumbnail(newTestEXIF(order, 3))
+		if !ok {
+			t.Fatalf("%s EXIF data cannot be parsed", name)
+		}
+
+		parsed, _ := parseTIFF(exif)
+		entries, _ := parsed.entries(8)
+		if next := parsed.order.Uint32(exif[parsed.nextIFDPosition(8, entries):]); next != 0 {
+			t.Errorf("%s first IFD still links to an IFD at %d", name, next)
+		}
+		if !isZero(exif[thumbnailIFDOffset:]) {
+			t.Errorf("%s thumbnail IFD and image were not cleared", name)
+		}
+		if Orientation(exif) != 3 || len(ifdTags(t, exif, gpsIFDOffset)) != 2 {
+			t.Errorf("%s data besides the thumbnail was removed", name)
+		}
+	}
+
+	// Data without a second IFD stays as it is
+	exif := newTestEXIF(binary.LittleEndian, 1)
+	exif, _ = withoutThumbnail(exif)
+	if again, ok := withoutThumbnail(exif); !ok || !bytes.Equal(again, exif) {
+		t.Error("Data without a thumbnail was changed")
+	}
+}
+
+func TestSelect(t *testing.T) {
+	metadata := Metadata{EXIF: newTestEXIF(binary.BigEndian, 1), ICC: []byte("profile")}
+
+	selected := metadata.Select(Selection{EXIF: true, Location: true})
+	if bytes.Contains(selected.EXIF, testThumbnail) {
+		t.Error("Thumbnail was kept")
+	}
+	if len(ifdTags(t, selected.EXIF, 8)) != 4 || selected.ICC != nil {
+		t.Errorf("Selected %+v", selected)
+	}
+
+	selected = metadata.Select(Selection{EXIF: true, ICC: true})
+	if len(ifdTags(t, selected.EXIF, 8)) != 3 || !isZero(selected.EXIF[gpsIFDOffset:]) {
+		t.Error("Location or thumbnail was kept")
+	}
+	if string(selected.ICC) != "profile" {
+		t.Errorf("Profile is %q", selected.ICC)
+	}
+
+	// Data that cannot be parsed is only kept when the location may be
+	broken := Metadata{EXIF: []byte("broken")}
+	if selected := broken.Select(Selection{EXIF: true}); selected.EXIF != nil {
+		t.Error("Unparsed EXIF data was kept without the location")
+	}
+	if selected := broken.Select(Selection{EXIF: true, Location: true}); string(selected.EXIF) != "broken" {
+		t.Error("Unparsed EXIF data was left out with the location")
+	}
+}
+
+// Image as shown, 2x3 pixels of different colors, and as stored with each orientation. Column 0
+// of the stored image is the top row as shown for orientations 5 to 8.
+func orientedTestImages(orientation int) (upright, stored *image.RGBA) {
+	const width, height = 2, 3
+	upright = image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			upright.SetRGBA(x, y, color.RGBA{uint8(x * 100), uint8(y * 100), 0, 255})
+		}
+	}
+
+	// Upright position of the pixel stored at x, y
+	source := map[int]func(x, y int) (int, int){
+		1: func(x, y int) (int, int) { return x, y },
+		2: func(x, y int) (int, int) { return width - 1 - x, y },
+		3: func(x, y int) (int, int) { return width - 1 - x, height - 1 - y },
+		4: func(x, y int) (int, int) { return x, height - 1 - y },
+		5: func(x, y int) (int, int) { return y, x },
+		6: func(x, y int) (int, int) { return width - 1 - y, x },
+		7: func(x, y int) (int, int) { return width - 1 - y, height - 1 - x },
+		8: func(x, y int) (int, int) { return y, height - 1 - x },
+	}[orientation]
+
+	storedWidth, storedHeight := width, height
+	if orientation >= 5 {
+		storedWidth, storedHeight = height, width
+	}
+	stored = image.NewRGBA(image.Rect(0, 0, storedWidth, storedHeight))
+	for y := 0; y < storedHeight; y++ {
+		for x := 0; x < storedWidth; x++ {
+			stored.SetRGBA(x, y, upright.RGBAAt(source(x, y)))
+		}
+	}
+	return upright, stored
+}
+
+func TestOrientationOperations(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		upright, stored := orientedTestImages(orientation)
+
+		var img models.Image = stored
+		for _, operation := range orientationOperations(orientation) {
+			var err error
+			if img, err = operation.Execute(context.Background(), img); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !reflect.DeepEqual(img.(*image.RGBA).Pix, upright.Pix) || img.Bounds() != upright.Bounds() {
+			t.Errorf("Orientation %d turned %v into %v, expected %v", orientation, stored.Pix, img.(*image.RGBA).Pix, upright.Pix)
+		}
+	}
+}
+
+// JPEG files are turned upright when loaded, and keep an upright orientation in their metadata
+func TestLoadImageTurnsUpright(t *testing.T) {
+	directory := t.TempDir()
+
+	for orientation := 1; orientation <= 8; orientation++ {
+		upright, stored := orientedTestImages(orientation)
+
+		// Blocks of 8x8 pixels survive compression
+		enlarged := image.NewRGBA(image.Rect(0, 0, stored.Rect.Dx()*8, stored.Rect.Dy()*8))
+		for y := 0; y < enlarged.Rect.Dy(); y++ {
+			for x := 0; x < enlarged.Rect.Dx(); x++ {
+				enlarged.SetRGBA(x, y, stored.RGBAAt(x/8, y/8))
+			}
+		}
+		var buff bytes.Buffer
+		if err := jpeg.Encode(&buff, enlarged, &jpeg.Options{Quality: 100}); err != nil {
+			t.Fatal(err)
+		}
+		filePath := filepath.Join(directory, "oriented.jpg")
+		encoded := Write(buff.Bytes(), Metadata{EXIF: newTestEXIF(binary.LittleEndian, orientation)})
+		if err := os.WriteFile(filePath, encoded, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		img, metadata, err := LoadImage(filePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if Orientation(metadata.EXIF) != 1 {
+			t.Errorf("Orientation %d is %d after loading", orientation, Orientation(metadata.EXIF))
+		}
+		if size := img.Bounds().Size(); size != upright.Rect.Size().Mul(8) {
+			t.Fatalf("Orientation %d loaded with size %v", orientation, size)
+		}
+
+		for y := 0; y < upright.Rect.Dy(); y++ {
+			for x := 0; x < upright.Rect.Dx(); x++ {
+				expected := upright.RGBAAt(x, y)
+				actual := color.RGBAModel.Convert(img.At(x*8+4, y*8+4)).(color.RGBA)
+				if diff(actual.R, expected.R) > 8 || diff(actual.G, expected.G) > 8 {
+					t.Errorf("Orientation %d has %v at %d,%d, expected %v", orientation, actual, x, y, expected)
+				}
+			}
+		}
+	}
+}
+
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,114 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	app1Marker = 0xe1
+	app2Marker = 0xe2
+	sosMarker  = 0xda
+	eoiMarker  = 0xd9
+
+	// Largest payload of a JPEG segment, whose length includes its own two bytes
+	maxSegmentPayload = 0xffff - 2
+)
+
+var (
+	jpegSignature = []byte{0xff, 0xd8}
+	exifHeader    = []byte("Exif\x00\x00")
+	xmpHeader     = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	// Followed by the number of the chunk, starting at 1, and the number of chunks
+	iccHeader = []byte("ICC_PROFILE\x00")
+)
+
+// Reads the metadata segments in front of the image data
+func readJPEG(data []byte) Metadata {
+	var metadata Metadata
+	iccChunks := map[byte][]byte{}
+	var iccChunkCount byte
+
+	position := len(jpegSignature)
+	for position+4 <= len(data) && data[position] == 0xff {
+		marker := data[position+1]
+		if marker == 0xff {
+			// Fill byte
+			position++
+			continue
+		}
+		if marker == sosMarker || marker == eoiMarker {
+			break
+		}
+
+		length := int(binary.BigEndian.Uint16(data[position+2:]))
+		if length < 2 || position+2+length > len(data) {
+			break
+		}
+		payload := data[position+4 : position+2+length]
+
+		switch {
+		case marker == app1Marker && bytes.HasPrefix(payload, exifHeader):
+			metadata.EXIF = append([]byte(nil), payload[len(exifHeader):]...)
+		case marker == app1Marker && bytes.HasPrefix(payload, xmpHeader):
+			metadata.XMP = append([]byte(nil), payload[len(xmpHeader):]...)
+		case marker == app2Marker && bytes.HasPrefix(payload, iccHeader) && len(payload) >= len(iccHeader)+2:
+			iccChunks[payload[len(iccHeader)]] = payload[len(iccHeader)+2:]
+			iccChunkCount = payload[len(iccHeader)+1]
+		}
+
+		position += 2 + length
+	}
+
+	// A profile with missing chunks is left out
+	if iccChunkCount > 0 && len(iccChunks) == int(iccChunkCount) {
+		for i := byte(1); i <= iccChunkCount; i++ {
+			chunk, ok := iccChunks[i]
+			if !ok {
+				metadata.ICC = nil
+				break
+			}
+			metadata.ICC = append(metadata.ICC, chunk...)
+		}
+	}
+
+	return metadata
+}
+
+// Inserts the metadata segments right after the start of the image. EXIF and XMP data too large
+// for a single segment is left out.
+func writeJPEG(encoded []byte, metadata Metadata) []byte {
+	var segments bytes.Buffer
+
+	if len(metadata.EXIF) > 0 && len(exifHeader)+len(metadata.EXIF) <= maxSegmentPayload {
+		writeSegment(&segments, app1Marker, exifHeader, metadata.EXIF)
+	}
+	if len(metadata.XMP) > 0 && len(xmpHeader)+len(metadata.XMP) <= maxSegmentPayload {
+		writeSegment(&segments, app1Marker, xmpHeader, metadata.XMP)
+	}
+
+	chunkSize := maxSegmentPayload - len(iccHeader) - 2
+	chunkCount := (len(metadata.ICC) + chunkSize - 1) / chunkSize
+	if chunkCount <= 255 {
+		for i := 0; i < chunkCount; i++ {
+			end := (i + 1) * chunkSize
+			if end > len(metadata.ICC) {
+				end = len(metadata.ICC)
+			}
+			header := append(append([]byte(nil), iccHeader...), byte(i+1), byte(chunkCount))
+			writeSegment(&segments, app2Marker, header, metadata.ICC[i*chunkSize:end])
+		}
+	}
+
+	result := make([]byte, 0, len(encoded)+segments.Len())
+	result = append(result, encoded[:len(jpegSignature)]...)
+	result = append(result, segments.Bytes()...)
+	return append(result, encoded[len(jpegSignature):]...)
+}
+
+func writeSegment(buffer *bytes.Buffer, marker byte, header, payload []byte) {
+	length := 2 + len(header) + len(payload)
+	buffer.Write([]byte{0xff, marker, byte(length >> 8), byte(length)})
+	buffer.Write(header)
+	buffer.Write(payload)
+}
@@ -0,0 +1,155 @@
+// Package metadata reads the EXIF, XMP and ICC metadata of JPEG and PNG files and writes it into
+// exported images, leaving out what the user chose to strip.
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+	"tool7/image-processing/utils"
+)
+
+// Metadata of an image file, stored as found in the file
+type Metadata struct {
+	// TIFF structure of the EXIF data, without the "Exif" header of JPEG files
+	EXIF []byte `json:"exif,omitempty"`
+	// XMP packet
+	XMP []byte `json:"xmp,omitempty"`
+	// ICC color profile
+	ICC []byte `json:"icc,omitempty"`
+}
+
+func (this Metadata) IsEmpty() bool {
+	return len(this.EXIF) == 0 && len(this.XMP) == 0 && len(this.ICC) == 0
+}
+
+// Which metadata is kept in exported images
+type Selection struct {
+	EXIF bool `json:"exif"`
+	XMP  bool `json:"xmp"`
+	ICC  bool `json:"icc"`
+	// Whether GPS coordinates are kept in the EXIF and XMP data
+	Location bool `json:"location"`
+}
+
+// Returns the metadata to write into an exported image. The EXIF thumbnail is always left out,
+// since it shows the image before editing, and so is data that cannot be parsed well enough to
+// remove the location from it when the location is not kept.
+func (this Metadata) Select(selection Selection) Metadata {
+	var result Metadata
+
+	if selection.EXIF && len(this.EXIF) > 0 {
+		exif, ok := withoutThumbnail(this.EXIF)
+		if ok && !selection.Location {
+			exif, ok = withoutGPS(exif)
+		}
+		switch {
+		case ok:
+			result.EXIF = exif
+		case selection.Location:
+			result.EXIF = this.EXIF
+		}
+	}
+	if selection.XMP && len(this.XMP) > 0 {
+		result.XMP = this.XMP
+		if !selection.Location {
+			result.XMP = xmpWithoutGPS(this.XMP)
+		}
+	}
+	if selection.ICC {
+		result.ICC = this.ICC
+	}
+
+	return result
+}
+
+// Reads the metadata of a JPEG or PNG file. Metadata that cannot be parsed is left out, as is all
+// metadata of other formats.
+func Read(data []byte) Metadata {
+	switch {
+	case bytes.HasPrefix(data, jpegSignature):
+		return readJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		return readPNG(data)
+	}
+	return Metadata{}
+}
+
+// Adds the metadata to an encoded JPEG or PNG image. Other formats are returned unchanged.
+func Write(encoded []byte, metadata Metadata) []byte {
+	if metadata.IsEmpty() {
+		return encoded
+	}
+
+	switch {
+	case bytes.HasPrefix(encoded, jpegSignature):
+		return writeJPEG(encoded, metadata)
+	case bytes.HasPrefix(encoded, pngSignature):
+		return writePNG(encoded, metadata)
+	}
+	return encoded
+}
+
+// Decodes the image file together with its metadata. Images with an EXIF orientation are turned
+// upright, and the orientation in their metadata is reset to match.
+func LoadImage(filePath string) (models.Image, Metadata, error) {
+	return LoadImagePage(filePath, 0)
+}
+
+// Like LoadImage, for the given page of a multi-page TIFF file, see utils.ImagePageCount
+func LoadImagePage(filePath string, page int) (models.Image, Metadata, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	return DecodeImagePage(data, page)
+}
+
+// Like LoadImagePage, for the content of a file that was already read
+func DecodeImagePage(data []byte, page int) (models.Image, Metadata, error) {
+	img, err := utils.GetImagePageFromBytes(data, page)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := Read(data)
+	for _, operation := range orientationOperations(Orientation(metadata.EXIF)) {
+		img, err = operation.Execute(context.Background(), img)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	return img, metadata.upright(), nil
+}
+
+// Operations turning an image with the given EXIF orientation upright, in order
+func orientationOperations(orientation int) []models.ImageOperation {
+	switch orientation {
+	case 2:
+		return []models.ImageOperation{operations.NewVerticalMirrorOperation()}
+	case 3:
+		return []models.ImageOperation{operations.NewRotationOperation(operations.By180Deg)}
+	case 4:
+		return []models.ImageOperation{operations.NewHorizontalMirrorOperation()}
+	case 5:
+		return []models.ImageOperation{operations.NewRotationOperation(operations.By90Deg), operations.NewVerticalMirrorOperation()}
+	case 6:
+		return []models.ImageOperation{operations.NewRotationOperation(operations.By90Deg)}
+	case 7:
+		return []models.ImageOperation{operations.NewRotationOperation(operations.By270Deg), operations.NewVerticalMirrorOperation()}
+	case 8:
+		return []models.ImageOperation{operations.NewRotationOperation(operations.By270Deg)}
+	}
+	return nil
+}
+
+// Returns the metadata of an image that was turned upright
+func (this Metadata) upright() Metadata {
+	this.EXIF = withOrientation(this.EXIF, 1)
+	this.XMP = xmpWithOrientation(this.XMP, 1)
+	return this
+}
@@ -0,0 +1,143 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// Keyword of the iTXt chunk holding the XMP packet
+	xmpKeyword = "XML:com.adobe.xmp"
+	iccName    = "ICC Profile"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Reads the eXIf, iCCP and XMP iTXt chunks
+func readPNG(data []byte) Metadata {
+	var metadata Metadata
+
+	position := len(pngSignature)
+	for position+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[position:]))
+		if length < 0 || position+12+length > len(data) {
+			break
+		}
+		chunkType := string(data[position+4 : position+8])
+		chunk := data[position+8 : position+8+length]
+
+		switch chunkType {
+		case "eXIf":
+			metadata.EXIF = append([]byte(nil), chunk...)
+		case "iCCP":
+			if profile, ok := readICCChunk(chunk); ok {
+				metadata.ICC = profile
+			}
+		case "iTXt":
+			if xmp, ok := readXMPChunk(chunk); ok {
+				metadata.XMP = xmp
+			}
+		case "IEND":
+			return metadata
+		}
+
+		position += 12 + length
+	}
+
+	return metadata
+}
+
+// Profile name, compression method and zlib compressed profile
+func readICCChunk(chunk []byte) ([]byte, bool) {
+	nameEnd := bytes.IndexByte(chunk, 0)
+	if nameEnd < 0 || nameEnd+2 > len(chunk) || chunk[nameEnd+1] != 0 {
+		return nil, false
+	}
+	profile, err := inflate(chunk[nameEnd+2:])
+	return profile, err == nil
+}
+
+// Keyword, compression flag and method, language tag, translated keyword and text
+func readXMPChunk(chunk []byte) ([]byte, bool) {
+	if !bytes.HasPrefix(chunk, []byte(xmpKeyword+"\x00")) || len(chunk) < len(xmpKeyword)+3 {
+		return nil, false
+	}
+	isCompressed := chunk[len(xmpKeyword)+1] == 1
+	rest := chunk[len(xmpKeyword)+3:]
+
+	// Skips the language tag and the translated keyword
+	for i := 0; i < 2; i++ {
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return nil, false
+		}
+		rest = rest[end+1:]
+	}
+
+	if isCompressed {
+		text, err := inflate(rest)
+		return text, err == nil
+	}
+	return append([]byte(nil), rest...), true
+}
+
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// Inserts the metadata chunks right after the IHDR chunk, which always comes first
+func writePNG(encoded []byte, metadata Metadata) []byte {
+	headerEnd := len(pngSignature)
+	if headerEnd+8 <= len(encoded) {
+		headerEnd += 12 + int(binary.BigEndian.Uint32(encoded[headerEnd:]))
+	}
+	if headerEnd > len(encoded) {
+		return encoded
+	}
+
+	var chunks bytes.Buffer
+
+	if len(metadata.ICC) > 0 {
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		writer.Write(metadata.ICC)
+		writer.Close()
+
+		writeChunk(&chunks, "iCCP", append([]byte(iccName+"\x00\x00"), compressed.Bytes()...))
+	}
+	if len(metadata.EXIF) > 0 {
+		writeChunk(&chunks, "eXIf", metadata.EXIF)
+	}
+	if len(metadata.XMP) > 0 {
+		// Uncompressed, without language tag or translated keyword
+		writeChunk(&chunks, "iTXt", append([]byte(xmpKeyword+"\x00\x00\x00\x00\x00"), metadata.XMP...))
+	}
+
+	result := make([]byte, 0, len(encoded)+chunks.Len())
+	result = append(result, encoded[:headerEnd]...)
+	result = append(result, chunks.Bytes()...)
+	return append(result, encoded[headerEnd:]...)
+}
+
+func writeChunk(buffer *bytes.Buffer, chunkType string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+
+	buffer.Write(header[:])
+	buffer.Write(data)
+	binary.BigEndian.PutUint32(header[:4], crc.Sum32())
+	buffer.Write(header[:4])
+}
@@ -0,0 +1,37 @@
+package metadata
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// GPS properties of the EXIF schema, written as attributes or as elements
+	xmpGPSAttribute = regexp.MustCompile(`\s+exif:GPS\w*\s*=\s*("[^"]*"|'[^']*')`)
+	xmpGPSElement   = regexp.MustCompile(`(?s)<exif:(GPS\w*)\b[^>]*?(/>|>.*?</exif:GPS\w*>)`)
+
+	xmpOrientationAttribute = regexp.MustCompile(`(tiff:Orientation\s*=\s*["'])\d(["'])`)
+	xmpOrientationElement   = regexp.MustCompile(`(<tiff:Orientation>)\d(</tiff:Orientation>)`)
+)
+
+// Returns the XMP packet without its GPS properties. Returns nothing when GPS data is left over
+// afterwards, for example written with an unusual namespace prefix.
+func xmpWithoutGPS(xmp []byte) []byte {
+	result := xmpGPSAttribute.ReplaceAll(xmp, nil)
+	result = xmpGPSElement.ReplaceAll(result, nil)
+
+	if bytes.Contains(bytes.ToLower(result), []byte("gps")) {
+		return nil
+	}
+	return result
+}
+
+func xmpWithOrientation(xmp []byte, orientation int) []byte {
+	if len(xmp) == 0 {
+		return xmp
+	}
+	value := []byte("${1}" + strconv.Itoa(orientation) + "${2}")
+	result := xmpOrientationAttribute.ReplaceAll(xmp, value)
+	return xmpOrientationElement.ReplaceAll(result, value)
+}
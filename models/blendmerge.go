@@ -0,0 +1,38 @@
+package models
+
+import (
+	"context"
+	"fmt"
+)
+
+// Merges two images by blending the second over the first
+type BlendMerge struct {
+	BlendMode BlendMode
+	Opacity   float64
+}
+
+func NewBlendMerge(mode BlendMode, opacity float64) (*BlendMerge, error) {
+	if !mode.IsValid() {
+		return nil, NewError(InvalidOperation, fmt.Sprintf("Unknown blend mode %q", mode))
+	}
+	if !(opacity >= 0 && opacity <= 1) {
+		return nil, NewError(InvalidOperation, "Opacity has to be between 0 and 1")
+	}
+	return &BlendMerge{BlendMode: mode, Opacity: opacity}, nil
+}
+
+func (this *BlendMerge) InputCount() int {
+	return 2
+}
+
+func (this *BlendMerge) Merge(ctx context.Context, inputImages []Image) (Image, error) {
+	base, blend := inputImages[0], inputImages[1]
+	if base.Bounds() != blend.Bounds() {
+		return nil, NewError(InvalidOperation, "Blended images differ in size")
+	}
+	return Blend(ctx, base, blend, this.BlendMode, this.Opacity)
+}
+
+func (this *BlendMerge) Fingerprint() string {
+	return fmt.Sprintf("blendmerge:%s@%v", this.BlendMode, this.Opacity)
+}
@@ -0,0 +1,322 @@
+package models
+
+import (
+	"context"
+	"image"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// Describes how the output of a layer is combined with its input
+type BlendMode string
+
+const (
+	NormalBlend     BlendMode = "normal"
+	MultiplyBlend   BlendMode = "multiply"
+	ScreenBlend     BlendMode = "screen"
+	OverlayBlend    BlendMode = "overlay"
+	SoftLightBlend  BlendMode = "softLight"
+	HardLightBlend  BlendMode = "hardLight"
+	DarkenBlend     BlendMode = "darken"
+	LightenBlend    BlendMode = "lighten"
+	DifferenceBlend BlendMode = "difference"
+	ColorBlend      BlendMode = "color"
+	LuminosityBlend BlendMode = "luminosity"
+)
+
+var BlendModes = []BlendMode{
+	NormalBlend,
+	MultiplyBlend,
+	ScreenBlend,
+	OverlayBlend,
+	SoftLightBlend,
+	HardLightBlend,
+	DarkenBlend,
+	LightenBlend,
+	DifferenceBlend,
+	ColorBlend,
+	LuminosityBlend,
+}
+
+func (this BlendMode) IsValid() bool {
+	for _, mode := range BlendModes {
+		if mode == this {
+			return true
+		}
+	}
+	return false
+}
+
+// Blends a color channel of the layer output over the same channel of its input. Channels range
+// from 0 to 1.
+type separableBlendFunc func(base, blend float64) float64
+
+// Blends all color channels of a pixel at once, for modes that mix channels
+type blendFunc func(base, blend [3]float64) [3]float64
+
+// Blend mode formulas as defined by the W3C Compositing and Blending specification
+var separableBlendFuncs = map[BlendMode]separableBlendFunc{
+	NormalBlend: func(_, blend float64) float64 {
+		return blend
+	},
+	MultiplyBlend: func(base, blend float64) float64 {
+		return base * blend
+	},
+	ScreenBlend: screen,
+	OverlayBlend: func(base, blend float64) float64 {
+		return hardLight(blend, base)
+	},
+	SoftLightBlend: softLight,
+	HardLightBlend: hardLight,
+	DarkenBlend:    math.Min,
+	LightenBlend:   math.Max,
+	DifferenceBlend: func(base, blend float64) float64 {
+		return math.Abs(base - blend)
+	},
+}
+
+var nonSeparableBlendFuncs = map[BlendMode]blendFunc{
+	ColorBlend: func(base, blend [3]float64) [3]float64 {
+		return setLuminosity(blend, luminosity(base))
+	},
+	LuminosityBlend: func(base, blend [3]float64) [3]float64 {
+		return setLuminosity(base, luminosity(blend))
+	},
+}
+
+// Results of a separable mode for all pairs of 8 bit channels, indexed by base<<8 | blend
+type blendTable [256 * 256]uint8
+
+var blendTables sync.Map
+
+func separableBlendTable(mode BlendMode, fn separableBlendFunc) *blendTable {
+	if table, ok := blendTables.Load(mode); ok {
+		return table.(*blendTable)
+	}
+
+	table := &blendTable{}
+	for base := 0; base < 256; base++ {
+		for blend := 0; blend < 256; blend++ {
+			table[base<<8|blend] = toChannel[uint8](fn(float64(base)/255, float64(blend)/255))
+		}
+	}
+
+	actual, _ := blendTables.LoadOrStore(mode, table)
+	return actual.(*blendTable)
+}
+
+func screen(base, blend float64) float64 {
+	return base + blend - base*blend
+}
+
+func hardLight(base, blend float64) float64 {
+	if blend <= 0.5 {
+		return base * 2 * blend
+	}
+	return screen(base, 2*blend-1)
+}
+
+func softLight(base, blend float64) float64 {
+	if blend <= 0.5 {
+		return base - (1-2*blend)*base*(1-base)
+	}
+
+	var d float64
+	if base <= 0.25 {
+		d = ((16*base-12)*base + 4) * base
+	} else {
+		d = math.Sqrt(base)
+	}
+	return base + (2*blend-1)*(d-base)
+}
+
+func luminosity(color [3]float64) float64 {
+	return 0.3*color[0] + 0.59*color[1] + 0.11*color[2]
+}
+
+// Shifts color to the given luminosity and brings it back into range, keeping its hue
+func setLuminosity(color [3]float64, lum float64) [3]float64 {
+	delta := lum - luminosity(color)
+	color = [3]float64{color[0] + delta, color[1] + delta, color[2] + delta}
+
+	lum = luminosity(color)
+	low := math.Min(color[0], math.Min(color[1], color[2]))
+	high := math.Max(color[0], math.Max(color[1], color[2]))
+
+	for i := range color {
+		if low < 0 {
+			color[i] = lum + (color[i]-lum)*lum/(lum-low)
+		}
+		if high > 1 {
+			color[i] = lum + (color[i]-lum)*(1-lum)/(high-lum)
+		}
+	}
+	return color
+}
+
+// Blends blendImage over baseImage with the given mode, as defined by the W3C Compositing and
+// Blending specification. The mode applies to the straight colors of both images, where the
+// blended image shows with its alpha times opacity over the base image, which also gives the
+// alpha of the result. Both images need the same bounds and depth. Linear images are blended in
+// linear light.
+func Blend(ctx context.Context, baseImage, blendImage Image, mode BlendMode, opacity float64) (Image, error) {
+	if !SameDepth(baseImage, blendImage) {
+		return nil, NewError(InvalidOperation, "Blended images differ in bit depth")
+	}
+
+	switch base := baseImage.(type) {
+	case *image.RGBA64:
+		return blendChannels(ctx, Channels16(base), Channels16(blendImage.(*image.RGBA64)), mode, opacity)
+	case *LinearImage:
+		return blendChannels(ctx, ChannelsLinear(base), ChannelsLinear(blendImage.(*LinearImage)), mode, opacity)
+	}
+	return blendChannels(ctx, Channels8(baseImage.(*image.RGBA)), Channels8(blendImage.(*image.RGBA)), mode, opacity)
+}
+
+func blendChannels[C Channel](ctx context.Context, baseImage, blendImage Channels[C], mode BlendMode, opacity float64) (Image, error) {
+	max := float64(ChannelMax[C]())
+	opacity = clampUnit(opacity)
+	weight := int(math.Round(opacity * float64(mixScale[C]())))
+	colors := blendColorsFunc(mode)
+
+	// Opaque pixels are blended channel by channel, since their straight colors are the channels
+	// themselves, and keep their alpha
+	blendOpaque := func(base, blend, output []C) {
+		result := colors(
+			[3]float64{float64(base[0]) / max, float64(base[1]) / max, float64(base[2]) / max},
+			[3]float64{float64(blend[0]) / max, float64(blend[1]) / max, float64(blend[2]) / max},
+		)
+		for c := 0; c < 3; c++ {
+			output[c] = mix(base[c], toChannel[C](result[c]), weight)
+		}
+		output[3] = base[3]
+	}
+
+	fn, isSeparable := separableBlendFuncs[mode]
+	if _, is8Bit := any(baseImage.Values).([]uint8); is8Bit && isSeparable {
+		table := separableBlendTable(mode, fn)
+
+		blendOpaque = func(base, blend, output []C) {
+			for c := 0; c < 3; c++ {
+				output[c] = mix(base[c], C(table[int(base[c])<<8|int(blend[c])]), weight)
+			}
+			output[3] = base[3]
+		}
+	}
+
+	bounds := baseImage.Rect
+	outputImage := NewChannels[C](bounds)
+
+	err := forEachRowParallel(ctx, bounds, func(y int) {
+		baseRow, blendRow, outputRow := baseImage.Row(y), blendImage.Row(y), outputImage.Row(y)
+		for i := 0; i < len(baseRow); i += 4 {
+			base, blend, output := baseRow[i:i+4:i+4], blendRow[i:i+4:i+4], outputRow[i:i+4:i+4]
+			if base[3] == ChannelMax[C]() && blend[3] == ChannelMax[C]() {
+				blendOpaque(base, blend, output)
+			} else {
+				compositePixel(base, blend, output, colors, opacity)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imageFromChannels(outputImage), nil
+}
+
+// Blend formula of the mode for straight colors, normal for unknown modes
+func blendColorsFunc(mode BlendMode) blendFunc {
+	if fn, ok := nonSeparableBlendFuncs[mode]; ok {
+		return fn
+	}
+
+	fn, ok := separableBlendFuncs[mode]
+	if !ok {
+		fn = separableBlendFuncs[NormalBlend]
+	}
+	return func(base, blend [3]float64) [3]float64 {
+		return [3]float64{fn(base[0], blend[0]), fn(base[1], blend[1]), fn(base[2], blend[2])}
+	}
+}
+
+// Composites a premultiplied pixel of the blended image over one of the base image. Where both
+// are transparent in part, the blended color only mixes with the base color as much as they
+// overlap, and shows as it is elsewhere.
+func compositePixel[C Channel](base, blend, output []C, colors blendFunc, opacity float64) {
+	max := float64(ChannelMax[C]())
+	baseAlpha := float64(base[3]) / max
+	blendAlpha := float64(blend[3]) / max
+	sourceAlpha := blendAlpha * opacity
+	outputAlpha := sourceAlpha + baseAlpha - sourceAlpha*baseAlpha
+
+	var baseColor, blendColor [3]float64
+	for c := 0; c < 3; c++ {
+		if baseAlpha > 0 {
+			baseColor[c] = math.Min(1, float64(base[c])/max/baseAlpha)
+		}
+		if blendAlpha > 0 {
+			blendColor[c] = math.Min(1, float64(blend[c])/max/blendAlpha)
+		}
+	}
+	mixed := colors(baseColor, blendColor)
+
+	for c := 0; c < 3; c++ {
+		value := sourceAlpha*(1-baseAlpha)*blendColor[c] +
+			sourceAlpha*baseAlpha*clampUnit(mixed[c]) +
+			(1-sourceAlpha)*float64(base[c])/max
+		// Colors cannot exceed alpha after rounding, since both are rounded alike
+		output[c] = toChannel[C](math.Min(value, outputAlpha))
+	}
+	output[3] = toChannel[C](outputAlpha)
+}
+
+// Calls fn for every row of bounds, with the rows split between runtime.NumCPU goroutines, as many
+// as utils.ProcessTiles uses by default. Stops with the context error once ctx is cancelled.
+// Blending, masking and color space conversion run here rather than through utils.ProcessTiles,
+// which imports this package. They read no neighbors and are a single cheap pass after the layer
+// operation, whose progress stands for the whole layer, so they report none of their own.
+func forEachRowParallel(ctx context.Context, bounds image.Rectangle, fn func(y int)) error {
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for y := bounds.Min.Y + worker; y < bounds.Max.Y && ctx.Err() == nil; y += workers {
+				fn(y)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// Largest weight of mix, which is the largest channel value for integer channels
+func mixScale[C Channel]() int {
+	if IsFloatChannel[C]() {
+		return 0xffff
+	}
+	return int(ChannelMax[C]())
+}
+
+// Interpolates from a to b by weight out of mixScale
+func mix[C Channel](a, b C, weight int) C {
+	if IsFloatChannel[C]() {
+		w := float32(weight) / 0xffff
+		return C(float32(a)*(1-w) + float32(b)*w)
+	}
+	max := int(ChannelMax[C]())
+	return C((int(a)*(max-weight) + int(b)*weight + max/2) / max)
+}
+
+func toChannel[C Channel](value float64) C {
+	if IsFloatChannel[C]() {
+		return C(clampUnit(value))
+	}
+	return C(math.Round(clampUnit(value) * float64(ChannelMax[C]())))
+}
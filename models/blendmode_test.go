@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// Semi-transparent pixels of every color, alpha and premultiplied value
+func newTranslucentImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			alpha := uint8(x * 17)
+			img.SetRGBA(x, y, color.RGBA{
+				R: uint8(int(alpha) * y / 15),
+				G: uint8(int(alpha) * (15 - y) / 15),
+				B: alpha / 2,
+				A: alpha,
+			})
+		}
+	}
+	return img
+}
+
+func TestBlendScreenOfTranslucentPixels(t *testing.T) {
+	tests := []struct {
+		pixel, expected color.RGBA
+	}{
+		// Half transparent white stays white, with alpha 0.5 over 0.5
+		{color.RGBA{128, 128, 128, 128}, color.RGBA{192, 192, 192, 192}},
+		// Straight 50% grey screened over itself is 75% grey where both overlap
+		{color.RGBA{64, 64, 64, 128}, color.RGBA{112, 112, 112, 192}},
+	}
+
+	for _, test := range tests {
+		img := newUniformImage(1, 1, test.pixel)
+
+		result, err := Blend(context.Background(), img, img, ScreenBlend, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pixel := rgbaAt(result, 0, 0); pixel != test.expected {
+			t.Errorf("Screen of %v is %v, expected %v", test.pixel, pixel, test.expected)
+		}
+	}
+}
+
+func TestBlendOpaquePixels(t *testing.T) {
+	base := newUniformImage(1, 1, color.RGBA{200, 100, 50, 255})
+	blend := newUniformImage(1, 1, color.RGBA{128, 255, 0, 255})
+
+	result, err := Blend(context.Background(), base, blend, MultiplyBlend, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Halfway between the base and the product of both
+	expected := color.RGBA{150, 100, 25, 255}
+	if pixel := rgbaAt(result, 0, 0); pixel != expected {
+		t.Errorf("Result is %v, expected %v", pixel, expected)
+	}
+}
+
+// 16-bit images are blended with 16-bit precision
+func TestBlend16BitPixels(t *testing.T) {
+	base := newUniformImage16(1, 1, color.RGBA64{0xc8a1, 0x6413, 0x3207, 0xffff})
+	blend := newUniformImage16(1, 1, color.RGBA64{0x8080, 0xffff, 0x00ff, 0xffff})
+
+	result, err := Blend(context.Background(), base, blend, MultiplyBlend, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pixel, ok := result.(*image.RGBA64)
+	if !ok {
+		t.Fatalf("Result is %T", result)
+	}
+
+	// Halfway between the base and the product of both
+	expected := color.RGBA64{38571, 25619, 6428, 0xffff}
+	if actual := pixel.RGBA64At(0, 0); actual != expected {
+		t.Errorf("Result is %v, expected %v", actual, expected)
+	}
+}
+
+func TestBlendNormalIsSourceOver(t *testing.T) {
+	base := newUniformImage(1, 1, color.RGBA{0, 0, 200, 200})
+	blend := newUniformImage(1, 1, color.RGBA{100, 0, 0, 100})
+
+	result, err := Blend(context.Background(), base, blend, NormalBlend, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := color.RGBA{100, 0, 122, 222}
+	if pixel := rgbaAt(result, 0, 0); pixel != expected {
+		t.Errorf("Result is %v, expected %v", pixel, expected)
+	}
+}
+
+// Colors never exceed alpha, at any depth
+func TestBlendKeepsPremultipliedColors(t *testing.T) {
+	base := newTranslucentImage()
+	blend := newTranslucentImage()
+	// Blend the pixels against other alphas than their own
+	for i := 0; i < len(blend.Pix); i += 4 {
+		blend.Pix[i] = blend.Pix[i+3] / 3
+	}
+
+	depths := map[string]func(*image.RGBA) Image{
+		"8-bit": func(img *image.RGBA) Image { return img },
+		"16-bit": func(img *image.RGBA) Image {
+			converted := image.NewRGBA64(img.Rect)
+			draw.Draw(converted, img.Rect, img, img.Rect.Min, draw.Src)
+			return converted
+		},
+		"linear": func(img *image.RGBA) Image { return ToLinearImage(img) },
+	}
+
+	for depth, convert := range depths {
+		for _, mode := range BlendModes {
+			result, err := Blend(context.Background(), convert(base), convert(blend), mode, 0.6)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bounds := result.Bounds()
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					r, g, b, a := result.At(x, y).RGBA()
+					if r > a || g > a || b > a {
+						t.Errorf("%s %s blend has color %v at %d,%d", depth, mode, result.At(x, y), x, y)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"math"
+	"sync"
+)
+
+// Color space of the values an image or operation works with
+type ColorSpace string
+
+const (
+	// Gamma encoded sRGB, whose values are spaced about as evenly as the eye perceives them
+	PerceptualSpace ColorSpace = "perceptual"
+	// Linear light, whose values are proportional to physical intensity, see LinearImage
+	LinearSpace ColorSpace = "linear"
+	// Either, for operations that only move pixels around
+	AnySpace ColorSpace = "any"
+)
+
+// Whether layers can work in the color space, which AnySpace is not. Empty stands for perceptual.
+func (this ColorSpace) IsWorkingSpace() bool {
+	return this == "" || this == PerceptualSpace || this == LinearSpace
+}
+
+// Operations implement this to tell which color space they expect their input in. Operations
+// that do not are given perceptual input.
+type ColorSpaceOperation interface {
+	InputColorSpace() ColorSpace
+}
+
+func InputColorSpace(operation ImageOperation) ColorSpace {
+	if operation, ok := operation.(ColorSpaceOperation); ok {
+		return operation.InputColorSpace()
+	}
+	return PerceptualSpace
+}
+
+// sRGB transfer functions for values from 0 to 1
+func SRGBToLinear(value float64) float64 {
+	if value <= 0.04045 {
+		return value / 12.92
+	}
+	return math.Pow((value+0.055)/1.055, 2.4)
+}
+
+func LinearToSRGB(value float64) float64 {
+	if value <= 0.0031308 {
+		return value * 12.92
+	}
+	return 1.055*math.Pow(value, 1/2.4) - 0.055
+}
+
+// Linear values of every 8 and 16-bit sRGB value, and sRGB values at evenly spaced linear values
+// that encodeSRGB interpolates between
+var (
+	transferTablesOnce sync.Once
+	decodeTable8       [1 << 8]float32
+	decodeTable16      [1 << 16]float32
+	encodeTable        [encodeTableSize + 1]float32
+)
+
+// Segments of encodeTable. The slope of the sRGB curve is steepest near black, where linear
+// interpolation between 64k samples still stays well below a 16-bit step.
+const encodeTableSize = 1 << 16
+
+func initTransferTables() {
+	transferTablesOnce.Do(func() {
+		for value := range decodeTable8 {
+			decodeTable8[value] = float32(SRGBToLinear(float64(value) / 0xff))
+		}
+		for value := range decodeTable16 {
+			decodeTable16[value] = float32(SRGBToLinear(float64(value) / 0xffff))
+		}
+		for index := range encodeTable {
+			encodeTable[index] = float32(LinearToSRGB(float64(index) / encodeTableSize))
+		}
+	})
+}
+
+// Linear value of a straight sRGB channel
+func decodeSRGB[C uint8 | uint16](value C) float32 {
+	if ^C(0) == 0xff {
+		return decodeTable8[value]
+	}
+	return decodeTable16[value]
+}
+
+// sRGB value from 0 to 1 of a straight linear channel, clipped to that range
+func encodeSRGB(value float32) float32 {
+	position := value * encodeTableSize
+	if !(position > 0) {
+		return 0
+	}
+	if position >= encodeTableSize {
+		return 1
+	}
+	index := int(position)
+	low := encodeTable[index]
+	return low + (encodeTable[index+1]-low)*(position-float32(index))
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+type ErrorCode string
+
+const (
+	UnknownError      ErrorCode = "unknown"
+	InvalidIndex      ErrorCode = "invalidIndex"
+	UnsupportedFormat ErrorCode = "unsupportedFormat"
+	DecodeFailed      ErrorCode = "decodeFailed"
+	OperationFailed   ErrorCode = "operationFailed"
+	InvalidOperation  ErrorCode = "invalidOperation"
+	NoImageLoaded     ErrorCode = "noImageLoaded"
+	Canceled          ErrorCode = "canceled"
+	TimedOut          ErrorCode = "timedOut"
+)
+
+// Error with a code describing what went wrong, so callers can react without parsing messages
+type Error struct {
+	Code    ErrorCode
+	Message string
+	// Index of the layer that failed when Code is OperationFailed, -1 otherwise
+	Layer int
+	Err   error
+}
+
+func NewError(code ErrorCode, message string) *Error {
+	return &Error{Code: code, Message: message, Layer: -1}
+}
+
+func WrapError(code ErrorCode, err error, message string) *Error {
+	return &Error{Code: code, Message: message, Layer: -1, Err: err}
+}
+
+// Error of the layer at the given index of a collection whose operation failed
+func NewLayerError(layer int, err error) *Error {
+	return &Error{
+		Code:    OperationFailed,
+		Message: fmt.Sprintf("Layer %d failed", layer+1),
+		Layer:   layer,
+		Err:     err,
+	}
+}
+
+func (this *Error) Error() string {
+	if this.Err == nil {
+		return this.Message
+	}
+	return this.Message + ": " + this.Err.Error()
+}
+
+func (this *Error) Unwrap() error {
+	return this.Err
+}
+
+// Returns the code of the first Error in the chain of err
+func ErrorCodeOf(err error) ErrorCode {
+	var codedError *Error
+	if errors.As(err, &codedError) {
+		return codedError.Code
+	}
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return TimedOut
+	}
+	return UnknownError
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"testing"
+)
+
+// Fails with Err, or with the error of its context once that is done
+type failingOperation struct {
+	Err error
+}
+
+func (this failingOperation) Execute(ctx context.Context, inputImage Image) (Image, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return nil, this.Err
+}
+
+func TestErrorCodeOf(t *testing.T) {
+	failure := errors.New("disk full")
+
+	tests := []struct {
+		err      error
+		expected ErrorCode
+	}{
+		{nil, UnknownError},
+		{failure, UnknownError},
+		{NewError(InvalidIndex, "No layer 3"), InvalidIndex},
+		{WrapError(DecodeFailed, failure, "Failed to load project"), DecodeFailed},
+		{fmt.Errorf("Opening: %w", NewError(UnsupportedFormat, "WebP cannot be written")), UnsupportedFormat},
+		{NewLayerError(2, failure), OperationFailed},
+		{context.Canceled, Canceled},
+		{fmt.Errorf("Rendering: %w", context.DeadlineExceeded), TimedOut},
+		// The first coded error wins over the context errors it wraps
+		{WrapError(InvalidOperation, context.Canceled, "Batch stopped"), InvalidOperation},
+		{NewLayerError(0, fmt.Errorf("Blur: %w", NewError(NoImageLoaded, "No image loaded"))), OperationFailed},
+	}
+
+	for _, test := range tests {
+		if code := ErrorCodeOf(test.err); code != test.expected {
+			t.Errorf("%v has code %q, expected %q", test.err, code, test.expected)
+		}
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	failure := errors.New("disk full")
+
+	tests := []struct {
+		err     *Error
+		message string
+		layer   int
+		unwraps error
+	}{
+		{NewError(InvalidIndex, "No layer 3"), "No layer 3", -1, nil},
+		{WrapError(DecodeFailed, failure, "Failed to load project"), "Failed to load project: disk full", -1, failure},
+		{NewLayerError(2, failure), "Layer 3 failed: disk full", 2, failure},
+	}
+
+	for _, test := range tests {
+		if message := test.err.Error(); message != test.message {
+			t.Errorf("Message is %q, expected %q", message, test.message)
+		}
+		if test.err.Layer != test.layer {
+			t.Errorf("%q has layer %d, expected %d", test.message, test.err.Layer, test.layer)
+		}
+		if unwrapped := errors.Unwrap(test.err); unwrapped != test.unwraps {
+			t.Errorf("%q unwraps to %v", test.message, unwrapped)
+		}
+	}
+}
+
+// Errors of layers carry the index of the layer, while cancellation is reported as it is
+func TestExecuteReportsFailedLayer(t *testing.T) {
+	failure := errors.New("out of memory")
+	img := newUniformImage(8, 8, color.RGBA{100, 100, 100, 255})
+	collection := newTestCollection(img, addOperation{1}, addOperation{2}, failingOperation{failure}, addOperation{3})
+
+	_, err := collection.ExecuteFullResolution(context.Background())
+	var codedError *Error
+	if !errors.As(err, &codedError) {
+		t.Fatalf("Failed with %v", err)
+	}
+	if codedError.Code != OperationFailed || codedError.Layer != 2 || !errors.Is(err, failure) {
+		t.Errorf("Failed with %+v", codedError)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = newTestCollection(img, addOperation{1}, failingOperation{failure}).ExecuteFullResolution(ctx)
+	if code := ErrorCodeOf(err); code != Canceled {
+		t.Errorf("Cancelled execution failed with %v, code %q", err, code)
+	}
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+)
+
+// Opaque image of a single color
+func newUniformImage(width, height int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+// Opaque 16-bit image of a single color
+func newUniformImage16(width, height int, c color.RGBA64) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA64(x, y, c)
+		}
+	}
+	return img
+}
+
+// Adds Amount to the color channels of every pixel of an opaque 8-bit image
+type addOperation struct {
+	Amount uint8
+}
+
+func (this addOperation) Execute(ctx context.Context, inputImage Image) (Image, error) {
+	src := inputImage.(*image.RGBA)
+	result := image.NewRGBA(src.Rect)
+	for i := range src.Pix {
+		result.Pix[i] = src.Pix[i]
+		if i%4 != 3 {
+			result.Pix[i] += this.Amount
+		}
+	}
+	return result, nil
+}
+
+// Passes its input through and counts how often it is executed
+type countingOperation struct {
+	name       string
+	executions int
+}
+
+func (this *countingOperation) Execute(ctx context.Context, inputImage Image) (Image, error) {
+	this.executions++
+	return inputImage, nil
+}
+
+func (this *countingOperation) Fingerprint() string {
+	return this.name
+}
+
+func newTestLayer(operation ImageOperation) *ImageLayer {
+	return &ImageLayer{Operation: operation, IsEnabled: true, Opacity: 1, BlendMode: NormalBlend}
+}
+
+func newTestCollection(img Image, operations ...ImageOperation) *ImageLayerCollection {
+	collection := &ImageLayerCollection{InputImage: img, Cache: NewLayerCache(DefaultCacheBudget)}
+	for _, operation := range operations {
+		collection.Append(newTestLayer(operation))
+	}
+	return collection
+}
+
+func rgbaAt(img Image, x, y int) color.RGBA {
+	return color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+}
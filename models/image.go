@@ -0,0 +1,184 @@
+package models
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Image passed through the pipeline. Sources with 8 bits per channel are processed as *image.RGBA
+// and sources with more as *image.RGBA64, so that their precision is not lost on the first layer.
+// Pipelines working in LinearSpace process *LinearImage instead. Operations return images of the
+// same depth as their input.
+type Image interface {
+	draw.Image
+	SubImage(r image.Rectangle) image.Image
+	PixOffset(x, y int) int
+}
+
+// Values of a color channel of 8-bit, 16-bit and linear images
+type Channel interface {
+	uint8 | uint16 | float32
+}
+
+// Largest value of the channel type, which stands for full intensity. Integer channels wrap
+// around below zero, while float channels go from 0 to 1.
+func ChannelMax[C Channel]() C {
+	var zero, one C = 0, 1
+	if max := zero - one; max > zero {
+		return max
+	}
+	return one
+}
+
+func IsFloatChannel[C Channel]() bool {
+	return ChannelMax[C]() == 1
+}
+
+// Converts a value within the range of C to C, rounding to integer channels. Values outside the
+// range are clipped.
+func RoundChannel[C Channel, T float32 | float64](value T) C {
+	if !IsFloatChannel[C]() {
+		value += 0.5
+	}
+	if !(value > 0) {
+		return 0
+	}
+	if max := ChannelMax[C](); float64(value) > float64(max) {
+		return max
+	}
+	return C(value)
+}
+
+// Creates an empty image of the same depth as like
+func NewImageLike(like Image, bounds image.Rectangle) Image {
+	switch like.(type) {
+	case *image.RGBA64:
+		return image.NewRGBA64(bounds)
+	case *LinearImage:
+		return NewLinearImage(bounds)
+	}
+	return image.NewRGBA(bounds)
+}
+
+func Is16Bit(img Image) bool {
+	_, ok := img.(*image.RGBA64)
+	return ok
+}
+
+// Whether both images store their channels the same way
+func SameDepth(a, b Image) bool {
+	return Is16Bit(a) == Is16Bit(b) && IsLinear(a) == IsLinear(b)
+}
+
+// Pixel buffer of the image, along with the distance between its rows and the size of a pixel,
+// both in bytes. 16-bit channels are stored big endian. Linear images have no byte buffer.
+func PixelBuffer(img Image) (pix []uint8, stride, bytesPerPixel int) {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return img.Pix, img.Stride, 4
+	case *image.RGBA64:
+		return img.Pix, img.Stride, 8
+	}
+	panic("models: unsupported image type")
+}
+
+// Channel values of an image, 4 per pixel in R, G, B, A order and premultiplied by alpha, with
+// rows Stride values apart. Algorithms written against Channels work on images of any depth.
+type Channels[C Channel] struct {
+	Values []C
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (this Channels[C]) Offset(x, y int) int {
+	return (y-this.Rect.Min.Y)*this.Stride + (x-this.Rect.Min.X)*4
+}
+
+// Returns the values of the row at y within the horizontal bounds
+func (this Channels[C]) Row(y int) []C {
+	start := this.Offset(this.Rect.Min.X, y)
+	return this.Values[start : start+this.Rect.Dx()*4]
+}
+
+// Channels of an 8-bit image, sharing its pixel buffer
+func Channels8(img *image.RGBA) Channels[uint8] {
+	return Channels[uint8]{Values: img.Pix, Stride: img.Stride, Rect: img.Rect}
+}
+
+// Copy of the channels of a 16-bit image, see StoreChannels16
+func Channels16(img *image.RGBA64) Channels[uint16] {
+	bounds := img.Rect
+	channels := NewChannels[uint16](bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := channels.Row(y)
+		pix := img.Pix[img.PixOffset(bounds.Min.X, y):]
+		for i := range row {
+			row[i] = uint16(pix[i*2])<<8 | uint16(pix[i*2+1])
+		}
+	}
+	return channels
+}
+
+// Writes the channels into the pixels of the 16-bit image under their bounds
+func StoreChannels16(img *image.RGBA64, channels Channels[uint16]) {
+	bounds := channels.Rect.Intersect(img.Rect)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		start := channels.Offset(bounds.Min.X, y)
+		row := channels.Values[start : start+bounds.Dx()*4]
+		pix := img.Pix[img.PixOffset(bounds.Min.X, y):]
+		for i, value := range row {
+			pix[i*2] = uint8(value >> 8)
+			pix[i*2+1] = uint8(value)
+		}
+	}
+}
+
+func NewChannels[C Channel](bounds image.Rectangle) Channels[C] {
+	return Channels[C]{Values: make([]C, bounds.Dx()*bounds.Dy()*4), Stride: bounds.Dx() * 4, Rect: bounds}
+}
+
+// Image of the same depth as C holding the channels, which 8-bit and linear images share
+func imageFromChannels[C Channel](channels Channels[C]) Image {
+	switch values := any(channels.Values).(type) {
+	case []uint8:
+		return &image.RGBA{Pix: values, Stride: channels.Stride, Rect: channels.Rect}
+	case []uint16:
+		img := image.NewRGBA64(channels.Rect)
+		StoreChannels16(img, Channels[uint16]{Values: values, Stride: channels.Stride, Rect: channels.Rect})
+		return img
+	case []float32:
+		return &LinearImage{Pix: values, Stride: channels.Stride, Rect: channels.Rect}
+	}
+	panic("models: unsupported channel type")
+}
+
+// Scales a straight color channel by alpha, as stored in premultiplied images
+func Premultiply[C Channel](value, alpha C) C {
+	if IsFloatChannel[C]() {
+		return value * alpha
+	}
+	max := uint32(ChannelMax[C]())
+	return C((uint32(value)*uint32(alpha) + max/2) / max)
+}
+
+// Recovers the straight color channel from a premultiplied one. Channels of transparent pixels
+// have no color and are 0, channels larger than alpha are clipped.
+func Unpremultiply[C Channel](value, alpha C) C {
+	if alpha == 0 {
+		return 0
+	}
+	if IsFloatChannel[C]() {
+		if value >= alpha {
+			return 1
+		}
+		return value / alpha
+	}
+	max := uint32(ChannelMax[C]())
+	straight := (uint32(value)*max + uint32(alpha)/2) / uint32(alpha)
+	if straight > max {
+		return C(max)
+	}
+	return C(straight)
+}
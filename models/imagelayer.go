@@ -1,22 +1,123 @@
 package models
 
 import (
-	"image"
+	"context"
+	"fmt"
 )
 
 type ImageLayer struct {
 	Operation ImageOperation
 	IsEnabled bool
-	Next      *ImageLayer
+	// How much of the blended operation output shows over the input, from 0 to 1
+	Opacity   float64
+	BlendMode BlendMode
+	// Restricts where the blended output replaces the input, applies everywhere when nil
+	Mask *LayerMask
+	Next *ImageLayer
 }
 
-func (this *ImageLayer) ExecuteOperation(inputImage *image.RGBA) *image.RGBA {
+// Executes the operation on an image that is scale times the size of the source image and
+// composites its output over inputImage. Operations expecting perceptual input are given linear
+// images as 16-bit sRGB, and their output is converted back.
+func (this *ImageLayer) ExecuteOperation(ctx context.Context, inputImage Image, scale float64) (Image, error) {
 	if !this.IsEnabled {
-		return inputImage
+		return inputImage, nil
 	}
 
-	outputImage, _ := this.Operation.Execute(inputImage)
-	return outputImage
+	operationInput := inputImage
+	linearInput, isLinear := inputImage.(*LinearImage)
+	if isLinear && InputColorSpace(this.Operation) == PerceptualSpace {
+		operationInput = linearInput.ToRGBA64()
+	}
+
+	var outputImage Image
+	var err error
+	if scalableOperation, ok := this.Operation.(ScalableOperation); ok {
+		outputImage, err = scalableOperation.ExecuteScaled(ctx, operationInput, scale)
+	} else {
+		outputImage, err = this.Operation.Execute(ctx, operationInput)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isLinear {
+		outputImage = ToLinearImage(outputImage)
+	}
+
+	return this.composite(ctx, inputImage, outputImage)
+}
+
+func (this *ImageLayer) SetBlending(mode BlendMode, opacity float64) error {
+	if !mode.IsValid() {
+		return NewError(InvalidOperation, fmt.Sprintf("Unknown blend mode %q", mode))
+	}
+	if !(opacity >= 0 && opacity <= 1) {
+		return NewError(InvalidOperation, "Opacity has to be between 0 and 1")
+	}
+
+	this.BlendMode = mode
+	this.Opacity = opacity
+	return nil
+}
+
+func (this *ImageLayer) isBlended() bool {
+	return this.Opacity < 1 || (this.BlendMode != NormalBlend && this.BlendMode != "")
+}
+
+// Whether the output is anything else than the operation output
+func (this *ImageLayer) isComposited() bool {
+	return this.isBlended() || this.Mask != nil
+}
+
+// Blends the operation output over inputImage and masks the result. Outputs whose bounds or depth
+// differ from the input, like rotations of non-square images, cannot be composited and replace the
+// input.
+func (this *ImageLayer) composite(ctx context.Context, inputImage, outputImage Image) (Image, error) {
+	if inputImage.Bounds() != outputImage.Bounds() || !SameDepth(inputImage, outputImage) {
+		return outputImage, nil
+	}
+
+	var err error
+	if this.isBlended() {
+		outputImage, err = Blend(ctx, inputImage, outputImage, this.BlendMode, this.Opacity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if this.Mask != nil {
+		return ApplyMask(ctx, inputImage, outputImage, this.Mask)
+	}
+	return outputImage, nil
+}
+
+// Fingerprint of the layer output for an input with the given fingerprint.
+// Disabled layers pass their input through unchanged, and groups and graphs derive it from the
+// fingerprints of their members.
+func (this *ImageLayer) Fingerprint(input Fingerprint, scale float64) Fingerprint {
+	if !this.IsEnabled {
+		return input
+	}
+
+	var output Fingerprint
+	if group, ok := this.Operation.(*LayerGroup); ok {
+		output = group.Layers.chainFingerprint(input, scale)
+	} else if graph, ok := this.Operation.(*LayerGraph); ok {
+		output = graph.fingerprint(input, scale)
+	} else {
+		description := FingerprintOperation(this.Operation)
+		if _, ok := this.Operation.(ScalableOperation); ok {
+			description += fmt.Sprintf("@%v", scale)
+		}
+		output = input.Chain(description)
+	}
+
+	if this.isBlended() {
+		output = output.Chain(fmt.Sprintf("blend:%s@%v", this.BlendMode, this.Opacity))
+	}
+	if this.Mask != nil {
+		output = output.Chain(this.Mask.description)
+	}
+	return output
 }
 
 func (this *ImageLayer) Enable() {
@@ -1,16 +1,32 @@
 package models
 
 import (
-	"errors"
+	"context"
 	"image"
 )
 
 // Linked list data structure for handling image layers
 type ImageLayerCollection struct {
-	InputImage   *image.RGBA
-	OutputImages map[int]*image.RGBA
-	Head         *ImageLayer
-	Size         int
+	InputImage Image
+	// Largest size of the downscaled copy of InputImage that previews are rendered on.
+	// Previews are rendered at full resolution when zero.
+	PreviewSize image.Point
+	Cache       *LayerCache
+	Head        *ImageLayer
+	Size        int
+	// Color space the layers work in. In LinearSpace, InputImage is converted to a LinearImage
+	// before the first layer, so that layer outputs are linear images as well. Perceptual when
+	// empty.
+	WorkingSpace ColorSpace
+
+	workingSource     Image
+	workingSpace      ColorSpace
+	workingImage      Image
+	previewSource     Image
+	previewSize       image.Point
+	previewImage      Image
+	fingerprintSource Image
+	fingerprints      map[Image]Fingerprint
 }
 
 func (this *ImageLayerCollection) validateIndex(index int) bool {
@@ -23,7 +39,7 @@ func (this *ImageLayerCollection) validateIndex(index int) bool {
 func (this *ImageLayerCollection) At(index int) (*ImageLayer, error) {
 	ok := this.validateIndex(index)
 	if !ok {
-		return nil, errors.New("Invalid index")
+		return nil, NewError(InvalidIndex, "Invalid index")
 	}
 
 	current := this.Head
@@ -59,7 +75,7 @@ func (this *ImageLayerCollection) InsertAt(imageLayer *ImageLayer, index int) er
 
 	ok := this.validateIndex(index)
 	if !ok {
-		return errors.New("Invalid index")
+		return NewError(InvalidIndex, "Invalid index")
 	}
 
 	if index == 0 {
@@ -89,7 +105,7 @@ func (this *ImageLayerCollection) InsertAt(imageLayer *ImageLayer, index int) er
 func (this *ImageLayerCollection) RemoveAt(index int) error {
 	ok := this.validateIndex(index)
 	if !ok {
-		return errors.New("Invalid index")
+		return NewError(InvalidIndex, "Invalid index")
 	}
 
 	var previous *ImageLayer
@@ -106,45 +122,153 @@ func (this *ImageLayerCollection) RemoveAt(index int) error {
 		previous.Next = current.Next
 	}
 
-	for index < this.Size {
-		delete(this.OutputImages, index)
-		index++
-	}
-
 	current.Next = nil
 	this.Size--
 	return nil
 }
 
-func (this *ImageLayerCollection) ExecuteLayersFrom(index int) (*image.RGBA, error) {
+// Renders the preview, which is the output of the last layer for the downscaled copy of
+// InputImage. Layer outputs are looked up in the cache by their fingerprint, so only layers
+// whose input or parameters changed since they were last executed are recomputed. The index
+// is validated but does not need to point at the first changed layer. The output of a layer with
+// a mask is mixed with its input per pixel by the mask value.
+// Progress is reported to the reporter of ctx, see WithProgress.
+func (this *ImageLayerCollection) ExecuteLayersFrom(ctx context.Context, index int) (Image, error) {
 	ok := this.validateIndex(index)
 	if !ok {
-		return nil, errors.New("Invalid index")
+		return nil, NewError(InvalidIndex, "Invalid index")
 	}
 
-	current := this.Head
+	previewImage, scale := this.PreviewImage()
+	return this.execute(ctx, previewImage, scale)
+}
 
-	for count := 0; count < index; count++ {
-		current = current.Next
+// Renders the output of the last layer for InputImage at its original size
+func (this *ImageLayerCollection) ExecuteFullResolution(ctx context.Context) (Image, error) {
+	return this.execute(ctx, this.WorkingImage(), 1)
+}
+
+func (this *ImageLayerCollection) execute(ctx context.Context, inputImage Image, scale float64) (Image, error) {
+	outputImage, _, err := this.executeLayers(ctx, this.Cache, inputImage, this.fingerprint(inputImage), scale, true)
+	return outputImage, err
+}
+
+// Executes the layers on inputImage, whose fingerprint is given, and returns the output of the
+// last layer with its fingerprint. Only outputs of layers that ran to completion are cached, so a
+// cancelled execution leaves the cache as consistent as it found it. Failing layers are reported
+// as a layer Error. Members of groups and nodes of graphs are executed through the same cache,
+// without reporting their own progress.
+func (this *ImageLayerCollection) executeLayers(ctx context.Context, cache *LayerCache, inputImage Image, fingerprint Fingerprint, scale float64, reportsProgress bool) (Image, Fingerprint, error) {
+	currentLayerInputImage := inputImage
+
+	layer := 0
+	for current := this.Head; current != nil; current = current.Next {
+		layer++
+		if err := ctx.Err(); err != nil {
+			return nil, fingerprint, err
+		}
+
+		outputFingerprint := current.Fingerprint(fingerprint, scale)
+
+		if outputFingerprint != fingerprint {
+			outputImage, cached := cache.Get(outputFingerprint)
+			if !cached {
+				layerCtx := ctx
+				if reportsProgress {
+					layerCtx = withLayerProgress(ctx, layer, this.Size)
+				}
+
+				var err error
+				outputImage, err = executeLayer(layerCtx, cache, current, currentLayerInputImage, fingerprint, scale)
+				if err == nil {
+					cache.Put(outputFingerprint, outputImage)
+				}
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, fingerprint, ctx.Err()
+					}
+					return nil, fingerprint, NewLayerError(layer-1, err)
+				}
+			}
+			currentLayerInputImage = outputImage
+		}
+
+		fingerprint = outputFingerprint
 	}
 
-	var currentLayerInputImage *image.RGBA
+	return currentLayerInputImage, fingerprint, nil
+}
 
-	if index > 0 && this.OutputImages[index-1] != nil {
-		currentLayerInputImage = this.OutputImages[index-1]
-	} else {
-		currentLayerInputImage = this.InputImage
+// Executes a single layer on inputImage, whose fingerprint is given. Members of groups and nodes
+// of graphs are looked up in and added to cache.
+func executeLayer(ctx context.Context, cache *LayerCache, imageLayer *ImageLayer, inputImage Image, fingerprint Fingerprint, scale float64) (Image, error) {
+	var outputImage Image
+	var err error
+
+	switch operation := imageLayer.Operation.(type) {
+	case *LayerGroup:
+		outputImage, _, err = operation.Layers.executeLayers(ctx, cache, inputImage, fingerprint, scale, false)
+	case *LayerGraph:
+		outputImage, err = operation.execute(ctx, cache, inputImage, fingerprint, scale)
+	default:
+		return imageLayer.ExecuteOperation(ctx, inputImage, scale)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	for current != nil {
-		outputImage := current.ExecuteOperation(currentLayerInputImage)
+	return imageLayer.composite(ctx, inputImage, outputImage)
+}
 
-		currentLayerInputImage = outputImage
-		this.OutputImages[index] = outputImage
+// Fingerprint of the output of the last layer for an input with the given fingerprint
+func (this *ImageLayerCollection) chainFingerprint(fingerprint Fingerprint, scale float64) Fingerprint {
+	for current := this.Head; current != nil; current = current.Next {
+		fingerprint = current.Fingerprint(fingerprint, scale)
+	}
+	return fingerprint
+}
 
-		current = current.Next
-		index++
+// Returns InputImage in the working space, which is only converted again when InputImage or
+// WorkingSpace change
+func (this *ImageLayerCollection) WorkingImage() Image {
+	if this.workingSource != this.InputImage || this.workingSpace != this.WorkingSpace {
+		this.workingImage = this.InputImage
+		if this.WorkingSpace == LinearSpace {
+			this.workingImage = ToLinearImage(this.InputImage)
+		}
+		this.workingSource = this.InputImage
+		this.workingSpace = this.WorkingSpace
 	}
+	return this.workingImage
+}
 
-	return currentLayerInputImage, nil
+// Returns the downscaled copy of the working image along with its size relative to InputImage.
+// The copy is only recreated when the working image or PreviewSize change.
+func (this *ImageLayerCollection) PreviewImage() (Image, float64) {
+	workingImage := this.WorkingImage()
+	if this.previewSource != workingImage || this.previewSize != this.PreviewSize {
+		this.previewImage = NewPreviewImage(workingImage, this.PreviewSize)
+		this.previewSource = workingImage
+		this.previewSize = this.PreviewSize
+		this.fingerprints = nil
+	}
+
+	scale := float64(this.previewImage.Bounds().Dx()) / float64(this.InputImage.Bounds().Dx())
+	return this.previewImage, scale
+}
+
+// Fingerprints of the pixels of the working image and its preview, remembered until the working
+// image changes
+func (this *ImageLayerCollection) fingerprint(img Image) Fingerprint {
+	if workingImage := this.WorkingImage(); this.fingerprints == nil || this.fingerprintSource != workingImage {
+		this.fingerprints = make(map[Image]Fingerprint, 2)
+		this.fingerprintSource = workingImage
+	}
+
+	fingerprint, ok := this.fingerprints[img]
+	if !ok {
+		fingerprint = FingerprintImage(img)
+		this.fingerprints[img] = fingerprint
+	}
+	return fingerprint
 }
@@ -1,7 +1,23 @@
 package models
 
-import "image"
+import "context"
 
+// Operations are expected to stop early and return the context error once ctx is cancelled
 type ImageOperation interface {
-	Execute(*image.RGBA) (*image.RGBA, error)
+	Execute(ctx context.Context, inputImage Image) (Image, error)
+}
+
+// Operation with spatial parameters expressed in source image pixels. When the pipeline runs on
+// a downscaled preview, scale is the size of the input relative to the source image, and the
+// operation is expected to scale its parameters so that the preview matches the full render.
+type ScalableOperation interface {
+	ImageOperation
+	ExecuteScaled(ctx context.Context, inputImage Image, scale float64) (Image, error)
+}
+
+// Operation combining several images, like the blend of two branches of a graph. Inputs are
+// given in order and there are always InputCount of them.
+type MergeOperation interface {
+	InputCount() int
+	Merge(ctx context.Context, inputImages []Image) (Image, error)
 }
@@ -0,0 +1,177 @@
+package models
+
+import "math"
+
+// Generates the kernel reaching radius pixels from its center. Taps fully within the radius
+// weigh 1 and the outermost ones the fraction of them the radius covers, so radius 1 gives the
+// classic 3x3 kernels, radius 2 their 5x5 variants and radius 1.5 something in between.
+func GenerateKernel(kernelType KernelType, radius float64) [][]float32 {
+	return GenerateScaledKernel(kernelType, radius, 1)
+}
+
+// Generates the kernel for an image that is scale times the size of the one radius refers to.
+// The kernel keeps the reach of the full size kernel in source pixels, so a blur of radius 4 on a
+// half size preview reaches 2 preview pixels. Kernels bringing out detail add up to a weaker
+// effect with fewer taps, so their weights are raised towards the total of the full size kernel.
+// Downscaling averages away part of the detail of the full size result, and the square root of
+// the ratio between both totals matches it best.
+func GenerateScaledKernel(kernelType KernelType, radius float64, scale float64) [][]float32 {
+	if scale > 1 {
+		scale = 1
+	}
+	// Radii that are not finite or positive reach no neighbors, which leaves the center tap alone
+	if !(radius > 0) || math.IsInf(radius, 1) {
+		radius = 0
+	}
+
+	kernel := generateKernelShape(kernelType, radius*scale)
+
+	switch kernelType {
+	case BoxBlur, MotionBlur:
+		return kernel
+	}
+
+	if scale < 1 {
+		if total := totalWeight(kernel); total > 0 {
+			factor := float32(math.Sqrt(float64(totalWeight(generateKernelShape(kernelType, radius)) / total)))
+			for _, row := range kernel {
+				for i := range row {
+					row[i] *= factor
+				}
+			}
+		}
+	}
+	// Sharpening and embossing add their detail to the image itself
+	if kernelType == Sharpen || kernelType == Emboss {
+		center := len(kernel) / 2
+		kernel[center][center]++
+	}
+	return kernel
+}
+
+// Blurs are normalized, other kernels are only the detail they bring out, which adds up to zero
+func generateKernelShape(kernelType KernelType, radius float64) [][]float32 {
+	arms := armWeights(radius)
+	length := len(arms)*2 + 1
+	center := len(arms)
+
+	kernel := make([][]float32, length)
+	for i := range kernel {
+		kernel[i] = make([]float32, length)
+	}
+
+	// Weight of the tap at the given offset from the center, 1 for the center itself
+	profile := func(offset int) float32 {
+		if offset == 0 {
+			return 1
+		}
+		if offset < 0 {
+			offset = -offset
+		}
+		return arms[offset-1]
+	}
+	// Profile across a gradient, which weighs the center twice like the Sobel operator
+	smoothing := func(offset int) float32 {
+		if offset == 0 {
+			return 2
+		}
+		return profile(offset)
+	}
+	// Gradients point from the positive towards the negative side of the center
+	sign := func(offset int) float32 {
+		switch {
+		case offset < 0:
+			return 1
+		case offset > 0:
+			return -1
+		}
+		return 0
+	}
+
+	switch kernelType {
+	case BoxBlur:
+		width := float32(1 + 2*radius)
+		for y := 0; y < length; y++ {
+			for x := 0; x < length; x++ {
+				kernel[y][x] = profile(x-center) * profile(y-center) / (width * width)
+			}
+		}
+	case MotionBlur:
+		width := float32(1 + 2*radius)
+		for i := 0; i < length; i++ {
+			kernel[i][i] = profile(i-center) / width
+		}
+	case Sharpen:
+		for i := 0; i < length; i++ {
+			if i == center {
+				continue
+			}
+			weight := profile(i - center)
+			kernel[center][i] = -weight
+			kernel[i][center] = -weight
+			kernel[center][center] += 2 * weight
+		}
+	case Emboss:
+		for i := 0; i < length; i++ {
+			weight := -sign(i-center) * profile(i-center)
+			if weight == 0 {
+				continue
+			}
+			kernel[center][i] = weight
+			kernel[i][center] = weight
+			kernel[i][i] = 2 * weight
+		}
+	case EdgeDetectionHorizontal:
+		for y := 0; y < length; y++ {
+			for x := 0; x < length; x++ {
+				kernel[y][x] = sign(x-center) * profile(x-center) * smoothing(y-center)
+			}
+		}
+	case EdgeDetectionVertical:
+		for y := 0; y < length; y++ {
+			for x := 0; x < length; x++ {
+				kernel[y][x] = sign(y-center) * profile(y-center) * smoothing(x-center)
+			}
+		}
+	case Outline:
+		for y := 0; y < length; y++ {
+			for x := 0; x < length; x++ {
+				if x == center && y == center {
+					continue
+				}
+				weight := profile(x-center) * profile(y-center)
+				kernel[y][x] = -weight
+				kernel[center][center] += weight
+			}
+		}
+	}
+
+	return kernel
+}
+
+// Sum of the absolute weights of the kernel
+func totalWeight(kernel [][]float32) float32 {
+	var total float32
+	for _, row := range kernel {
+		for _, weight := range row {
+			total += float32(math.Abs(float64(weight)))
+		}
+	}
+	return total
+}
+
+// Weights of the taps on one side of the kernel center for a possibly fractional radius.
+// Taps fully inside the radius weigh 1 and the last one weighs the fraction it covers.
+func armWeights(radius float64) []float32 {
+	if !(radius > 0) || math.IsInf(radius, 1) {
+		return nil
+	}
+
+	count := int(math.Ceil(radius - 1e-9))
+	weights := make([]float32, count)
+
+	for i := range weights {
+		weights[i] = float32(math.Min(1, radius-float64(i)))
+	}
+	return weights
+}
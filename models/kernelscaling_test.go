@@ -0,0 +1,49 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGenerateKernelSizes(t *testing.T) {
+	tests := []struct {
+		radius float64
+		size   int
+	}{
+		{1, 3},
+		{1.5, 5},
+		{2, 5},
+		{0.5, 3},
+		// Radii that are not finite or positive leave the center tap alone
+		{0, 1},
+		{-2, 1},
+		{math.NaN(), 1},
+		{math.Inf(1), 1},
+		{math.Inf(-1), 1},
+	}
+
+	for _, test := range tests {
+		for _, kernelType := range []KernelType{BoxBlur, Sharpen, EdgeDetectionVertical} {
+			kernel := GenerateKernel(kernelType, test.radius)
+			if len(kernel) != test.size {
+				t.Errorf("%v kernel of radius %v is %dx%d, expected %dx%d", kernelType, test.radius, len(kernel), len(kernel), test.size, test.size)
+			}
+			for _, row := range kernel {
+				for _, weight := range row {
+					if math.IsNaN(float64(weight)) || math.IsInf(float64(weight), 0) {
+						t.Fatalf("%v kernel of radius %v has weight %v", kernelType, test.radius, weight)
+					}
+				}
+			}
+		}
+	}
+
+	// A single tap blurs and sharpens nothing, on previews as well
+	for _, kernelType := range []KernelType{BoxBlur, Sharpen} {
+		for _, scale := range []float64{1, 0.5} {
+			if kernel := GenerateScaledKernel(kernelType, math.NaN(), scale); len(kernel) != 1 || kernel[0][0] != 1 {
+				t.Errorf("%v kernel without radius at scale %v is %v", kernelType, scale, kernel)
+			}
+		}
+	}
+}
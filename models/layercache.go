@@ -0,0 +1,185 @@
+package models
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+const DefaultCacheBudget = 512 << 20
+
+// Identifies the output of a layer by everything that contributes to it: the input pixels,
+// the parameters of the layer and of every layer before it
+type Fingerprint [sha256.Size]byte
+
+// Operations can implement this to describe their parameters more cheaply or precisely than
+// the default, which formats the operation value
+type Fingerprinter interface {
+	Fingerprint() string
+}
+
+func FingerprintImage(img Image) Fingerprint {
+	hash := sha256.New()
+	if linear, ok := img.(*LinearImage); ok {
+		fmt.Fprintf(hash, "%v|%d|linear|", linear.Rect, linear.Stride)
+		// Row by row, so that the bytes of the whole image are never held at once
+		for y := linear.Rect.Min.Y; y < linear.Rect.Max.Y; y++ {
+			start := linear.PixOffset(linear.Rect.Min.X, y)
+			binary.Write(hash, binary.LittleEndian, linear.Pix[start:start+linear.Rect.Dx()*4])
+		}
+	} else {
+		pix, stride, bytesPerPixel := PixelBuffer(img)
+		fmt.Fprintf(hash, "%v|%d|%d|", img.Bounds(), stride, bytesPerPixel)
+		hash.Write(pix)
+	}
+
+	var fingerprint Fingerprint
+	copy(fingerprint[:], hash.Sum(nil))
+	return fingerprint
+}
+
+func FingerprintOperation(operation ImageOperation) string {
+	if fingerprinter, ok := operation.(Fingerprinter); ok {
+		return fingerprinter.Fingerprint()
+	}
+	return fmt.Sprintf("%T%+v", operation, operation)
+}
+
+// Combines the fingerprint of a layer input with a description of the layer
+func (this Fingerprint) Chain(description string) Fingerprint {
+	hash := sha256.New()
+	hash.Write(this[:])
+	hash.Write([]byte(description))
+
+	var fingerprint Fingerprint
+	copy(fingerprint[:], hash.Sum(nil))
+	return fingerprint
+}
+
+type cacheEntry struct {
+	fingerprint Fingerprint
+	image       Image
+	size        int64
+}
+
+// Least recently used cache of layer outputs bounded by the memory their pixels take
+type LayerCache struct {
+	mutex   sync.Mutex
+	budget  int64
+	used    int64
+	entries map[Fingerprint]*list.Element
+	order   *list.List
+}
+
+func NewLayerCache(budget int64) *LayerCache {
+	return &LayerCache{
+		budget:  budget,
+		entries: make(map[Fingerprint]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// A nil cache holds nothing
+func (this *LayerCache) Get(fingerprint Fingerprint) (Image, bool) {
+	if this == nil {
+		return nil, false
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	element, ok := this.entries[fingerprint]
+	if !ok {
+		return nil, false
+	}
+
+	this.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).image, true
+}
+
+// Stores the image, evicting the least recently used entries when over budget.
+// Images larger than the whole budget are not cached, and a nil cache stores nothing.
+func (this *LayerCache) Put(fingerprint Fingerprint, img Image) {
+	if this == nil {
+		return
+	}
+	size := imageSize(img)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if element, ok := this.entries[fingerprint]; ok {
+		this.removeElement(element)
+	}
+	if size > this.budget {
+		return
+	}
+
+	element := this.order.PushFront(&cacheEntry{fingerprint, img, size})
+	this.entries[fingerprint] = element
+	this.used += size
+	this.evict()
+}
+
+func (this *LayerCache) SetBudget(budget int64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.budget = budget
+	this.evict()
+}
+
+func (this *LayerCache) Budget() int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.budget
+}
+
+// Returns the number of bytes held by cached images
+func (this *LayerCache) Used() int64 {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.used
+}
+
+func (this *LayerCache) Len() int {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.order.Len()
+}
+
+func (this *LayerCache) Clear() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.entries = make(map[Fingerprint]*list.Element)
+	this.order.Init()
+	this.used = 0
+}
+
+func (this *LayerCache) evict() {
+	for this.used > this.budget && this.order.Len() > 0 {
+		this.removeElement(this.order.Back())
+	}
+}
+
+func (this *LayerCache) removeElement(element *list.Element) {
+	entry := element.Value.(*cacheEntry)
+	this.order.Remove(element)
+	delete(this.entries, entry.fingerprint)
+	this.used -= entry.size
+}
+
+// Memory taken by the pixels of img
+func imageSize(img Image) int64 {
+	if linear, ok := img.(*LinearImage); ok {
+		return int64(len(linear.Pix)) * 4
+	}
+	pix, _, _ := PixelBuffer(img)
+	return int64(len(pix))
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func fingerprintOf(name string) Fingerprint {
+	return Fingerprint{}.Chain(name)
+}
+
+// Every test image takes 10*10*4 bytes
+const testImageSize = 400
+
+func TestLayerCacheEvictsLeastRecentlyPut(t *testing.T) {
+	cache := NewLayerCache(2 * testImageSize)
+	for _, name := range []string{"a", "b", "c"} {
+		cache.Put(fingerprintOf(name), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	}
+
+	if _, ok := cache.Get(fingerprintOf("a")); ok {
+		t.Error("Oldest entry was kept over the budget")
+	}
+	for _, name := range []string{"b", "c"} {
+		if _, ok := cache.Get(fingerprintOf(name)); !ok {
+			t.Errorf("Entry %s was evicted", name)
+		}
+	}
+	if cache.Len() != 2 || cache.Used() != 2*testImageSize {
+		t.Errorf("Cache holds %d entries taking %d bytes", cache.Len(), cache.Used())
+	}
+}
+
+func TestLayerCacheGetMovesToFront(t *testing.T) {
+	cache := NewLayerCache(2 * testImageSize)
+	a := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	cache.Put(fingerprintOf("a"), a)
+	cache.Put(fingerprintOf("b"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+
+	if img, ok := cache.Get(fingerprintOf("a")); !ok || img != Image(a) {
+		t.Fatal("Entry a was not returned")
+	}
+	cache.Put(fingerprintOf("c"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+
+	if _, ok := cache.Get(fingerprintOf("b")); ok {
+		t.Error("Entry b was kept, although a was used more recently")
+	}
+	if _, ok := cache.Get(fingerprintOf("a")); !ok {
+		t.Error("Recently used entry a was evicted")
+	}
+}
+
+func TestLayerCacheBudget(t *testing.T) {
+	cache := NewLayerCache(2 * testImageSize)
+
+	cache.Put(fingerprintOf("large"), image.NewRGBA(image.Rect(0, 0, 20, 20)))
+	if cache.Len() != 0 {
+		t.Error("Image larger than the budget was cached")
+	}
+
+	cache.Put(fingerprintOf("a"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	cache.Put(fingerprintOf("a"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if cache.Len() != 1 || cache.Used() != testImageSize {
+		t.Errorf("Replaced entry left %d entries taking %d bytes", cache.Len(), cache.Used())
+	}
+
+	cache.Put(fingerprintOf("b"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	cache.SetBudget(testImageSize)
+	if _, ok := cache.Get(fingerprintOf("b")); !ok || cache.Len() != 1 {
+		t.Error("Lowering the budget did not evict only the oldest entry")
+	}
+
+	cache.SetBudget(0)
+	if cache.Len() != 0 || cache.Used() != 0 {
+		t.Errorf("Zero budget left %d entries taking %d bytes", cache.Len(), cache.Used())
+	}
+}
+
+func TestNilLayerCache(t *testing.T) {
+	var cache *LayerCache
+	cache.Put(fingerprintOf("a"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if _, ok := cache.Get(fingerprintOf("a")); ok {
+		t.Error("Nil cache returned an image")
+	}
+}
+
+func TestFingerprintOperation(t *testing.T) {
+	// Without a Fingerprint method, the type and fields of the operation describe it
+	if description := FingerprintOperation(addOperation{Amount: 3}); description != "models.addOperation{Amount:3}" {
+		t.Errorf("Description is %q", description)
+	}
+	if FingerprintOperation(addOperation{Amount: 3}) == FingerprintOperation(addOperation{Amount: 4}) {
+		t.Error("Operations with different parameters have the same description")
+	}
+
+	operation := &countingOperation{name: "counting"}
+	if description := FingerprintOperation(operation); description != "counting" {
+		t.Errorf("Fingerprinter is described as %q", description)
+	}
+	// The number of executions must not change the description
+	operation.Execute(context.Background(), nil)
+	if description := FingerprintOperation(operation); description != "counting" {
+		t.Errorf("Fingerprinter is described as %q after executing", description)
+	}
+}
+
+func TestFingerprintImage(t *testing.T) {
+	img := newUniformImage(4, 4, color.RGBA{10, 20, 30, 255})
+	same := newUniformImage(4, 4, color.RGBA{10, 20, 30, 255})
+	if FingerprintImage(img) != FingerprintImage(same) {
+		t.Error("Equal images have different fingerprints")
+	}
+
+	same.Pix[5]++
+	if FingerprintImage(img) == FingerprintImage(same) {
+		t.Error("Different pixels have the same fingerprint")
+	}
+	if FingerprintImage(img) == FingerprintImage(newUniformImage(2, 8, color.RGBA{10, 20, 30, 255})) {
+		t.Error("Different bounds have the same fingerprint")
+	}
+	if FingerprintImage(img) == FingerprintImage(ToLinearImage(img)) {
+		t.Error("Linear image has the fingerprint of its sRGB source")
+	}
+}
+
+// Only layers after a changed one are executed again
+func TestCollectionReusesCachedOutputs(t *testing.T) {
+	first := &countingOperation{name: "first"}
+	second := &countingOperation{name: "second"}
+	collection := newTestCollection(newUniformImage(8, 8, color.RGBA{10, 20, 30, 255}), first, addOperation{Amount: 1}, second)
+
+	for i := 0; i < 2; i++ {
+		if _, err := collection.ExecuteFullResolution(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if first.executions != 1 || second.executions != 1 {
+		t.Errorf("Unchanged layers executed %d and %d times", first.executions, second.executions)
+	}
+
+	layer, _ := collection.At(1)
+	layer.Operation = addOperation{Amount: 2}
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.executions != 1 || second.executions != 2 {
+		t.Errorf("After changing the middle layer, the layers executed %d and %d times", first.executions, second.executions)
+	}
+	if c := rgbaAt(result, 0, 0); c != (color.RGBA{12, 22, 32, 255}) {
+		t.Errorf("Result is %v", c)
+	}
+}
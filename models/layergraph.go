@@ -0,0 +1,378 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Name of graphs in project files and layer descriptions
+const GraphOperationName = "graph"
+
+type NodeID int
+
+const (
+	// Node holding the input of the graph, which every graph has
+	GraphInputNode NodeID = 0
+	// Marks an input of a node that is not connected
+	NoNode NodeID = -1
+)
+
+// Node of a LayerGraph. Layer nodes have a single input, which the layer is executed on with its
+// blending and mask like in a collection. Merge nodes combine their inputs in order.
+type GraphNode struct {
+	ID     NodeID
+	Layer  *ImageLayer
+	Merge  MergeOperation
+	Inputs []NodeID
+}
+
+func (this *GraphNode) description() string {
+	if fingerprinter, ok := this.Merge.(Fingerprinter); ok {
+		return fingerprinter.Fingerprint()
+	}
+	return fmt.Sprintf("%T%+v", this.Merge, this.Merge)
+}
+
+// Layer made of a directed acyclic graph of nodes, so that branches of the pipeline can be
+// processed separately and merged again. Nodes are executed in topological order from the input
+// of the graph to its output node, and their outputs are cached like those of any other layer.
+type LayerGraph struct {
+	nodes  map[NodeID]*GraphNode
+	Output NodeID
+	nextID NodeID
+}
+
+// Returns a graph whose output is its input
+func NewLayerGraph() *LayerGraph {
+	return &LayerGraph{
+		nodes:  map[NodeID]*GraphNode{GraphInputNode: {ID: GraphInputNode}},
+		Output: GraphInputNode,
+		nextID: GraphInputNode + 1,
+	}
+}
+
+// Turns a linear chain of layers into a graph in which every layer is the input of the next one
+func NewLayerGraphFromChain(imageLayers []*ImageLayer) *LayerGraph {
+	graph := NewLayerGraph()
+
+	previous := GraphInputNode
+	for _, imageLayer := range imageLayers {
+		id := graph.AddLayerNode(imageLayer)
+		graph.nodes[id].Inputs[0] = previous
+		previous = id
+	}
+
+	graph.Output = previous
+	return graph
+}
+
+func (this *LayerGraph) AddLayerNode(imageLayer *ImageLayer) NodeID {
+	return this.addNode(&GraphNode{Layer: imageLayer, Inputs: []NodeID{NoNode}})
+}
+
+func (this *LayerGraph) AddMergeNode(merge MergeOperation) NodeID {
+	inputs := make([]NodeID, merge.InputCount())
+	for i := range inputs {
+		inputs[i] = NoNode
+	}
+	return this.addNode(&GraphNode{Merge: merge, Inputs: inputs})
+}
+
+func (this *LayerGraph) addNode(node *GraphNode) NodeID {
+	node.ID = this.nextID
+	this.nodes[node.ID] = node
+	this.nextID++
+	return node.ID
+}
+
+// Adds a node with the ID it already has, as done when loading a graph. Inputs are connected
+// afterwards.
+func (this *LayerGraph) RestoreNode(node *GraphNode) error {
+	if _, ok := this.nodes[node.ID]; ok || node.ID <= GraphInputNode {
+		return NewError(InvalidIndex, fmt.Sprintf("Node %d already exists", node.ID))
+	}
+
+	this.nodes[node.ID] = node
+	if node.ID >= this.nextID {
+		this.nextID = node.ID + 1
+	}
+	return nil
+}
+
+func (this *LayerGraph) Node(id NodeID) (*GraphNode, error) {
+	node, ok := this.nodes[id]
+	if !ok {
+		return nil, NewError(InvalidIndex, fmt.Sprintf("Node %d does not exist", id))
+	}
+	return node, nil
+}
+
+// Returns all nodes ordered by ID, starting with the input node
+func (this *LayerGraph) Nodes() []*GraphNode {
+	nodes := make([]*GraphNode, 0, len(this.nodes))
+	for _, node := range this.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Removes the node and disconnects it from the nodes it was an input of. The output moves to the
+// input of the graph when its node is removed.
+func (this *LayerGraph) RemoveNode(id NodeID) error {
+	if id == GraphInputNode {
+		return NewError(InvalidOperation, "The graph input cannot be removed")
+	}
+	if _, err := this.Node(id); err != nil {
+		return err
+	}
+
+	delete(this.nodes, id)
+	for _, node := range this.nodes {
+		for i, input := range node.Inputs {
+			if input == id {
+				node.Inputs[i] = NoNode
+			}
+		}
+	}
+	if this.Output == id {
+		this.Output = GraphInputNode
+	}
+	return nil
+}
+
+// Makes the output of the node from the input at the given slot of the node to
+func (this *LayerGraph) Connect(from, to NodeID, slot int) error {
+	if _, err := this.Node(from); err != nil {
+		return err
+	}
+	node, err := this.Node(to)
+	if err != nil {
+		return err
+	}
+	if slot < 0 || slot >= len(node.Inputs) {
+		return NewError(InvalidIndex, fmt.Sprintf("Node %d has no input %d", to, slot))
+	}
+	if from == to || this.dependsOn(from, to) {
+		return NewError(InvalidOperation, "Connection would create a cycle")
+	}
+
+	node.Inputs[slot] = from
+	return nil
+}
+
+func (this *LayerGraph) Disconnect(to NodeID, slot int) error {
+	node, err := this.Node(to)
+	if err != nil {
+		return err
+	}
+	if slot < 0 || slot >= len(node.Inputs) {
+		return NewError(InvalidIndex, fmt.Sprintf("Node %d has no input %d", to, slot))
+	}
+
+	node.Inputs[slot] = NoNode
+	return nil
+}
+
+func (this *LayerGraph) SetOutput(id NodeID) error {
+	if _, err := this.Node(id); err != nil {
+		return err
+	}
+	this.Output = id
+	return nil
+}
+
+// Whether the output of the node id is computed from the output of the node ancestor
+func (this *LayerGraph) dependsOn(id, ancestor NodeID) bool {
+	visited := map[NodeID]bool{}
+	pending := []NodeID{id}
+
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if current == ancestor {
+			return true
+		}
+		if visited[current] || current == NoNode {
+			continue
+		}
+		visited[current] = true
+		pending = append(pending, this.nodes[current].Inputs...)
+	}
+	return false
+}
+
+// Returns the nodes the output depends on, each one after all of its inputs
+func (this *LayerGraph) order() ([]*GraphNode, error) {
+	var order []*GraphNode
+	visited := map[NodeID]bool{}
+
+	var visit func(id NodeID) error
+	visit = func(id NodeID) error {
+		if visited[id] {
+			return nil
+		}
+		visited[id] = true
+
+		node := this.nodes[id]
+		for slot, input := range node.Inputs {
+			if input == NoNode {
+				return NewError(InvalidOperation, fmt.Sprintf("Input %d of node %d is not connected", slot+1, id))
+			}
+			if err := visit(input); err != nil {
+				return err
+			}
+		}
+
+		order = append(order, node)
+		return nil
+	}
+
+	if err := visit(this.Output); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// Fingerprint of a node output given the fingerprints of its inputs
+func (this *GraphNode) fingerprint(inputs []Fingerprint, scale float64) Fingerprint {
+	if this.Layer != nil {
+		return this.Layer.Fingerprint(inputs[0], scale)
+	}
+
+	description := this.description()
+	for _, input := range inputs[1:] {
+		description += fmt.Sprintf("|%x", input)
+	}
+	return inputs[0].Chain(description)
+}
+
+// Fingerprint of the graph output for an input with the given fingerprint
+func (this *LayerGraph) fingerprint(input Fingerprint, scale float64) Fingerprint {
+	order, err := this.order()
+	if err != nil {
+		// Executing the graph fails, so there is no output to identify
+		return input.Chain("graph:" + err.Error())
+	}
+
+	fingerprints := map[NodeID]Fingerprint{}
+	for _, node := range order {
+		fingerprints[node.ID] = this.nodeFingerprint(node, fingerprints, input, scale)
+	}
+	return fingerprints[this.Output]
+}
+
+func (this *LayerGraph) nodeFingerprint(node *GraphNode, fingerprints map[NodeID]Fingerprint, input Fingerprint, scale float64) Fingerprint {
+	if node.ID == GraphInputNode {
+		return input
+	}
+
+	inputs := make([]Fingerprint, len(node.Inputs))
+	for i, id := range node.Inputs {
+		inputs[i] = fingerprints[id]
+	}
+	return node.fingerprint(inputs, scale)
+}
+
+func (this *LayerGraph) Execute(ctx context.Context, inputImage Image) (Image, error) {
+	return this.ExecuteScaled(ctx, inputImage, 1)
+}
+
+// Nodes convert their input themselves where they need to
+func (this *LayerGraph) InputColorSpace() ColorSpace {
+	return AnySpace
+}
+
+// Executes the nodes without a cache, as done when the graph is not part of a collection
+func (this *LayerGraph) ExecuteScaled(ctx context.Context, inputImage Image, scale float64) (Image, error) {
+	return this.execute(ctx, nil, inputImage, Fingerprint{}, scale)
+}
+
+// Executes the nodes the output depends on, looking up and storing their outputs in cache
+func (this *LayerGraph) execute(ctx context.Context, cache *LayerCache, inputImage Image, fingerprint Fingerprint, scale float64) (Image, error) {
+	order, err := this.order()
+	if err != nil {
+		return nil, err
+	}
+
+	images := map[NodeID]Image{}
+	fingerprints := map[NodeID]Fingerprint{}
+
+	for _, node := range order {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		outputFingerprint := this.nodeFingerprint(node, fingerprints, fingerprint, scale)
+		fingerprints[node.ID] = outputFingerprint
+
+		if node.ID == GraphInputNode {
+			images[node.ID] = inputImage
+			continue
+		}
+
+		inputImages := make([]Image, len(node.Inputs))
+		for i, id := range node.Inputs {
+			inputImages[i] = images[id]
+		}
+
+		// Disabled layers pass their input through
+		if node.Layer != nil && outputFingerprint == fingerprints[node.Inputs[0]] {
+			images[node.ID] = inputImages[0]
+			continue
+		}
+
+		outputImage, cached := cache.Get(outputFingerprint)
+		if !cached {
+			if node.Layer != nil {
+				outputImage, err = executeLayer(ctx, cache, node.Layer, inputImages[0], fingerprints[node.Inputs[0]], scale)
+			} else {
+				outputImage, err = node.Merge.Merge(ctx, inputImages)
+			}
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				return nil, WrapError(OperationFailed, err, fmt.Sprintf("Node %d failed", node.ID))
+			}
+			cache.Put(outputFingerprint, outputImage)
+		}
+		images[node.ID] = outputImage
+	}
+
+	return images[this.Output], nil
+}
+
+// Copy of the structure of a graph, whose nodes share their layers and merge operations with
+// the graph it was taken from
+type GraphSnapshot struct {
+	nodes  map[NodeID]GraphNode
+	output NodeID
+	nextID NodeID
+}
+
+func (this *LayerGraph) Snapshot() GraphSnapshot {
+	snapshot := GraphSnapshot{
+		nodes:  make(map[NodeID]GraphNode, len(this.nodes)),
+		output: this.Output,
+		nextID: this.nextID,
+	}
+	for id, node := range this.nodes {
+		copied := *node
+		copied.Inputs = append([]NodeID(nil), node.Inputs...)
+		snapshot.nodes[id] = copied
+	}
+	return snapshot
+}
+
+func (this *LayerGraph) Restore(snapshot GraphSnapshot) {
+	this.nodes = make(map[NodeID]*GraphNode, len(snapshot.nodes))
+	for id, node := range snapshot.nodes {
+		copied := node
+		copied.Inputs = append([]NodeID(nil), node.Inputs...)
+		this.nodes[id] = &copied
+	}
+	this.Output = snapshot.output
+	this.nextID = snapshot.nextID
+}
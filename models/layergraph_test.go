@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func nodeInputs(graph *LayerGraph) map[NodeID][]NodeID {
+	inputs := map[NodeID][]NodeID{}
+	for _, node := range graph.Nodes() {
+		inputs[node.ID] = append([]NodeID(nil), node.Inputs...)
+	}
+	return inputs
+}
+
+// input -> add 1 -> add 2, with add 2 as output
+func newTestGraph() (*LayerGraph, NodeID, NodeID) {
+	graph := NewLayerGraphFromChain([]*ImageLayer{
+		newTestLayer(addOperation{Amount: 1}),
+		newTestLayer(addOperation{Amount: 2}),
+	})
+	return graph, 1, 2
+}
+
+func TestGraphFromChain(t *testing.T) {
+	graph, first, second := newTestGraph()
+
+	expected := map[NodeID][]NodeID{GraphInputNode: nil, first: {GraphInputNode}, second: {first}}
+	if inputs := nodeInputs(graph); !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("Inputs are %v, expected %v", inputs, expected)
+	}
+	if graph.Output != second {
+		t.Errorf("Output is node %d", graph.Output)
+	}
+
+	result, err := graph.Execute(context.Background(), newUniformImage(2, 2, color.RGBA{0, 0, 0, 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := rgbaAt(result, 0, 0); c != (color.RGBA{3, 3, 3, 255}) {
+		t.Errorf("Result is %v", c)
+	}
+}
+
+func TestGraphRejectsCycles(t *testing.T) {
+	graph, first, second := newTestGraph()
+
+	if err := graph.Connect(first, first, 0); err == nil {
+		t.Error("Node was connected to itself")
+	}
+	if err := graph.Connect(second, first, 0); err == nil {
+		t.Error("Node was connected to a node it depends on")
+	}
+
+	merge, _ := NewBlendMerge(NormalBlend, 1)
+	mergeID := graph.AddMergeNode(merge)
+	graph.Connect(second, mergeID, 0)
+	if err := graph.Connect(mergeID, first, 0); err == nil {
+		t.Error("Cycle through a merge node was accepted")
+	}
+
+	expected := map[NodeID][]NodeID{GraphInputNode: nil, first: {GraphInputNode}, second: {first}, mergeID: {second, NoNode}}
+	if inputs := nodeInputs(graph); !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("Rejected connections changed the inputs to %v", inputs)
+	}
+}
+
+func TestGraphConnectionErrors(t *testing.T) {
+	graph, first, _ := newTestGraph()
+
+	if err := graph.Connect(GraphInputNode, first, 1); err == nil {
+		t.Error("Connected a slot the node does not have")
+	}
+	if err := graph.Connect(42, first, 0); err == nil {
+		t.Error("Connected a node that does not exist")
+	}
+	if err := graph.SetOutput(42); err == nil {
+		t.Error("Output was set to a node that does not exist")
+	}
+	if err := graph.RestoreNode(&GraphNode{ID: first}); err == nil {
+		t.Error("Restored a node with an existing ID")
+	}
+}
+
+func TestGraphUnconnectedInputs(t *testing.T) {
+	graph, first, second := newTestGraph()
+	if err := graph.Disconnect(second, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	input := newUniformImage(2, 2, color.RGBA{0, 0, 0, 255})
+	if _, err := graph.Execute(context.Background(), input); err == nil {
+		t.Error("Graph with an unconnected input executed")
+	}
+
+	// Only inputs the output depends on matter
+	graph.SetOutput(first)
+	if _, err := graph.Execute(context.Background(), input); err != nil {
+		t.Errorf("Graph failed on an unconnected input of another node: %v", err)
+	}
+
+	merge, _ := NewBlendMerge(NormalBlend, 1)
+	mergeID := graph.AddMergeNode(merge)
+	graph.Connect(first, mergeID, 0)
+	graph.SetOutput(mergeID)
+	if _, err := graph.Execute(context.Background(), input); err == nil {
+		t.Error("Merge node with an unconnected input executed")
+	}
+
+	// The fingerprint of a failing graph differs from its input so that nothing is cached for it
+	if fingerprint := graph.fingerprint(Fingerprint{}, 1); fingerprint == (Fingerprint{}) {
+		t.Error("Failing graph has the fingerprint of its input")
+	}
+}
+
+func TestGraphRemoveNode(t *testing.T) {
+	graph, first, second := newTestGraph()
+
+	if err := graph.RemoveNode(GraphInputNode); err == nil {
+		t.Error("Graph input was removed")
+	}
+	if err := graph.RemoveNode(42); err == nil {
+		t.Error("Node that does not exist was removed")
+	}
+
+	if err := graph.RemoveNode(first); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[NodeID][]NodeID{GraphInputNode: nil, second: {NoNode}}
+	if inputs := nodeInputs(graph); !reflect.DeepEqual(inputs, expected) {
+		t.Errorf("Inputs are %v, expected %v", inputs, expected)
+	}
+	if graph.Output != second {
+		t.Errorf("Output moved to node %d", graph.Output)
+	}
+
+	// Removing the output node makes the graph pass its input through
+	if err := graph.RemoveNode(second); err != nil {
+		t.Fatal(err)
+	}
+	if graph.Output != GraphInputNode {
+		t.Errorf("Output is node %d after removing it", graph.Output)
+	}
+	input := newUniformImage(2, 2, color.RGBA{5, 5, 5, 255})
+	result, err := graph.Execute(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != Image(input) {
+		t.Error("Empty graph did not pass its input through")
+	}
+}
+
+func TestGraphSnapshotRestore(t *testing.T) {
+	graph, first, second := newTestGraph()
+	snapshot := graph.Snapshot()
+	before := nodeInputs(graph)
+
+	merge, _ := NewBlendMerge(ScreenBlend, 0.5)
+	mergeID := graph.AddMergeNode(merge)
+	graph.Connect(first, mergeID, 0)
+	graph.Connect(second, mergeID, 1)
+	graph.SetOutput(mergeID)
+	graph.Disconnect(second, 0)
+	graph.RemoveNode(first)
+
+	graph.Restore(snapshot)
+	if inputs := nodeInputs(graph); !reflect.DeepEqual(inputs, before) {
+		t.Errorf("Restored inputs are %v, expected %v", inputs, before)
+	}
+	if graph.Output != second {
+		t.Errorf("Restored output is node %d", graph.Output)
+	}
+	// IDs handed out after the snapshot are handed out again
+	if id := graph.AddLayerNode(newTestLayer(addOperation{})); id != mergeID {
+		t.Errorf("New node has ID %d, expected %d", id, mergeID)
+	}
+
+	// Changes after restoring do not reach the snapshot
+	graph.Disconnect(second, 0)
+	graph.Restore(snapshot)
+	if inputs := nodeInputs(graph); !reflect.DeepEqual(inputs, before) {
+		t.Errorf("Snapshot changed along with the graph, inputs are %v", inputs)
+	}
+}
+
+// Blend nodes merge two branches, whose outputs are cached separately
+func TestGraphBlendNode(t *testing.T) {
+	counter := &countingOperation{name: "counter"}
+	graph := NewLayerGraph()
+	countID := graph.AddLayerNode(newTestLayer(counter))
+	addID := graph.AddLayerNode(newTestLayer(addOperation{Amount: 100}))
+	merge, _ := NewBlendMerge(NormalBlend, 0.5)
+	mergeID := graph.AddMergeNode(merge)
+	graph.Connect(GraphInputNode, countID, 0)
+	graph.Connect(GraphInputNode, addID, 0)
+	graph.Connect(countID, mergeID, 0)
+	graph.Connect(addID, mergeID, 1)
+	graph.SetOutput(mergeID)
+
+	collection := newTestCollection(newUniformImage(2, 2, color.RGBA{0, 0, 0, 255}), graph)
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := rgbaAt(result, 0, 0); c != (color.RGBA{50, 50, 50, 255}) {
+		t.Errorf("Result is %v", c)
+	}
+
+	// Changing the other branch leaves the cached output of the counting branch in use
+	addNode, _ := graph.Node(addID)
+	addNode.Layer.Operation = addOperation{Amount: 50}
+	if _, err := collection.ExecuteFullResolution(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if counter.executions != 1 {
+		t.Errorf("Unchanged branch was executed %d times", counter.executions)
+	}
+}
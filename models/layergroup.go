@@ -0,0 +1,36 @@
+package models
+
+import (
+	"context"
+)
+
+// Name of groups in project files and layer descriptions
+const GroupOperationName = "group"
+
+// Layer made of its own collection of layers, which are executed one after another on the input
+// of the group. Within a collection, the members of a group are executed through the cache of
+// that collection like any other layer.
+type LayerGroup struct {
+	Layers *ImageLayerCollection
+}
+
+func NewLayerGroup() *LayerGroup {
+	return &LayerGroup{
+		Layers: &ImageLayerCollection{},
+	}
+}
+
+func (this *LayerGroup) Execute(ctx context.Context, inputImage Image) (Image, error) {
+	return this.ExecuteScaled(ctx, inputImage, 1)
+}
+
+// Members convert their input themselves where they need to
+func (this *LayerGroup) InputColorSpace() ColorSpace {
+	return AnySpace
+}
+
+// Executes the members without a cache, as done when the group is not part of a collection
+func (this *LayerGroup) ExecuteScaled(ctx context.Context, inputImage Image, scale float64) (Image, error) {
+	outputImage, _, err := this.Layers.executeLayers(ctx, nil, inputImage, Fingerprint{}, scale, false)
+	return outputImage, err
+}
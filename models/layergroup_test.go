@@ -0,0 +1,130 @@
+package models
+
+import (
+	"context"
+	"image/color"
+	"testing"
+)
+
+func newTestGroup(operations ...ImageOperation) *LayerGroup {
+	group := NewLayerGroup()
+	for _, operation := range operations {
+		group.Layers.Append(newTestLayer(operation))
+	}
+	return group
+}
+
+// add 1, group(add 2, group(add 4)), add 8
+func newNestedTestCollection() (*ImageLayerCollection, *LayerGroup) {
+	inner := newTestGroup(addOperation{Amount: 4})
+	outer := newTestGroup(addOperation{Amount: 2}, inner)
+	collection := newTestCollection(newUniformImage(4, 4, color.RGBA{0, 0, 0, 255}), addOperation{Amount: 1}, outer, addOperation{Amount: 8})
+	return collection, inner
+}
+
+func TestNestedGroupsExecuteTheirMembers(t *testing.T) {
+	collection, _ := newNestedTestCollection()
+
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := rgbaAt(result, 0, 0); c != (color.RGBA{15, 15, 15, 255}) {
+		t.Errorf("Result is %v", c)
+	}
+
+	// Executed on its own, without a cache, a group gives the same output
+	outer, _ := collection.At(1)
+	output, err := outer.Operation.(*LayerGroup).Execute(context.Background(), newUniformImage(4, 4, color.RGBA{0, 0, 0, 255}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := rgbaAt(output, 0, 0); c != (color.RGBA{6, 6, 6, 255}) {
+		t.Errorf("Group output is %v", c)
+	}
+}
+
+func TestDisabledMembersAndGroups(t *testing.T) {
+	collection, inner := newNestedTestCollection()
+
+	member, _ := inner.Layers.At(0)
+	member.Disable()
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := rgbaAt(result, 0, 0); c != (color.RGBA{11, 11, 11, 255}) {
+		t.Errorf("Result without the inner member is %v", c)
+	}
+
+	outer, _ := collection.At(1)
+	outer.Disable()
+	result, err = collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := rgbaAt(result, 0, 0); c != (color.RGBA{9, 9, 9, 255}) {
+		t.Errorf("Result without the group is %v", c)
+	}
+}
+
+// A group stands for its members, so it has the fingerprint of the same layers without it
+func TestGroupFingerprints(t *testing.T) {
+	input := FingerprintImage(newUniformImage(4, 4, color.RGBA{0, 0, 0, 255}))
+	collection, inner := newNestedTestCollection()
+	flat := newTestCollection(nil, addOperation{Amount: 1}, addOperation{Amount: 2}, addOperation{Amount: 4}, addOperation{Amount: 8})
+
+	fingerprint := collection.chainFingerprint(input, 1)
+	if fingerprint != flat.chainFingerprint(input, 1) {
+		t.Error("Nested groups have another fingerprint than their members")
+	}
+
+	member, _ := inner.Layers.At(0)
+	member.Operation = addOperation{Amount: 5}
+	changed := collection.chainFingerprint(input, 1)
+	if changed == fingerprint {
+		t.Error("Changing a member of the inner group kept the fingerprint")
+	}
+
+	member.Disable()
+	if disabled := collection.chainFingerprint(input, 1); disabled == changed || disabled == fingerprint {
+		t.Error("Disabling a member of the inner group kept the fingerprint")
+	}
+
+	// Blending the group sets it apart from the same layers without a group
+	member.Operation = addOperation{Amount: 4}
+	member.Enable()
+	outer, _ := collection.At(1)
+	if err := outer.SetBlending(MultiplyBlend, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if collection.chainFingerprint(input, 1) == fingerprint {
+		t.Error("Blending the group kept the fingerprint")
+	}
+}
+
+// Members are cached like other layers, so only those after a change run again
+func TestGroupMembersAreCached(t *testing.T) {
+	before := &countingOperation{name: "before"}
+	after := &countingOperation{name: "after"}
+	inner := newTestGroup(before, addOperation{Amount: 1}, after)
+	collection := newTestCollection(newUniformImage(4, 4, color.RGBA{0, 0, 0, 255}), newTestGroup(inner))
+
+	for i := 0; i < 2; i++ {
+		if _, err := collection.ExecuteFullResolution(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if before.executions != 1 || after.executions != 1 {
+		t.Fatalf("Members executed %d and %d times", before.executions, after.executions)
+	}
+
+	member, _ := inner.Layers.At(1)
+	member.Operation = addOperation{Amount: 2}
+	if _, err := collection.ExecuteFullResolution(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if before.executions != 1 || after.executions != 2 {
+		t.Errorf("After a change, members executed %d and %d times", before.executions, after.executions)
+	}
+}
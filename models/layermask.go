@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"math"
+	"sync"
+)
+
+type MaskKind string
+
+const (
+	LinearGradientMask MaskKind = "linearGradient"
+	RadialGradientMask MaskKind = "radialGradient"
+	EllipseMask        MaskKind = "ellipse"
+	RectangleMask      MaskKind = "rectangle"
+	BitmapMask         MaskKind = "bitmap"
+)
+
+// Position relative to the image, where 0 is the left or top edge and 1 the right or bottom edge
+type MaskPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Describes a mask independently of the size of the image it is applied to
+type MaskShape struct {
+	Kind MaskKind `json:"kind"`
+	// Linear gradients go from no effect at Start to full effect at End
+	Start MaskPoint `json:"start,omitempty"`
+	End   MaskPoint `json:"end,omitempty"`
+	// Radial gradients, ellipses and rectangles, with radii relative to the image size
+	Center MaskPoint `json:"center,omitempty"`
+	Radius MaskPoint `json:"radius,omitempty"`
+	// Share of the radius over which the edge of an ellipse or rectangle fades out, from 0 to 1
+	Feather  float64 `json:"feather,omitempty"`
+	Inverted bool    `json:"inverted,omitempty"`
+}
+
+// Grayscale mask restricting where a layer applies. White pixels take the layer output, black
+// pixels keep its input and gray pixels mix both. Masks are immutable, so the last rendering is
+// kept for the next image of the same size.
+type LayerMask struct {
+	Shape MaskShape
+	// Source of bitmap masks, stretched over the image
+	Bitmap *image.Gray
+
+	description string
+
+	mutex    sync.Mutex
+	rendered *image.Gray
+}
+
+func NewLayerMask(shape MaskShape, bitmap *image.Gray) (*LayerMask, error) {
+	switch shape.Kind {
+	case LinearGradientMask:
+		if shape.Start == shape.End {
+			return nil, NewError(InvalidOperation, "Gradient start and end cannot be the same")
+		}
+	case RadialGradientMask, EllipseMask, RectangleMask:
+		if !(shape.Radius.X > 0 && shape.Radius.Y > 0) {
+			return nil, NewError(InvalidOperation, "Mask radius has to be positive")
+		}
+		if !(shape.Feather >= 0 && shape.Feather <= 1) {
+			return nil, NewError(InvalidOperation, "Mask feather has to be between 0 and 1")
+		}
+	case BitmapMask:
+		if bitmap == nil || bitmap.Rect.Empty() {
+			return nil, NewError(InvalidOperation, "Bitmap mask without image")
+		}
+	default:
+		return nil, NewError(InvalidOperation, fmt.Sprintf("Unknown mask kind %q", shape.Kind))
+	}
+
+	description := fmt.Sprintf("mask:%+v", shape)
+	if shape.Kind == BitmapMask {
+		description += fmt.Sprintf("|%x", sha256.Sum256(bitmap.Pix))
+	} else {
+		bitmap = nil
+	}
+
+	return &LayerMask{Shape: shape, Bitmap: bitmap, description: description}, nil
+}
+
+// Returns the mask for an image with the given bounds
+func (this *LayerMask) Render(bounds image.Rectangle) *image.Gray {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.rendered != nil && this.rendered.Rect == bounds {
+		return this.rendered
+	}
+
+	mask := image.NewGray(bounds)
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := mask.Pix[mask.PixOffset(bounds.Min.X, y):]
+		// Pixel centers, relative to the image
+		relativeY := (float64(y-bounds.Min.Y) + 0.5) / height
+
+		for x := 0; x < bounds.Dx(); x++ {
+			relativeX := (float64(x) + 0.5) / width
+			value := this.value(relativeX, relativeY, width, height)
+			if this.Shape.Inverted {
+				value = 1 - value
+			}
+			row[x] = toChannel[uint8](value)
+		}
+	}
+
+	this.rendered = mask
+	return mask
+}
+
+// Mask value from 0 to 1 at a position relative to an image of the given size
+func (this *LayerMask) value(x, y, width, height float64) float64 {
+	shape := this.Shape
+
+	switch shape.Kind {
+	case LinearGradientMask:
+		// Projection onto the gradient line, measured in pixels so that angles are kept
+		dx, dy := (shape.End.X-shape.Start.X)*width, (shape.End.Y-shape.Start.Y)*height
+		px, py := (x-shape.Start.X)*width, (y-shape.Start.Y)*height
+		return clampUnit((px*dx + py*dy) / (dx*dx + dy*dy))
+	case RadialGradientMask:
+		return clampUnit(1 - math.Hypot((x-shape.Center.X)/shape.Radius.X, (y-shape.Center.Y)/shape.Radius.Y))
+	case EllipseMask:
+		return feathered(math.Hypot((x-shape.Center.X)/shape.Radius.X, (y-shape.Center.Y)/shape.Radius.Y), shape.Feather)
+	case RectangleMask:
+		return feathered(math.Max(math.Abs(x-shape.Center.X)/shape.Radius.X, math.Abs(y-shape.Center.Y)/shape.Radius.Y), shape.Feather)
+	case BitmapMask:
+		return sampleGray(this.Bitmap, x, y)
+	}
+	return 1
+}
+
+// Value of a shape at a distance from its center, where the edge of the shape is at 1
+func feathered(distance, feather float64) float64 {
+	if feather == 0 {
+		if distance <= 1 {
+			return 1
+		}
+		return 0
+	}
+	return clampUnit((1 - distance) / feather)
+}
+
+// Bilinear sample of img at a position relative to its bounds
+func sampleGray(img *image.Gray, x, y float64) float64 {
+	bounds := img.Rect
+	fx := x*float64(bounds.Dx()) - 0.5
+	fy := y*float64(bounds.Dy()) - 0.5
+
+	x0, y0 := int(math.Floor(fx)), int(math.Floor(fy))
+	wx, wy := fx-float64(x0), fy-float64(y0)
+
+	at := func(x, y int) float64 {
+		x = clampIndex(x, bounds.Dx()) + bounds.Min.X
+		y = clampIndex(y, bounds.Dy()) + bounds.Min.Y
+		return float64(img.Pix[img.PixOffset(x, y)]) / 255
+	}
+
+	top := at(x0, y0)*(1-wx) + at(x0+1, y0)*wx
+	bottom := at(x0, y0+1)*(1-wx) + at(x0+1, y0+1)*wx
+	return top*(1-wy) + bottom*wy
+}
+
+func clampIndex(index, length int) int {
+	if index < 0 {
+		return 0
+	}
+	if index >= length {
+		return length - 1
+	}
+	return index
+}
+
+func clampUnit(value float64) float64 {
+	return math.Max(0, math.Min(1, value))
+}
+
+// Mixes outputImage into inputImage by the mask values. Both images need the same bounds and
+// depth.
+func ApplyMask(ctx context.Context, inputImage, outputImage Image, mask *LayerMask) (Image, error) {
+	switch input := inputImage.(type) {
+	case *image.RGBA64:
+		return applyMaskChannels(ctx, Channels16(input), Channels16(outputImage.(*image.RGBA64)), mask)
+	case *LinearImage:
+		return applyMaskChannels(ctx, ChannelsLinear(input), ChannelsLinear(outputImage.(*LinearImage)), mask)
+	}
+	return applyMaskChannels(ctx, Channels8(inputImage.(*image.RGBA)), Channels8(outputImage.(*image.RGBA)), mask)
+}
+
+func applyMaskChannels[C Channel](ctx context.Context, inputImage, outputImage Channels[C], mask *LayerMask) (Image, error) {
+	bounds := inputImage.Rect
+	maskImage := mask.Render(bounds)
+	resultImage := NewChannels[C](bounds)
+	scale := mixScale[C]()
+
+	err := forEachRowParallel(ctx, bounds, func(y int) {
+		inputRow := inputImage.Row(y)
+		outputRow := outputImage.Row(y)
+		resultRow := resultImage.Row(y)
+		maskRow := maskImage.Pix[maskImage.PixOffset(bounds.Min.X, y):]
+
+		for i := range resultRow {
+			resultRow[i] = mix(inputRow[i], outputRow[i], int(maskRow[i/4])*scale/255)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return imageFromChannels(resultImage), nil
+}
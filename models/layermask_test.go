@@ -0,0 +1,214 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func maskValues(mask *image.Gray) []uint8 {
+	values := make([]uint8, 0, mask.Rect.Dx()*mask.Rect.Dy())
+	for y := mask.Rect.Min.Y; y < mask.Rect.Max.Y; y++ {
+		values = append(values, mask.Pix[mask.PixOffset(mask.Rect.Min.X, y):][:mask.Rect.Dx()]...)
+	}
+	return values
+}
+
+func newTestMask(t *testing.T, shape MaskShape, bitmap *image.Gray) *LayerMask {
+	mask, err := NewLayerMask(shape, bitmap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mask
+}
+
+func TestNewLayerMaskValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		shape MaskShape
+	}{
+		{"empty gradient", MaskShape{Kind: LinearGradientMask, Start: MaskPoint{0.5, 0.5}, End: MaskPoint{0.5, 0.5}}},
+		{"zero radius", MaskShape{Kind: RadialGradientMask, Radius: MaskPoint{0, 0.5}}},
+		{"negative feather", MaskShape{Kind: EllipseMask, Radius: MaskPoint{0.5, 0.5}, Feather: -0.1}},
+		{"feather over 1", MaskShape{Kind: RectangleMask, Radius: MaskPoint{0.5, 0.5}, Feather: 1.5}},
+		{"bitmap without image", MaskShape{Kind: BitmapMask}},
+		{"unknown kind", MaskShape{Kind: "star"}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewLayerMask(test.shape, nil); err == nil {
+			t.Errorf("Mask with %s was accepted", test.name)
+		}
+	}
+}
+
+func TestLinearGradientMask(t *testing.T) {
+	mask := newTestMask(t, MaskShape{Kind: LinearGradientMask, Start: MaskPoint{0, 0}, End: MaskPoint{1, 0}}, nil)
+
+	// Sampled at the pixel centers
+	expected := []uint8{32, 96, 159, 223}
+	if values := maskValues(mask.Render(image.Rect(0, 0, 4, 1))); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Mask is %v, expected %v", values, expected)
+	}
+
+	// Beyond its ends the gradient keeps the value of the nearest end
+	mask = newTestMask(t, MaskShape{Kind: LinearGradientMask, Start: MaskPoint{0.25, 0}, End: MaskPoint{0.75, 0}, Inverted: true}, nil)
+	expected = []uint8{255, 223, 159, 96, 32, 0}
+	if values := maskValues(mask.Render(image.Rect(0, 0, 8, 1)))[1:7]; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Inverted mask is %v, expected %v", values, expected)
+	}
+}
+
+func TestRadialGradientMask(t *testing.T) {
+	mask := newTestMask(t, MaskShape{Kind: RadialGradientMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.5, 0.5}}, nil)
+
+	values := maskValues(mask.Render(image.Rect(0, 0, 3, 3)))
+	if values[4] != 255 {
+		t.Errorf("Center is %d", values[4])
+	}
+	// Corners are farther from the center than the middles of the edges
+	if values[0] >= values[1] || values[1] >= values[4] || values[1] != values[3] {
+		t.Errorf("Mask is %v", values)
+	}
+}
+
+func TestShapeMasks(t *testing.T) {
+	tests := []struct {
+		name     string
+		shape    MaskShape
+		expected []uint8
+	}{
+		{
+			"ellipse",
+			MaskShape{Kind: EllipseMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.3, 0.3}},
+			[]uint8{0, 0, 0, 0, 255, 0, 0, 0, 0},
+		},
+		{
+			"inverted ellipse",
+			MaskShape{Kind: EllipseMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.3, 0.3}, Inverted: true},
+			[]uint8{255, 255, 255, 255, 0, 255, 255, 255, 255},
+		},
+		{
+			// Covers the middle column, where it reaches the edges
+			"rectangle",
+			MaskShape{Kind: RectangleMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.2, 0.5}},
+			[]uint8{0, 255, 0, 0, 255, 0, 0, 255, 0},
+		},
+		{
+			// Fades out over the outer half of its radius
+			"feathered rectangle",
+			MaskShape{Kind: RectangleMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.5, 0.5}, Feather: 0.5},
+			[]uint8{170, 170, 170, 170, 255, 170, 170, 170, 170},
+		},
+	}
+
+	for _, test := range tests {
+		mask := newTestMask(t, test.shape, nil)
+		if values := maskValues(mask.Render(image.Rect(0, 0, 3, 3))); !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("%s mask is %v, expected %v", test.name, values, test.expected)
+		}
+	}
+}
+
+// Bitmaps are stretched over the image with bilinear sampling
+func TestBitmapMask(t *testing.T) {
+	bitmap := image.NewGray(image.Rect(0, 0, 2, 1))
+	bitmap.Pix = []uint8{0, 255}
+	mask := newTestMask(t, MaskShape{Kind: BitmapMask}, bitmap)
+
+	expected := []uint8{0, 64, 191, 255}
+	if values := maskValues(mask.Render(image.Rect(0, 0, 4, 1))); !reflect.DeepEqual(values, expected) {
+		t.Errorf("Mask is %v, expected %v", values, expected)
+	}
+
+	// The bitmap content is part of the description, unlike for other kinds
+	other := image.NewGray(image.Rect(0, 0, 2, 1))
+	other.Pix = []uint8{255, 0}
+	if mask.description == newTestMask(t, MaskShape{Kind: BitmapMask}, other).description {
+		t.Error("Masks of different bitmaps have the same description")
+	}
+	if shape := newTestMask(t, MaskShape{Kind: EllipseMask, Radius: MaskPoint{1, 1}}, bitmap); shape.Bitmap != nil {
+		t.Error("Shape mask kept the bitmap")
+	}
+}
+
+func TestMaskRenderingIsKept(t *testing.T) {
+	mask := newTestMask(t, MaskShape{Kind: RadialGradientMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.5, 0.5}}, nil)
+
+	first := mask.Render(image.Rect(0, 0, 4, 4))
+	if mask.Render(image.Rect(0, 0, 4, 4)) != first {
+		t.Error("Mask was rendered again for the same bounds")
+	}
+	if mask.Render(image.Rect(0, 0, 2, 2)) == first {
+		t.Error("Mask was not rendered again for other bounds")
+	}
+}
+
+func TestApplyMask(t *testing.T) {
+	input := newUniformImage(4, 1, color.RGBA{0, 0, 0, 255})
+	output := newUniformImage(4, 1, color.RGBA{200, 100, 0, 255})
+	mask := newTestMask(t, MaskShape{Kind: LinearGradientMask, Start: MaskPoint{0, 0}, End: MaskPoint{1, 0}}, nil)
+
+	result, err := ApplyMask(context.Background(), input, output, mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []color.RGBA{{25, 13, 0, 255}, {75, 38, 0, 255}, {125, 62, 0, 255}, {175, 87, 0, 255}}
+	for x, pixel := range expected {
+		if actual := rgbaAt(result, x, 0); actual != pixel {
+			t.Errorf("Pixel %d is %v, expected %v", x, actual, pixel)
+		}
+	}
+}
+
+func TestApplyMask16Bit(t *testing.T) {
+	input := newUniformImage16(4, 1, color.RGBA64{0x0123, 0x8000, 0, 0xffff})
+	output := newUniformImage16(4, 1, color.RGBA64{0xfedc, 0x8001, 0x1000, 0xffff})
+	mask := newTestMask(t, MaskShape{Kind: LinearGradientMask, Start: MaskPoint{0, 0}, End: MaskPoint{1, 0}}, nil)
+
+	result, err := ApplyMask(context.Background(), input, output, mask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rgba64, ok := result.(*image.RGBA64)
+	if !ok {
+		t.Fatalf("Result is %T", result)
+	}
+
+	// Mixed by the mask values 32, 96, 159 and 223 out of 255
+	for x, maskValue := range []float64{32, 96, 159, 223} {
+		in, out, actual := input.RGBA64At(x, 0), output.RGBA64At(x, 0), rgba64.RGBA64At(x, 0)
+		channels := [][3]uint16{{in.R, out.R, actual.R}, {in.G, out.G, actual.G}, {in.B, out.B, actual.B}}
+		for _, channel := range channels {
+			expected := float64(channel[0]) + (float64(channel[1])-float64(channel[0]))*maskValue/255
+			if math.Abs(float64(channel[2])-expected) > 1 {
+				t.Errorf("Pixel %d is %v, expected %.0f from %v and %v", x, actual, expected, in, out)
+			}
+		}
+		if actual.A != 0xffff {
+			t.Errorf("Pixel %d has alpha %d", x, actual.A)
+		}
+	}
+}
+
+// Masked layers only change the image where the mask is white
+func TestMaskedLayer(t *testing.T) {
+	collection := newTestCollection(newUniformImage(3, 3, color.RGBA{10, 10, 10, 255}), addOperation{Amount: 100})
+	layer, _ := collection.At(0)
+	layer.Mask = newTestMask(t, MaskShape{Kind: EllipseMask, Center: MaskPoint{0.5, 0.5}, Radius: MaskPoint{0.3, 0.3}}, nil)
+
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if center := rgbaAt(result, 1, 1); center != (color.RGBA{110, 110, 110, 255}) {
+		t.Errorf("Center is %v", center)
+	}
+	if corner := rgbaAt(result, 0, 0); corner != (color.RGBA{10, 10, 10, 255}) {
+		t.Errorf("Corner is %v", corner)
+	}
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+)
+
+// Image holding linear light as float32, 4 values per pixel from 0 to 1 in R, G, B, A order and
+// premultiplied by alpha, with rows Stride values apart. Pipelines working in LinearSpace run on
+// it, so that filters average light the way it physically mixes and chained layers lose no
+// precision between them. At and Set convert to and from sRGB colors.
+type LinearImage struct {
+	Pix    []float32
+	Stride int
+	Rect   image.Rectangle
+}
+
+func NewLinearImage(bounds image.Rectangle) *LinearImage {
+	return &LinearImage{Pix: make([]float32, bounds.Dx()*bounds.Dy()*4), Stride: bounds.Dx() * 4, Rect: bounds}
+}
+
+func (this *LinearImage) ColorModel() color.Model {
+	return color.RGBA64Model
+}
+
+func (this *LinearImage) Bounds() image.Rectangle {
+	return this.Rect
+}
+
+func (this *LinearImage) At(x, y int) color.Color {
+	return this.RGBA64At(x, y)
+}
+
+func (this *LinearImage) RGBA64At(x, y int) color.RGBA64 {
+	if !(image.Point{x, y}.In(this.Rect)) {
+		return color.RGBA64{}
+	}
+	initTransferTables()
+	pixel := this.Pix[this.PixOffset(x, y):]
+	r, g, b, a := encodePixel[uint16](pixel[0], pixel[1], pixel[2], pixel[3])
+	return color.RGBA64{r, g, b, a}
+}
+
+func (this *LinearImage) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(this.Rect)) {
+		return
+	}
+	initTransferTables()
+	r, g, b, a := color.RGBA64Model.Convert(c).(color.RGBA64).RGBA()
+	pixel := this.Pix[this.PixOffset(x, y):]
+	pixel[0], pixel[1], pixel[2], pixel[3] = decodePixel(uint16(r), uint16(g), uint16(b), uint16(a))
+}
+
+func (this *LinearImage) PixOffset(x, y int) int {
+	return (y-this.Rect.Min.Y)*this.Stride + (x-this.Rect.Min.X)*4
+}
+
+// Image sharing the pixels of the part within r
+func (this *LinearImage) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(this.Rect)
+	if r.Empty() {
+		return &LinearImage{}
+	}
+	return &LinearImage{Pix: this.Pix[this.PixOffset(r.Min.X, r.Min.Y):], Stride: this.Stride, Rect: r}
+}
+
+// Channels of a linear image, sharing its pixel buffer
+func ChannelsLinear(img *LinearImage) Channels[float32] {
+	return Channels[float32]{Values: img.Pix, Stride: img.Stride, Rect: img.Rect}
+}
+
+func IsLinear(img Image) bool {
+	_, ok := img.(*LinearImage)
+	return ok
+}
+
+// Converts an sRGB image of either depth to linear light. Linear images are returned as they are.
+func ToLinearImage(img Image) *LinearImage {
+	initTransferTables()
+
+	switch img := img.(type) {
+	case *LinearImage:
+		return img
+	case *image.RGBA64:
+		result := NewLinearImage(img.Rect)
+		result.forEachRow(func(y int, row []float32) {
+			pix := img.Pix[img.PixOffset(img.Rect.Min.X, y):]
+			for i := 0; i < len(row); i += 4 {
+				p := pix[i*2 : i*2+8 : i*2+8]
+				row[i], row[i+1], row[i+2], row[i+3] = decodePixel(
+					uint16(p[0])<<8|uint16(p[1]), uint16(p[2])<<8|uint16(p[3]),
+					uint16(p[4])<<8|uint16(p[5]), uint16(p[6])<<8|uint16(p[7]))
+			}
+		})
+		return result
+	}
+
+	rgba := img.(*image.RGBA)
+	result := NewLinearImage(rgba.Rect)
+	result.forEachRow(func(y int, row []float32) {
+		pix := rgba.Pix[rgba.PixOffset(rgba.Rect.Min.X, y):]
+		for i := 0; i < len(row); i += 4 {
+			row[i], row[i+1], row[i+2], row[i+3] = decodePixel(pix[i], pix[i+1], pix[i+2], pix[i+3])
+		}
+	})
+	return result
+}
+
+// Converts the image to 16-bit sRGB, which keeps nearly all of its precision
+func (this *LinearImage) ToRGBA64() *image.RGBA64 {
+	initTransferTables()
+	result := image.NewRGBA64(this.Rect)
+
+	this.forEachRow(func(y int, row []float32) {
+		pix := result.Pix[result.PixOffset(this.Rect.Min.X, y):]
+		for i := 0; i < len(row); i += 4 {
+			r, g, b, a := encodePixel[uint16](row[i], row[i+1], row[i+2], row[i+3])
+			p := pix[i*2 : i*2+8 : i*2+8]
+			p[0], p[1], p[2], p[3] = uint8(r>>8), uint8(r), uint8(g>>8), uint8(g)
+			p[4], p[5], p[6], p[7] = uint8(b>>8), uint8(b), uint8(a>>8), uint8(a)
+		}
+	})
+	return result
+}
+
+// Converts the image to 8-bit sRGB, as needed for display
+func (this *LinearImage) ToRGBA() *image.RGBA {
+	initTransferTables()
+	result := image.NewRGBA(this.Rect)
+
+	this.forEachRow(func(y int, row []float32) {
+		pix := result.Pix[result.PixOffset(this.Rect.Min.X, y):]
+		for i := 0; i < len(row); i += 4 {
+			pix[i], pix[i+1], pix[i+2], pix[i+3] = encodePixel[uint8](row[i], row[i+1], row[i+2], row[i+3])
+		}
+	})
+	return result
+}
+
+// Calls fn with the values of every row within the bounds, with the rows split between all CPUs
+func (this *LinearImage) forEachRow(fn func(y int, row []float32)) {
+	forEachRowParallel(context.Background(), this.Rect, func(y int) {
+		start := this.PixOffset(this.Rect.Min.X, y)
+		fn(y, this.Pix[start:start+this.Rect.Dx()*4])
+	})
+}
+
+// Linear premultiplied pixel of a premultiplied sRGB pixel. The sRGB curve applies to straight
+// colors, so colors are unpremultiplied first.
+func decodePixel[C uint8 | uint16](r, g, b, a C) (float32, float32, float32, float32) {
+	max := ^C(0)
+	if a == max {
+		return decodeSRGB(r), decodeSRGB(g), decodeSRGB(b), 1
+	}
+	alpha := float32(a) / float32(max)
+	r, g, b = Unpremultiply(r, a), Unpremultiply(g, a), Unpremultiply(b, a)
+	return decodeSRGB(r) * alpha, decodeSRGB(g) * alpha, decodeSRGB(b) * alpha, alpha
+}
+
+// Premultiplied sRGB pixel of a linear premultiplied pixel
+func encodePixel[C uint8 | uint16](r, g, b, a float32) (C, C, C, C) {
+	if !(a > 0) {
+		return 0, 0, 0, 0
+	}
+	if a >= 1 {
+		max := float32(^C(0))
+		return C(encodeSRGB(r)*max + 0.5), C(encodeSRGB(g)*max + 0.5), C(encodeSRGB(b)*max + 0.5), ^C(0)
+	}
+	// Colors stay at or below alpha after rounding, since encodeSRGB is at most 1
+	scale := a * float32(^C(0))
+	return C(encodeSRGB(r/a)*scale + 0.5), C(encodeSRGB(g/a)*scale + 0.5), C(encodeSRGB(b/a)*scale + 0.5), C(scale + 0.5)
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// Every 16-bit value comes back from linear light within a step, opaque or not
+func TestLinearImageRoundTrip16Bit(t *testing.T) {
+	for _, alpha := range []int{0xffff, 0x8000, 0x0101} {
+		img := image.NewRGBA64(image.Rect(0, 0, 256, 256))
+		for i := 0; i < 1<<16; i++ {
+			value := uint16(i * alpha / 0xffff)
+			img.SetRGBA64(i%256, i/256, color.RGBA64{value, value, value, uint16(alpha)})
+		}
+
+		result := ToLinearImage(img).ToRGBA64()
+		largest := 0
+		for i := 0; i < 1<<16; i++ {
+			expected, actual := img.RGBA64At(i%256, i/256), result.RGBA64At(i%256, i/256)
+			if actual.A != expected.A || actual.R > actual.A {
+				t.Fatalf("%v came back as %v", expected, actual)
+			}
+			d := int(actual.R) - int(expected.R)
+			if d < 0 {
+				d = -d
+			}
+			if d > largest {
+				largest = d
+			}
+		}
+		if largest > 1 {
+			t.Errorf("Values with alpha %#04x differ by up to %d after the round trip", alpha, largest)
+		}
+	}
+}
+
+// 8-bit pixels of every alpha and premultiplied value come back exactly
+func TestLinearImageRoundTrip8Bit(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for alpha := 0; alpha < 256; alpha++ {
+		for value := 0; value <= alpha; value++ {
+			img.SetRGBA(value, alpha, color.RGBA{uint8(value), uint8(value / 2), 0, uint8(alpha)})
+		}
+	}
+
+	result := ToLinearImage(img).ToRGBA()
+	for y := 0; y < 256; y++ {
+		for x := 0; x <= y; x++ {
+			if expected, actual := img.RGBAAt(x, y), result.RGBAAt(x, y); actual != expected {
+				t.Fatalf("%v came back as %v", expected, actual)
+			}
+		}
+	}
+}
+
+// Sub-images keep the pixels of their parents at the same coordinates
+func TestLinearImageOfSubImage(t *testing.T) {
+	parent := image.NewRGBA64(image.Rect(0, 0, 4, 4))
+	parent.SetRGBA64(2, 3, color.RGBA64{0x4000, 0x2000, 0x1000, 0x8000})
+	img := parent.SubImage(image.Rect(1, 2, 4, 4)).(*image.RGBA64)
+
+	linear := ToLinearImage(img)
+	if linear.Bounds() != img.Rect {
+		t.Fatalf("Bounds are %v, expected %v", linear.Bounds(), img.Rect)
+	}
+	if pixel := linear.ToRGBA64().RGBA64At(2, 3); pixel != parent.RGBA64At(2, 3) {
+		t.Errorf("Pixel is %v, expected %v", pixel, parent.RGBA64At(2, 3))
+	}
+	if pixel := linear.RGBA64At(1, 2); pixel != (color.RGBA64{}) {
+		t.Errorf("Transparent pixel is %v", pixel)
+	}
+}
+
+func TestDecodePixel(t *testing.T) {
+	initTransferTables()
+	tests := []struct {
+		name       string
+		r, g, b, a uint8
+		expected   [4]float64
+	}{
+		{"transparent", 0, 0, 0, 0, [4]float64{0, 0, 0, 0}},
+		{"opaque", 255, 128, 0, 255, [4]float64{1, SRGBToLinear(128.0 / 255), 0, 1}},
+		// The straight color of 64 at alpha 128 is 128, whose light is premultiplied again
+		{"half transparent", 128, 64, 0, 128, [4]float64{128.0 / 255, SRGBToLinear(128.0/255) * 128 / 255, 0, 128.0 / 255}},
+		{"barely visible", 1, 1, 0, 1, [4]float64{1.0 / 255, 1.0 / 255, 0, 1.0 / 255}},
+	}
+
+	for _, test := range tests {
+		r, g, b, a := decodePixel(test.r, test.g, test.b, test.a)
+		for c, value := range []float32{r, g, b, a} {
+			if math.Abs(float64(value)-test.expected[c]) > 1e-6 {
+				t.Errorf("%s pixel decoded to %v, expected %v", test.name, []float32{r, g, b, a}, test.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestEncodePixel(t *testing.T) {
+	initTransferTables()
+	// Light of the sRGB value 128
+	gray := float32(SRGBToLinear(128.0 / 255))
+	tests := []struct {
+		name       string
+		r, g, b, a float32
+		expected   color.RGBA
+	}{
+		{"transparent", 0, 0, 0, 0, color.RGBA{}},
+		{"transparent with color", 0.5, 0.5, 0.5, 0, color.RGBA{}},
+		{"negative alpha", 0.5, 0.5, 0.5, -0.5, color.RGBA{}},
+		{"alpha NaN", 0.5, 0.5, 0.5, float32(math.NaN()), color.RGBA{}},
+		{"opaque", 1, gray, 0, 1, color.RGBA{255, 128, 0, 255}},
+		{"alpha over 1", gray, gray, gray, 1.5, color.RGBA{128, 128, 128, 255}},
+		{"half transparent", 0.5, gray / 2, 0, 0.5, color.RGBA{128, 64, 0, 128}},
+		// Light beyond what alpha allows, as blurs and blends can leave it, is clipped to alpha
+		{"colors over alpha", 0.8, 2, 0, 0.5, color.RGBA{128, 128, 0, 128}},
+	}
+
+	for _, test := range tests {
+		r, g, b, a := encodePixel[uint8](test.r, test.g, test.b, test.a)
+		if actual := (color.RGBA{r, g, b, a}); actual != test.expected {
+			t.Errorf("%s pixel encoded to %v, expected %v", test.name, actual, test.expected)
+		}
+	}
+}
+
+// Mixing black and white halfway gives half their light, which is brighter than the halfway
+// sRGB value
+func TestBlendInLinearLight(t *testing.T) {
+	black := newUniformImage(1, 1, color.RGBA{0, 0, 0, 255})
+	white := newUniformImage(1, 1, color.RGBA{255, 255, 255, 255})
+
+	perceptual, err := Blend(context.Background(), black, white, NormalBlend, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linear, err := Blend(context.Background(), ToLinearImage(black), ToLinearImage(white), NormalBlend, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsLinear(linear) {
+		t.Fatalf("Linear blend is %T", linear)
+	}
+
+	if pixel := rgbaAt(perceptual, 0, 0); pixel != (color.RGBA{128, 128, 128, 255}) {
+		t.Errorf("Perceptual blend is %v", pixel)
+	}
+	// LinearToSRGB(0.5) is 0.735
+	if pixel := rgbaAt(linear, 0, 0); pixel != (color.RGBA{188, 188, 188, 255}) {
+		t.Errorf("Linear blend is %v", pixel)
+	}
+}
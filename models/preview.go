@@ -0,0 +1,95 @@
+package models
+
+import (
+	"image"
+	"math"
+)
+
+type sampleWeight struct {
+	index  int
+	weight float32
+}
+
+// Returns a copy of img downscaled to fit within maxSize, keeping its aspect ratio.
+// Images that already fit, or a zero maxSize, return img itself.
+func NewPreviewImage(img Image, maxSize image.Point) Image {
+	bounds := img.Bounds()
+	if maxSize.X <= 0 || maxSize.Y <= 0 || (bounds.Dx() <= maxSize.X && bounds.Dy() <= maxSize.Y) {
+		return img
+	}
+
+	scale := math.Min(float64(maxSize.X)/float64(bounds.Dx()), float64(maxSize.Y)/float64(bounds.Dy()))
+	width := int(math.Max(1, math.Round(float64(bounds.Dx())*scale)))
+	height := int(math.Max(1, math.Round(float64(bounds.Dy())*scale)))
+
+	switch img := img.(type) {
+	case *image.RGBA64:
+		return imageFromChannels(downscale(Channels16(img), width, height))
+	case *LinearImage:
+		return imageFromChannels(downscale(ChannelsLinear(img), width, height))
+	}
+	return imageFromChannels(downscale(Channels8(img.(*image.RGBA)), width, height))
+}
+
+// Area averaging downscale. Every destination pixel is the coverage weighted mean of the source
+// pixels under it, done as a horizontal pass followed by a vertical one.
+func downscale[C Channel](img Channels[C], width, height int) Channels[C] {
+	bounds := img.Rect
+	columnWeights := boxWeights(bounds.Dx(), width)
+	rowWeights := boxWeights(bounds.Dy(), height)
+
+	horizontal := make([]float32, width*bounds.Dy()*4)
+	for y := 0; y < bounds.Dy(); y++ {
+		row := img.Values[y*img.Stride:]
+		for x, weights := range columnWeights {
+			var sum [4]float32
+			for _, sample := range weights {
+				pixel := row[sample.index*4 : sample.index*4+4]
+				for channel := 0; channel < 4; channel++ {
+					sum[channel] += float32(pixel[channel]) * sample.weight
+				}
+			}
+			copy(horizontal[(y*width+x)*4:], sum[:])
+		}
+	}
+
+	result := NewChannels[C](image.Rect(0, 0, width, height))
+	for y, weights := range rowWeights {
+		for x := 0; x < width; x++ {
+			var sum [4]float32
+			for _, sample := range weights {
+				offset := (sample.index*width + x) * 4
+				for channel := 0; channel < 4; channel++ {
+					sum[channel] += horizontal[offset+channel] * sample.weight
+				}
+			}
+
+			offset := result.Offset(x, y)
+			for channel := 0; channel < 4; channel++ {
+				result.Values[offset+channel] = RoundChannel[C](float64(sum[channel]))
+			}
+		}
+	}
+
+	return result
+}
+
+// For every destination sample, the source samples it covers and their normalized coverage
+func boxWeights(sourceLength, destinationLength int) [][]sampleWeight {
+	ratio := float64(sourceLength) / float64(destinationLength)
+	weights := make([][]sampleWeight, destinationLength)
+
+	for i := range weights {
+		start := float64(i) * ratio
+		end := start + ratio
+
+		for index := int(start); index < int(math.Ceil(end)) && index < sourceLength; index++ {
+			coverage := math.Min(end, float64(index+1)) - math.Max(start, float64(index))
+			if coverage > 0 {
+				weights[i] = append(weights[i], sampleWeight{index, float32(coverage / ratio)})
+			}
+		}
+	}
+
+	return weights
+}
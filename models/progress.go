@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type Progress struct {
+	// Layer being executed, starting at 1
+	Layer      int `json:"layer"`
+	LayerCount int `json:"layerCount"`
+	// Share of the current layer that is done, from 0 to 100
+	Percent float64 `json:"percent"`
+}
+
+type ProgressFunc func(Progress)
+
+type progressKey struct{}
+
+// Shortest time between two reports of a layer. Every report becomes an event sent to the
+// frontend, and images of many tiles would otherwise send hundreds of them per layer.
+const progressInterval = 50 * time.Millisecond
+
+type progressReporter struct {
+	report     ProgressFunc
+	layer      int
+	layerCount int
+
+	mutex        sync.Mutex
+	lastPercent  int
+	lastReported time.Time
+}
+
+// Returns a context that delivers progress of pipeline executions using it to report
+func WithProgress(ctx context.Context, report ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, &progressReporter{report: report})
+}
+
+func withLayerProgress(ctx context.Context, layer, layerCount int) context.Context {
+	reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, progressKey{}, &progressReporter{report: reporter.report, layer: layer, layerCount: layerCount})
+}
+
+// Reports that done out of total parts of the current layer are processed. Reports are passed on
+// when the whole percent changed and progressInterval has passed since the last one, and always
+// once the layer is done.
+func ReportProgress(ctx context.Context, done, total int) {
+	reporter, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok || total == 0 {
+		return
+	}
+
+	reporter.mutex.Lock()
+	defer reporter.mutex.Unlock()
+
+	percent := done * 100 / total
+	now := time.Now()
+	if done < total && (percent == reporter.lastPercent || now.Sub(reporter.lastReported) < progressInterval) {
+		return
+	}
+	reporter.lastPercent = percent
+	reporter.lastReported = now
+
+	reporter.report(Progress{
+		Layer:      reporter.layer,
+		LayerCount: reporter.layerCount,
+		Percent:    float64(done) / float64(total) * 100,
+	})
+}
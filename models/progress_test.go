@@ -0,0 +1,27 @@
+package models
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReportProgressIsThrottled(t *testing.T) {
+	var reports []Progress
+	ctx := WithProgress(context.Background(), func(progress Progress) {
+		reports = append(reports, progress)
+	})
+	ctx = withLayerProgress(ctx, 2, 3)
+
+	for done := 1; done <= 1000; done++ {
+		ReportProgress(ctx, done, 1000)
+	}
+
+	// The first report goes out at once, the rest of a fast layer only once it is done
+	if len(reports) < 2 || len(reports) > 10 {
+		t.Fatalf("Reported %d times for 1000 parts", len(reports))
+	}
+	last := reports[len(reports)-1]
+	if last != (Progress{Layer: 2, LayerCount: 3, Percent: 100}) {
+		t.Errorf("Last report is %+v", last)
+	}
+}
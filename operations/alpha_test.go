@@ -0,0 +1,304 @@
+package operations
+
+import (
+	"context"
+	"image"
+	"path/filepath"
+	"testing"
+
+	models "tool7/image-processing/models"
+	utils "tool7/image-processing/utils"
+)
+
+// Transparent images the operations are checked against:
+//
+//	disc.png      red disc with an antialiased edge on a transparent background
+//	disc16.png    the same with 16 bits per channel
+//	gradient.png  colors fading from opaque to transparent
+//	holes.png     opaque checkerboard with transparent squares
+//	palette.png   palette with semi-transparent entries
+func loadAlphaImages(t *testing.T) map[string]models.Image {
+	paths, err := filepath.Glob(filepath.Join("testdata", "alpha", "*.png"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("No test images found: %v", err)
+	}
+
+	images := map[string]models.Image{}
+	for _, path := range paths {
+		img, err := utils.GetImageFromFilePath(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		images[filepath.Base(path)] = img
+	}
+	return images
+}
+
+// Parameters at their defaults and at the extremes that push colors out of range the most
+func alphaTestParameters(definition Definition) []Parameters {
+	strong := Parameters{}
+	for _, spec := range definition.Parameters {
+		switch spec.Kind {
+		case NumberParameter, IntegerParameter:
+			strong[spec.Name] = spec.Max
+		case ColorParameter:
+			strong[spec.Name] = Color{255, 255, 255}
+		case BooleanParameter:
+			strong[spec.Name] = true
+		}
+	}
+	return []Parameters{nil, strong}
+}
+
+// Operations that move pixels instead of changing them
+var geometryOperations = map[string]bool{"rotate": true, "mirrorvertical": true, "mirrorhorizontal": true}
+
+// Premultiplied colors can never exceed alpha, and only kernels told to process alpha change it
+func TestOperationsKeepColorsWithinAlpha(t *testing.T) {
+	for name, img := range loadAlphaImages(t) {
+		for _, definition := range List() {
+			for _, params := range alphaTestParameters(definition) {
+				operation, err := Create(definition.Name, params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result, err := operation.Execute(context.Background(), img)
+				if err != nil {
+					t.Fatalf("%s on %s: %v", definition.Name, name, err)
+				}
+				if models.Is16Bit(result) != models.Is16Bit(img) {
+					t.Errorf("%s on %s changed the bit depth", definition.Name, name)
+				}
+
+				keepsAlpha := !geometryOperations[definition.Name] && params["processAlpha"] != true
+				if x, y, ok := findInvalidPixel(img, result, keepsAlpha); !ok {
+					t.Errorf("%s %v on %s: pixel %d,%d is %v, input was %v",
+						definition.Name, params, name, x, y, result.At(x, y), img.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+// Images to blend over each other: the image itself and its copy turned by 180 degrees, whose
+// alpha differs from that of the image, in the working spaces of the layers
+func alphaBlendPairs(t *testing.T, img models.Image) [][2]models.Image {
+	turned, err := NewRotationOperation(By180Deg).Execute(context.Background(), img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pairs [][2]models.Image
+	for _, pair := range [][2]models.Image{{img, img}, {img, turned}, {turned, img}} {
+		pairs = append(pairs, pair, [2]models.Image{models.ToLinearImage(pair[0]), models.ToLinearImage(pair[1])})
+	}
+	return pairs
+}
+
+// Blending composites alpha, so only colors are checked
+func TestBlendModesKeepColorsWithinAlpha(t *testing.T) {
+	for name, img := range loadAlphaImages(t) {
+		for _, pair := range alphaBlendPairs(t, img) {
+			for _, mode := range models.BlendModes {
+				for _, opacity := range []float64{0.4, 1} {
+					result, err := models.Blend(context.Background(), pair[0], pair[1], mode, opacity)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if x, y, ok := findInvalidPixel(pair[0], result, false); !ok {
+						t.Errorf("%s blend at %v of %T %s: pixel %d,%d is %v over %v",
+							mode, opacity, pair[0], name, x, y, result.At(x, y), pair[0].At(x, y))
+					}
+				}
+			}
+		}
+	}
+}
+
+// Layers blending and masking their output over their input, and graphs merging branches with
+// blend nodes
+func TestCompositingKeepsColorsWithinAlpha(t *testing.T) {
+	mask, err := models.NewLayerMask(models.MaskShape{
+		Kind:  models.LinearGradientMask,
+		Start: models.MaskPoint{X: 0, Y: 0},
+		End:   models.MaskPoint{X: 1, Y: 1},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, img := range loadAlphaImages(t) {
+		for _, mode := range models.BlendModes {
+			for _, workingSpace := range []models.ColorSpace{models.PerceptualSpace, models.LinearSpace} {
+				layer := utils.NewImageLayer(NewRotationOperation(By180Deg))
+				if err := layer.SetBlending(mode, 0.6); err != nil {
+					t.Fatal(err)
+				}
+				layer.Mask = mask
+
+				collection := utils.NewImageLayerCollection(img)
+				collection.WorkingSpace = workingSpace
+				collection.Append(layer)
+
+				result, err := collection.ExecuteFullResolution(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if x, y, ok := findInvalidPixel(img, result, false); !ok {
+					t.Errorf("Masked %s layer in %s space on %s: pixel %d,%d is %v, input was %v",
+						mode, workingSpace, name, x, y, result.At(x, y), img.At(x, y))
+				}
+			}
+
+			merge, err := models.NewBlendMerge(mode, 0.6)
+			if err != nil {
+				t.Fatal(err)
+			}
+			graph := models.NewLayerGraph()
+			turned := graph.AddLayerNode(utils.NewImageLayer(NewRotationOperation(By180Deg)))
+			blended := graph.AddMergeNode(merge)
+			graph.Connect(models.GraphInputNode, turned, 0)
+			graph.Connect(models.GraphInputNode, blended, 0)
+			graph.Connect(turned, blended, 1)
+			graph.SetOutput(blended)
+
+			result, err := graph.Execute(context.Background(), img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x, y, ok := findInvalidPixel(img, result, false); !ok {
+				t.Errorf("%s blend node on %s: pixel %d,%d is %v, input was %v",
+					mode, name, x, y, result.At(x, y), img.At(x, y))
+			}
+		}
+	}
+}
+
+func findInvalidPixel(input, result models.Image, keepsAlpha bool) (int, int, bool) {
+	bounds := result.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := result.At(x, y).RGBA()
+			if r > a || g > a || b > a {
+				return x, y, false
+			}
+			if _, _, _, inputAlpha := input.At(x, y).RGBA(); keepsAlpha && a != inputAlpha {
+				return x, y, false
+			}
+		}
+	}
+	return 0, 0, true
+}
+
+// Straight color of a pixel with 16 bits per channel
+func straightColor(img image.Image, x, y int) ([3]float64, float64) {
+	r, g, b, a := img.At(x, y).RGBA()
+	if a == 0 {
+		return [3]float64{}, 0
+	}
+	scale := float64(0xffff) / float64(a)
+	return [3]float64{float64(r) * scale, float64(g) * scale, float64(b) * scale}, float64(a)
+}
+
+// Blurring a single colored shape must not darken its edges with the black of the transparent
+// pixels around it
+func TestBlurKeepsColorOfTransparentEdges(t *testing.T) {
+	images := loadAlphaImages(t)
+
+	for _, name := range []string{"disc.png", "disc16.png"} {
+		img := images[name]
+		shapeColor, _ := straightColor(img, 24, 24)
+
+		for _, processAlpha := range []bool{false, true} {
+			operation, err := Create("boxblur", Parameters{"radius": 4, "processAlpha": processAlpha})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := operation.Execute(context.Background(), img)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			bounds := result.Bounds()
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					color, alpha := straightColor(result, x, y)
+					// Colors of nearly transparent pixels are too coarse to compare
+					if alpha < 0x2000 {
+						continue
+					}
+					for c := range color {
+						if diff := color[c] - shapeColor[c]; diff > 5*0x101 || diff < -5*0x101 {
+							t.Fatalf("%s with processAlpha %v: pixel %d,%d has color %v, the disc has %v",
+								name, processAlpha, x, y, color, shapeColor)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestProcessAlphaSoftensEdges(t *testing.T) {
+	img := loadAlphaImages(t)["disc.png"]
+
+	operation, err := Create("boxblur", Parameters{"radius": 2, "processAlpha": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := operation.Execute(context.Background(), img)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, a := result.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("Corner far from the disc has alpha %d", a)
+	}
+	// The edge of the disc has a radius of about 14.4 pixels
+	_, _, _, before := img.At(24+14, 24).RGBA()
+	_, _, _, after := result.At(24+14, 24).RGBA()
+	if before == after {
+		t.Errorf("Alpha at the edge of the disc stayed %d", before)
+	}
+}
+
+// Point operations change the straight color, whatever the alpha of the pixel
+func TestPointOperationsUseStraightColor(t *testing.T) {
+	img := loadAlphaImages(t)["gradient.png"]
+
+	tests := []struct {
+		name     string
+		params   Parameters
+		expected func(value float64) float64
+	}{
+		{"negative", nil, func(value float64) float64 { return 0xffff - value }},
+		{"brightness", Parameters{"level": 0.5}, func(value float64) float64 { return value * 0.5 }},
+	}
+
+	for _, test := range tests {
+		operation, err := Create(test.name, test.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := operation.Execute(context.Background(), img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		bounds := result.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				input, alpha := straightColor(img, x, y)
+				if alpha < 0x4000 {
+					continue
+				}
+				output, _ := straightColor(result, x, y)
+				for c := range output {
+					if diff := output[c] - test.expected(input[c]); diff > 4*0x101 || diff < -4*0x101 {
+						t.Fatalf("%s: pixel %d,%d has color %v from %v", test.name, x, y, output, input)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package operations
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	models "tool7/image-processing/models"
+	utils "tool7/image-processing/utils"
+)
+
+// Runs every registered operation with its default parameters on a full HD image:
+//
+//	go test -bench . ./operations
+func BenchmarkOperations(b *testing.B) {
+	benchmarkOperations(b, newBenchmarkImage(1920, 1080))
+}
+
+// Same as BenchmarkOperations with 16 bits per channel
+func BenchmarkOperations16(b *testing.B) {
+	benchmarkOperations(b, newBenchmarkImage16(1920, 1080))
+}
+
+// Same as BenchmarkOperations in linear light. Operations expecting perceptual input run on a
+// 16-bit sRGB conversion of the image, which is included in their timings.
+func BenchmarkOperationsLinear(b *testing.B) {
+	benchmarkOperations(b, models.ToLinearImage(newBenchmarkImage(1920, 1080)))
+}
+
+func benchmarkOperations(b *testing.B, img models.Image) {
+	var size int64
+	if linear, ok := img.(*models.LinearImage); ok {
+		size = int64(len(linear.Pix)) * 4
+	} else {
+		pix, _, _ := models.PixelBuffer(img)
+		size = int64(len(pix))
+	}
+
+	for _, definition := range List() {
+		operation, err := Create(definition.Name, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		// Layers convert linear images for the operations that expect perceptual input
+		layer := utils.NewImageLayer(operation)
+
+		b.Run(definition.Name, func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				if _, err := layer.ExecuteOperation(context.Background(), img, 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Opaque like a photo, transparent pixels take longer since their colors are unpremultiplied
+func newBenchmarkImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i*7 + i/width)
+		if i%4 == 3 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+func newBenchmarkImage16(width, height int) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i*7 + i/width)
+		if i%8 >= 6 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
@@ -0,0 +1,65 @@
+package operations
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	models "tool7/image-processing/models"
+)
+
+// Opaque gray ramp of 16-bit values that differ only in their lower byte
+func newFineRampImage() *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, 64, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 64; x++ {
+			value := uint16(0x8000 + x*3)
+			img.SetRGBA64(x, y, color.RGBA64{value, value, value, 0xffff})
+		}
+	}
+	return img
+}
+
+// Operations on 16-bit images compute with all 16 bits, instead of the 8 bits of the display
+func TestOperationsKeep16BitPrecision(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation models.ImageOperation
+		expected  func(value float64) float64
+		// Columns at the edges, where the kernel reaches outside the image
+		edge int
+	}{
+		{"brightness", NewBrightnessOperation(0.5), func(value float64) float64 { return value * 0.5 }, 0},
+		{"negative", NewNegativeOperation(), func(value float64) float64 { return 0xffff - value }, 0},
+		// Averaging a ramp keeps its values
+		{"box blur", NewKernelOperation(models.BoxBlur, 1), func(value float64) float64 { return value }, 1},
+	}
+
+	img := newFineRampImage()
+	for _, test := range tests {
+		result, err := test.operation.Execute(context.Background(), img)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		rgba64, ok := result.(*image.RGBA64)
+		if !ok {
+			t.Fatalf("%s returned %T", test.name, result)
+		}
+
+		distinct := map[uint16]bool{}
+		for x := test.edge; x < 64-test.edge; x++ {
+			input := float64(img.RGBA64At(x, 1).R)
+			pixel := rgba64.RGBA64At(x, 1)
+			if math.Abs(float64(pixel.R)-test.expected(input)) > 1 || pixel.A != 0xffff {
+				t.Errorf("%s of %v is %v, expected %.0f", test.name, input, pixel, test.expected(input))
+			}
+			distinct[pixel.R] = true
+		}
+		// At 8 bits per channel the whole ramp is a single value
+		if len(distinct) < 32 {
+			t.Errorf("%s has %d distinct values", test.name, len(distinct))
+		}
+	}
+}
@@ -1,9 +1,9 @@
 package operations
 
 import (
-	"image"
-	"image/color"
+	"context"
 
+	models "tool7/image-processing/models"
 	utils "tool7/image-processing/utils"
 )
 
@@ -17,23 +17,30 @@ func NewBrightnessOperation(level float64) *BrightnessOperation {
 	}
 }
 
-func (this *BrightnessOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		chunkResult := image.NewRGBA(bounds)
+func (this *BrightnessOperation) Name() string {
+	return "brightness"
+}
+
+func (this *BrightnessOperation) Parameters() Parameters {
+	return Parameters{"level": this.Level}
+}
 
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				R, G, B, A := utils.GetPixelColor(inputImage, x, y)
+func (this *BrightnessOperation) SetParameters(params Parameters) error {
+	if level, ok := params["level"].(float64); ok {
+		this.Level = level
+	}
+	return nil
+}
 
-				newR := utils.ClipColorChannel(float64(R) * this.Level)
-				newG := utils.ClipColorChannel(float64(G) * this.Level)
-				newB := utils.ClipColorChannel(float64(B) * this.Level)
+// Scaling linear light is like changing the exposure, which keeps the ratios between colors
+func (this *BrightnessOperation) InputColorSpace() models.ColorSpace {
+	return models.LinearSpace
+}
 
-				chunkResult.SetRGBA(x, y, color.RGBA{newR, newG, newB, A})
-			}
-		}
-		return chunkResult
+func (this *BrightnessOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	brightness := func(value, max float64) float64 {
+		return value * this.Level
 	}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+	return utils.MapImageChannels(ctx, inputImage, brightness, brightness, brightness)
 }
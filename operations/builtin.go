@@ -0,0 +1,112 @@
+package operations
+
+import (
+	models "tool7/image-processing/models"
+)
+
+// Kernel reach in pixels of the source image, so that previews rendered on a downscaled copy match
+// the full resolution result. Radius 1 is the classic 3x3 kernel.
+var radiusParameter = ParameterSpec{
+	Name:    "radius",
+	Label:   "Radius",
+	Kind:    NumberParameter,
+	Min:     0.5,
+	Max:     10,
+	Step:    0.5,
+	Default: 1.0,
+}
+
+var processAlphaParameter = ParameterSpec{
+	Name:    "processAlpha",
+	Label:   "Apply to transparency",
+	Kind:    BooleanParameter,
+	Default: false,
+}
+
+func newKernelDefinition(kernelType models.KernelType, label string) Definition {
+	return Definition{
+		Name:       kernelOperationNames[kernelType],
+		Label:      label,
+		Parameters: []ParameterSpec{radiusParameter, processAlphaParameter},
+		New: func() ConfigurableOperation {
+			return NewKernelOperation(kernelType, 1)
+		},
+	}
+}
+
+// Built-in operations, registered in the order they are presented to the user
+func init() {
+	MustRegister(Definition{
+		Name:  "brightness",
+		Label: "Brightness",
+		Parameters: []ParameterSpec{
+			{Name: "level", Label: "Level", Kind: NumberParameter, Min: 0, Max: 2, Step: 0.2, Default: 1.0},
+		},
+		New: func() ConfigurableOperation { return NewBrightnessOperation(1) },
+	})
+	MustRegister(Definition{
+		Name:  "contrast",
+		Label: "Contrast",
+		Parameters: []ParameterSpec{
+			{Name: "factor", Label: "Factor", Kind: NumberParameter, Min: 0, Max: 4, Step: 0.1, Default: 1.0},
+		},
+		New: func() ConfigurableOperation { return NewContrastOperation(1) },
+	})
+	MustRegister(Definition{
+		Name:  "saturation",
+		Label: "Saturation",
+		Parameters: []ParameterSpec{
+			{Name: "level", Label: "Level", Kind: NumberParameter, Min: 0, Max: 3, Step: 0.1, Default: 1.0},
+		},
+		New: func() ConfigurableOperation { return NewSaturationOperation(1) },
+	})
+	MustRegister(Definition{
+		Name:  "tint",
+		Label: "Tint",
+		Parameters: []ParameterSpec{
+			{Name: "color", Label: "Color", Kind: ColorParameter, Default: Color{0, 0, 255}},
+			{Name: "intensity", Label: "Intensity", Kind: NumberParameter, Min: 0, Max: 1, Step: 0.01, Default: 1.0},
+		},
+		New: func() ConfigurableOperation { return NewTintOperation(Color{0, 0, 255}.RGBA(), 1) },
+	})
+	MustRegister(Definition{
+		Name:  "greyscale",
+		Label: "Greyscale",
+		New:   func() ConfigurableOperation { return NewGreyscaleOperation() },
+	})
+	MustRegister(Definition{
+		Name:  "negative",
+		Label: "Negative",
+		New:   func() ConfigurableOperation { return NewNegativeOperation() },
+	})
+	MustRegister(Definition{
+		Name:  "sepia",
+		Label: "Sepia",
+		New:   func() ConfigurableOperation { return NewSepiaOperation() },
+	})
+	MustRegister(newKernelDefinition(models.BoxBlur, "Blur"))
+	MustRegister(newKernelDefinition(models.MotionBlur, "Motion blur"))
+	MustRegister(newKernelDefinition(models.Sharpen, "Sharpen"))
+	MustRegister(newKernelDefinition(models.Emboss, "Emboss"))
+	MustRegister(newKernelDefinition(models.EdgeDetectionHorizontal, "Horizontal edges"))
+	MustRegister(newKernelDefinition(models.EdgeDetectionVertical, "Vertical edges"))
+	MustRegister(newKernelDefinition(models.Outline, "Outline"))
+	MustRegister(Definition{
+		Name:  "rotate",
+		Label: "Rotate",
+		Parameters: []ParameterSpec{
+			{Name: "degrees", Label: "Degrees", Kind: IntegerParameter, Min: 90, Max: 270, Step: 90, Default: 90},
+		},
+		New: func() ConfigurableOperation { return NewRotationOperation(By90Deg) },
+	})
+	MustRegister(Definition{
+		Name:  "mirrorvertical",
+		Label: "Mirror vertically",
+		New:   func() ConfigurableOperation { return NewVerticalMirrorOperation() },
+	})
+	MustRegister(Definition{
+		Name:  "mirrorhorizontal",
+		Label: "Mirror horizontally",
+		New:   func() ConfigurableOperation { return NewHorizontalMirrorOperation() },
+	})
+}
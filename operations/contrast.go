@@ -1,9 +1,9 @@
 package operations
 
 import (
-	"image"
-	"image/color"
+	"context"
 
+	models "tool7/image-processing/models"
 	utils "tool7/image-processing/utils"
 )
 
@@ -17,27 +17,27 @@ func NewContrastOperation(factor float64) *ContrastOperation {
 	}
 }
 
-func (this *ContrastOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		chunkResult := image.NewRGBA(bounds)
-
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				R, G, B, A := utils.GetPixelColor(inputImage, x, y)
+func (this *ContrastOperation) Name() string {
+	return "contrast"
+}
 
-				newR := this.Factor*(float64(R)-128) + 128
-				newG := this.Factor*(float64(G)-128) + 128
-				newB := this.Factor*(float64(B)-128) + 128
+func (this *ContrastOperation) Parameters() Parameters {
+	return Parameters{"factor": this.Factor}
+}
 
-				clippedR := utils.ClipColorChannel(newR)
-				clippedG := utils.ClipColorChannel(newG)
-				clippedB := utils.ClipColorChannel(newB)
+func (this *ContrastOperation) SetParameters(params Parameters) error {
+	if factor, ok := params["factor"].(float64); ok {
+		this.Factor = factor
+	}
+	return nil
+}
 
-				chunkResult.SetRGBA(x, y, color.RGBA{clippedR, clippedG, clippedB, A})
-			}
-		}
-		return chunkResult
+func (this *ContrastOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	// Contrast is stretched around the value 128 has in 8-bit images
+	contrast := func(value, max float64) float64 {
+		middle := 128 * max / 255
+		return this.Factor*(value-middle) + middle
 	}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+	return utils.MapImageChannels(ctx, inputImage, contrast, contrast, contrast)
 }
@@ -1,9 +1,9 @@
 package operations
 
 import (
-	"image"
-	"image/color"
+	"context"
 
+	models "tool7/image-processing/models"
 	utils "tool7/image-processing/utils"
 )
 
@@ -13,25 +13,28 @@ func NewGreyscaleOperation() *GreyscaleOperation {
 	return &GreyscaleOperation{}
 }
 
-// This is one of the standard formulas for calculating "grey value" of the pixel
-func getPixelGreyValue(r, g, b uint8) uint8 {
-	return uint8(0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b))
+func (this *GreyscaleOperation) Name() string {
+	return "greyscale"
 }
 
-func (this *GreyscaleOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		chunkResult := image.NewRGBA(bounds)
+func (this *GreyscaleOperation) Parameters() Parameters {
+	return Parameters{}
+}
 
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				R, G, B, A := utils.GetPixelColor(inputImage, x, y)
+func (this *GreyscaleOperation) SetParameters(params Parameters) error {
+	return nil
+}
 
-				grey := getPixelGreyValue(R, G, B)
-				chunkResult.SetRGBA(x, y, color.RGBA{grey, grey, grey, A})
-			}
-		}
-		return chunkResult
-	}
+// This is one of the standard formulas for calculating "grey value" of the pixel
+func getPixelGreyValue[C models.Channel](r, g, b C) C {
+	return C(0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b))
+}
+
+func greyscalePixel[C models.Channel](r, g, b, a C) (C, C, C, C) {
+	grey := getPixelGreyValue(r, g, b)
+	return grey, grey, grey, a
+}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+func (this *GreyscaleOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	return utils.MapImagePixels(ctx, inputImage, greyscalePixel[uint8], greyscalePixel[uint16])
 }
@@ -1,8 +1,9 @@
 package operations
 
 import (
+	"context"
+	"errors"
 	"image"
-	"image/color"
 	"math"
 
 	models "tool7/image-processing/models"
@@ -11,67 +12,206 @@ import (
 
 type KernelOperation struct {
 	KernelType models.KernelType
-	KernelSize models.KernelSize
+	// Reach of the kernel from its center in pixels of the source image
+	Radius float64
+	// Whether the kernel also applies to alpha, which softens the edges of transparent areas.
+	// Otherwise every pixel keeps its alpha.
+	ProcessAlpha bool
 }
 
-func NewKernelOperation(kernelType models.KernelType, kernelSize models.KernelSize) *KernelOperation {
+func NewKernelOperation(kernelType models.KernelType, radius float64) *KernelOperation {
 	return &KernelOperation{
-		kernelType,
-		kernelSize,
+		KernelType: kernelType,
+		Radius:     radius,
 	}
 }
 
-func (this *KernelOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	kernel := models.GenerateKernel(this.KernelType, this.KernelSize)
+var kernelOperationNames = map[models.KernelType]string{
+	models.BoxBlur:                 "boxblur",
+	models.MotionBlur:              "motionblur",
+	models.Sharpen:                 "sharpen",
+	models.Emboss:                  "emboss",
+	models.EdgeDetectionHorizontal: "edgeshorizontal",
+	models.EdgeDetectionVertical:   "edgesvertical",
+	models.Outline:                 "outline",
+}
+
+func (this *KernelOperation) Name() string {
+	return kernelOperationNames[this.KernelType]
+}
+
+func (this *KernelOperation) Parameters() Parameters {
+	return Parameters{"radius": this.Radius, "processAlpha": this.ProcessAlpha}
+}
+
+func (this *KernelOperation) SetParameters(params Parameters) error {
+	if processAlpha, ok := params["processAlpha"].(bool); ok {
+		this.ProcessAlpha = processAlpha
+	}
+	if radius, ok := params["radius"].(float64); ok {
+		if !(radius > 0) || math.IsInf(radius, 1) {
+			return errors.New("Kernel radius must be positive and finite")
+		}
+		this.Radius = radius
+	}
+	return nil
+}
 
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		return applyKernel(inputImage, bounds, kernel)
+// Blurs average light, which only gives the physically correct result in linear light, while
+// edge detection and embossing look for perceived differences
+func (this *KernelOperation) InputColorSpace() models.ColorSpace {
+	switch this.KernelType {
+	case models.BoxBlur, models.MotionBlur, models.Sharpen:
+		return models.LinearSpace
+	}
+	return models.PerceptualSpace
+}
+
+func (this *KernelOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	return this.ExecuteScaled(ctx, inputImage, 1)
+}
+
+// The radius is measured in source image pixels, so previews get a proportionally smaller kernel
+func (this *KernelOperation) ExecuteScaled(ctx context.Context, inputImage models.Image, scale float64) (models.Image, error) {
+	kernel := models.GenerateScaledKernel(this.KernelType, this.Radius, scale)
+
+	worker := func(src, dst models.Image) {
+		switch src := src.(type) {
+		case *image.RGBA64:
+			dst := dst.(*image.RGBA64)
+			result := models.NewChannels[uint16](dst.Rect)
+			applyKernel(models.Channels16(src), result, kernel, this.ProcessAlpha)
+			models.StoreChannels16(dst, result)
+			return
+		case *models.LinearImage:
+			applyKernel(models.ChannelsLinear(src), models.ChannelsLinear(dst.(*models.LinearImage)), kernel, this.ProcessAlpha)
+			return
+		}
+		applyKernel(models.Channels8(src.(*image.RGBA)), models.Channels8(dst.(*image.RGBA)), kernel, this.ProcessAlpha)
 	}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+	// Tiles read the pixels the kernel reaches around them
+	options := utils.TileOptions{Halo: len(kernel) / 2}
+	return utils.ProcessTiles(ctx, inputImage, options, worker)
 }
 
-func applyKernel(inputImage *image.RGBA, bounds image.Rectangle, kernel [][]float32) *image.RGBA {
-	result := image.NewRGBA(bounds)
+// Colors are weighted by alpha, so that transparent pixels do not darken their neighbors. Pixels
+// outside the image are treated as opaque black, or as transparent when alpha is processed.
+func applyKernel[C models.Channel](inputImage, result models.Channels[C], kernel [][]float32, processAlpha bool) {
+	if !processAlpha && isOpaque(inputImage) {
+		applyOpaqueKernel(inputImage, result, kernel)
+	} else {
+		applyKernelWithAlpha(inputImage, result, kernel, processAlpha)
+	}
+}
+
+func isOpaque[C models.Channel](img models.Channels[C]) bool {
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		row := img.Row(y)
+		for i := 3; i < len(row); i += 4 {
+			if row[i] != models.ChannelMax[C]() {
+				return false
+			}
+		}
+	}
+	return true
+}
 
-	minY := bounds.Min.Y
-	maxY := bounds.Max.Y
-	minX := bounds.Min.X
-	maxX := bounds.Max.X
+// Faster variant for opaque pixels, where weighting by alpha changes nothing
+func applyOpaqueKernel[C models.Channel](inputImage, result models.Channels[C], kernel [][]float32) {
+	kernelCenter := len(kernel) / 2
 
-	kernelLength := len(kernel)
-	kernelCenter := int(math.Floor(float64(kernelLength) / 2))
+	for y := result.Rect.Min.Y; y < result.Rect.Max.Y; y++ {
+		resultRow := result.Row(y)
+		inputRow := inputImage.Values[inputImage.Offset(result.Rect.Min.X, y):]
 
-	for y := minY; y < maxY; y++ {
-		for x := minX; x < maxX; x++ {
-			_, _, _, A := utils.GetPixelColor(inputImage, x, y)
+		for offset := 0; offset < len(resultRow); offset += 4 {
+			x := result.Rect.Min.X + offset/4
 
 			var sumR float32 = 0
 			var sumG float32 = 0
 			var sumB float32 = 0
 
 			for j := -kernelCenter; j <= kernelCenter; j++ {
-				for i := -kernelCenter; i <= kernelCenter; i++ {
-					offsetX := x + i
-					offsetY := y + j
-					kernelX := i + kernelCenter
-					kernelY := j + kernelCenter
+				row, first := utils.NeighborhoodRow(&inputImage, x, y+j, kernelCenter)
+				weights := kernel[j+kernelCenter][first:]
+
+				for i := 0; i < len(row); i += 4 {
+					weight := weights[i/4]
+					sumR += weight * float32(row[i])
+					sumG += weight * float32(row[i+1])
+					sumB += weight * float32(row[i+2])
+				}
+			}
+
+			resultRow[offset] = utils.ClipChannel[C](sumR)
+			resultRow[offset+1] = utils.ClipChannel[C](sumG)
+			resultRow[offset+2] = utils.ClipChannel[C](sumB)
+			resultRow[offset+3] = inputRow[offset+3]
+		}
+	}
+}
+
+// The weights of pixels are multiplied by their alpha and scaled so that their absolute values
+// still add up to those of the kernel. For blurs that is the mean of the colors weighted by alpha.
+func applyKernelWithAlpha[C models.Channel](inputImage, result models.Channels[C], kernel [][]float32, processAlpha bool) {
+	kernelCenter := len(kernel) / 2
+	max := float32(models.ChannelMax[C]())
 
-					R, G, B, _ := utils.GetPixelColor(inputImage, offsetX, offsetY)
+	var totalWeight float32
+	for _, weights := range kernel {
+		for _, weight := range weights {
+			totalWeight += float32(math.Abs(float64(weight)))
+		}
+	}
+
+	for y := result.Rect.Min.Y; y < result.Rect.Max.Y; y++ {
+		resultRow := result.Row(y)
+		inputRow := inputImage.Values[inputImage.Offset(result.Rect.Min.X, y):]
+
+		for offset := 0; offset < len(resultRow); offset += 4 {
+			x := result.Rect.Min.X + offset/4
+
+			var sumR, sumG, sumB, sumA float32
+			// Absolute weights of the pixels within the image, and the same times their alpha
+			var insideWeight, coverage float32
 
-					sumR += kernel[kernelY][kernelX] * float32(R)
-					sumG += kernel[kernelY][kernelX] * float32(G)
-					sumB += kernel[kernelY][kernelX] * float32(B)
+			for j := -kernelCenter; j <= kernelCenter; j++ {
+				row, first := utils.NeighborhoodRow(&inputImage, x, y+j, kernelCenter)
+				weights := kernel[j+kernelCenter][first:]
+
+				for i := 0; i < len(row); i += 4 {
+					weight := weights[i/4]
+					absWeight := float32(math.Abs(float64(weight)))
+					alpha := float32(row[i+3])
+
+					sumR += weight * float32(row[i])
+					sumG += weight * float32(row[i+1])
+					sumB += weight * float32(row[i+2])
+					sumA += weight * alpha
+					insideWeight += absWeight
+					coverage += absWeight * alpha
 				}
 			}
 
-			newR := utils.ClipColorChannel(sumR)
-			newG := utils.ClipColorChannel(sumG)
-			newB := utils.ClipColorChannel(sumB)
+			alpha := float32(inputRow[offset+3])
+			if processAlpha {
+				alpha = float32(models.RoundChannel[C](sumA))
+			} else {
+				coverage += (totalWeight - insideWeight) * max
+			}
 
-			result.SetRGBA(x, y, color.RGBA{newR, newG, newB, A})
+			// Colors are premultiplied, so dividing by coverage gives straight colors, which are
+			// premultiplied by the new alpha again
+			var scale float32
+			if coverage > 0 {
+				scale = alpha * totalWeight / coverage
+			}
+
+			resultRow[offset] = models.RoundChannel[C](float32(math.Min(float64(sumR*scale), float64(alpha))))
+			resultRow[offset+1] = models.RoundChannel[C](float32(math.Min(float64(sumG*scale), float64(alpha))))
+			resultRow[offset+2] = models.RoundChannel[C](float32(math.Min(float64(sumB*scale), float64(alpha))))
+			resultRow[offset+3] = C(alpha)
 		}
 	}
-
-	return result
 }
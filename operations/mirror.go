@@ -1,13 +1,15 @@
 package operations
 
 import (
-	"image"
-	"image/color"
+	"context"
 
-	utils "tool7/image-processing/utils"
+	models "tool7/image-processing/models"
 )
 
+// Mirrors the image along its vertical axis, swapping left and right
 type VerticalMirrorOperation struct{}
+
+// Mirrors the image along its horizontal axis, swapping top and bottom
 type HorizontalMirrorOperation struct{}
 
 func NewVerticalMirrorOperation() *VerticalMirrorOperation {
@@ -18,46 +20,48 @@ func NewHorizontalMirrorOperation() *HorizontalMirrorOperation {
 	return &HorizontalMirrorOperation{}
 }
 
-func (this *VerticalMirrorOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	return CreateVerticalMirror(inputImage), nil
+func (this *VerticalMirrorOperation) Name() string {
+	return "mirrorvertical"
 }
 
-func (this *HorizontalMirrorOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	return CreateHorizontalMirror(inputImage), nil
+func (this *VerticalMirrorOperation) Parameters() Parameters {
+	return Parameters{}
 }
 
-func CreateVerticalMirror(inputImage *image.RGBA) *image.RGBA {
-	result := image.NewRGBA(inputImage.Bounds())
-	minX := inputImage.Bounds().Min.X
-	minY := inputImage.Bounds().Min.Y
-	maxX := inputImage.Bounds().Max.X
-	maxY := inputImage.Bounds().Max.Y
+func (this *VerticalMirrorOperation) SetParameters(params Parameters) error {
+	return nil
+}
 
-	for x := minX; x < maxX; x++ {
-		for y := minY; y < maxY; y++ {
-			r, g, b, a := utils.GetPixelColor(inputImage, x, y)
+func (this *VerticalMirrorOperation) InputColorSpace() models.ColorSpace {
+	return models.AnySpace
+}
 
-			result.SetRGBA(inputImage.Bounds().Max.X-x, y, color.RGBA{r, g, b, a})
-		}
-	}
+func (this *VerticalMirrorOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	width := inputImage.Bounds().Dx()
+	return remapPixels(ctx, inputImage, width, inputImage.Bounds().Dy(), func(x, y int) (int, int) {
+		return width - 1 - x, y
+	})
+}
 
-	return result
+func (this *HorizontalMirrorOperation) Name() string {
+	return "mirrorhorizontal"
 }
 
-func CreateHorizontalMirror(inputImage *image.RGBA) *image.RGBA {
-	result := image.NewRGBA(inputImage.Bounds())
-	minX := inputImage.Bounds().Min.X
-	minY := inputImage.Bounds().Min.Y
-	maxX := inputImage.Bounds().Max.X
-	maxY := inputImage.Bounds().Max.Y
+func (this *HorizontalMirrorOperation) Parameters() Parameters {
+	return Parameters{}
+}
 
-	for x := minX; x < maxX; x++ {
-		for y := minY; y < maxY; y++ {
-			r, g, b, a := utils.GetPixelColor(inputImage, x, y)
+func (this *HorizontalMirrorOperation) SetParameters(params Parameters) error {
+	return nil
+}
 
-			result.SetRGBA(x, inputImage.Bounds().Max.Y-y, color.RGBA{r, g, b, a})
-		}
-	}
+func (this *HorizontalMirrorOperation) InputColorSpace() models.ColorSpace {
+	return models.AnySpace
+}
 
-	return result
+func (this *HorizontalMirrorOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	height := inputImage.Bounds().Dy()
+	return remapPixels(ctx, inputImage, inputImage.Bounds().Dx(), height, func(x, y int) (int, int) {
+		return x, height - 1 - y
+	})
 }
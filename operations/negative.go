@@ -1,9 +1,9 @@
 package operations
 
 import (
-	"image"
-	"image/color"
+	"context"
 
+	models "tool7/image-processing/models"
 	utils "tool7/image-processing/utils"
 )
 
@@ -13,23 +13,22 @@ func NewNegativeOperation() *NegativeOperation {
 	return &NegativeOperation{}
 }
 
-func (this *NegativeOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		chunkResult := image.NewRGBA(bounds)
+func (this *NegativeOperation) Name() string {
+	return "negative"
+}
 
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				R, G, B, A := utils.GetPixelColor(inputImage, x, y)
+func (this *NegativeOperation) Parameters() Parameters {
+	return Parameters{}
+}
 
-				newR := 255 - R
-				newG := 255 - G
-				newB := 255 - B
+func (this *NegativeOperation) SetParameters(params Parameters) error {
+	return nil
+}
 
-				chunkResult.SetRGBA(x, y, color.RGBA{newR, newG, newB, A})
-			}
-		}
-		return chunkResult
+func (this *NegativeOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	negative := func(value, max float64) float64 {
+		return max - value
 	}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+	return utils.MapImageChannels(ctx, inputImage, negative, negative, negative)
 }
@@ -0,0 +1,151 @@
+package operations
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+type ParameterKind string
+
+const (
+	NumberParameter  ParameterKind = "number"
+	IntegerParameter ParameterKind = "integer"
+	ColorParameter   ParameterKind = "color"
+	BooleanParameter ParameterKind = "boolean"
+)
+
+// Describes a single tunable value of an operation so that the frontend can build its controls
+type ParameterSpec struct {
+	Name    string        `json:"name"`
+	Label   string        `json:"label"`
+	Kind    ParameterKind `json:"kind"`
+	Min     float64       `json:"min"`
+	Max     float64       `json:"max"`
+	Step    float64       `json:"step"`
+	Default interface{}   `json:"default"`
+}
+
+// Parameter values keyed by ParameterSpec.Name. After validation, number values are float64,
+// integer values are int, color values are Color and boolean values are bool.
+type Parameters map[string]interface{}
+
+type Color struct {
+	R uint8 `json:"r"`
+	G uint8 `json:"g"`
+	B uint8 `json:"b"`
+}
+
+func (this Color) RGBA() color.RGBA {
+	return color.RGBA{this.R, this.G, this.B, 255}
+}
+
+func ColorFromRGBA(c color.RGBA) Color {
+	return Color{c.R, c.G, c.B}
+}
+
+func (this ParameterSpec) normalize(value interface{}) (interface{}, error) {
+	switch this.Kind {
+	case NumberParameter:
+		number, err := toFloat(value)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %q: %w", this.Name, err)
+		}
+		if err := this.checkRange(number); err != nil {
+			return nil, err
+		}
+		return number, nil
+	case IntegerParameter:
+		number, err := toFloat(value)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %q: %w", this.Name, err)
+		}
+		if number != math.Trunc(number) {
+			return nil, fmt.Errorf("Parameter %q must be a whole number", this.Name)
+		}
+		if err := this.checkRange(number); err != nil {
+			return nil, err
+		}
+		return int(number), nil
+	case ColorParameter:
+		c, err := toColor(value)
+		if err != nil {
+			return nil, fmt.Errorf("Parameter %q: %w", this.Name, err)
+		}
+		return c, nil
+	case BooleanParameter:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("Parameter %q: expected true or false, got %T", this.Name, value)
+		}
+		return b, nil
+	}
+
+	return nil, fmt.Errorf("Parameter %q has unknown kind %q", this.Name, this.Kind)
+}
+
+// Values must lie within Min and Max, unless both are zero. Step only positions the slider, so
+// values between its steps are accepted.
+func (this ParameterSpec) checkRange(value float64) error {
+	if this.Min == 0 && this.Max == 0 {
+		return nil
+	}
+	if value < this.Min || value > this.Max {
+		return fmt.Errorf("Parameter %q must be between %v and %v, got %v", this.Name, this.Min, this.Max, value)
+	}
+	return nil
+}
+
+// Converts numbers of any type to float64. NaN and infinities are rejected, as no range check
+// could catch them.
+func toFloat(value interface{}) (float64, error) {
+	var number float64
+
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case float32:
+		number = float64(v)
+	case int:
+		number = float64(v)
+	case int64:
+		number = float64(v)
+	case uint8:
+		number = float64(v)
+	default:
+		return 0, fmt.Errorf("expected a number, got %T", value)
+	}
+
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("expected a finite number, got %v", number)
+	}
+	return number, nil
+}
+
+func toColor(value interface{}) (Color, error) {
+	switch v := value.(type) {
+	case Color:
+		return v, nil
+	case color.RGBA:
+		return ColorFromRGBA(v), nil
+	case map[string]interface{}:
+		var c Color
+		channels := []struct {
+			key string
+			dst *uint8
+		}{{"r", &c.R}, {"g", &c.G}, {"b", &c.B}}
+
+		for _, channel := range channels {
+			number, err := toFloat(v[channel.key])
+			if err != nil {
+				return Color{}, fmt.Errorf("channel %q: %w", channel.key, err)
+			}
+			if number < 0 || number > 255 {
+				return Color{}, fmt.Errorf("channel %q must be between 0 and 255", channel.key)
+			}
+			*channel.dst = uint8(number)
+		}
+		return c, nil
+	}
+	return Color{}, fmt.Errorf("expected a color, got %T", value)
+}
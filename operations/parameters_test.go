@@ -0,0 +1,57 @@
+package operations
+
+import (
+	"math"
+	"testing"
+
+	models "tool7/image-processing/models"
+)
+
+func TestValidateParameterValues(t *testing.T) {
+	tests := []struct {
+		operation string
+		params    Parameters
+		valid     bool
+	}{
+		{"brightness", Parameters{"level": 1.0}, true},
+		{"brightness", Parameters{"level": 1.3}, true},
+		{"brightness", Parameters{"level": 2.5}, false},
+		{"brightness", Parameters{"level": -0.1}, false},
+		{"brightness", Parameters{"level": "bright"}, false},
+		{"brightness", Parameters{"exposure": 1.0}, false},
+		{"boxblur", Parameters{"radius": 0.7}, true},
+		{"boxblur", Parameters{"radius": 0.2}, false},
+		{"tint", Parameters{"intensity": 0.333}, true},
+		// Every comparison with NaN is false, so it would pass any range check
+		{"brightness", Parameters{"level": math.NaN()}, false},
+		{"brightness", Parameters{"level": math.Inf(1)}, false},
+		{"boxblur", Parameters{"radius": math.NaN()}, false},
+		{"boxblur", Parameters{"radius": float32(math.Inf(-1))}, false},
+		{"tint", Parameters{"color": map[string]interface{}{"r": math.NaN(), "g": 0.0, "b": 0.0}}, false},
+	}
+
+	for _, test := range tests {
+		definition, ok := Lookup(test.operation)
+		if !ok {
+			t.Fatalf("%s is not registered", test.operation)
+		}
+		_, err := definition.Validate(test.params)
+		if test.valid && err != nil {
+			t.Errorf("%s %v: %v", test.operation, test.params, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s %v was accepted", test.operation, test.params)
+		}
+	}
+}
+
+func TestKernelRejectsRadiiThatAreNotFinite(t *testing.T) {
+	for _, radius := range []float64{math.NaN(), math.Inf(1), 0, -1} {
+		if _, err := Create("boxblur", Parameters{"radius": radius}); err == nil {
+			t.Errorf("Radius %v was accepted", radius)
+		}
+		if err := NewKernelOperation(models.BoxBlur, 1).SetParameters(Parameters{"radius": radius}); err == nil {
+			t.Errorf("Radius %v was set", radius)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package operations
+
+import (
+	"fmt"
+	"sync"
+
+	models "tool7/image-processing/models"
+)
+
+// Operation that can be created and tuned through the registry
+type ConfigurableOperation interface {
+	models.ImageOperation
+	Name() string
+	Parameters() Parameters
+	SetParameters(Parameters) error
+}
+
+type Definition struct {
+	Name       string                       `json:"name"`
+	Label      string                       `json:"label"`
+	Parameters []ParameterSpec              `json:"parameters"`
+	New        func() ConfigurableOperation `json:"-"`
+}
+
+var registry = struct {
+	sync.RWMutex
+	definitions map[string]Definition
+	order       []string
+}{
+	definitions: make(map[string]Definition),
+}
+
+// Makes an operation available under its stable name. Names must be unique.
+func Register(definition Definition) error {
+	if definition.Name == "" {
+		return fmt.Errorf("Operation definition is missing a name")
+	}
+	if definition.New == nil {
+		return fmt.Errorf("Operation %q is missing a constructor", definition.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, exists := registry.definitions[definition.Name]; exists {
+		return fmt.Errorf("Operation %q is already registered", definition.Name)
+	}
+
+	registry.definitions[definition.Name] = definition
+	registry.order = append(registry.order, definition.Name)
+	return nil
+}
+
+func MustRegister(definition Definition) {
+	if err := Register(definition); err != nil {
+		panic(err)
+	}
+}
+
+func Lookup(name string) (Definition, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	definition, ok := registry.definitions[name]
+	return definition, ok
+}
+
+// Returns all registered operations in registration order
+func List() []Definition {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	definitions := make([]Definition, 0, len(registry.order))
+	for _, name := range registry.order {
+		definitions = append(definitions, registry.definitions[name])
+	}
+	return definitions
+}
+
+// Creates the named operation with its defaults, overridden by any given parameters
+func Create(name string, params Parameters) (ConfigurableOperation, error) {
+	definition, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("Unknown operation %q", name)
+	}
+
+	merged := definition.Defaults()
+	for name, value := range params {
+		merged[name] = value
+	}
+
+	operation := definition.New()
+	if err := Update(operation, merged); err != nil {
+		return nil, err
+	}
+
+	return operation, nil
+}
+
+// Validates the given parameters against the operation schema and applies them
+func Update(operation models.ImageOperation, params Parameters) error {
+	configurable, ok := operation.(ConfigurableOperation)
+	if !ok {
+		return fmt.Errorf("Operation %T cannot be configured", operation)
+	}
+
+	definition, ok := Lookup(configurable.Name())
+	if !ok {
+		return fmt.Errorf("Unknown operation %q", configurable.Name())
+	}
+
+	validated, err := definition.Validate(params)
+	if err != nil {
+		return err
+	}
+
+	return configurable.SetParameters(validated)
+}
+
+func (this Definition) Defaults() Parameters {
+	defaults := make(Parameters, len(this.Parameters))
+	for _, spec := range this.Parameters {
+		defaults[spec.Name] = spec.Default
+	}
+	return defaults
+}
+
+// Returns a copy of params with every value converted to its canonical type.
+// Unknown parameter names are rejected.
+func (this Definition) Validate(params Parameters) (Parameters, error) {
+	validated := make(Parameters, len(params))
+
+	for name, value := range params {
+		spec, ok := this.parameter(name)
+		if !ok {
+			return nil, fmt.Errorf("Operation %q has no parameter %q", this.Name, name)
+		}
+
+		normalized, err := spec.normalize(value)
+		if err != nil {
+			return nil, err
+		}
+		validated[name] = normalized
+	}
+
+	return validated, nil
+}
+
+func (this Definition) parameter(name string) (ParameterSpec, bool) {
+	for _, spec := range this.Parameters {
+		if spec.Name == name {
+			return spec, true
+		}
+	}
+	return ParameterSpec{}, false
+}
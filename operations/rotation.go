@@ -1,23 +1,24 @@
 package operations
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"image"
-	"image/color"
 
-	utils "tool7/image-processing/utils"
+	models "tool7/image-processing/models"
 )
 
+// Clockwise rotation in degrees
 type RotationDegrees int
 
 const (
-	By90Deg RotationDegrees = iota
-	By180Deg
-	By270Deg
+	By90Deg  RotationDegrees = 90
+	By180Deg RotationDegrees = 180
+	By270Deg RotationDegrees = 270
 )
 
 type RotationOperation struct {
-	degrees RotationDegrees
+	Degrees RotationDegrees
 }
 
 func NewRotationOperation(degrees RotationDegrees) *RotationOperation {
@@ -26,44 +27,97 @@ func NewRotationOperation(degrees RotationDegrees) *RotationOperation {
 	}
 }
 
-func (this *RotationOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	switch this.degrees {
+func (this *RotationOperation) Name() string {
+	return "rotate"
+}
+
+func (this *RotationOperation) Parameters() Parameters {
+	return Parameters{"degrees": int(this.Degrees)}
+}
+
+func (this *RotationOperation) SetParameters(params Parameters) error {
+	if degrees, ok := params["degrees"].(int); ok {
+		switch RotationDegrees(degrees) {
+		case By90Deg, By180Deg, By270Deg:
+			this.Degrees = RotationDegrees(degrees)
+		default:
+			return fmt.Errorf("Rotation must be 90, 180 or 270 degrees, got %d", degrees)
+		}
+	}
+	return nil
+}
+
+// Rotations only move pixels, so they work on linear images as they are
+func (this *RotationOperation) InputColorSpace() models.ColorSpace {
+	return models.AnySpace
+}
+
+// Rotating by 90 or 270 degrees swaps the width and height of the image
+func (this *RotationOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	width := inputImage.Bounds().Dx()
+	height := inputImage.Bounds().Dy()
+
+	switch this.Degrees {
 	case By90Deg:
-		return RotateBy90Deg(inputImage), nil
+		return remapPixels(ctx, inputImage, height, width, func(x, y int) (int, int) {
+			return height - 1 - y, x
+		})
 	case By180Deg:
-		return RotateBy180Deg(inputImage), nil
+		return remapPixels(ctx, inputImage, width, height, func(x, y int) (int, int) {
+			return width - 1 - x, height - 1 - y
+		})
 	case By270Deg:
-		return RotateBy270Deg(inputImage), nil
+		return remapPixels(ctx, inputImage, height, width, func(x, y int) (int, int) {
+			return y, width - 1 - x
+		})
 	}
 
-	return nil, errors.New("Invalid RotationDegrees value")
+	return nil, fmt.Errorf("Invalid RotationDegrees value %d", this.Degrees)
 }
 
-func RotateBy90Deg(img *image.RGBA) *image.RGBA {
-	imageMinX := img.Bounds().Min.X
-	imageMinY := img.Bounds().Min.Y
-	imageMaxX := img.Bounds().Max.X
-	imageMaxY := img.Bounds().Max.Y
-
-	result := image.NewRGBA(image.Rect(imageMinX, imageMinY, imageMaxY, imageMaxX))
-
-	// Transposing the matrix
-	for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
-		for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
-			r, g, b, a := utils.GetPixelColor(img, x, y)
+// Moves every pixel of img to the position returned by target into a new image of the given
+// size. Positions are relative to the top left corner of both images, and the new image starts
+// at the origin. The new image has the depth of img.
+func remapPixels(ctx context.Context, img models.Image, width, height int, target func(x, y int) (int, int)) (models.Image, error) {
+	bounds := image.Rect(0, 0, width, height)
 
-			result.SetRGBA(y, x, color.RGBA{r, g, b, a})
+	switch img := img.(type) {
+	case *image.RGBA64:
+		result := image.NewRGBA64(bounds)
+		resultChannels := models.NewChannels[uint16](bounds)
+		if err := remapChannels(ctx, models.Channels16(img), resultChannels, target); err != nil {
+			return nil, err
 		}
+		models.StoreChannels16(result, resultChannels)
+		return result, nil
+	case *models.LinearImage:
+		result := models.NewLinearImage(bounds)
+		if err := remapChannels(ctx, models.ChannelsLinear(img), models.ChannelsLinear(result), target); err != nil {
+			return nil, err
+		}
+		return result, nil
 	}
 
-	// Reversing columns
-	return CreateVerticalMirror(result)
+	result := image.NewRGBA(bounds)
+	if err := remapChannels(ctx, models.Channels8(img.(*image.RGBA)), models.Channels8(result), target); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func RotateBy180Deg(img *image.RGBA) *image.RGBA {
-	return CreateVerticalMirror(CreateHorizontalMirror(img))
-}
+func remapChannels[C models.Channel](ctx context.Context, img, result models.Channels[C], target func(x, y int) (int, int)) error {
+	for y := 0; y < img.Rect.Dy(); y++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		row := img.Values[y*img.Stride : y*img.Stride+img.Rect.Dx()*4]
+		for x := 0; x < len(row)/4; x++ {
+			targetX, targetY := target(x, y)
+			offset := targetY*result.Stride + targetX*4
+			copy(result.Values[offset:offset+4], row[x*4:x*4+4])
+		}
+	}
 
-func RotateBy270Deg(img *image.RGBA) *image.RGBA {
-	return RotateBy180Deg(RotateBy90Deg(img))
+	return nil
 }
@@ -0,0 +1,175 @@
+package operations
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	models "tool7/image-processing/models"
+	utils "tool7/image-processing/utils"
+)
+
+// 3x2 sub-image with a non-zero origin, in which every pixel has its own 16-bit color
+func newRotationTestImage() *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(2, -4, 9, 3))
+	for i := 0; i < len(img.Pix); i += 2 {
+		value := uint16(i*997 + 3)
+		if i%8 == 6 {
+			value = 0xffff
+		}
+		img.Pix[i], img.Pix[i+1] = uint8(value>>8), uint8(value)
+	}
+	return img.SubImage(image.Rect(4, -2, 7, 0)).(*image.RGBA64)
+}
+
+func TestRotateAndMirrorMovePixels(t *testing.T) {
+	src16 := newRotationTestImage()
+	sources := map[string]models.Image{
+		"8-bit":  utils.ConvertTo8Bit(src16),
+		"16-bit": src16,
+		"linear": models.ToLinearImage(src16),
+	}
+
+	const width, height = 3, 2
+	tests := []struct {
+		operation     ConfigurableOperation
+		width, height int
+		// Position in the source, relative to its top left corner, of the output pixel at x, y
+		source func(x, y int) (int, int)
+	}{
+		{NewRotationOperation(By90Deg), height, width, func(x, y int) (int, int) { return y, height - 1 - x }},
+		{NewRotationOperation(By180Deg), width, height, func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }},
+		{NewRotationOperation(By270Deg), height, width, func(x, y int) (int, int) { return width - 1 - y, x }},
+		{NewVerticalMirrorOperation(), width, height, func(x, y int) (int, int) { return width - 1 - x, y }},
+		{NewHorizontalMirrorOperation(), width, height, func(x, y int) (int, int) { return x, height - 1 - y }},
+	}
+
+	for depth, src := range sources {
+		origin := src.Bounds().Min
+		for _, test := range tests {
+			name := fmt.Sprintf("%s %s%v", depth, test.operation.Name(), test.operation.Parameters())
+
+			result, err := test.operation.Execute(context.Background(), src)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if bounds := result.Bounds(); bounds != image.Rect(0, 0, test.width, test.height) {
+				t.Errorf("%s has bounds %v", name, bounds)
+				continue
+			}
+			if !models.SameDepth(result, src) {
+				t.Errorf("%s changed the depth to %T", name, result)
+			}
+
+			for y := 0; y < test.height; y++ {
+				for x := 0; x < test.width; x++ {
+					sourceX, sourceY := test.source(x, y)
+					expected := color.RGBA64Model.Convert(src.At(origin.X+sourceX, origin.Y+sourceY))
+					if got := color.RGBA64Model.Convert(result.At(x, y)); got != expected {
+						t.Errorf("%s: pixel (%d, %d) is %v, expected %v", name, x, y, got, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRotationRejectsOtherAngles(t *testing.T) {
+	for _, degrees := range []int{0, 45, 135, 360} {
+		if _, err := Create("rotate", Parameters{"degrees": degrees}); err == nil {
+			t.Errorf("Rotation by %d degrees was accepted", degrees)
+		}
+	}
+}
+
+// Layers after one that changes the bounds get its output, and mask and blend it at its size
+func TestLayersAfterRotation(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 13)
+		if i%4 == 3 {
+			src.Pix[i] = 255
+		}
+	}
+
+	mask, err := models.NewLayerMask(models.MaskShape{
+		Kind:  models.LinearGradientMask,
+		Start: models.MaskPoint{X: 0, Y: 0},
+		End:   models.MaskPoint{X: 0, Y: 1},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotation := NewRotationOperation(By90Deg)
+	rotationLayer := utils.NewImageLayer(rotation)
+	// Blending a layer with its input needs both at the same size, which only 180 degrees keep
+	rotationLayer.Opacity = 0.5
+	negativeLayer := utils.NewImageLayer(NewNegativeOperation())
+	negativeLayer.BlendMode = models.MultiplyBlend
+	negativeLayer.Opacity = 0.7
+	negativeLayer.Mask = mask
+	mirrorLayer := utils.NewImageLayer(NewHorizontalMirrorOperation())
+
+	collection := utils.NewImageLayerCollection(src)
+	for _, layer := range []*models.ImageLayer{rotationLayer, negativeLayer, mirrorLayer} {
+		collection.Append(layer)
+	}
+
+	// The same steps one after the other
+	expectedResult := func(input models.Image) models.Image {
+		ctx := context.Background()
+		rotated, _ := rotation.Execute(ctx, input)
+		if rotated.Bounds() == input.Bounds() {
+			rotated, _ = models.Blend(ctx, input, rotated, models.NormalBlend, 0.5)
+		}
+		negative, _ := NewNegativeOperation().Execute(ctx, rotated)
+		blended, _ := models.Blend(ctx, rotated, negative, models.MultiplyBlend, 0.7)
+		masked, _ := models.ApplyMask(ctx, rotated, blended, mask)
+		mirrored, _ := NewHorizontalMirrorOperation().Execute(ctx, masked)
+		return mirrored
+	}
+	checkResult := func(name string, result, expected models.Image) {
+		t.Helper()
+		if result.Bounds() != expected.Bounds() {
+			t.Fatalf("%s has bounds %v, expected %v", name, result.Bounds(), expected.Bounds())
+		}
+		if string(result.(*image.RGBA).Pix) != string(expected.(*image.RGBA).Pix) {
+			t.Errorf("%s differs from executing the layers one by one", name)
+		}
+	}
+
+	for _, degrees := range []RotationDegrees{By90Deg, By270Deg, By180Deg, By90Deg} {
+		rotation.Degrees = degrees
+
+		result, err := collection.ExecuteFullResolution(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkResult(fmt.Sprintf("Rotation by %d degrees", degrees), result, expectedResult(src))
+	}
+
+	// Previews are rotated as well, from the downscaled copy
+	collection.PreviewSize = image.Pt(4, 4)
+	preview, err := collection.ExecuteLayersFrom(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previewImage, _ := collection.PreviewImage()
+	checkResult("Preview", preview, expectedResult(previewImage))
+	if preview.Bounds() != image.Rect(0, 0, 2, 4) {
+		t.Errorf("Preview has bounds %v", preview.Bounds())
+	}
+
+	// Without the rotation, the mask and blend apply at the original size
+	rotationLayer.IsEnabled = false
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Bounds() != src.Rect {
+		t.Errorf("Result without rotation has bounds %v", result.Bounds())
+	}
+}
@@ -1,8 +1,8 @@
 package operations
 
 import (
-	"image"
-	"image/color"
+	"context"
+	models "tool7/image-processing/models"
 	utils "tool7/image-processing/utils"
 
 	colorful "github.com/lucasb-eyer/go-colorful"
@@ -18,34 +18,40 @@ func NewSaturationOperation(level float64) *SaturationOperation {
 	}
 }
 
-func (this *SaturationOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		chunkResult := image.NewRGBA(bounds)
-
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				R, G, B, A := utils.GetPixelColor(inputImage, x, y)
-
-				hue, normalizedSaturation, value := colorful.Color{
-					R: float64(R),
-					G: float64(G),
-					B: float64(B)}.Hsv()
-				saturation := utils.ClipColorChannel(normalizedSaturation * 255)
-
-				increasedSaturation := utils.ClipColorChannel(float64(saturation) * this.Level)
-				normalizedIncreasedSaturation := float64(increasedSaturation) / 255.0
-
-				newColor := colorful.Hsv(hue, normalizedIncreasedSaturation, value)
-				chunkResult.SetRGBA(x, y, color.RGBA{
-					uint8(newColor.R),
-					uint8(newColor.G),
-					uint8(newColor.B),
-					A,
-				})
-			}
-		}
-		return chunkResult
+func (this *SaturationOperation) Name() string {
+	return "saturation"
+}
+
+func (this *SaturationOperation) Parameters() Parameters {
+	return Parameters{"level": this.Level}
+}
+
+func (this *SaturationOperation) SetParameters(params Parameters) error {
+	if level, ok := params["level"].(float64); ok {
+		this.Level = level
 	}
+	return nil
+}
+
+// Saturation is quantized to the channel depth, like the channels themselves
+func saturatePixel[C models.Channel](level float64) func(r, g, b, a C) (C, C, C, C) {
+	max := float64(models.ChannelMax[C]())
+
+	return func(r, g, b, a C) (C, C, C, C) {
+		hue, normalizedSaturation, value := colorful.Color{
+			R: float64(r),
+			G: float64(g),
+			B: float64(b)}.Hsv()
+		saturation := utils.ClipChannel[C](normalizedSaturation * max)
+
+		increasedSaturation := utils.ClipChannel[C](float64(saturation) * level)
+		normalizedIncreasedSaturation := float64(increasedSaturation) / max
+
+		newColor := colorful.Hsv(hue, normalizedIncreasedSaturation, value)
+		return C(newColor.R), C(newColor.G), C(newColor.B), a
+	}
+}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+func (this *SaturationOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	return utils.MapImagePixels(ctx, inputImage, saturatePixel[uint8](this.Level), saturatePixel[uint16](this.Level))
 }
@@ -1,9 +1,11 @@
 package operations
 
 import (
-	"image"
+	"context"
 	"image/color"
+	"math"
 
+	models "tool7/image-processing/models"
 	utils "tool7/image-processing/utils"
 )
 
@@ -19,27 +21,35 @@ func NewTintOperation(tint color.RGBA, intensity float64) *TintOperation {
 	}
 }
 
-func (this *TintOperation) Execute(inputImage *image.RGBA) (*image.RGBA, error) {
-	worker := func(bounds image.Rectangle) *image.RGBA {
-		chunkResult := image.NewRGBA(bounds)
-
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			for x := bounds.Min.X; x < bounds.Max.X; x++ {
-				R, G, B, A := utils.GetPixelColor(inputImage, x, y)
+func (this *TintOperation) Name() string {
+	return "tint"
+}
 
-				tintR := float64(this.Tint.R) * this.Intensity
-				tintG := float64(this.Tint.G) * this.Intensity
-				tintB := float64(this.Tint.B) * this.Intensity
+func (this *TintOperation) Parameters() Parameters {
+	return Parameters{
+		"color":     ColorFromRGBA(this.Tint),
+		"intensity": this.Intensity,
+	}
+}
 
-				newR := utils.ClipColorChannel(int32(R) + int32(tintR))
-				newG := utils.ClipColorChannel(int32(G) + int32(tintG))
-				newB := utils.ClipColorChannel(int32(B) + int32(tintB))
+func (this *TintOperation) SetParameters(params Parameters) error {
+	if tint, ok := params["color"].(Color); ok {
+		this.Tint = tint.RGBA()
+	}
+	if intensity, ok := params["intensity"].(float64); ok {
+		this.Intensity = intensity
+	}
+	return nil
+}
 
-				chunkResult.SetRGBA(x, y, color.RGBA{newR, newG, newB, A})
-			}
+func (this *TintOperation) Execute(ctx context.Context, inputImage models.Image) (models.Image, error) {
+	// The tint color has 8 bits per channel, so its offsets are scaled to the image depth
+	tint := func(tint uint8) utils.ChannelFunc {
+		offset := math.Trunc(float64(tint) * this.Intensity)
+		return func(value, max float64) float64 {
+			return value + offset*max/255
 		}
-		return chunkResult
 	}
 
-	return utils.ProcessImageConcurrently(*inputImage, worker)
+	return utils.MapImageChannels(ctx, inputImage, tint(this.Tint.R), tint(this.Tint.G), tint(this.Tint.B))
 }
@@ -0,0 +1,120 @@
+package preset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tool7/image-processing/project"
+)
+
+// Version of the preset file layout written by Encode. Version 1 files stored kernel sizes instead
+// of radii.
+const CurrentVersion = 2
+
+const FileExtension = ".gopreset"
+
+// Named chain of operations that can be applied to any image. Presets hold the operations with
+// their parameters, blending and masks, but never image data, so bitmap masks are left out.
+type Preset struct {
+	Name       string                   `json:"name"`
+	Operations []project.OperationState `json:"operations"`
+}
+
+type presetFile struct {
+	Version int `json:"version"`
+	Preset
+}
+
+func New(name string, operations []project.OperationState) (*Preset, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("Preset name cannot be empty")
+	}
+
+	return &Preset{Name: name, Operations: withoutImageData(operations)}, nil
+}
+
+func Encode(writer io.Writer, preset Preset) error {
+	file := presetFile{Version: CurrentVersion, Preset: preset}
+	if file.Operations == nil {
+		file.Operations = []project.OperationState{}
+	}
+
+	return json.NewEncoder(writer).Encode(file)
+}
+
+func Decode(data []byte) (*Preset, error) {
+	var file presetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("Invalid preset file: %w", err)
+	}
+	if file.Version == 0 {
+		return nil, fmt.Errorf("Invalid preset file: missing version")
+	}
+	if file.Version > CurrentVersion {
+		return nil, fmt.Errorf("Preset file version %d is newer than the supported version %d", file.Version, CurrentVersion)
+	}
+	if file.Version < 2 {
+		project.MigrateKernelSizes(file.Operations)
+	}
+
+	return New(file.Name, file.Operations)
+}
+
+// Writes the preset to a file outside of the store, as done when exporting it
+func WriteFile(filePath string, preset Preset) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := Encode(f, preset); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func ReadFile(filePath string) (*Preset, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(data)
+}
+
+// Copies the operations without bitmap masks, including those of group members and graph nodes
+func withoutImageData(states []project.OperationState) []project.OperationState {
+	if states == nil {
+		return nil
+	}
+
+	copied := make([]project.OperationState, len(states))
+	for i, state := range states {
+		if state.Mask != nil && state.Mask.Bitmap != "" {
+			state.Mask = nil
+		}
+		state.Layers = withoutImageData(state.Layers)
+
+		if state.Graph != nil {
+			graph := *state.Graph
+			graph.Nodes = make([]project.GraphNodeState, len(state.Graph.Nodes))
+			for j, node := range state.Graph.Nodes {
+				if node.Layer != nil {
+					layer := withoutImageData([]project.OperationState{*node.Layer})[0]
+					node.Layer = &layer
+				}
+				graph.Nodes[j] = node
+			}
+			state.Graph = &graph
+		}
+
+		copied[i] = state
+	}
+	return copied
+}
@@ -0,0 +1,149 @@
+package preset
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directory of the presets within the user config directory
+const defaultDirectory = "image-processing/presets"
+
+// Presets saved as one file each in a directory, which is created on the first save
+type Store struct {
+	Directory string
+}
+
+func NewStore(directory string) *Store {
+	return &Store{Directory: directory}
+}
+
+// Returns the store in the config directory of the user, e.g. ~/.config/image-processing/presets
+func DefaultStore() (*Store, error) {
+	configDirectory, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStore(filepath.Join(configDirectory, filepath.FromSlash(defaultDirectory))), nil
+}
+
+// Saving under the name of an existing preset replaces it
+func (this *Store) Save(preset Preset) error {
+	if err := os.MkdirAll(this.Directory, 0755); err != nil {
+		return err
+	}
+
+	return WriteFile(this.path(preset.Name), preset)
+}
+
+// Saves the preset without replacing another one. When its name is taken, the first free name
+// with a number appended is used instead, like "Punchy (2)". Returns the name it was saved under.
+func (this *Store) Add(preset Preset) (string, error) {
+	if err := os.MkdirAll(this.Directory, 0755); err != nil {
+		return "", err
+	}
+
+	baseName := strings.TrimSpace(preset.Name)
+	preset.Name = baseName
+	for number := 2; ; number++ {
+		// Creating the file fails when it exists, so that a preset saved meanwhile is kept as well
+		f, err := os.OpenFile(this.path(preset.Name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, os.ErrExist) {
+			preset.Name = fmt.Sprintf("%s (%d)", baseName, number)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+
+		if err := Encode(f, preset); err != nil {
+			return "", err
+		}
+		return preset.Name, f.Close()
+	}
+}
+
+func (this *Store) Load(name string) (*Preset, error) {
+	preset, err := ReadFile(this.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("Preset %q does not exist: %w", name, err)
+	}
+	return preset, err
+}
+
+func (this *Store) Delete(name string) error {
+	err := os.Remove(this.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("Preset %q does not exist: %w", name, err)
+	}
+	return err
+}
+
+// Renaming to the name of another preset fails instead of replacing it
+func (this *Store) Rename(oldName, newName string) error {
+	storedPreset, err := this.Load(oldName)
+	if err != nil {
+		return err
+	}
+	renamed, err := New(newName, storedPreset.Operations)
+	if err != nil {
+		return err
+	}
+
+	oldPath, newPath := this.path(oldName), this.path(renamed.Name)
+	if newInfo, err := os.Stat(newPath); err == nil {
+		oldInfo, err := os.Stat(oldPath)
+		if err != nil {
+			return err
+		}
+		// Names differing only in case are the same file on case-insensitive file systems
+		if !os.SameFile(oldInfo, newInfo) {
+			return fmt.Errorf("Preset %q already exists", renamed.Name)
+		}
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	return WriteFile(newPath, *renamed)
+}
+
+// Returns all presets ordered by name. Files that cannot be read are left out.
+func (this *Store) List() ([]Preset, error) {
+	entries, err := os.ReadDir(this.Directory)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Preset{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	presets := []Preset{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != FileExtension {
+			continue
+		}
+
+		preset, err := ReadFile(filepath.Join(this.Directory, entry.Name()))
+		if err != nil {
+			continue
+		}
+		presets = append(presets, *preset)
+	}
+
+	sort.Slice(presets, func(i, j int) bool {
+		return strings.ToLower(presets[i].Name) < strings.ToLower(presets[j].Name)
+	})
+	return presets, nil
+}
+
+// Escapes the name, so that any name makes a valid file name on every platform
+func (this *Store) path(name string) string {
+	return filepath.Join(this.Directory, url.QueryEscape(strings.TrimSpace(name))+FileExtension)
+}
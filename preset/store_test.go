@@ -0,0 +1,225 @@
+package preset
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+	"tool7/image-processing/project"
+)
+
+func newTestPreset(t *testing.T, name string) Preset {
+	preset, err := New(name, []project.OperationState{
+		{Name: "contrast", Params: operations.Parameters{"level": 1.3}, IsEnabled: true},
+		{Name: "sharpen", Params: operations.Parameters{"radius": 2.0}, IsEnabled: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return *preset
+}
+
+func presetNames(t *testing.T, store *Store) []string {
+	presets, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, preset := range presets {
+		names = append(names, preset.Name)
+	}
+	return names
+}
+
+func TestStoreSaveLoad(t *testing.T) {
+	// The directory is created on the first save
+	store := NewStore(filepath.Join(t.TempDir(), "presets"))
+	if names := presetNames(t, store); len(names) != 0 {
+		t.Errorf("Missing directory lists %v", names)
+	}
+
+	saved := newTestPreset(t, "Product photos")
+	if err := store.Save(saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load("Product photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*loaded, saved) {
+		t.Errorf("Loaded %+v, expected %+v", *loaded, saved)
+	}
+
+	// Saving under the same name replaces the preset
+	replacement := newTestPreset(t, "Product photos")
+	replacement.Operations = replacement.Operations[:1]
+	if err := store.Save(replacement); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, _ := store.Load("Product photos"); len(loaded.Operations) != 1 {
+		t.Errorf("Replaced preset has %d operations", len(loaded.Operations))
+	}
+
+	if _, err := store.Load("Missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Loading a missing preset gave %v", err)
+	}
+}
+
+// Names are escaped, so that they can hold characters that file names cannot
+func TestStoreNamesAreEscaped(t *testing.T) {
+	store := NewStore(t.TempDir())
+
+	for _, name := range []string{"a/b", `c:\d`, "..", "zebra"} {
+		if err := store.Save(newTestPreset(t, name)); err != nil {
+			t.Fatalf("Saving %q failed: %v", name, err)
+		}
+	}
+
+	expected := []string{"..", "a/b", `c:\d`, "zebra"}
+	if names := presetNames(t, store); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Presets are %v, expected %v", names, expected)
+	}
+	entries, _ := os.ReadDir(store.Directory)
+	if len(entries) != len(expected) {
+		t.Errorf("Store directory has %d entries", len(entries))
+	}
+}
+
+func TestStoreRename(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.Save(newTestPreset(t, "Old"))
+	store.Save(newTestPreset(t, "Other"))
+
+	if err := store.Rename("Old", "New"); err != nil {
+		t.Fatal(err)
+	}
+	if names := presetNames(t, store); !reflect.DeepEqual(names, []string{"New", "Other"}) {
+		t.Errorf("Presets are %v after renaming", names)
+	}
+	renamed, err := store.Load("New")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed.Name != "New" || len(renamed.Operations) != 2 {
+		t.Errorf("Renamed preset is %+v", *renamed)
+	}
+
+	// Changing the case only renames the preset itself
+	if err := store.Rename("New", "NEW"); err != nil {
+		t.Fatal(err)
+	}
+	if names := presetNames(t, store); !reflect.DeepEqual(names, []string{"NEW", "Other"}) {
+		t.Errorf("Presets are %v after changing the case", names)
+	}
+
+	if err := store.Rename("NEW", "Other"); err == nil {
+		t.Error("Renaming replaced another preset")
+	}
+	if err := store.Rename("NEW", " "); err == nil {
+		t.Error("Preset was renamed to an empty name")
+	}
+	if err := store.Rename("Missing", "Found"); err == nil {
+		t.Error("Missing preset was renamed")
+	}
+	if names := presetNames(t, store); !reflect.DeepEqual(names, []string{"NEW", "Other"}) {
+		t.Errorf("Failed renames changed the presets to %v", names)
+	}
+}
+
+// Imported presets are added next to presets of the same name instead of replacing them
+func TestStoreAddKeepsPresetsOfTheSameName(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "presets"))
+	store.Save(newTestPreset(t, "Punchy"))
+
+	for _, expected := range []string{"Punchy (2)", "Punchy (3)"} {
+		imported := newTestPreset(t, "Punchy")
+		imported.Operations = imported.Operations[:1]
+		name, err := store.Add(imported)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != expected {
+			t.Errorf("Preset was added as %q, expected %q", name, expected)
+		}
+	}
+
+	original, err := store.Load("Punchy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(original.Operations) != 2 {
+		t.Errorf("Adding replaced the existing preset with %+v", *original)
+	}
+	added, err := store.Load("Punchy (2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Name != "Punchy (2)" || len(added.Operations) != 1 {
+		t.Errorf("Added preset is %+v", *added)
+	}
+
+	if name, err := store.Add(newTestPreset(t, "Soft")); err != nil || name != "Soft" {
+		t.Errorf("Preset with a free name was added as %q: %v", name, err)
+	}
+	if names := presetNames(t, store); !reflect.DeepEqual(names, []string{"Punchy", "Punchy (2)", "Punchy (3)", "Soft"}) {
+		t.Errorf("Presets are %v", names)
+	}
+}
+
+func TestStoreDelete(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.Save(newTestPreset(t, "First"))
+	store.Save(newTestPreset(t, "Second"))
+
+	if err := store.Delete("First"); err != nil {
+		t.Fatal(err)
+	}
+	if names := presetNames(t, store); !reflect.DeepEqual(names, []string{"Second"}) {
+		t.Errorf("Presets are %v after deleting", names)
+	}
+	if err := store.Delete("First"); err == nil {
+		t.Error("Deleted preset was deleted again")
+	}
+}
+
+// Unreadable files and files of other types are left out of the list
+func TestStoreListSkipsOtherFiles(t *testing.T) {
+	store := NewStore(t.TempDir())
+	store.Save(newTestPreset(t, "Valid"))
+	os.WriteFile(filepath.Join(store.Directory, "broken"+FileExtension), []byte("{"), 0644)
+	os.WriteFile(filepath.Join(store.Directory, "notes.txt"), []byte("text"), 0644)
+	os.Mkdir(filepath.Join(store.Directory, "folder"+FileExtension), 0755)
+
+	if names := presetNames(t, store); !reflect.DeepEqual(names, []string{"Valid"}) {
+		t.Errorf("Presets are %v", names)
+	}
+}
+
+// Presets never hold image data, also within groups
+func TestNewPresetLeavesOutBitmapMasks(t *testing.T) {
+	shapeMask := &project.MaskState{MaskShape: models.MaskShape{Kind: models.EllipseMask}}
+	preset, err := New(" Masked ", []project.OperationState{
+		{Name: "greyscale", Mask: &project.MaskState{MaskShape: models.MaskShape{Kind: models.BitmapMask}, Bitmap: "iVBORw0KGgo="}},
+		{Name: "group", Layers: []project.OperationState{
+			{Name: "negative", Mask: &project.MaskState{MaskShape: models.MaskShape{Kind: models.BitmapMask}, Bitmap: "iVBORw0KGgo="}},
+			{Name: "sepia", Mask: shapeMask},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preset.Name != "Masked" {
+		t.Errorf("Name is %q", preset.Name)
+	}
+	if preset.Operations[0].Mask != nil || preset.Operations[1].Layers[0].Mask != nil {
+		t.Error("Bitmap masks were kept")
+	}
+	if preset.Operations[1].Layers[1].Mask != shapeMask {
+		t.Error("Shape mask was left out")
+	}
+}
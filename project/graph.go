@@ -0,0 +1,123 @@
+package project
+
+import (
+	"fmt"
+
+	"tool7/image-processing/models"
+)
+
+// Layer graph as stored in project files. The input node of the graph is not stored.
+type GraphState struct {
+	Nodes  []GraphNodeState `json:"nodes"`
+	Output int              `json:"output"`
+}
+
+type GraphNodeState struct {
+	ID int `json:"id"`
+	// IDs of the input nodes in order, -1 for inputs that are not connected
+	Inputs []int `json:"inputs"`
+	// Operation of layer nodes
+	Layer *OperationState `json:"layer,omitempty"`
+	// Merge nodes blending their second input over their first one
+	Blend *BlendState `json:"blend,omitempty"`
+}
+
+type BlendState struct {
+	BlendMode models.BlendMode `json:"blendMode"`
+	Opacity   float64          `json:"opacity"`
+}
+
+// Creates the graph described by state. Nodes that cannot be created are left out and reported,
+// leaving the inputs they were connected to unconnected.
+func newLayerGraph(state GraphState) (*models.LayerGraph, []SkippedOperation, error) {
+	graph := models.NewLayerGraph()
+	var skipped []SkippedOperation
+
+	for index, nodeState := range state.Nodes {
+		node := &models.GraphNode{ID: models.NodeID(nodeState.ID)}
+
+		switch {
+		case nodeState.Layer != nil:
+			imageLayer, layerSkipped, err := newImageLayer(*nodeState.Layer)
+			if err != nil {
+				skipped = append(skipped, SkippedOperation{Index: index, Name: nodeState.Layer.Name, Reason: err.Error()})
+				continue
+			}
+			for _, member := range layerSkipped {
+				skipped = append(skipped, SkippedOperation{Index: index, Name: nodeState.Layer.Name + " > " + member.Name, Reason: member.Reason})
+			}
+			node.Layer = imageLayer
+			node.Inputs = []models.NodeID{models.NoNode}
+		case nodeState.Blend != nil:
+			merge, err := models.NewBlendMerge(nodeState.Blend.BlendMode, nodeState.Blend.Opacity)
+			if err != nil {
+				skipped = append(skipped, SkippedOperation{Index: index, Name: "blend", Reason: err.Error()})
+				continue
+			}
+			node.Merge = merge
+			node.Inputs = []models.NodeID{models.NoNode, models.NoNode}
+		default:
+			return nil, nil, fmt.Errorf("Graph node %d has no operation", nodeState.ID)
+		}
+
+		if err := graph.RestoreNode(node); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Connections are made once all nodes exist, skipping those of left out nodes
+	for _, nodeState := range state.Nodes {
+		to := models.NodeID(nodeState.ID)
+		if _, err := graph.Node(to); err != nil {
+			continue
+		}
+
+		for slot, from := range nodeState.Inputs {
+			if models.NodeID(from) == models.NoNode {
+				continue
+			}
+			if _, err := graph.Node(models.NodeID(from)); err != nil {
+				continue
+			}
+			if err := graph.Connect(models.NodeID(from), to, slot); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if _, err := graph.Node(models.NodeID(state.Output)); err == nil {
+		graph.Output = models.NodeID(state.Output)
+	}
+	return graph, skipped, nil
+}
+
+func captureGraph(graph *models.LayerGraph) (GraphState, error) {
+	state := GraphState{Nodes: []GraphNodeState{}, Output: int(graph.Output)}
+
+	for _, node := range graph.Nodes() {
+		if node.ID == models.GraphInputNode {
+			continue
+		}
+
+		nodeState := GraphNodeState{ID: int(node.ID)}
+		for _, input := range node.Inputs {
+			nodeState.Inputs = append(nodeState.Inputs, int(input))
+		}
+
+		if node.Layer != nil {
+			layerState, err := CaptureLayer(node.Layer)
+			if err != nil {
+				return GraphState{}, err
+			}
+			nodeState.Layer = &layerState
+		} else if blend, ok := node.Merge.(*models.BlendMerge); ok {
+			nodeState.Blend = &BlendState{BlendMode: blend.BlendMode, Opacity: blend.Opacity}
+		} else {
+			return GraphState{}, fmt.Errorf("Merge %T cannot be saved", node.Merge)
+		}
+
+		state.Nodes = append(state.Nodes, nodeState)
+	}
+
+	return state, nil
+}
@@ -0,0 +1,84 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"tool7/image-processing/operations"
+)
+
+// Layout of the unversioned .goimp files that were assembled and downloaded by the frontend
+type legacyProjectFile struct {
+	OriginalImage struct {
+		Base64 string `json:"base64"`
+	} `json:"originalImage"`
+	Operations []struct {
+		Name       string                `json:"name"`
+		Type       int                   `json:"type"`
+		Params     operations.Parameters `json:"params"`
+		Level      *float64              `json:"level"`
+		Tint       *operations.Color     `json:"tint"`
+		KernelSize *int                  `json:"kernelSize"`
+		IsEnabled  bool                  `json:"isEnabled"`
+	} `json:"operations"`
+}
+
+// Operation names in the order of the integer types used by projects saved before the operation registry
+var legacyOperationNames = []string{
+	"brightness", "contrast", "saturation", "tint", "greyscale", "negative", "sepia",
+	"boxblur", "motionblur", "sharpen", "emboss", "edgeshorizontal", "edgesvertical", "outline",
+}
+
+func decodeLegacy(data []byte) (*projectFile, error) {
+	var legacy legacyProjectFile
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("Invalid project file: %w", err)
+	}
+
+	file := &projectFile{
+		Version:    CurrentVersion,
+		Operations: make([]OperationState, 0, len(legacy.Operations)),
+	}
+
+	// Legacy images are stored as data URLs
+	file.Image = legacy.OriginalImage.Base64
+	if _, data, ok := strings.Cut(file.Image, ","); ok {
+		file.Image = data
+	}
+
+	for _, operation := range legacy.Operations {
+		state := OperationState{Name: operation.Name, Params: operation.Params, IsEnabled: operation.IsEnabled}
+
+		if state.Name == "" {
+			if operation.Type >= 1 && operation.Type <= len(legacyOperationNames) {
+				state.Name = legacyOperationNames[operation.Type-1]
+				state.Params = legacyParams(state.Name, operation.Level, operation.Tint, operation.KernelSize)
+			} else {
+				state.Name = fmt.Sprintf("type %d", operation.Type)
+			}
+		}
+
+		file.Operations = append(file.Operations, state)
+	}
+
+	return file, nil
+}
+
+func legacyParams(name string, level *float64, tint *operations.Color, kernelSize *int) operations.Parameters {
+	params := operations.Parameters{}
+	definition, _ := operations.Lookup(name)
+
+	for _, spec := range definition.Parameters {
+		switch {
+		case spec.Kind == operations.ColorParameter && tint != nil:
+			params[spec.Name] = *tint
+		case spec.Name == "radius" && kernelSize != nil:
+			params[spec.Name] = kernelRadius(float64(*kernelSize))
+		case spec.Kind == operations.NumberParameter && level != nil:
+			params[spec.Name] = *level
+		}
+	}
+
+	return params
+}
@@ -0,0 +1,48 @@
+package project
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image/png"
+	"strings"
+
+	"tool7/image-processing/models"
+	"tool7/image-processing/utils"
+)
+
+// Layer mask as stored in project files
+type MaskState struct {
+	models.MaskShape
+	// PNG of bitmap masks, base64 encoded
+	Bitmap string `json:"bitmap,omitempty"`
+}
+
+func NewLayerMask(state MaskState) (*models.LayerMask, error) {
+	if state.Kind != models.BitmapMask {
+		return models.NewLayerMask(state.MaskShape, nil)
+	}
+
+	reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader(state.Bitmap))
+	img, err := png.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid mask bitmap: %w", err)
+	}
+
+	return models.NewLayerMask(state.MaskShape, utils.ConvertToGray(img))
+}
+
+func CaptureMask(mask *models.LayerMask) (MaskState, error) {
+	state := MaskState{MaskShape: mask.Shape}
+	if mask.Bitmap == nil {
+		return state, nil
+	}
+
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, mask.Bitmap); err != nil {
+		return MaskState{}, err
+	}
+
+	state.Bitmap = base64.StdEncoding.EncodeToString(buff.Bytes())
+	return state, nil
+}
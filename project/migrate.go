@@ -0,0 +1,88 @@
+package project
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"tool7/image-processing/operations"
+)
+
+// Geometric transform of version 1 project files, which were applied to the source image before
+// the operation layers. Since version 2 rotation and mirroring are regular layers.
+type transform string
+
+const (
+	rotateBy90Deg      transform = "rotate90"
+	mirrorVertically   transform = "mirrorVertical"
+	mirrorHorizontally transform = "mirrorHorizontal"
+)
+
+type projectFileVersion1 struct {
+	projectFile
+	Transforms []transform `json:"transforms,omitempty"`
+}
+
+// Version 1 files are migrated by turning their transforms into the first layers
+func decodeVersion1(data []byte) (*projectFile, error) {
+	var file projectFileVersion1
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	operationStates := make([]OperationState, 0, len(file.Transforms)+len(file.Operations))
+	for _, transform := range file.Transforms {
+		state, err := transform.operationState()
+		if err != nil {
+			return nil, err
+		}
+		operationStates = append(operationStates, state)
+	}
+
+	file.projectFile.Version = CurrentVersion
+	file.projectFile.Operations = append(operationStates, file.Operations...)
+	return &file.projectFile, nil
+}
+
+func (this transform) operationState() (OperationState, error) {
+	switch this {
+	case rotateBy90Deg:
+		return OperationState{Name: "rotate", Params: operations.Parameters{"degrees": int(operations.By90Deg)}, IsEnabled: true}, nil
+	case mirrorVertically:
+		return OperationState{Name: "mirrorvertical", IsEnabled: true}, nil
+	case mirrorHorizontally:
+		return OperationState{Name: "mirrorhorizontal", IsEnabled: true}, nil
+	}
+	return OperationState{}, fmt.Errorf("Unknown transform %q", string(this))
+}
+
+// Kernel operations of files before version 3 had an odd kernel size of up to 9 instead of a
+// radius, which is half the size without the center
+func MigrateKernelSizes(states []OperationState) {
+	for i := range states {
+		state := &states[i]
+		if size, ok := state.Params["kernelSize"]; ok {
+			delete(state.Params, "kernelSize")
+			switch size := size.(type) {
+			case float64:
+				state.Params["radius"] = kernelRadius(size)
+			case int:
+				state.Params["radius"] = kernelRadius(float64(size))
+			}
+		}
+
+		MigrateKernelSizes(state.Layers)
+		if state.Graph != nil {
+			for _, node := range state.Graph.Nodes {
+				if node.Layer != nil {
+					layer := []OperationState{*node.Layer}
+					MigrateKernelSizes(layer)
+					*node.Layer = layer[0]
+				}
+			}
+		}
+	}
+}
+
+func kernelRadius(kernelSize float64) float64 {
+	return (kernelSize - 1) / 2
+}
@@ -0,0 +1,204 @@
+package project
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"tool7/image-processing/operations"
+)
+
+// Base64 PNG of a 2x1 image with a red and a blue pixel
+func testImageBase64(t *testing.T) string {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	img.Set(1, 0, color.RGBA{0, 0, 255, 255})
+
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, img); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(buff.Bytes())
+}
+
+func operationNames(states []OperationState) []string {
+	names := make([]string, len(states))
+	for i, state := range states {
+		names[i] = state.Name
+	}
+	return names
+}
+
+// Unversioned files stored operations by integer type with loose parameter fields, and the image
+// as a data URL
+func TestDecodeLegacy(t *testing.T) {
+	data := fmt.Sprintf(`{
+		"originalImage": {"base64": "data:image/png;base64,%s"},
+		"operations": [
+			{"type": 1, "level": 1.2, "isEnabled": true},
+			{"type": 4, "tint": {"r": 255, "g": 136, "b": 0}, "isEnabled": false},
+			{"type": 8, "kernelSize": 5, "isEnabled": true},
+			{"name": "sharpen", "params": {"kernelSize": 7}, "isEnabled": true},
+			{"name": "negative", "isEnabled": true},
+			{"type": 99, "isEnabled": true}
+		]
+	}`, testImageBase64(t))
+
+	state, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bounds := state.Image.Bounds(); bounds.Dx() != 2 || bounds.Dy() != 1 {
+		t.Errorf("Image has bounds %v", bounds)
+	}
+	if r, _, _, _ := state.Image.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("First pixel is %v, expected red", state.Image.At(0, 0))
+	}
+
+	expected := []OperationState{
+		{Name: "brightness", Params: operations.Parameters{"level": 1.2}, IsEnabled: true},
+		{Name: "tint", Params: operations.Parameters{"color": operations.Color{R: 255, G: 136}}, IsEnabled: false},
+		{Name: "boxblur", Params: operations.Parameters{"radius": 2.0}, IsEnabled: true},
+		{Name: "sharpen", Params: operations.Parameters{"radius": 3.0}, IsEnabled: true},
+		{Name: "negative", IsEnabled: true},
+		{Name: "type 99", IsEnabled: true},
+	}
+	if !reflect.DeepEqual(state.Operations, expected) {
+		t.Errorf("Operations are %+v, expected %+v", state.Operations, expected)
+	}
+
+	// Unknown types are kept so that loading can report them as skipped
+	_, skipped := BuildCollection(state.Image, state.Operations)
+	if len(skipped) != 1 || skipped[0].Index != 5 {
+		t.Errorf("Skipped %+v, expected only the unknown type", skipped)
+	}
+}
+
+// Version 1 transforms become the first layers, in their order and before the operations
+func TestDecodeVersion1(t *testing.T) {
+	data := fmt.Sprintf(`{
+		"version": 1,
+		"image": %q,
+		"operations": [{"name": "greyscale", "isEnabled": true}],
+		"transforms": ["rotate90", "mirrorHorizontal", "mirrorVertical"]
+	}`, testImageBase64(t))
+
+	state, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := operationNames(state.Operations)
+	expected := []string{"rotate", "mirrorhorizontal", "mirrorvertical", "greyscale"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Operations are %v, expected %v", names, expected)
+	}
+	if degrees := state.Operations[0].Params["degrees"]; degrees != int(operations.By90Deg) {
+		t.Errorf("Rotation has %v degrees", degrees)
+	}
+
+	collection, skipped := BuildCollection(state.Image, state.Operations)
+	if len(skipped) > 0 {
+		t.Fatalf("Skipped %+v", skipped)
+	}
+	// The 2x1 image is 1x2 after the rotation
+	result, err := collection.ExecuteFullResolution(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := result.Bounds(); bounds.Dx() != 1 || bounds.Dy() != 2 {
+		t.Errorf("Result has bounds %v", bounds)
+	}
+}
+
+// Version 2 kernel sizes become radii, also within groups and graphs
+func TestDecodeVersion2(t *testing.T) {
+	data := fmt.Sprintf(`{
+		"version": 2,
+		"image": %q,
+		"operations": [
+			{"name": "boxblur", "params": {"kernelSize": 9, "processAlpha": true}, "isEnabled": true},
+			{"name": "group", "isEnabled": true, "layers": [
+				{"name": "emboss", "params": {"kernelSize": 3}, "isEnabled": true}
+			]},
+			{"name": "graph", "isEnabled": true, "graph": {"nodes": [
+				{"id": 1, "inputs": [0], "layer": {"name": "sharpen", "params": {"kernelSize": 5}, "isEnabled": true}}
+			], "output": 1}}
+		]
+	}`, testImageBase64(t))
+
+	state, err := Decode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	radii := []interface{}{
+		state.Operations[0].Params["radius"],
+		state.Operations[1].Layers[0].Params["radius"],
+		state.Operations[2].Graph.Nodes[0].Layer.Params["radius"],
+	}
+	if !reflect.DeepEqual(radii, []interface{}{4.0, 1.0, 2.0}) {
+		t.Errorf("Radii are %v", radii)
+	}
+	if _, ok := state.Operations[0].Params["kernelSize"]; ok || state.Operations[0].Params["processAlpha"] != true {
+		t.Errorf("Parameters are %v", state.Operations[0].Params)
+	}
+	if _, skipped := BuildCollection(state.Image, state.Operations); len(skipped) > 0 {
+		t.Errorf("Skipped %+v", skipped)
+	}
+}
+
+func TestDecodeVersion1RejectsUnknownTransforms(t *testing.T) {
+	data := fmt.Sprintf(`{"version": 1, "image": %q, "transforms": ["skew"]}`, testImageBase64(t))
+	if _, err := Decode([]byte(data)); err == nil {
+		t.Error("Unknown transform was accepted")
+	}
+}
+
+// Files of the current version are read as they are written
+func TestEncodeDecodeCurrentVersion(t *testing.T) {
+	original, err := Decode([]byte(fmt.Sprintf(`{"version": 1, "image": %q, "transforms": ["rotate90"]}`, testImageBase64(t))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	original.Operations = append(original.Operations, OperationState{
+		Name: "brightness", Params: operations.Parameters{"level": 1.4}, IsEnabled: true,
+	})
+
+	var buff bytes.Buffer
+	if err := Encode(&buff, *original); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buff.Bytes(), []byte(fmt.Sprintf(`"version":%d`, CurrentVersion))) {
+		t.Errorf("Encoded file has no version %d: %s", CurrentVersion, buff.String())
+	}
+	if bytes.Contains(buff.Bytes(), []byte("transforms")) {
+		t.Error("Encoded file still has transforms")
+	}
+
+	decoded, err := Decode(buff.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := operationNames(decoded.Operations)
+	if !reflect.DeepEqual(names, []string{"rotate", "brightness"}) {
+		t.Errorf("Operations are %v", names)
+	}
+	if level := decoded.Operations[1].Params["level"]; level != 1.4 {
+		t.Errorf("Brightness level is %v", level)
+	}
+}
+
+func TestDecodeRejectsNewerVersions(t *testing.T) {
+	data := fmt.Sprintf(`{"version": %d, "image": %q}`, CurrentVersion+1, testImageBase64(t))
+	if _, err := Decode([]byte(data)); err == nil {
+		t.Error("Newer version was accepted")
+	}
+}
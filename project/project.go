@@ -0,0 +1,334 @@
+package project
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"os"
+	"strings"
+
+	"tool7/image-processing/metadata"
+	"tool7/image-processing/models"
+	"tool7/image-processing/operations"
+	"tool7/image-processing/utils"
+)
+
+// Version of the project file layout written by Save. Files without a version were written by
+// the frontend before the format moved to the Go side and are still accepted by Load, as are
+// version 1 files, which stored rotation and mirroring apart from the layers, and version 2
+// files, which stored kernel sizes instead of radii.
+const CurrentVersion = 3
+
+const FileExtension = ".goimp"
+
+type OperationState struct {
+	Name      string                `json:"name"`
+	Params    operations.Parameters `json:"params,omitempty"`
+	IsEnabled bool                  `json:"isEnabled"`
+	// Blending of the layer output over its input, fully opaque and normal when left out
+	Opacity   *float64         `json:"opacity,omitempty"`
+	BlendMode models.BlendMode `json:"blendMode,omitempty"`
+	Mask      *MaskState       `json:"mask,omitempty"`
+	// Members of a group, in pipeline order
+	Layers []OperationState `json:"layers,omitempty"`
+	// Nodes of a graph
+	Graph *GraphState `json:"graph,omitempty"`
+}
+
+// Operation from a project file that could not be restored
+type SkippedOperation struct {
+	Index  int    `json:"index"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// Everything needed to restore the editing session
+type State struct {
+	// Source pixels, which the layers never modify
+	Image      models.Image
+	Operations []OperationState
+	// Metadata of the file the image was opened from
+	Metadata metadata.Metadata
+	// Color space the layers work in, see models.ImageLayerCollection
+	WorkingSpace models.ColorSpace
+}
+
+type projectFile struct {
+	Version    int                `json:"version"`
+	Image      string             `json:"image"`
+	Operations []OperationState   `json:"operations"`
+	Metadata   *metadata.Metadata `json:"metadata,omitempty"`
+	// Perceptual when left out
+	WorkingSpace models.ColorSpace `json:"workingSpace,omitempty"`
+}
+
+func Save(filePath string, state State) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := Encode(f, state); err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func Encode(writer io.Writer, state State) error {
+	if state.Image == nil {
+		return fmt.Errorf("Project has no image")
+	}
+
+	var buff bytes.Buffer
+	if err := png.Encode(&buff, state.Image); err != nil {
+		return err
+	}
+
+	file := projectFile{
+		Version:      CurrentVersion,
+		Image:        base64.StdEncoding.EncodeToString(buff.Bytes()),
+		Operations:   state.Operations,
+		WorkingSpace: state.WorkingSpace,
+	}
+	if file.WorkingSpace == models.PerceptualSpace {
+		file.WorkingSpace = ""
+	}
+	if file.Operations == nil {
+		file.Operations = []OperationState{}
+	}
+	if !state.Metadata.IsEmpty() {
+		file.Metadata = &state.Metadata
+	}
+
+	return json.NewEncoder(writer).Encode(file)
+}
+
+func Load(filePath string) (*State, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(data)
+}
+
+func Decode(data []byte) (*State, error) {
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("Invalid project file: %w", err)
+	}
+
+	var file *projectFile
+	var err error
+
+	switch {
+	case header.Version == 0:
+		file, err = decodeLegacy(data)
+	case header.Version == 1:
+		file, err = decodeVersion1(data)
+	case header.Version > CurrentVersion:
+		return nil, fmt.Errorf("Project file version %d is newer than the supported version %d", header.Version, CurrentVersion)
+	default:
+		file = &projectFile{}
+		err = json.Unmarshal(data, file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid project file: %w", err)
+	}
+	if header.Version < 3 {
+		MigrateKernelSizes(file.Operations)
+	}
+
+	if file.Image == "" {
+		return nil, fmt.Errorf("Project file has no image")
+	}
+	if !file.WorkingSpace.IsWorkingSpace() {
+		return nil, fmt.Errorf("Project file has unknown working space %q", file.WorkingSpace)
+	}
+
+	reader := base64.NewDecoder(base64.StdEncoding, strings.NewReader(file.Image))
+	img, err := utils.GetImageFromReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid project image: %w", err)
+	}
+
+	state := &State{
+		Image:        img,
+		Operations:   file.Operations,
+		WorkingSpace: file.WorkingSpace,
+	}
+	if file.Metadata != nil {
+		state.Metadata = *file.Metadata
+	}
+	return state, nil
+}
+
+// Builds the layer pipeline described by the given operations on top of img. Operations that are
+// unknown or have invalid parameters are left out and reported instead.
+func BuildCollection(img models.Image, states []OperationState) (*models.ImageLayerCollection, []SkippedOperation) {
+	collection := utils.NewImageLayerCollection(img)
+	skipped := appendLayers(collection, states)
+	return collection, skipped
+}
+
+func appendLayers(collection *models.ImageLayerCollection, states []OperationState) []SkippedOperation {
+	imageLayers, skipped := NewImageLayers(states)
+	for _, imageLayer := range imageLayers {
+		collection.Append(imageLayer)
+	}
+	return skipped
+}
+
+// Creates the layers described by states, in order. Operations that are unknown or have invalid
+// parameters are left out and reported instead. Skipped members of groups and nodes of graphs are
+// reported with the index of their group or graph.
+func NewImageLayers(states []OperationState) ([]*models.ImageLayer, []SkippedOperation) {
+	var imageLayers []*models.ImageLayer
+	var skipped []SkippedOperation
+
+	for index, state := range states {
+		imageLayer, groupSkipped, err := newImageLayer(state)
+		if err != nil {
+			skipped = append(skipped, SkippedOperation{Index: index, Name: state.Name, Reason: err.Error()})
+			continue
+		}
+		for _, member := range groupSkipped {
+			skipped = append(skipped, SkippedOperation{Index: index, Name: state.Name + " > " + member.Name, Reason: member.Reason})
+		}
+		imageLayers = append(imageLayers, imageLayer)
+	}
+
+	return imageLayers, skipped
+}
+
+// Creates the layer described by state. Groups fail as a whole when any of their members is invalid.
+func NewImageLayer(state OperationState) (*models.ImageLayer, error) {
+	imageLayer, skipped, err := newImageLayer(state)
+	if err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		return nil, fmt.Errorf("Member %d (%s): %s", skipped[0].Index+1, skipped[0].Name, skipped[0].Reason)
+	}
+	return imageLayer, nil
+}
+
+func newImageLayer(state OperationState) (*models.ImageLayer, []SkippedOperation, error) {
+	var operation models.ImageOperation
+	var skipped []SkippedOperation
+
+	if state.Name == models.GroupOperationName {
+		group := models.NewLayerGroup()
+		skipped = appendLayers(group.Layers, state.Layers)
+		operation = group
+	} else if state.Name == models.GraphOperationName {
+		graph := models.NewLayerGraph()
+		if state.Graph != nil {
+			var err error
+			graph, skipped, err = newLayerGraph(*state.Graph)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		operation = graph
+	} else {
+		var err error
+		operation, err = operations.Create(state.Name, state.Params)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	imageLayer := utils.NewImageLayer(operation)
+	imageLayer.IsEnabled = state.IsEnabled
+
+	blendMode, opacity := imageLayer.BlendMode, imageLayer.Opacity
+	if state.BlendMode != "" {
+		blendMode = state.BlendMode
+	}
+	if state.Opacity != nil {
+		opacity = *state.Opacity
+	}
+	if err := imageLayer.SetBlending(blendMode, opacity); err != nil {
+		return nil, nil, err
+	}
+
+	if state.Mask != nil {
+		mask, err := NewLayerMask(*state.Mask)
+		if err != nil {
+			return nil, nil, err
+		}
+		imageLayer.Mask = mask
+	}
+
+	return imageLayer, skipped, nil
+}
+
+// Describes the layers of the collection, in order
+func Capture(collection *models.ImageLayerCollection) ([]OperationState, error) {
+	states := make([]OperationState, 0, collection.Size)
+
+	for current := collection.Head; current != nil; current = current.Next {
+		state, err := CaptureLayer(current)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func CaptureLayer(imageLayer *models.ImageLayer) (OperationState, error) {
+	state := OperationState{IsEnabled: imageLayer.IsEnabled}
+
+	if group, ok := imageLayer.Operation.(*models.LayerGroup); ok {
+		layers, err := Capture(group.Layers)
+		if err != nil {
+			return OperationState{}, err
+		}
+
+		state.Name = models.GroupOperationName
+		state.Layers = layers
+	} else if graph, ok := imageLayer.Operation.(*models.LayerGraph); ok {
+		graphState, err := captureGraph(graph)
+		if err != nil {
+			return OperationState{}, err
+		}
+
+		state.Name = models.GraphOperationName
+		state.Graph = &graphState
+	} else {
+		operation, ok := imageLayer.Operation.(operations.ConfigurableOperation)
+		if !ok {
+			return OperationState{}, fmt.Errorf("Operation %T cannot be saved", imageLayer.Operation)
+		}
+
+		state.Name = operation.Name()
+		state.Params = operation.Parameters()
+	}
+
+	if imageLayer.Opacity != 1 {
+		opacity := imageLayer.Opacity
+		state.Opacity = &opacity
+	}
+	if imageLayer.BlendMode != models.NormalBlend {
+		state.BlendMode = imageLayer.BlendMode
+	}
+	if imageLayer.Mask != nil {
+		mask, err := CaptureMask(imageLayer.Mask)
+		if err != nil {
+			return OperationState{}, err
+		}
+		state.Mask = &mask
+	}
+
+	return state, nil
+}
@@ -0,0 +1,53 @@
+package project
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"tool7/image-processing/models"
+)
+
+func TestWorkingSpaceRoundTrip(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{255, 0, 0, 255})
+
+	tests := []struct {
+		space, expected models.ColorSpace
+		isWritten       bool
+	}{
+		{models.LinearSpace, models.LinearSpace, true},
+		// Perceptual is left out, as in files of versions without working spaces
+		{models.PerceptualSpace, "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		var buff bytes.Buffer
+		if err := Encode(&buff, State{Image: img, WorkingSpace: test.space}); err != nil {
+			t.Fatal(err)
+		}
+		if isWritten := bytes.Contains(buff.Bytes(), []byte(`"workingSpace"`)); isWritten != test.isWritten {
+			t.Errorf("Working space %q written: %v", test.space, isWritten)
+		}
+
+		state, err := Decode(buff.Bytes())
+		if err != nil {
+			t.Fatalf("%q: %v", test.space, err)
+		}
+		if state.WorkingSpace != test.expected {
+			t.Errorf("Working space %q decoded as %q", test.space, state.WorkingSpace)
+		}
+	}
+}
+
+func TestDecodeRejectsUnknownWorkingSpace(t *testing.T) {
+	for _, space := range []string{"any", "cmyk"} {
+		data := []byte(fmt.Sprintf(`{"version":%d,"image":%q,"operations":[],"workingSpace":%q}`, CurrentVersion, testImageBase64(t), space))
+		if _, err := Decode(data); err == nil {
+			t.Errorf("Working space %q was accepted", space)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+type ImageFormat struct {
+	Name string
+	// In lower case, including the dot
+	Extensions []string
+}
+
+// Formats of the decoders registered above, which image.Decode tells apart by their content
+var ImageFormats = []ImageFormat{
+	{Name: "PNG", Extensions: []string{".png"}},
+	{Name: "JPEG", Extensions: []string{".jpg", ".jpeg"}},
+	{Name: "GIF", Extensions: []string{".gif"}},
+	{Name: "BMP", Extensions: []string{".bmp"}},
+	{Name: "TIFF", Extensions: []string{".tif", ".tiff"}},
+	{Name: "WebP", Extensions: []string{".webp"}},
+}
+
+// Extensions of the image files that can be decoded, in lower case
+var SupportedImageExtensions = imageExtensions()
+
+func imageExtensions() []string {
+	var extensions []string
+	for _, format := range ImageFormats {
+		extensions = append(extensions, format.Extensions...)
+	}
+	return extensions
+}
+
+func supportedFormatNames() string {
+	names := make([]string, len(ImageFormats))
+	for i, format := range ImageFormats {
+		names[i] = format.Name
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// Number of images in the file, more than one only for multi-page TIFF files
+func ImagePageCount(data []byte) int {
+	offsets, ok := tiffIFDOffsets(data)
+	if !ok || len(offsets) == 0 {
+		return 1
+	}
+	return len(offsets)
+}
+
+// Returns a copy of the TIFF file whose first image is the given page, since TIFF decoders only
+// decode the first one
+func tiffPage(data []byte, page int) ([]byte, bool) {
+	offsets, ok := tiffIFDOffsets(data)
+	if !ok || page < 0 || page >= len(offsets) {
+		return nil, false
+	}
+
+	pageData := append([]byte(nil), data...)
+	tiffByteOrder(data).PutUint32(pageData[4:8], offsets[page])
+	return pageData, true
+}
+
+// Offsets of the image file directories, one per page, or false if data is not a TIFF file
+func tiffIFDOffsets(data []byte) ([]uint32, bool) {
+	order := tiffByteOrder(data)
+	if order == nil || len(data) < 8 {
+		return nil, false
+	}
+
+	var offsets []uint32
+	seen := map[uint32]bool{}
+	offset := order.Uint32(data[4:8])
+
+	// Broken files may link directories in a loop
+	for offset != 0 && !seen[offset] && int(offset)+2 <= len(data) {
+		seen[offset] = true
+		entryCount := int(order.Uint16(data[offset:]))
+		next := int(offset) + 2 + entryCount*12
+		if next+4 > len(data) {
+			break
+		}
+		offsets = append(offsets, offset)
+		offset = order.Uint32(data[next:])
+	}
+
+	return offsets, true
+}
+
+func tiffByteOrder(data []byte) binary.ByteOrder {
+	switch {
+	case bytes.HasPrefix(data, []byte("II*\x00")):
+		return binary.LittleEndian
+	case bytes.HasPrefix(data, []byte("MM\x00*")):
+		return binary.BigEndian
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+)
+
+// Uncompressed grayscale TIFF file with a page of the given width and height per value, each
+// filled with its value. The last page links back to the first when isLooped.
+func newTestTIFF(order binary.ByteOrder, sizes []image.Point, values []uint8, isLooped bool) []byte {
+	data := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(data, "II*\x00")
+	} else {
+		copy(data, "MM\x00*")
+	}
+	order.PutUint32(data[4:], 8)
+
+	const entryCount = 8
+	var offsets []int
+	for i, size := range sizes {
+		offset := len(data)
+		offsets = append(offsets, offset)
+		pixelOffset := offset + 2 + entryCount*12 + 4
+
+		ifd := make([]byte, 2+entryCount*12+4)
+		order.PutUint16(ifd, entryCount)
+		entries := [entryCount][2]uint32{
+			{256, uint32(size.X)},      // ImageWidth
+			{257, uint32(size.Y)},      // ImageLength
+			{258, 8},                   // BitsPerSample
+			{259, 1},                   // Compression: none
+			{262, 1},                   // PhotometricInterpretation: black is zero
+			{273, uint32(pixelOffset)}, // StripOffsets
+			{278, uint32(size.Y)},      // RowsPerStrip
+			{279, uint32(size.X * size.Y)},
+		}
+		for j, entry := range entries {
+			position := 2 + j*12
+			order.PutUint16(ifd[position:], uint16(entry[0]))
+			order.PutUint16(ifd[position+2:], 4)
+			order.PutUint32(ifd[position+4:], 1)
+			order.PutUint32(ifd[position+8:], entry[1])
+		}
+		next := uint32(pixelOffset + size.X*size.Y)
+		if i == len(sizes)-1 {
+			next = 0
+			if isLooped {
+				next = 8
+			}
+		}
+		order.PutUint32(ifd[2+entryCount*12:], next)
+
+		data = append(data, ifd...)
+		data = append(data, bytes.Repeat([]byte{values[i]}, size.X*size.Y)...)
+	}
+	return data
+}
+
+func TestImagePageCount(t *testing.T) {
+	sizes := []image.Point{{4, 3}, {2, 5}, {6, 1}}
+	values := []uint8{10, 20, 30}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := newTestTIFF(order, sizes, values, false)
+		if count := ImagePageCount(data); count != 3 {
+			t.Errorf("%v file has %d pages", order, count)
+		}
+
+		for page, size := range sizes {
+			img, err := GetImagePageFromBytes(data, page)
+			if err != nil {
+				t.Fatalf("%v page %d: %v", order, page+1, err)
+			}
+			if img.Bounds().Size() != size {
+				t.Errorf("%v page %d has size %v, expected %v", order, page+1, img.Bounds().Size(), size)
+			}
+			if r, _, _, _ := GetPixelColor(img, 0, 0); r != values[page] {
+				t.Errorf("%v page %d has value %d, expected %d", order, page+1, r, values[page])
+			}
+		}
+
+		for _, page := range []int{-1, 3} {
+			if _, err := GetImagePageFromBytes(data, page); err == nil {
+				t.Errorf("%v page %d was decoded", order, page+1)
+			}
+		}
+	}
+}
+
+func TestImagePageCountOfOtherFiles(t *testing.T) {
+	var buff bytes.Buffer
+	png.Encode(&buff, image.NewGray(image.Rect(0, 0, 2, 2)))
+
+	single := newTestTIFF(binary.LittleEndian, []image.Point{{2, 2}}, []uint8{1}, false)
+	// Directories linked in a loop are counted once
+	looped := newTestTIFF(binary.LittleEndian, []image.Point{{2, 2}, {3, 3}}, []uint8{1, 2}, true)
+	// The second directory is cut off
+	truncated := newTestTIFF(binary.BigEndian, []image.Point{{2, 2}, {3, 3}}, []uint8{1, 2}, false)
+	truncated = truncated[:len(truncated)-9-12*8]
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected int
+	}{
+		{"PNG", buff.Bytes(), 1},
+		{"empty", nil, 1},
+		{"header only", []byte("II*\x00"), 1},
+		{"single page", single, 1},
+		{"looped", looped, 2},
+		{"truncated", truncated, 1},
+	}
+
+	for _, test := range tests {
+		if count := ImagePageCount(test.data); count != test.expected {
+			t.Errorf("%s file has %d pages, expected %d", test.name, count, test.expected)
+		}
+	}
+
+	if _, err := GetImagePageFromBytes(buff.Bytes(), 1); err == nil {
+		t.Error("Second page of a PNG file was decoded")
+	}
+}
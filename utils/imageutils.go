@@ -1,33 +1,37 @@
 package utils
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"image"
 	"image/color"
-	_ "image/jpeg"
-	_ "image/png"
-	"math"
+	"image/draw"
+	"io"
 	"os"
-	"runtime"
-	"sync"
-	"time"
+	"path/filepath"
+	"strings"
 
 	models "tool7/image-processing/models"
+
+	"golang.org/x/image/tiff"
 )
 
 func NewImageLayer(operation models.ImageOperation) *models.ImageLayer {
 	return &models.ImageLayer{
 		Operation: operation,
 		IsEnabled: true,
+		Opacity:   1,
+		BlendMode: models.NormalBlend,
 	}
 }
 
-func NewImageLayerCollection(img *image.RGBA) *models.ImageLayerCollection {
+func NewImageLayerCollection(img models.Image) *models.ImageLayerCollection {
 	return &models.ImageLayerCollection{
-		InputImage:   img,
-		OutputImages: make(map[int]*image.RGBA),
-		Head:         nil,
-		Size:         0,
+		InputImage: img,
+		Cache:      models.NewLayerCache(models.DefaultCacheBudget),
+		Head:       nil,
+		Size:       0,
 	}
 }
 
@@ -50,100 +54,169 @@ func ClipColorChannel[T models.ColorChannel](channel T) uint8 {
 	return uint8(channel)
 }
 
-func GetImageFromFilePath(filePath string) (*image.RGBA, error) {
-	f, err := os.Open(filePath)
-	defer f.Close()
+// Clips the value to the range of the channel type C
+func ClipChannel[C models.Channel, T models.ColorChannel](channel T) C {
+	if channel < 0 {
+		return 0
+	}
+	if float64(channel) > float64(models.ChannelMax[C]()) {
+		return models.ChannelMax[C]()
+	}
+	return C(channel)
+}
 
+func IsSupportedImageFile(filePath string) bool {
+	extension := strings.ToLower(filepath.Ext(filePath))
+	for _, supported := range SupportedImageExtensions {
+		if extension == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func GetImageFromFilePath(filePath string) (models.Image, error) {
+	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return nil, err
 	}
+	return GetImagePageFromBytes(data, 0)
+}
 
-	img, _, err := image.Decode(f)
+func GetImageFromReader(reader io.Reader) (models.Image, error) {
+	data, err := io.ReadAll(reader)
 	if err != nil {
-		return nil, err
+		return nil, models.WrapError(models.DecodeFailed, err, "Failed to read image")
 	}
+	return GetImagePageFromBytes(data, 0)
+}
 
-	rgbaImage := image.NewRGBA(img.Bounds())
-	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
-		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
-			r, g, b, a := GetPixelColor(img, x, y)
-			rgbaImage.SetRGBA(x, y, color.RGBA{r, g, b, a})
+// Decodes the page of a multi-page TIFF file, see ImagePageCount. Files of other formats only have
+// page 0. Images with 16 bits per channel keep them, see ConvertToImage.
+func GetImagePageFromBytes(data []byte, page int) (models.Image, error) {
+	if page != 0 {
+		pageData, ok := tiffPage(data, page)
+		if !ok {
+			return nil, models.NewError(models.InvalidIndex, fmt.Sprintf("Image has no page %d", page+1))
 		}
+		data = pageData
 	}
-
-	return rgbaImage, nil
+	return decodeImage(data)
 }
 
-func ProcessImageConcurrently(img image.RGBA, worker func(image.Rectangle) *image.RGBA) (*image.RGBA, error) {
-	numberOfThreads := runtime.NumCPU()
+// Largest number of pixels of a decoded image, so broken or hostile files cannot claim more memory
+// than a large photo needs
+const MaxImagePixels = 1 << 28
 
-	var wg sync.WaitGroup
-	bounds := splitImageToBounds(img, numberOfThreads)
-	resultChunks := make([]*image.RGBA, 0, numberOfThreads)
-	resultChannel := make(chan *image.RGBA, numberOfThreads)
+func decodeImage(data []byte) (img models.Image, err error) {
+	// Decoders of the less common formats are not hardened against every malformed file
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			img = nil
+			err = models.NewError(models.DecodeFailed, fmt.Sprintf("Failed to decode image: %v", recovered))
+		}
+	}()
 
-	for _, imageBound := range bounds {
-		wg.Add(1)
+	// image.Decode hides that the reader supports io.ReaderAt, without which the TIFF decoder
+	// buffers the file up to any offset it claims to have
+	isTIFF := tiffByteOrder(data) != nil
 
-		imageBound := imageBound
+	var config image.Config
+	if isTIFF {
+		config, err = tiff.DecodeConfig(bytes.NewReader(data))
+	} else {
+		config, _, err = image.DecodeConfig(bytes.NewReader(data))
+	}
+	if errors.Is(err, image.ErrFormat) {
+		return nil, models.NewError(models.UnsupportedFormat, "Unsupported image format, supported are "+supportedFormatNames())
+	}
+	if err != nil {
+		return nil, models.WrapError(models.DecodeFailed, err, "Failed to decode image")
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, models.NewError(models.DecodeFailed, "Image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > MaxImagePixels {
+		return nil, models.NewError(models.DecodeFailed, fmt.Sprintf("Image of %dx%d pixels is too large", config.Width, config.Height))
+	}
 
-		go func() {
-			defer wg.Done()
-			resultChannel <- worker(imageBound)
-		}()
+	var decoded image.Image
+	if isTIFF {
+		decoded, err = tiff.Decode(bytes.NewReader(data))
+	} else {
+		decoded, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, models.WrapError(models.DecodeFailed, err, "Failed to decode image")
+	}
+	if decoded.Bounds().Empty() {
+		return nil, models.NewError(models.DecodeFailed, "Image has no pixels")
 	}
 
-	wg.Wait()
+	return ConvertToImage(decoded), nil
+}
 
-	for i := 0; i < len(bounds); i++ {
-		select {
-		case chunk := <-resultChannel:
-			resultChunks = append(resultChunks, chunk)
-		case <-time.After(time.Second * 5):
-			return nil, errors.New("Timeout exceeded (5s)")
-		}
+// Converts img to the image the pipeline works on: *image.RGBA64 when it has 16 bits per channel,
+// like 16-bit PNG and TIFF files, otherwise *image.RGBA
+func ConvertToImage(img image.Image) models.Image {
+	switch img := img.(type) {
+	case *image.RGBA:
+		return img
+	case *image.RGBA64:
+		return img
 	}
 
-	result := image.NewRGBA(img.Bounds())
-
-	for _, chunk := range resultChunks {
-		minX := chunk.Bounds().Min.X
-		minY := chunk.Bounds().Min.Y
-		maxX := chunk.Bounds().Max.X
-		maxY := chunk.Bounds().Max.Y
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		rgbaImage := image.NewRGBA64(img.Bounds())
+		draw.Draw(rgbaImage, rgbaImage.Rect, img, img.Bounds().Min, draw.Src)
+		return rgbaImage
+	}
+	return ConvertToRGBA(img)
+}
 
-		for y := minY; y < maxY; y++ {
-			for x := minX; x < maxX; x++ {
-				r, g, b, a := GetPixelColor(chunk, x, y)
-				result.SetRGBA(x, y, color.RGBA{r, g, b, a})
-			}
-		}
+// Reduces a 16-bit or linear image to 8 bits per channel, as needed for display. 8-bit images
+// are returned as they are.
+func ConvertTo8Bit(img models.Image) *image.RGBA {
+	if linear, ok := img.(*models.LinearImage); ok {
+		return linear.ToRGBA()
+	}
+	img16, ok := img.(*image.RGBA64)
+	if !ok {
+		return img.(*image.RGBA)
 	}
 
-	return result, nil
+	rgbaImage := image.NewRGBA(img16.Rect)
+	for i := range rgbaImage.Pix {
+		rgbaImage.Pix[i] = img16.Pix[i*2]
+	}
+	return rgbaImage
 }
 
-func splitImageToBounds(img image.RGBA, desiredCount int) []image.Rectangle {
-	chunks := make([]image.Rectangle, 0, desiredCount)
+func ConvertToRGBA(img image.Image) *image.RGBA {
+	rgbaImage := image.NewRGBA(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			r, g, b, a := GetPixelColor(img, x, y)
+			rgbaImage.SetRGBA(x, y, color.RGBA{r, g, b, a})
+		}
+	}
 
-	minX := img.Bounds().Min.X
-	minY := img.Bounds().Min.Y
-	maxX := img.Bounds().Max.X
-	maxY := img.Bounds().Max.Y
-	chunkHeight := int(
-		math.Ceil(float64(maxY-minY) / float64(desiredCount)),
-	)
+	return rgbaImage
+}
 
-	for y := minY; y < maxY; y += chunkHeight {
-		end := y + chunkHeight
+// Converts img to its luminance, as used for bitmap masks
+func ConvertToGray(img image.Image) *image.Gray {
+	if grayImage, ok := img.(*image.Gray); ok {
+		return grayImage
+	}
 
-		if end > maxY {
-			end = maxY
+	grayImage := image.NewGray(img.Bounds())
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			grayImage.Set(x, y, img.At(x, y))
 		}
-
-		chunk := image.Rect(minX, y, maxX, end)
-		chunks = append(chunks, chunk)
 	}
 
-	return chunks
+	return grayImage
 }
@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"context"
+	"image"
+
+	models "tool7/image-processing/models"
+)
+
+// Direct access to the Pix buffer of RGBA images. Pixels are 4 consecutive bytes in R, G, B, A
+// order, and rows are Stride bytes apart, which is why rows are handed out as slices. RGBA64
+// images store each channel as 2 bytes in big endian order, which the functions ending in 16
+// take care of. Colors are stored premultiplied by alpha, while the point operations below work
+// on straight colors, so that changing a color never makes it brighter than its alpha allows.
+
+// Transforms the straight color channels and the alpha of a single pixel
+type PixelFunc func(r, g, b, a uint8) (uint8, uint8, uint8, uint8)
+
+// Maps every value of a color channel to a new value
+type ChannelTable [256]uint8
+
+func NewChannelTable(fn func(value uint8) uint8) *ChannelTable {
+	var table ChannelTable
+	for value := range table {
+		table[value] = fn(uint8(value))
+	}
+	return &table
+}
+
+// Transforms the straight color channels and the alpha of a single pixel of a 16-bit image
+type PixelFunc16 func(r, g, b, a uint16) (uint16, uint16, uint16, uint16)
+
+// Maps every value of a 16-bit color channel to a new value
+type ChannelTable16 [1 << 16]uint16
+
+func NewChannelTable16(fn func(value uint16) uint16) *ChannelTable16 {
+	var table ChannelTable16
+	for value := range table {
+		table[value] = fn(uint16(value))
+	}
+	return &table
+}
+
+// Returns the pixels of the row at y within the horizontal bounds of img
+func Row(img *image.RGBA, y int) []uint8 {
+	start := img.PixOffset(img.Rect.Min.X, y)
+	return img.Pix[start : start+img.Rect.Dx()*4]
+}
+
+// Calls fn with the rows of src and dst at every y within the bounds of dst. Both rows span the
+// horizontal bounds of dst, so the pixel at index i of one is at the same position as the pixel
+// at index i of the other. src has to cover the bounds of dst and have the same depth.
+func ForEachRow(src, dst models.Image, fn func(y int, srcRow, dstRow []uint8)) {
+	srcPix, _, _ := models.PixelBuffer(src)
+	dstPix, _, bytesPerPixel := models.PixelBuffer(dst)
+	bounds := dst.Bounds()
+	length := bounds.Dx() * bytesPerPixel
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		srcStart := src.PixOffset(bounds.Min.X, y)
+		dstStart := dst.PixOffset(bounds.Min.X, y)
+		fn(y, srcPix[srcStart:srcStart+length], dstPix[dstStart:dstStart+length])
+	}
+}
+
+// Point operation: stores fn of every pixel of src in dst. fn receives straight colors and its
+// result is premultiplied by the alpha it returns.
+func MapPixels(src, dst *image.RGBA, fn PixelFunc) {
+	ForEachRow(src, dst, func(_ int, srcRow, dstRow []uint8) {
+		for i := 0; i < len(srcRow); i += 4 {
+			s := srcRow[i : i+4 : i+4]
+			d := dstRow[i : i+4 : i+4]
+			// Colors of opaque pixels are the same either way
+			if a := s[3]; a == 0xff {
+				d[0], d[1], d[2], d[3] = fn(s[0], s[1], s[2], a)
+			} else {
+				d[0], d[1], d[2], d[3] = fn(models.Unpremultiply(s[0], a), models.Unpremultiply(s[1], a), models.Unpremultiply(s[2], a), a)
+			}
+
+			if a := d[3]; a != 0xff {
+				d[0] = models.Premultiply(d[0], a)
+				d[1] = models.Premultiply(d[1], a)
+				d[2] = models.Premultiply(d[2], a)
+			}
+		}
+	})
+}
+
+// Point operation mapping every straight color channel through its own table. Alpha is copied.
+func MapChannels(src, dst *image.RGBA, red, green, blue *ChannelTable) {
+	ForEachRow(src, dst, func(_ int, srcRow, dstRow []uint8) {
+		for i := 0; i < len(srcRow); i += 4 {
+			s := srcRow[i : i+4 : i+4]
+			d := dstRow[i : i+4 : i+4]
+			switch a := s[3]; a {
+			case 0xff:
+				d[0] = red[s[0]]
+				d[1] = green[s[1]]
+				d[2] = blue[s[2]]
+			case 0:
+				d[0], d[1], d[2] = 0, 0, 0
+			default:
+				d[0] = models.Premultiply(red[models.Unpremultiply(s[0], a)], a)
+				d[1] = models.Premultiply(green[models.Unpremultiply(s[1], a)], a)
+				d[2] = models.Premultiply(blue[models.Unpremultiply(s[2], a)], a)
+			}
+			d[3] = s[3]
+		}
+	})
+}
+
+// 16-bit variant of MapPixels
+func MapPixels16(src, dst *image.RGBA64, fn PixelFunc16) {
+	ForEachRow(src, dst, func(_ int, srcRow, dstRow []uint8) {
+		for i := 0; i < len(srcRow); i += 8 {
+			s := srcRow[i : i+8 : i+8]
+			d := dstRow[i : i+8 : i+8]
+			r, g, b, a := get16(s[0:]), get16(s[2:]), get16(s[4:]), get16(s[6:])
+			if a != 0xffff {
+				r, g, b = models.Unpremultiply(r, a), models.Unpremultiply(g, a), models.Unpremultiply(b, a)
+			}
+
+			r, g, b, a = fn(r, g, b, a)
+			if a != 0xffff {
+				r, g, b = models.Premultiply(r, a), models.Premultiply(g, a), models.Premultiply(b, a)
+			}
+			put16(d[0:], r)
+			put16(d[2:], g)
+			put16(d[4:], b)
+			put16(d[6:], a)
+		}
+	})
+}
+
+// 16-bit variant of MapChannels
+func MapChannels16(src, dst *image.RGBA64, red, green, blue *ChannelTable16) {
+	ForEachRow(src, dst, func(_ int, srcRow, dstRow []uint8) {
+		for i := 0; i < len(srcRow); i += 8 {
+			s := srcRow[i : i+8 : i+8]
+			d := dstRow[i : i+8 : i+8]
+			if a := get16(s[6:]); a == 0xffff {
+				put16(d[0:], red[get16(s[0:])])
+				put16(d[2:], green[get16(s[2:])])
+				put16(d[4:], blue[get16(s[4:])])
+			} else {
+				put16(d[0:], models.Premultiply(red[models.Unpremultiply(get16(s[0:]), a)], a))
+				put16(d[2:], models.Premultiply(green[models.Unpremultiply(get16(s[2:]), a)], a))
+				put16(d[4:], models.Premultiply(blue[models.Unpremultiply(get16(s[4:]), a)], a))
+			}
+			d[6], d[7] = s[6], s[7]
+		}
+	})
+}
+
+// Linear variant of MapChannels, calling the functions for every pixel with straight values from
+// 0 to 1. Alpha is copied.
+func MapChannelsLinear(src, dst *models.LinearImage, red, green, blue ChannelFunc) {
+	bounds := dst.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		srcRow := src.Pix[src.PixOffset(bounds.Min.X, y):]
+		dstStart := dst.PixOffset(bounds.Min.X, y)
+		dstRow := dst.Pix[dstStart : dstStart+bounds.Dx()*4]
+
+		for i := 0; i < len(dstRow); i += 4 {
+			s := srcRow[i : i+4 : i+4]
+			d := dstRow[i : i+4 : i+4]
+			if a := s[3]; a > 0 {
+				d[0] = mapLinearChannel(red, s[0], a)
+				d[1] = mapLinearChannel(green, s[1], a)
+				d[2] = mapLinearChannel(blue, s[2], a)
+			} else {
+				d[0], d[1], d[2] = 0, 0, 0
+			}
+			d[3] = s[3]
+		}
+	}
+}
+
+// Maps the straight value of a premultiplied linear channel and premultiplies the result again
+func mapLinearChannel(fn ChannelFunc, value, alpha float32) float32 {
+	straight := value / alpha
+	if straight > 1 {
+		straight = 1
+	}
+	return ClipChannel[float32](fn(float64(straight), 1)) * alpha
+}
+
+func get16(pix []uint8) uint16 {
+	return uint16(pix[0])<<8 | uint16(pix[1])
+}
+
+func put16(pix []uint8, value uint16) {
+	pix[0] = uint8(value >> 8)
+	pix[1] = uint8(value)
+}
+
+// Maps a color channel to a new value, given the largest value of a channel of the image depth.
+// Results are clipped to the channel range.
+type ChannelFunc func(value, max float64) float64
+
+// Point operation on an image of any depth that maps every color channel through its own
+// function, see MapChannels. Runs on tiles like ProcessTiles.
+func MapImageChannels(ctx context.Context, img models.Image, red, green, blue ChannelFunc) (models.Image, error) {
+	if models.IsLinear(img) {
+		return ProcessTiles(ctx, img, TileOptions{}, func(src, dst models.Image) {
+			MapChannelsLinear(src.(*models.LinearImage), dst.(*models.LinearImage), red, green, blue)
+		})
+	}
+	if models.Is16Bit(img) {
+		table := func(fn ChannelFunc) *ChannelTable16 {
+			return NewChannelTable16(func(value uint16) uint16 {
+				return ClipChannel[uint16](fn(float64(value), 0xffff))
+			})
+		}
+		redTable, greenTable, blueTable := table(red), table(green), table(blue)
+
+		return ProcessTiles(ctx, img, TileOptions{}, func(src, dst models.Image) {
+			MapChannels16(src.(*image.RGBA64), dst.(*image.RGBA64), redTable, greenTable, blueTable)
+		})
+	}
+
+	table := func(fn ChannelFunc) *ChannelTable {
+		return NewChannelTable(func(value uint8) uint8 {
+			return ClipColorChannel(fn(float64(value), 0xff))
+		})
+	}
+	redTable, greenTable, blueTable := table(red), table(green), table(blue)
+
+	return ProcessTiles(ctx, img, TileOptions{}, func(src, dst models.Image) {
+		MapChannels(src.(*image.RGBA), dst.(*image.RGBA), redTable, greenTable, blueTable)
+	})
+}
+
+// Point operation on an image of any depth, with fn for 8-bit and fn16 for 16-bit images. Linear
+// images are converted to 16-bit sRGB for fn16 and back.
+// Runs on tiles like ProcessTiles.
+func MapImagePixels(ctx context.Context, img models.Image, fn PixelFunc, fn16 PixelFunc16) (models.Image, error) {
+	if linear, ok := img.(*models.LinearImage); ok {
+		result, err := MapImagePixels(ctx, linear.ToRGBA64(), fn, fn16)
+		if err != nil {
+			return nil, err
+		}
+		return models.ToLinearImage(result), nil
+	}
+	if models.Is16Bit(img) {
+		return ProcessTiles(ctx, img, TileOptions{}, func(src, dst models.Image) {
+			MapPixels16(src.(*image.RGBA64), dst.(*image.RGBA64), fn16)
+		})
+	}
+	return ProcessTiles(ctx, img, TileOptions{}, func(src, dst models.Image) {
+		MapPixels(src.(*image.RGBA), dst.(*image.RGBA), fn)
+	})
+}
+
+// Returns the channel values of the row at y from x-radius to x+radius, clipped to the bounds of
+// img, together with the position of the first returned pixel within that window. The row is
+// empty when y lies outside img.
+func NeighborhoodRow[C models.Channel](img *models.Channels[C], x, y, radius int) (row []C, first int) {
+	bounds := img.Rect
+	if y < bounds.Min.Y || y >= bounds.Max.Y {
+		return nil, 0
+	}
+
+	minX := x - radius
+	maxX := x + radius + 1
+	if minX < bounds.Min.X {
+		first = bounds.Min.X - minX
+		minX = bounds.Min.X
+	}
+	if maxX > bounds.Max.X {
+		maxX = bounds.Max.X
+	}
+	if minX >= maxX {
+		return nil, 0
+	}
+
+	start := img.Offset(minX, y)
+	return img.Values[start : start+(maxX-minX)*4], first
+}
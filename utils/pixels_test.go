@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	models "tool7/image-processing/models"
+)
+
+// Image whose pixels are opaque, transparent or partly transparent in turn. Tests work on
+// sub-images of it with a non-zero origin, whose rows are further apart than their width.
+func newMixedAlphaImage(bounds image.Rectangle, seed int) *image.RGBA {
+	img := image.NewRGBA(bounds)
+	for i := 0; i < len(img.Pix); i += 4 {
+		alpha := [...]uint8{255, 0, 128, 37}[(i/4+seed)%4]
+		for c := 0; c < 3; c++ {
+			img.Pix[i+c] = models.Premultiply(uint8(i*7+c*50+seed), alpha)
+		}
+		img.Pix[i+3] = alpha
+	}
+	return img
+}
+
+// Checks that dst matches expected within bounds and still holds the pixels of untouched outside
+func checkMappedPixels(t *testing.T, dst, untouched *image.RGBA, bounds image.Rectangle, expected func(x, y int) color.RGBA) {
+	t.Helper()
+
+	for y := dst.Rect.Min.Y; y < dst.Rect.Max.Y; y++ {
+		for x := dst.Rect.Min.X; x < dst.Rect.Max.X; x++ {
+			want := untouched.RGBAAt(x, y)
+			if (image.Point{x, y}).In(bounds) {
+				want = expected(x, y)
+			}
+			if got := dst.RGBAAt(x, y); got != want {
+				t.Fatalf("Pixel (%d, %d) is %v, expected %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// Compares reading and writing pixels through the image interfaces with direct Pix access,
+// for the same brightness adjustment:
+//
+//	go test -bench PixelAccess ./utils
+func BenchmarkPixelAccess(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 1920, 1080))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i * 7)
+	}
+	brighten := func(value uint8) uint8 {
+		return ClipColorChannel(float64(value) * 1.2)
+	}
+
+	b.Run("interface", func(b *testing.B) {
+		b.SetBytes(int64(len(src.Pix)))
+		for i := 0; i < b.N; i++ {
+			dst := image.NewRGBA(src.Bounds())
+			for y := src.Rect.Min.Y; y < src.Rect.Max.Y; y++ {
+				for x := src.Rect.Min.X; x < src.Rect.Max.X; x++ {
+					r, g, b, a := GetPixelColor(src, x, y)
+					dst.SetRGBA(x, y, color.RGBA{brighten(r), brighten(g), brighten(b), a})
+				}
+			}
+		}
+	})
+
+	b.Run("MapPixels", func(b *testing.B) {
+		b.SetBytes(int64(len(src.Pix)))
+		for i := 0; i < b.N; i++ {
+			dst := image.NewRGBA(src.Bounds())
+			MapPixels(src, dst, func(r, g, b, a uint8) (uint8, uint8, uint8, uint8) {
+				return brighten(r), brighten(g), brighten(b), a
+			})
+		}
+	})
+
+	b.Run("MapChannels", func(b *testing.B) {
+		b.SetBytes(int64(len(src.Pix)))
+		table := NewChannelTable(brighten)
+		for i := 0; i < b.N; i++ {
+			dst := image.NewRGBA(src.Bounds())
+			MapChannels(src, dst, table, table, table)
+		}
+	})
+}
+
+func TestMapPixelsOnSubImages(t *testing.T) {
+	bounds := image.Rect(1, 4, 9, 11)
+	src := newMixedAlphaImage(image.Rect(-3, 2, 20, 15), 0).SubImage(bounds).(*image.RGBA)
+	dst := newMixedAlphaImage(image.Rect(0, 3, 12, 13), 1)
+	untouched := newMixedAlphaImage(dst.Rect, 1)
+
+	// Inverts the straight colors and halves alpha
+	MapPixels(src, dst.SubImage(bounds).(*image.RGBA), func(r, g, b, a uint8) (uint8, uint8, uint8, uint8) {
+		return 255 - r, 255 - g, 255 - b, a / 2
+	})
+
+	checkMappedPixels(t, dst, untouched, bounds, func(x, y int) color.RGBA {
+		s := src.RGBAAt(x, y)
+		a := s.A / 2
+		invert := func(value uint8) uint8 {
+			return models.Premultiply(255-models.Unpremultiply(value, s.A), a)
+		}
+		return color.RGBA{invert(s.R), invert(s.G), invert(s.B), a}
+	})
+}
+
+func TestMapChannelsOnSubImages(t *testing.T) {
+	bounds := image.Rect(-2, 0, 5, 6)
+	src := newMixedAlphaImage(image.Rect(-4, -1, 9, 8), 2).SubImage(bounds).(*image.RGBA)
+	dst := newMixedAlphaImage(image.Rect(-2, -3, 7, 6), 3)
+	untouched := newMixedAlphaImage(dst.Rect, 3)
+
+	red := NewChannelTable(func(value uint8) uint8 { return 255 - value })
+	green := NewChannelTable(func(value uint8) uint8 { return value / 2 })
+	blue := NewChannelTable(func(value uint8) uint8 { return 200 })
+	MapChannels(src, dst.SubImage(bounds).(*image.RGBA), red, green, blue)
+
+	checkMappedPixels(t, dst, untouched, bounds, func(x, y int) color.RGBA {
+		s := src.RGBAAt(x, y)
+		if s.A == 0 {
+			return color.RGBA{}
+		}
+		mapped := func(table *ChannelTable, value uint8) uint8 {
+			return models.Premultiply(table[models.Unpremultiply(value, s.A)], s.A)
+		}
+		return color.RGBA{mapped(red, s.R), mapped(green, s.G), mapped(blue, s.B), s.A}
+	})
+}
+
+func TestNeighborhoodRowOnSubImages(t *testing.T) {
+	img := newMixedAlphaImage(image.Rect(-5, -5, 20, 20), 0).SubImage(image.Rect(2, -1, 8, 4)).(*image.RGBA)
+	channels := models.Channels8(img)
+
+	tests := []struct {
+		x, y, radius int
+		// Pixels of the row expected in the window, and where the first one is within it
+		minX, maxX, first int
+	}{
+		{4, 1, 1, 3, 6, 0},
+		{5, -1, 2, 3, 8, 0},
+		{2, 3, 2, 2, 5, 2},
+		{7, 0, 3, 4, 8, 0},
+		{3, 2, 10, 2, 8, 9},
+		// Windows outside the image
+		{4, -2, 1, 0, 0, 0},
+		{4, 4, 1, 0, 0, 0},
+		{-3, 1, 2, 0, 0, 0},
+		{11, 1, 2, 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		row, first := NeighborhoodRow(&channels, test.x, test.y, test.radius)
+		if test.maxX == 0 {
+			if row != nil {
+				t.Errorf("Window at (%d, %d) of radius %d is %v", test.x, test.y, test.radius, row)
+			}
+			continue
+		}
+
+		if first != test.first || len(row) != (test.maxX-test.minX)*4 {
+			t.Errorf("Window at (%d, %d) of radius %d has %d pixels from %d, expected %d from %d",
+				test.x, test.y, test.radius, len(row)/4, first, test.maxX-test.minX, test.first)
+			continue
+		}
+		for x := test.minX; x < test.maxX; x++ {
+			pixel := img.RGBAAt(x, test.y)
+			i := (x - test.minX) * 4
+			if got := (color.RGBA{row[i], row[i+1], row[i+2], row[i+3]}); got != pixel {
+				t.Errorf("Pixel %d of the window at (%d, %d) is %v, expected %v", x, test.x, test.y, got, pixel)
+			}
+		}
+	}
+}
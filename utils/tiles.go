@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"image"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	models "tool7/image-processing/models"
+)
+
+const DefaultTileSize = 256
+
+// Describes how an image is split into tiles and processed
+type TileOptions struct {
+	// Width and height of the tiles, DefaultTileSize when zero
+	TileSize int
+	// Pixels around a tile that its worker reads, like the radius of a kernel
+	Halo int
+	// Number of tiles processed at the same time, runtime.NumCPU when zero
+	Workers int
+}
+
+// Processes a single tile. dst is the tile within the destination image, which the worker writes
+// to directly. src is the part of the source image under the tile grown by the halo, clipped to
+// the source bounds. Both use the coordinates of the whole image.
+type TileWorker func(src, dst models.Image)
+
+// Runs worker for every tile of src on a bounded pool of goroutines that share one destination
+// image with the bounds and depth of src. Stops with the context error once ctx is cancelled or its
+// deadline passes, and reports the share of finished tiles to the progress reporter of ctx.
+func ProcessTiles(ctx context.Context, src models.Image, options TileOptions, worker TileWorker) (models.Image, error) {
+	tileSize := options.TileSize
+	if tileSize <= 0 {
+		tileSize = DefaultTileSize
+	}
+
+	numberOfWorkers := options.Workers
+	if numberOfWorkers <= 0 {
+		numberOfWorkers = runtime.NumCPU()
+	}
+
+	dst := models.NewImageLike(src, src.Bounds())
+	tiles := splitImageToTiles(src.Bounds(), tileSize)
+	if numberOfWorkers > len(tiles) {
+		numberOfWorkers = len(tiles)
+	}
+
+	var wg sync.WaitGroup
+	var nextTile int64 = -1
+
+	var progressMutex sync.Mutex
+	processedTiles := 0
+
+	for i := 0; i < numberOfWorkers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				index := int(atomic.AddInt64(&nextTile, 1))
+				if index >= len(tiles) {
+					return
+				}
+
+				tile := tiles[index]
+				halo := tile.Inset(-options.Halo).Intersect(src.Bounds())
+				worker(src.SubImage(halo).(models.Image), dst.SubImage(tile).(models.Image))
+
+				progressMutex.Lock()
+				processedTiles++
+				models.ReportProgress(ctx, processedTiles, len(tiles))
+				progressMutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// Splits bounds into a grid of square tiles, with smaller tiles along the right and bottom edges
+func splitImageToTiles(bounds image.Rectangle, tileSize int) []image.Rectangle {
+	tiles := make([]image.Rectangle, 0, ((bounds.Dx()+tileSize-1)/tileSize)*((bounds.Dy()+tileSize-1)/tileSize))
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += tileSize {
+		for x := bounds.Min.X; x < bounds.Max.X; x += tileSize {
+			tile := image.Rect(x, y, x+tileSize, y+tileSize).Intersect(bounds)
+			tiles = append(tiles, tile)
+		}
+	}
+
+	return tiles
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"sync"
+	"testing"
+
+	models "tool7/image-processing/models"
+)
+
+// Image with a non-zero origin whose sides are no multiple of the tile sizes used below
+func newTileTestImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(3, -5, 40, 28))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i*31 + i/7)
+	}
+	return img
+}
+
+// Averages the 3x3 neighborhood of every pixel within the bounds of src, so that the result
+// differs at tile seams whenever the halo is not read
+func averageNeighbors(src, dst models.Image) {
+	srcChannels := models.Channels8(src.(*image.RGBA))
+	dstChannels := models.Channels8(dst.(*image.RGBA))
+	bounds := dst.Bounds()
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var sums [4]int
+			count := 0
+			for dy := -1; dy <= 1; dy++ {
+				row, _ := NeighborhoodRow(&srcChannels, x, y+dy, 1)
+				for i := 0; i < len(row); i += 4 {
+					for c := 0; c < 4; c++ {
+						sums[c] += int(row[i+c])
+					}
+					count++
+				}
+			}
+			pixel := dstChannels.Values[dstChannels.Offset(x, y):]
+			for c := 0; c < 4; c++ {
+				pixel[c] = uint8(sums[c] / count)
+			}
+		}
+	}
+}
+
+func TestProcessTilesMatchesSinglePass(t *testing.T) {
+	src := newTileTestImage()
+
+	expected := image.NewRGBA(src.Rect)
+	averageNeighbors(src, expected)
+
+	for _, options := range []TileOptions{
+		{TileSize: 8, Halo: 1},
+		{TileSize: 5, Halo: 1, Workers: 3},
+		{TileSize: 1, Halo: 2, Workers: 1},
+		{Halo: 1},
+	} {
+		result, err := ProcessTiles(context.Background(), src, options, averageNeighbors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Bounds() != src.Rect || !bytes.Equal(result.(*image.RGBA).Pix, expected.Pix) {
+			t.Errorf("Tiles of %+v differ from a single pass", options)
+		}
+	}
+
+	// Without the halo the pixels along the seams miss their neighbors
+	result, err := ProcessTiles(context.Background(), src, TileOptions{TileSize: 8}, averageNeighbors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(result.(*image.RGBA).Pix, expected.Pix) {
+		t.Error("Tiles without halo match a single pass")
+	}
+}
+
+// Every pixel belongs to exactly one tile, whose source is grown by the halo within the image
+func TestProcessTilesHaloAndEdgeTiles(t *testing.T) {
+	src := newTileTestImage()
+	options := TileOptions{TileSize: 16, Halo: 2}
+
+	var mutex sync.Mutex
+	sources := map[image.Rectangle]image.Rectangle{}
+	coverage := make([]int, src.Rect.Dx()*src.Rect.Dy())
+
+	_, err := ProcessTiles(context.Background(), src, options, func(tileSrc, tileDst models.Image) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		sources[tileDst.Bounds()] = tileSrc.Bounds()
+		for y := tileDst.Bounds().Min.Y; y < tileDst.Bounds().Max.Y; y++ {
+			for x := tileDst.Bounds().Min.X; x < tileDst.Bounds().Max.X; x++ {
+				coverage[(y-src.Rect.Min.Y)*src.Rect.Dx()+x-src.Rect.Min.X]++
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, count := range coverage {
+		if count != 1 {
+			t.Fatalf("Pixel %d is in %d tiles", i, count)
+		}
+	}
+
+	// 37x33 pixels starting at (3, -5) make 3x3 tiles, the last ones 5 and 1 pixels wide
+	expected := map[image.Rectangle]image.Rectangle{
+		image.Rect(3, -5, 19, 11):  image.Rect(3, -5, 21, 13),
+		image.Rect(19, -5, 35, 11): image.Rect(17, -5, 37, 13),
+		image.Rect(35, -5, 40, 11): image.Rect(33, -5, 40, 13),
+		image.Rect(3, 11, 19, 27):  image.Rect(3, 9, 21, 28),
+		image.Rect(19, 11, 35, 27): image.Rect(17, 9, 37, 28),
+		image.Rect(35, 11, 40, 27): image.Rect(33, 9, 40, 28),
+		image.Rect(3, 27, 19, 28):  image.Rect(3, 25, 21, 28),
+		image.Rect(19, 27, 35, 28): image.Rect(17, 25, 37, 28),
+		image.Rect(35, 27, 40, 28): image.Rect(33, 25, 40, 28),
+	}
+	if len(sources) != len(expected) {
+		t.Fatalf("Image was split into %d tiles, expected %d", len(sources), len(expected))
+	}
+	for tile, halo := range expected {
+		if sources[tile] != halo {
+			t.Errorf("Tile %v read %v, expected %v", tile, sources[tile], halo)
+		}
+	}
+}
+
+func TestProcessTilesStopsWhenCancelled(t *testing.T) {
+	src := newTileTestImage()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	processed := 0
+	_, err := ProcessTiles(ctx, src, TileOptions{TileSize: 4, Workers: 1}, func(tileSrc, tileDst models.Image) {
+		processed++
+		if processed == 5 {
+			cancel()
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled processing failed with %v", err)
+	}
+	// 10x9 tiles of 4 pixels, of which the worker gets no more after the one that cancelled
+	if processed != 5 {
+		t.Errorf("%d tiles were processed after cancelling at the fifth", processed)
+	}
+}
+
+func TestProcessTilesReportsProgress(t *testing.T) {
+	src := newTileTestImage()
+
+	var reports []models.Progress
+	ctx := models.WithProgress(context.Background(), func(progress models.Progress) {
+		reports = append(reports, progress)
+	})
+	if _, err := ProcessTiles(ctx, src, TileOptions{TileSize: 4}, averageNeighbors); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reports) == 0 || reports[len(reports)-1].Percent != 100 {
+		t.Errorf("Reported %+v", reports)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Percent < reports[i-1].Percent {
+			t.Errorf("Progress went back from %v to %v", reports[i-1].Percent, reports[i].Percent)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package watch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Name of the log within the processed directory
+const LogFileName = "goimp-watch.log"
+
+// Line of the log, written once a file is processed
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	// Name of the file in the input directory, together with its size and modification time when
+	// it was processed, which identify the file across restarts
+	Input   string    `json:"input"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	// Paths of the result and of the moved original, empty when processing failed
+	Output    string `json:"output,omitempty"`
+	Processed string `json:"processed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (this LogEntry) key() fileKey {
+	return fileKey{this.Input, this.Size, this.ModTime.UnixNano()}
+}
+
+// Identifies a version of an input file
+type fileKey struct {
+	name    string
+	size    int64
+	modTime int64
+}
+
+// Log of processed files, one JSON entry per line, which is only ever appended to
+type processLog struct {
+	path    string
+	entries map[fileKey]LogEntry
+}
+
+// Reads the entries of the log at path, which does not need to exist yet
+func openLog(path string) (*processLog, error) {
+	log := &processLog{path: path, entries: map[fileKey]LogEntry{}}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry LogEntry
+		// A line cut short by a crash is ignored, so its file is processed again
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		log.entries[entry.key()] = entry
+	}
+
+	return log, scanner.Err()
+}
+
+func (this *processLog) lookup(key fileKey) (LogEntry, bool) {
+	entry, ok := this.entries[key]
+	return entry, ok
+}
+
+func (this *processLog) append(entry LogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(this.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	this.entries[entry.key()] = entry
+	return nil
+}
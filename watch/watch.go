@@ -0,0 +1,287 @@
+// Package watch processes the images arriving in a directory as they come, moving the originals
+// out of the way once their results are written.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tool7/image-processing/batch"
+	"tool7/image-processing/models"
+	"tool7/image-processing/project"
+	"tool7/image-processing/utils"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	DefaultSettleTime   = 2 * time.Second
+)
+
+type Options struct {
+	InputDirectory  string
+	OutputDirectory string
+	// Where originals are moved once processed, and where the log is kept
+	ProcessedDirectory string
+	// See batch.Options, {index} counts the files processed by the watcher
+	NameTemplate string
+	Quality      int
+	// Longest time spent rendering each file, no limit when zero
+	Timeout time.Duration
+	// Color space the layers work in, perceptual when empty
+	WorkingSpace models.ColorSpace
+	// How often the input directory is checked for new files
+	PollInterval time.Duration
+	// How long a file has to stay the same size before it is processed, so that files still
+	// being copied into the input directory are left alone
+	SettleTime time.Duration
+}
+
+// Reported for every file that was processed or failed
+type Event = LogEntry
+
+// Size and modification time of a file that has not been processed yet, as last seen
+type candidate struct {
+	key         fileKey
+	stableSince time.Time
+}
+
+type Watcher struct {
+	steps   []project.OperationState
+	options Options
+	log     *processLog
+	// Number of files processed so far, including those of earlier runs
+	count int
+
+	candidates map[string]candidate
+}
+
+// Checks the options and creates the output and processed directories
+func New(steps []project.OperationState, options Options) (*Watcher, error) {
+	if _, skipped := project.NewImageLayers(steps); len(skipped) > 0 {
+		return nil, fmt.Errorf("Operation %d (%s): %s", skipped[0].Index+1, skipped[0].Name, skipped[0].Reason)
+	}
+	if options.InputDirectory == "" || options.OutputDirectory == "" || options.ProcessedDirectory == "" {
+		return nil, fmt.Errorf("Input, output and processed directories are required")
+	}
+	if sameDirectory(options.InputDirectory, options.OutputDirectory) || sameDirectory(options.InputDirectory, options.ProcessedDirectory) {
+		return nil, fmt.Errorf("Output and processed directories have to differ from the input directory")
+	}
+
+	if options.NameTemplate == "" {
+		options.NameTemplate = batch.DefaultNameTemplate
+	}
+	if options.Quality == 0 {
+		options.Quality = batch.DefaultQuality
+	}
+	if options.Quality < 1 || options.Quality > 100 {
+		return nil, fmt.Errorf("JPEG quality has to be between 1 and 100")
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultPollInterval
+	}
+	if options.SettleTime <= 0 {
+		options.SettleTime = DefaultSettleTime
+	}
+	// Fails early on templates that cannot make a file name
+	if _, err := batch.OutputName(options.NameTemplate, "image.png", 0); err != nil {
+		return nil, err
+	}
+
+	for _, directory := range []string{options.OutputDirectory, options.ProcessedDirectory} {
+		if err := os.MkdirAll(directory, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	log, err := openLog(filepath.Join(options.ProcessedDirectory, LogFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	for _, entry := range log.entries {
+		if entry.Error == "" {
+			count++
+		}
+	}
+
+	return &Watcher{
+		steps:      steps,
+		options:    options,
+		log:        log,
+		count:      count,
+		candidates: map[string]candidate{},
+	}, nil
+}
+
+// Processes arriving files one at a time until ctx is cancelled, which is the only way it
+// returns without error. Files that fail are logged and left in the input directory, and are
+// tried again once they change.
+func (this *Watcher) Run(ctx context.Context, report func(Event)) error {
+	ticker := time.NewTicker(this.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := this.poll(ctx, time.Now(), report); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Processes the files that stayed the same for the settle time
+func (this *Watcher) poll(ctx context.Context, now time.Time, report func(Event)) error {
+	entries, err := os.ReadDir(this.options.InputDirectory)
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		if entry.IsDir() || !utils.IsSupportedImageFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Moved or deleted since the directory was read
+			continue
+		}
+
+		name := entry.Name()
+		seen[name] = true
+		key := fileKey{name, info.Size(), info.ModTime().UnixNano()}
+
+		previous, ok := this.candidates[name]
+		if !ok || previous.key != key {
+			this.candidates[name] = candidate{key: key, stableSince: now}
+			continue
+		}
+		if now.Sub(previous.stableSince) < this.options.SettleTime {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if event, ok := this.process(ctx, key, info.ModTime()); ok {
+			report(event)
+		}
+	}
+
+	// Forget files that disappeared, so that they are waited for again if they come back
+	for name := range this.candidates {
+		if !seen[name] {
+			delete(this.candidates, name)
+		}
+	}
+	return nil
+}
+
+// Processes the file unless the log shows it was already processed or failed in this version.
+// Returns false when there is nothing new to report.
+func (this *Watcher) process(ctx context.Context, key fileKey, modTime time.Time) (Event, bool) {
+	input := filepath.Join(this.options.InputDirectory, key.name)
+
+	if entry, ok := this.log.lookup(key); ok {
+		if entry.Error == "" {
+			// Processed before a restart that came before the original was moved
+			if err := moveFile(input, entry.Processed); err == nil {
+				delete(this.candidates, key.name)
+			}
+		}
+		return Event{}, false
+	}
+
+	event := Event{Time: time.Now(), Input: key.name, Size: key.size, ModTime: modTime}
+
+	name, err := batch.OutputName(this.options.NameTemplate, input, this.count)
+	if err == nil {
+		// Inputs of the same name arrive one after the other and would replace each other's output
+		event.Output = freePath(filepath.Join(this.options.OutputDirectory, name))
+		err = batch.ProcessFile(ctx, input, event.Output, this.steps, this.options.WorkingSpace, this.options.Quality, this.options.Timeout)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Stopped while processing, the file is processed again on the next run
+			return Event{}, false
+		}
+		event.Output = ""
+		event.Error = err.Error()
+		if err := this.log.append(event); err != nil {
+			event.Error += "; failed to write log: " + err.Error()
+		}
+		return event, true
+	}
+
+	event.Processed = freePath(filepath.Join(this.options.ProcessedDirectory, key.name))
+	if err := this.log.append(event); err != nil {
+		event.Error = "Failed to write log: " + err.Error()
+		return event, true
+	}
+	this.count++
+
+	if err := moveFile(input, event.Processed); err != nil {
+		event.Error = "Failed to move original: " + err.Error()
+		return event, true
+	}
+	delete(this.candidates, key.name)
+	return event, true
+}
+
+// Returns path, or path with a number added to its name if a file exists there
+func freePath(path string) string {
+	extension := filepath.Ext(path)
+	base := strings.TrimSuffix(path, extension)
+
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s_%d%s", base, i, extension)
+	}
+}
+
+// Renames the file, or copies and removes it when it is moved to another file system
+func moveFile(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	if _, err := io.Copy(destination, source); err != nil {
+		return err
+	}
+	if err := destination.Close(); err != nil {
+		return err
+	}
+	source.Close()
+
+	return os.Remove(from)
+}
+
+func sameDirectory(a, b string) bool {
+	absoluteA, errA := filepath.Abs(a)
+	absoluteB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absoluteA == absoluteB
+}
@@ -0,0 +1,339 @@
+package watch
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"tool7/image-processing/project"
+)
+
+type testDirectories struct {
+	input, output, processed string
+}
+
+func newTestDirectories(t *testing.T) testDirectories {
+	root := t.TempDir()
+	directories := testDirectories{
+		input:     filepath.Join(root, "in"),
+		output:    filepath.Join(root, "out"),
+		processed: filepath.Join(root, "done"),
+	}
+	if err := os.Mkdir(directories.input, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return directories
+}
+
+func newTestWatcher(t *testing.T, directories testDirectories) *Watcher {
+	watcher, err := New([]project.OperationState{{Name: "negative", IsEnabled: true}}, Options{
+		InputDirectory:     directories.input,
+		OutputDirectory:    directories.output,
+		ProcessedDirectory: directories.processed,
+		NameTemplate:       "{index}_{name}.{ext}",
+		SettleTime:         time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return watcher
+}
+
+func writeTestImage(t *testing.T, filePath string) {
+	f, err := os.Create(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Polls twice, the settle time apart, and returns the events of the second poll
+func pollSettled(t *testing.T, watcher *Watcher, now time.Time) []Event {
+	var events []Event
+	report := func(event Event) {
+		events = append(events, event)
+	}
+
+	if err := watcher.poll(context.Background(), now, report); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) > 0 {
+		t.Errorf("Files were processed before settling: %+v", events)
+	}
+	if err := watcher.poll(context.Background(), now.Add(watcher.options.SettleTime), report); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func directoryNames(t *testing.T, directory string) []string {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LogFileName)
+
+	log, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(log.entries) != 0 {
+		t.Errorf("Missing log has %d entries", len(log.entries))
+	}
+
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{Input: "a.png", Size: 10, ModTime: modTime, Output: "out/a.png", Processed: "done/a.png"},
+		{Input: "b.png", Size: 20, ModTime: modTime, Error: "Broken"},
+	}
+	for _, entry := range entries {
+		if err := log.append(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A line cut short by a crash is ignored
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`{"input": "c.png", "si`)
+	f.Close()
+
+	reopened, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.entries) != 2 {
+		t.Errorf("Reopened log has %d entries", len(reopened.entries))
+	}
+	for _, entry := range entries {
+		if found, ok := reopened.lookup(entry.key()); !ok || !reflect.DeepEqual(found, entry) {
+			t.Errorf("Found %+v for %+v", found, entry)
+		}
+	}
+
+	// Other versions of a file are not in the log
+	if _, ok := reopened.lookup(fileKey{"a.png", 11, modTime.UnixNano()}); ok {
+		t.Error("File of another size was found")
+	}
+	if _, ok := reopened.lookup(fileKey{"a.png", 10, modTime.Add(time.Second).UnixNano()}); ok {
+		t.Error("File with another modification time was found")
+	}
+}
+
+func TestWatcherProcessesSettledFiles(t *testing.T) {
+	directories := newTestDirectories(t)
+	watcher := newTestWatcher(t, directories)
+	writeTestImage(t, filepath.Join(directories.input, "a.png"))
+
+	events := pollSettled(t, watcher, time.Now())
+	if len(events) != 1 || events[0].Error != "" {
+		t.Fatalf("Events are %+v", events)
+	}
+	if expected := filepath.Join(directories.output, "1_a.png"); events[0].Output != expected {
+		t.Errorf("Output is %q, expected %q", events[0].Output, expected)
+	}
+
+	if names := directoryNames(t, directories.input); len(names) != 0 {
+		t.Errorf("Input directory still has %v", names)
+	}
+	if names := directoryNames(t, directories.output); !reflect.DeepEqual(names, []string{"1_a.png"}) {
+		t.Errorf("Output directory has %v", names)
+	}
+	if names := directoryNames(t, directories.processed); !reflect.DeepEqual(names, []string{"a.png", LogFileName}) {
+		t.Errorf("Processed directory has %v", names)
+	}
+}
+
+// Files still being written change between polls and are waited for
+func TestWatcherWaitsForChangingFiles(t *testing.T) {
+	directories := newTestDirectories(t)
+	watcher := newTestWatcher(t, directories)
+	input := filepath.Join(directories.input, "a.png")
+	os.WriteFile(input, []byte("partial"), 0644)
+
+	var events []Event
+	report := func(event Event) {
+		events = append(events, event)
+	}
+	now := time.Now()
+	watcher.poll(context.Background(), now, report)
+
+	writeTestImage(t, input)
+	now = now.Add(watcher.options.SettleTime)
+	watcher.poll(context.Background(), now, report)
+	if len(events) != 0 {
+		t.Fatalf("Changed file was processed: %+v", events)
+	}
+
+	watcher.poll(context.Background(), now.Add(watcher.options.SettleTime), report)
+	if len(events) != 1 || events[0].Error != "" {
+		t.Errorf("Events are %+v", events)
+	}
+}
+
+// Restarted watchers continue the count and skip what was processed, moving originals that were
+// left behind
+func TestWatcherResumesAfterRestart(t *testing.T) {
+	directories := newTestDirectories(t)
+	writeTestImage(t, filepath.Join(directories.input, "a.png"))
+	pollSettled(t, newTestWatcher(t, directories), time.Now())
+
+	// The original comes back as if the watcher stopped before moving it
+	processed := filepath.Join(directories.processed, "a.png")
+	if err := os.Rename(processed, filepath.Join(directories.input, "a.png")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestImage(t, filepath.Join(directories.input, "b.png"))
+
+	watcher := newTestWatcher(t, directories)
+	if watcher.count != 1 {
+		t.Errorf("Restarted watcher counts %d files", watcher.count)
+	}
+
+	events := pollSettled(t, watcher, time.Now())
+	if len(events) != 1 || events[0].Input != "b.png" {
+		t.Fatalf("Events are %+v", events)
+	}
+	if expected := filepath.Join(directories.output, "2_b.png"); events[0].Output != expected {
+		t.Errorf("Output is %q, expected %q", events[0].Output, expected)
+	}
+	if names := directoryNames(t, directories.input); len(names) != 0 {
+		t.Errorf("Input directory still has %v", names)
+	}
+	if names := directoryNames(t, directories.output); !reflect.DeepEqual(names, []string{"1_a.png", "2_b.png"}) {
+		t.Errorf("Output directory has %v", names)
+	}
+}
+
+// Failed files stay in place and are only tried again once they change, also across restarts
+func TestWatcherRetriesChangedFailures(t *testing.T) {
+	directories := newTestDirectories(t)
+	input := filepath.Join(directories.input, "a.png")
+	os.WriteFile(input, []byte("not an image"), 0644)
+
+	events := pollSettled(t, newTestWatcher(t, directories), time.Now())
+	if len(events) != 1 || events[0].Error == "" || events[0].Output != "" {
+		t.Fatalf("Events are %+v", events)
+	}
+
+	watcher := newTestWatcher(t, directories)
+	if watcher.count != 0 {
+		t.Errorf("Failed file was counted")
+	}
+	if events := pollSettled(t, watcher, time.Now()); len(events) != 0 {
+		t.Errorf("Failed file was tried again: %+v", events)
+	}
+
+	writeTestImage(t, input)
+	// Keeps the modification time apart from that of the failed version on coarse file systems
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(input, later, later)
+
+	events = pollSettled(t, watcher, time.Now().Add(time.Hour))
+	if len(events) != 1 || events[0].Error != "" {
+		t.Errorf("Events after fixing the file are %+v", events)
+	}
+}
+
+// Originals of the same name do not replace each other in the processed directory
+func TestWatcherKeepsProcessedNamesApart(t *testing.T) {
+	directories := newTestDirectories(t)
+	watcher := newTestWatcher(t, directories)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		writeTestImage(t, filepath.Join(directories.input, "a.png"))
+		later := now.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(filepath.Join(directories.input, "a.png"), later, later)
+
+		if events := pollSettled(t, watcher, now.Add(time.Duration(i)*time.Hour)); len(events) != 1 {
+			t.Fatalf("Events are %+v", events)
+		}
+	}
+
+	expected := []string{"a.png", "a_2.png", LogFileName}
+	if names := directoryNames(t, directories.processed); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Processed directory has %v, expected %v", names, expected)
+	}
+}
+
+// Outputs of inputs of the same name are kept apart as well, whatever the name template
+func TestWatcherKeepsOutputNamesApart(t *testing.T) {
+	for _, nameTemplate := range []string{"", "{name}.{ext}"} {
+		directories := newTestDirectories(t)
+		watcher, err := New([]project.OperationState{{Name: "negative", IsEnabled: true}}, Options{
+			InputDirectory:     directories.input,
+			OutputDirectory:    directories.output,
+			ProcessedDirectory: directories.processed,
+			NameTemplate:       nameTemplate,
+			SettleTime:         time.Second,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+
+		var outputs []string
+		for i := 0; i < 3; i++ {
+			writeTestImage(t, filepath.Join(directories.input, "a.png"))
+			later := now.Add(time.Duration(i) * time.Minute)
+			os.Chtimes(filepath.Join(directories.input, "a.png"), later, later)
+
+			events := pollSettled(t, watcher, now.Add(time.Duration(i)*time.Hour))
+			if len(events) != 1 || events[0].Error != "" {
+				t.Fatalf("Events are %+v", events)
+			}
+			outputs = append(outputs, filepath.Base(events[0].Output))
+		}
+
+		expected := []string{"a.png", "a_2.png", "a_3.png"}
+		if nameTemplate == "" {
+			expected = []string{"a_edited.png", "a_edited_2.png", "a_edited_3.png"}
+		}
+		if !reflect.DeepEqual(outputs, expected) {
+			t.Errorf("Outputs of %q are %v, expected %v", nameTemplate, outputs, expected)
+		}
+		if names := directoryNames(t, directories.output); !reflect.DeepEqual(names, expected) {
+			t.Errorf("Output directory of %q has %v, expected %v", nameTemplate, names, expected)
+		}
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	directories := newTestDirectories(t)
+	steps := []project.OperationState{{Name: "negative", IsEnabled: true}}
+
+	tests := []struct {
+		name    string
+		steps   []project.OperationState
+		options Options
+	}{
+		{"unknown operation", []project.OperationState{{Name: "unknown"}}, Options{InputDirectory: directories.input, OutputDirectory: directories.output, ProcessedDirectory: directories.processed}},
+		{"missing directory", steps, Options{InputDirectory: directories.input, OutputDirectory: directories.output}},
+		{"output in input", steps, Options{InputDirectory: directories.input, OutputDirectory: directories.input, ProcessedDirectory: directories.processed}},
+		{"processed in input", steps, Options{InputDirectory: directories.input, OutputDirectory: directories.output, ProcessedDirectory: directories.input + "/."}},
+		{"quality", steps, Options{InputDirectory: directories.input, OutputDirectory: directories.output, ProcessedDirectory: directories.processed, Quality: 101}},
+		{"template", steps, Options{InputDirectory: directories.input, OutputDirectory: directories.output, ProcessedDirectory: directories.processed, NameTemplate: "{date}.png"}},
+	}
+
+	for _, test := range tests {
+		if _, err := New(test.steps, test.options); err == nil {
+			t.Errorf("Watcher with invalid %s was created", test.name)
+		}
+	}
+}